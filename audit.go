@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/VirgilSecurity/virgild/modules/card/audit"
+	"github.com/namsral/flag"
+)
+
+const auditUsage = "Usage: virgild audit verify [-key-file <key file>] [-head <seq>:<hash>] <audit file>"
+
+// auditCommand runs `virgild audit verify <file>` command
+func auditCommand(args []string) int {
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, auditUsage)
+		return 2
+	}
+	fs := flag.NewFlagSet("audit verify", flag.ContinueOnError)
+	keyFile := fs.String("key-file", "", "Path to file with HMAC key of records")
+	head := fs.String("head", "", "Sequence number and hash of a record stored outside of the host (<seq>:<hash>)")
+	if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, auditUsage)
+		return 2
+	}
+	var (
+		key []byte
+		err error
+	)
+	if *keyFile != "" {
+		if key, err = audit.ReadKey(*keyFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer f.Close()
+
+	var (
+		anchorSeq  uint64
+		anchorHash string
+		anchored   bool
+	)
+	if *head != "" {
+		parts := strings.SplitN(*head, ":", 2)
+		if len(parts) == 2 {
+			anchorSeq, err = strconv.ParseUint(parts[0], 10, 64)
+			anchorHash = parts[1]
+		}
+		if len(parts) != 2 || err != nil || anchorSeq == 0 {
+			fmt.Fprintln(os.Stderr, auditUsage)
+			return 2
+		}
+	}
+	count, last, err := audit.VerifyFunc(f, key, func(r audit.Record) {
+		if r.Seq == anchorSeq && r.Hash == anchorHash {
+			anchored = true
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Audit log is broken after %d valid records: %v\n", count, err)
+		return 1
+	}
+	if *head != "" && !anchored {
+		fmt.Fprintf(os.Stderr, "Audit log doesn't contain record %d with hash %v: the log was truncated or replaced\n", anchorSeq, anchorHash)
+		return 1
+	}
+	if count == 0 {
+		fmt.Println("Audit log is valid: no records")
+		return 0
+	}
+	fmt.Printf("Audit log is valid: %d records, last hash %v\n", count, last.Hash)
+	return 0
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/namsral/flag"
+)
+
+// configCommand runs `virgild config check [args]` command. It loads configuration like the service does
+// and prints the effective values.
+func configCommand(args []string) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "Usage: virgild config check [args]")
+		return 2
+	}
+	if err := flag.CommandLine.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if err := loadConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := coreapi.PrintConfig(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func loadConfig() error {
+	if err := coreapi.LoadConfig(); err != nil {
+		return err
+	}
+	return coreapi.ValidateConfig()
+}
@@ -0,0 +1,272 @@
+package coreapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	accessLogCommon   = "common"
+	accessLogCombined = "combined"
+	accessLogJSON     = "json"
+)
+
+// accessEntry collects request attributes which are known only inside of the handler chain
+type accessEntry struct {
+	sync.Mutex
+	requestID string
+	route     string
+	owner     string
+}
+
+var contextAccessEntryKey contextKey = "access_entry"
+
+func accessEntryFromContext(ctx context.Context) *accessEntry {
+	e, _ := ctx.Value(contextAccessEntryKey).(*accessEntry)
+	return e
+}
+
+// withAccessEntry returns request with entry in the context. The entry is shared by access log and metrics.
+func withAccessEntry(r *http.Request) (*http.Request, *accessEntry) {
+	if e := accessEntryFromContext(r.Context()); e != nil {
+		return r, e
+	}
+	e := new(accessEntry)
+	return r.WithContext(context.WithValue(r.Context(), contextAccessEntryKey, e)), e
+}
+
+func (e *accessEntry) set(f func(e *accessEntry)) {
+	if e == nil {
+		return
+	}
+	e.Lock()
+	defer e.Unlock()
+	f(e)
+}
+
+// SetAccessOwner records hash of owner token of the request for the access log
+func SetAccessOwner(ctx context.Context, owner string) {
+	accessEntryFromContext(ctx).set(func(e *accessEntry) { e.owner = owner })
+}
+
+type accessRecord struct {
+	Time      time.Time
+	RemoteIP  string
+	Method    string
+	URI       string
+	Proto     string
+	Status    int
+	Bytes     int64
+	Latency   time.Duration
+	RequestID string
+	Route     string
+	Owner     string
+	Referer   string
+	UserAgent string
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush sends buffered data of streamed responses to the client
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// openAccessLog opens sink of the access log ('-' - stdout)
+func openAccessLog(path string) (io.Writer, error) {
+	if path == "-" {
+		return os.Stdout, nil
+	}
+	f := &reopenableFile{path: path}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// reopenableFile is the file of the access log which can be reopened after it was moved by external tool (e.g. logrotate)
+type reopenableFile struct {
+	sync.Mutex
+	path string
+	file *os.File
+}
+
+func (f *reopenableFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return errors.Wrapf(err, "Open access log (%v)", f.path)
+	}
+	f.file = file
+	return nil
+}
+
+func (f *reopenableFile) Write(p []byte) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+	return f.file.Write(p)
+}
+
+// Reopen opens the file again. The current file is kept if the new one cannot be opened.
+func (f *reopenableFile) Reopen() error {
+	f.Lock()
+	defer f.Unlock()
+
+	old := f.file
+	if err := f.open(); err != nil {
+		return err
+	}
+	return old.Close()
+}
+
+func (f *reopenableFile) Close() error {
+	f.Lock()
+	defer f.Unlock()
+	return f.file.Close()
+}
+
+// reopenAccessLogOnSignal reopens the access log on SIGHUP, so it can be rotated by logrotate
+func reopenAccessLogOnSignal(logger Logger, f *reopenableFile) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		if err := f.Reopen(); err != nil {
+			logger.Err("Access log: %+v", err)
+		}
+	}
+}
+
+func accessLogMiddleware(out io.Writer, format string) (Middleware, error) {
+	var formatter func(r accessRecord) []byte
+	switch format {
+	case accessLogCommon:
+		formatter = formatCommon
+	case accessLogCombined:
+		formatter = formatCombined
+	case accessLogJSON:
+		formatter = formatJSON
+	default:
+		return nil, fmt.Errorf("Unknown access log format (%v)", format)
+	}
+
+	var mu sync.Mutex
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			r, entry := withAccessEntry(r)
+			sw := &statusWriter{ResponseWriter: w}
+
+			next.ServeHTTP(sw, r)
+
+			entry.Lock()
+			rec := accessRecord{
+				Time:      start,
+				RemoteIP:  remoteIP(r),
+				Method:    r.Method,
+				URI:       r.RequestURI,
+				Proto:     r.Proto,
+				Status:    sw.status,
+				Bytes:     sw.bytes,
+				Latency:   time.Since(start),
+				RequestID: entry.requestID,
+				Route:     entry.route,
+				Owner:     entry.owner,
+				Referer:   r.Referer(),
+				UserAgent: r.UserAgent(),
+			}
+			entry.Unlock()
+			if rec.Status == 0 {
+				rec.Status = http.StatusOK
+			}
+			if rec.RequestID == "" {
+				rec.RequestID = r.Header.Get(RequestIDHeader)
+			}
+
+			b := formatter(rec)
+			mu.Lock()
+			out.Write(b)
+			mu.Unlock()
+		})
+	}, nil
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// formatCommon formats record in Common Log Format. The owner token hash is used as user name.
+// Request id, route and latency in milliseconds are appended to the line.
+func formatCommon(r accessRecord) []byte {
+	return []byte(commonLine(r) + "\n")
+}
+
+// formatCombined formats record in Combined Log Format with the same extra fields as formatCommon
+func formatCombined(r accessRecord) []byte {
+	return []byte(fmt.Sprintf("%s %q %q\n", commonLine(r), dash(r.Referer), dash(r.UserAgent)))
+}
+
+func commonLine(r accessRecord) string {
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %d %s %s %.3f",
+		dash(r.RemoteIP),
+		dash(r.Owner),
+		r.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method, r.URI, r.Proto,
+		r.Status,
+		r.Bytes,
+		dash(r.RequestID),
+		dash(r.Route),
+		float64(r.Latency)/float64(time.Millisecond))
+}
+
+func formatJSON(r accessRecord) []byte {
+	b, _ := json.Marshal(map[string]interface{}{
+		"time":       r.Time.UTC().Format(time.RFC3339Nano),
+		"remote_ip":  r.RemoteIP,
+		"method":     r.Method,
+		"uri":        r.URI,
+		"proto":      r.Proto,
+		"status":     r.Status,
+		"bytes":      r.Bytes,
+		"latency_ms": float64(r.Latency) / float64(time.Millisecond),
+		"request_id": r.RequestID,
+		"route":      r.Route,
+		"owner":      r.Owner,
+		"referer":    r.Referer,
+		"user_agent": r.UserAgent,
+	})
+	return append(b, '\n')
+}
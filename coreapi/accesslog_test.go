@@ -0,0 +1,114 @@
+package coreapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func serveAccessLog(t *testing.T, format string, h http.Handler) string {
+	out := new(bytes.Buffer)
+	m, err := accessLogMiddleware(out, format)
+	assert.Nil(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/v4/card/123", nil)
+	r.RemoteAddr = "10.0.0.1:5000"
+	r.Header.Set(RequestIDHeader, "req-1")
+	r.Header.Set("User-Agent", "test-agent")
+	m(h).ServeHTTP(httptest.NewRecorder(), r)
+	return out.String()
+}
+
+func TestAccessLog_UnknownFormat_ReturnErr(t *testing.T) {
+	_, err := accessLogMiddleware(new(bytes.Buffer), "xml")
+	assert.NotNil(t, err)
+}
+
+func TestAccessLog_Common_ContainsRequestAttributes(t *testing.T) {
+	handler := func(req *http.Request) (interface{}, error) {
+		SetAccessOwner(req.Context(), "ownerhash")
+		return map[string]string{"id": "123"}, nil
+	}
+	line := serveAccessLog(t, accessLogCommon, routeMiddleware("get_card")(wrapAPIHandler(new(fakeLogger), nil)(handler)))
+
+	assert.Regexp(t, `^10\.0\.0\.1 - ownerhash \[.+\] "GET /v4/card/123 HTTP/1\.1" 200 12 req-1 get_card \d+\.\d{3}\n$`, line)
+}
+
+func TestAccessLog_Combined_ContainsRefererAndAgent(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	line := serveAccessLog(t, accessLogCombined, h)
+
+	assert.Regexp(t, `^10\.0\.0\.1 - - \[.+\] "GET /v4/card/123 HTTP/1\.1" 429 0 req-1 - \d+\.\d{3} "-" "test-agent"\n$`, line)
+}
+
+func TestAccessLog_JSON_ContainsRequestAttributes(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		w.Write([]byte("ok"))
+	})
+	line := serveAccessLog(t, accessLogJSON, routeMiddleware("search")(h))
+
+	var rec map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(line), &rec))
+	assert.Equal(t, "GET", rec["method"])
+	assert.Equal(t, "search", rec["route"])
+	assert.Equal(t, "req-1", rec["request_id"])
+	assert.Equal(t, float64(200), rec["status"])
+	assert.Equal(t, float64(2), rec["bytes"])
+	assert.True(t, rec["latency_ms"].(float64) >= 1)
+}
+
+func TestAccessLogFile_Reopen_WriteToNewFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+
+	out, err := openAccessLog(path)
+	assert.NoError(t, err)
+	f := out.(*reopenableFile)
+	defer f.Close()
+	f.Write([]byte("first\n"))
+	// the file is moved by logrotate
+	assert.NoError(t, os.Rename(path, path+".1"))
+	f.Write([]byte("second\n"))
+
+	assert.NoError(t, f.Reopen())
+	f.Write([]byte("third\n"))
+
+	rotated, _ := ioutil.ReadFile(path + ".1")
+	assert.Equal(t, "first\nsecond\n", string(rotated))
+	current, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "third\n", string(current))
+}
+
+func TestAccessLogFile_ReopenFailed_KeepCurrentFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+
+	out, err := openAccessLog(path)
+	assert.NoError(t, err)
+	f := out.(*reopenableFile)
+	defer f.Close()
+	// the path is replaced by a directory, so the file cannot be opened
+	assert.NoError(t, os.Rename(path, path+".1"))
+	assert.NoError(t, os.Mkdir(path, 0777))
+
+	assert.Error(t, f.Reopen())
+	_, err = f.Write([]byte("record\n"))
+	assert.NoError(t, err)
+	rotated, _ := ioutil.ReadFile(path + ".1")
+	assert.Equal(t, "record\n", string(rotated))
+}
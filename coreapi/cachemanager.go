@@ -1,6 +1,8 @@
 package coreapi
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -24,13 +26,7 @@ type cacheManager struct {
 }
 
 func (m cacheManager) Get(key string, val interface{}) bool {
-	var has bool
-	var err error
-
-	t := prometheus.NewTimer(cacheManagerMetric.WithLabelValues("get"))
-	has, err = m.cache.Get(key, val)
-	t.ObserveDuration()
-
+	has, err := m.GetChecked(key, val)
 	if err != nil {
 		m.logger.Err("Cache Manager: %+v", err)
 		return false
@@ -38,17 +34,43 @@ func (m cacheManager) Get(key string, val interface{}) bool {
 	return has
 }
 
+func (m cacheManager) GetChecked(key string, val interface{}) (bool, error) {
+	t := prometheus.NewTimer(cacheManagerMetric.WithLabelValues("get"))
+	defer t.ObserveDuration()
+
+	return m.cache.Get(key, val)
+}
+
 func (m cacheManager) Set(key string, val interface{}) {
-	var err error
+	if err := m.SetChecked(key, val); err != nil {
+		m.logger.Err("Cache Manager: %+v", err)
+	}
+}
 
+func (m cacheManager) SetChecked(key string, val interface{}) error {
 	t := prometheus.NewTimer(cacheManagerMetric.WithLabelValues("set"))
-	err = m.cache.Set(key, val)
-	t.ObserveDuration()
+	defer t.ObserveDuration()
 
-	if err != nil {
+	return m.cache.Set(key, val)
+}
+func (m cacheManager) SetTTL(key string, val interface{}, ttl time.Duration) {
+	if err := m.SetTTLChecked(key, val, ttl); err != nil {
 		m.logger.Err("Cache Manager: %+v", err)
 	}
 }
+
+func (m cacheManager) SetTTLChecked(key string, val interface{}, ttl time.Duration) error {
+	c, ok := m.cache.(RawCacheTTL)
+	if !ok {
+		return m.SetChecked(key, val)
+	}
+
+	t := prometheus.NewTimer(cacheManagerMetric.WithLabelValues("set"))
+	defer t.ObserveDuration()
+
+	return c.SetTTL(key, val, ttl)
+}
+
 func (m cacheManager) Del(key string) {
 	var err error
 
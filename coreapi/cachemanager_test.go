@@ -12,6 +12,8 @@ type fakeLogger struct {
 	mock.Mock
 }
 
+func (f *fakeLogger) Debug(format string, args ...interface{}) {
+}
 func (f *fakeLogger) Info(format string, args ...interface{}) {
 	f.Called()
 }
@@ -0,0 +1,65 @@
+package coreapi
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Closer is implemented by plugins (loggers, caches, rate limiters) which hold resources or buffer data.
+// Core closes such plugins on shutdown.
+type Closer interface {
+	Close() error
+}
+
+type closeHook struct {
+	name string
+	f    func(ctx context.Context) error
+}
+
+var (
+	closeHooksMu sync.Mutex
+	closeHooks   []closeHook
+
+	drainOnce sync.Once
+	draining  = make(chan struct{})
+)
+
+// Draining returns channel which is closed when shutdown starts. Long-lived handlers (streams) return on it,
+// so the server doesn't wait for them until the drain timeout.
+func Draining() <-chan struct{} {
+	return draining
+}
+
+// Drain starts shutdown of long-lived handlers, it is called by the server on shutdown
+func Drain() {
+	drainOnce.Do(func() { close(draining) })
+}
+
+// RegisterCloseHook registers function which is called on shutdown. Hooks are called in reverse order of registration,
+// so resources are released before resources they depend on. The logger is closed after all hooks.
+func RegisterCloseHook(name string, f func(ctx context.Context) error) {
+	closeHooksMu.Lock()
+	defer closeHooksMu.Unlock()
+
+	closeHooks = append(closeHooks, closeHook{name: name, f: f})
+}
+
+// closeAll calls all close hooks. Every hook is called even if previous ones fail, the first error is returned
+func closeAll(ctx context.Context) error {
+	Drain()
+
+	closeHooksMu.Lock()
+	hooks := closeHooks
+	closeHooks = nil
+	closeHooksMu.Unlock()
+
+	var first error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i].f(ctx); err != nil && first == nil {
+			first = errors.Wrapf(err, "Close %v", hooks[i].name)
+		}
+	}
+	return first
+}
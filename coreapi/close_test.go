@@ -0,0 +1,58 @@
+package coreapi
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// resetCloseHooks removes registered close hooks. The returned function restores them.
+func resetCloseHooks() func() {
+	closeHooksMu.Lock()
+	defer closeHooksMu.Unlock()
+
+	saved := closeHooks
+	closeHooks = nil
+	return func() {
+		closeHooksMu.Lock()
+		defer closeHooksMu.Unlock()
+		closeHooks = saved
+	}
+}
+
+func TestCloseAll_CallHooksInReverseOrder(t *testing.T) {
+	defer resetCloseHooks()()
+	var order []string
+	RegisterCloseHook("a", func(ctx context.Context) error { order = append(order, "a"); return nil })
+	RegisterCloseHook("b", func(ctx context.Context) error { order = append(order, "b"); return nil })
+
+	err := closeAll(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "a"}, order)
+}
+
+func TestCloseAll_HookFailed_CallOthersReturnErr(t *testing.T) {
+	defer resetCloseHooks()()
+	called := false
+	RegisterCloseHook("a", func(ctx context.Context) error { called = true; return nil })
+	RegisterCloseHook("b", func(ctx context.Context) error { return fmt.Errorf("error") })
+
+	err := closeAll(context.Background())
+
+	assert.EqualError(t, err, "Close b: error")
+	assert.True(t, called)
+}
+
+func TestCloseAll_CalledTwice_HooksCalledOnce(t *testing.T) {
+	defer resetCloseHooks()()
+	count := 0
+	RegisterCloseHook("a", func(ctx context.Context) error { count++; return nil })
+
+	closeAll(context.Background())
+	closeAll(context.Background())
+
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,255 @@
+package coreapi
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	configFile       string
+	configValidators []func() error
+	// pinnedFlags are set by command line arguments or environment variables, the config file doesn't change them
+	pinnedFlags map[string]bool
+)
+
+func init() {
+	flag.StringVar(&configFile, "config", "virgild.conf", "Path to config file (YAML)")
+	// the config file is loaded by LoadConfig, the file format of the flag package is not used
+	flag.DefaultConfigFlagname = ""
+}
+
+// LoadConfig applies the config file to flags which are not set by command line arguments or environment variables.
+// Missing file is ignored unless its path is set explicitly.
+func LoadConfig() error {
+	pinnedFlags = visitedFlags(flag.CommandLine)
+	return loadConfigFile(flag.CommandLine, configFile)
+}
+
+func loadConfigFile(fs *flag.FlagSet, path string) error {
+	b, err := readConfigFile(path, visitedFlags(fs)["config"])
+	if err != nil {
+		return err
+	}
+	if err = applyConfig(fs, b); err != nil {
+		return errors.Wrapf(err, "Config (%v)", path)
+	}
+	return nil
+}
+
+// readConfigFile returns content of the config file. Missing file is empty unless its path is set explicitly.
+func readConfigFile(path string, explicit bool) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Config: read file (%v)", path)
+	}
+	return b, nil
+}
+
+// applyConfig sets flags from YAML document. Keys are flag names, nested keys are joined by dash
+// (cache: {mem-size: 512} is cache-mem-size), lists are joined by comma.
+func applyConfig(fs *flag.FlagSet, data []byte) error {
+	values, problems, err := parseConfig(fs, data)
+	if err != nil {
+		return err
+	}
+	set := visitedFlags(fs)
+
+	for _, k := range sortedKeys(values) {
+		if set[k] {
+			continue
+		}
+		if err := fs.Set(k, values[k]); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid value of %v (%v): %v", k, values[k], err))
+		}
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("%v", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// parseConfig returns values of the YAML document by flag names. Keys which are not flags are returned as problems.
+func parseConfig(fs *flag.FlagSet, data []byte) (map[string]string, []string, error) {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, nil, errors.Wrap(err, "parse YAML")
+	}
+	values := make(map[string]string)
+	if err := flattenConfig("", raw, values); err != nil {
+		return nil, nil, err
+	}
+
+	var problems []string
+	for _, k := range sortedKeys(values) {
+		if k == "config" || fs.Lookup(k) == nil {
+			problems = append(problems, fmt.Sprintf("unknown key (%v)", k))
+			delete(values, k)
+		}
+	}
+	return values, problems, nil
+}
+
+// visitedFlags returns names of flags which are set by command line arguments, environment variables or Set
+func visitedFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func flattenConfig(key string, v interface{}, out map[string]string) error {
+	join := func(k interface{}) string {
+		if key == "" {
+			return fmt.Sprint(k)
+		}
+		return key + "-" + fmt.Sprint(k)
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if err := flattenConfig(join(k), val, out); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		for k, val := range v {
+			if err := flattenConfig(join(k), val, out); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			switch item.(type) {
+			case map[interface{}]interface{}, []interface{}:
+				return fmt.Errorf("unsupported value of %v: list items must be scalars", key)
+			}
+			items[i] = fmt.Sprint(item)
+		}
+		out[key] = strings.Join(items, ",")
+	case nil:
+		out[key] = ""
+	default:
+		out[key] = fmt.Sprint(v)
+	}
+	return nil
+}
+
+// RegisterConfigValidator registers check of module flags which is run by ValidateConfig
+func RegisterConfigValidator(f func() error) {
+	configValidators = append(configValidators, f)
+}
+
+// ValidateConfig checks values of flags which can't be checked by their types
+func ValidateConfig() error {
+	var problems []string
+	if _, ok := loggers[loggerType]; !ok {
+		problems = append(problems, fmt.Sprintf("logger-type: logger (%v) is not registered", loggerType))
+	}
+	if _, ok := cachers[cacheType]; !ok {
+		problems = append(problems, fmt.Sprintf("cache-type: cache (%v) is not registered", cacheType))
+	}
+	if _, ok := rateLimiters[rateLimitType]; rateLimitEnabled && !ok {
+		problems = append(problems, fmt.Sprintf("ratelimit-type: rate limiter (%v) is not registered", rateLimitType))
+	}
+	if _, err := parseRouteLimits(rateLimits.Routes); err != nil {
+		problems = append(problems, fmt.Sprintf("ratelimit-routes: %v", err))
+	}
+	if _, err := parseRouteDeadlines(deadlines.Routes); err != nil {
+		problems = append(problems, fmt.Sprintf("http-route-deadlines: %v", err))
+	}
+	if _, err := loadTenants(tenantsFile, rateLimitEnabled); err != nil {
+		problems = append(problems, fmt.Sprintf("%v: %v", TenantsFlag, err))
+	}
+	if maxHops < 0 {
+		problems = append(problems, fmt.Sprintf("hop-max: %v is negative", maxHops))
+	}
+	switch accessLogFormat {
+	case accessLogCommon, accessLogCombined, accessLogJSON:
+	default:
+		problems = append(problems, fmt.Sprintf("accesslog-format: unknown format (%v)", accessLogFormat))
+	}
+	switch tracing.Exporter {
+	case "", tracingExporterOTLP, tracingExporterFile:
+	default:
+		problems = append(problems, fmt.Sprintf("tracing-exporter: unknown exporter (%v)", tracing.Exporter))
+	}
+	if tracing.SampleRatio < 0 || tracing.SampleRatio > 1 {
+		problems = append(problems, fmt.Sprintf("tracing-sample-ratio: %v is out of range [0, 1]", tracing.SampleRatio))
+	}
+	for _, validate := range configValidators {
+		if err := validate(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("Config: %v", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// PrintConfig writes effective values of all flags as YAML. Passwords, secrets and credentials of URLs are redacted.
+func PrintConfig(w io.Writer) error {
+	return printConfig(w, flag.CommandLine)
+}
+
+func printConfig(w io.Writer, fs *flag.FlagSet) error {
+	values := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		values[f.Name] = redactConfigValue(f.Name, f.Value.String())
+	})
+	b, err := yaml.Marshal(values)
+	if err != nil {
+		return errors.Wrap(err, "Print config")
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+const redacted = "REDACTED"
+
+func redactConfigValue(name, value string) string {
+	if value == "" {
+		return value
+	}
+	if strings.Contains(name, "password") || strings.Contains(name, "secret") {
+		return redacted
+	}
+	// upstream flags contain comma separated lists of URLs
+	parts := strings.Split(value, ",")
+	for i, p := range parts {
+		if u, err := url.Parse(p); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), redacted)
+				parts[i] = u.String()
+			}
+		}
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,96 @@
+package coreapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+)
+
+type deadlinePolicy struct {
+	Default time.Duration
+	Routes  map[string]time.Duration
+	// Tenants are policies of tenants by name
+	Tenants map[string]deadlinePolicy
+}
+
+// tenant returns policy of the tenant of the request
+func (p deadlinePolicy) tenant(t *Tenant) deadlinePolicy {
+	if t == nil {
+		return p
+	}
+	if tp, ok := p.Tenants[t.Name]; ok {
+		return tp
+	}
+	return p
+}
+
+func (p deadlinePolicy) deadline(route string) time.Duration {
+	if d, ok := p.Routes[route]; ok {
+		return d
+	}
+	return p.Default
+}
+
+// Current makes static policy a source of policies
+func (p deadlinePolicy) Current() deadlinePolicy {
+	return p
+}
+
+type deadlinePolicySource interface {
+	Current() deadlinePolicy
+}
+
+type deadlineConfig struct {
+	Default time.Duration
+	Routes  string
+}
+
+func (c *deadlineConfig) define(fs *flag.FlagSet) {
+	fs.DurationVar(&c.Default, "http-deadline", 30*time.Second, "Maximum time of API request processing (0 - unlimited)")
+	fs.StringVar(&c.Routes, "http-route-deadlines", "", "Per route deadlines in format route=duration separated by comma")
+}
+
+// parseRouteDeadlines parses overrides in format route=duration[,route=duration...]
+func parseRouteDeadlines(s string) (map[string]time.Duration, error) {
+	routes := make(map[string]time.Duration)
+	if strings.TrimSpace(s) == "" {
+		return routes, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("route deadline (%v) must be in format route=duration", item)
+		}
+		d, err := time.ParseDuration(kv[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "route deadline (%v) has invalid duration", item)
+		}
+		routes[kv[0]] = d
+	}
+	return routes, nil
+}
+
+// deadlineMiddleware limits time of the handler chain. The context of the request is cancelled
+// when the deadline is exceeded, so upstream calls are interrupted and the wrapper returns GatewayTimeoutErr
+func deadlineMiddleware(policies deadlinePolicySource) func(route string) Middleware {
+	return func(route string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				d := policies.Current().tenant(GetTenant(r.Context())).deadline(route)
+				if d <= 0 {
+					next.ServeHTTP(w, r)
+					return
+				}
+				ctx, cancel := context.WithTimeout(r.Context(), d)
+				defer cancel()
+				next.ServeHTTP(w, r.WithContext(ctx))
+			})
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package coreapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	thttp "github.com/stretchr/testify/http"
+)
+
+func TestParseRouteDeadlines_Valid(t *testing.T) {
+	routes, err := parseRouteDeadlines("search=5s, create_card=1m")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{
+		"search":      5 * time.Second,
+		"create_card": time.Minute,
+	}, routes)
+}
+
+func TestParseRouteDeadlines_Invalid_ReturnErr(t *testing.T) {
+	for _, v := range []string{"search", "search=5"} {
+		_, err := parseRouteDeadlines(v)
+		assert.Error(t, err, v)
+	}
+}
+
+func TestDeadlineMiddleware_SetContextDeadline(t *testing.T) {
+	var deadline time.Time
+	var ok bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok = r.Context().Deadline()
+	})
+	p := deadlinePolicy{Default: time.Minute, Routes: map[string]time.Duration{"search": time.Second}}
+
+	start := time.Now()
+	deadlineMiddleware(p)("search")(next).ServeHTTP(&thttp.TestResponseWriter{}, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.True(t, ok)
+	assert.WithinDuration(t, start.Add(time.Second), deadline, 500*time.Millisecond)
+}
+
+func TestDeadlineMiddleware_Unlimited_ContextWithoutDeadline(t *testing.T) {
+	var ok bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok = r.Context().Deadline()
+	})
+
+	deadlineMiddleware(deadlinePolicy{})("search")(next).ServeHTTP(&thttp.TestResponseWriter{}, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.False(t, ok)
+}
+
+func TestWrapperAPIHandlerServeHTTP_DeadlineExceeded_ReturnGatewayTimeout(t *testing.T) {
+	handler := func(req *http.Request) (interface{}, error) {
+		<-req.Context().Done()
+		return nil, errors.Wrap(req.Context().Err(), "upstream")
+	}
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	wrap := deadlineMiddleware(deadlinePolicy{Default: time.Millisecond})("search")(wrapAPIHandler(new(fakeLogger), nil)(handler))
+	wrap.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.StatusCode)
+	assert.Equal(t, `{"code":10003}`, w.Output)
+}
+
+func TestWrapperAPIHandlerServeHTTP_ClientCancelled_ReturnClientClosedRequest(t *testing.T) {
+	handler := func(req *http.Request) (interface{}, error) {
+		return nil, &url.Error{Op: "Get", URL: "https://cards", Err: req.Context().Err()}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+	wrapAPIHandler(new(fakeLogger), nil)(handler).ServeHTTP(w, r)
+
+	assert.Equal(t, 499, w.StatusCode)
+}
+
+func TestWrapperAPIHandlerServeHTTP_OtherErrAfterCancel_ReturnErr(t *testing.T) {
+	handler := func(req *http.Request) (interface{}, error) {
+		return nil, errors.Wrap(TooManyRequestsErr, "upstream")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+	wrapAPIHandler(new(fakeLogger), nil)(handler).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.StatusCode)
+}
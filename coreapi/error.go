@@ -23,4 +23,36 @@ var (
 	EntityNotFoundErr = APIError{
 		StatusCode: http.StatusNotFound,
 	}
+	TooManyRequestsErr = APIError{
+		Code:       10001,
+		StatusCode: http.StatusTooManyRequests,
+	}
+	UpstreamUnavailableErr = APIError{
+		Code:       10002,
+		StatusCode: http.StatusServiceUnavailable,
+	}
+	GatewayTimeoutErr = APIError{
+		Code:       10003,
+		StatusCode: http.StatusGatewayTimeout,
+	}
+	// ClientClosedRequestErr is never seen by the client, it marks requests cancelled by the client in logs and metrics
+	ClientClosedRequestErr = APIError{
+		Code:       10004,
+		StatusCode: 499,
+	}
+	// LoopDetectedErr is returned if the request came back to the instance through chained VirgilD
+	LoopDetectedErr = APIError{
+		Code:       10005,
+		StatusCode: http.StatusLoopDetected,
+	}
+	// TooManyHopsErr is returned if the request already passed hop-max chained VirgilD
+	TooManyHopsErr = APIError{
+		Code:       10006,
+		StatusCode: http.StatusLoopDetected,
+	}
+	// RequestQueuedErr is returned if the request is stored and will be sent to the upstream later
+	RequestQueuedErr = APIError{
+		Code:       10007,
+		StatusCode: http.StatusAccepted,
+	}
 )
@@ -0,0 +1,47 @@
+package coreapi
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+)
+
+// lockPollInterval is the interval of attempts to lock a file which is locked by another process
+const lockPollInterval = 100 * time.Millisecond
+
+var lockTimeout time.Duration
+
+func init() {
+	flag.DurationVar(&lockTimeout, "lock-timeout", time.Minute, "Time to wait for files (journals, audit log) locked by another process, e.g. the previous process which drains requests after hand-off (should exceed shutdown-timeout)")
+}
+
+// LockFile takes exclusive lock of the opened file, the lock is released when the file is closed.
+// If the file is locked by another process (e.g. the previous process drains requests after it handed off
+// listening sockets), LockFile logs it and waits until the lock is released, ctx is done or lock-timeout elapses.
+func LockFile(ctx context.Context, f *os.File) error {
+	locked, err := tryLockFile(f)
+	if err != nil || locked {
+		return errors.Wrapf(err, "Lock file (%v)", f.Name())
+	}
+	GetLogger(ctx).Warn("File %v is locked by another process, wait for it up to %v ...", f.Name(), lockTimeout)
+	// the previous process releases the file only after it stops serving, so it may start draining
+	NotifyReady()
+
+	timeout := time.NewTimer(lockTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "Lock file (%v)", f.Name())
+		case <-timeout.C:
+			return errors.Errorf("Lock file (%v): it is locked by another process longer than %v", f.Name(), lockTimeout)
+		case <-time.After(lockPollInterval):
+		}
+		if locked, err = tryLockFile(f); err != nil || locked {
+			return errors.Wrapf(err, "Lock file (%v)", f.Name())
+		}
+	}
+}
@@ -0,0 +1,52 @@
+//go:build !windows
+// +build !windows
+
+package coreapi
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func openLockTestFile(t *testing.T, path string) *os.File {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	assert.Nil(t, err)
+	return f
+}
+
+func TestLockFile_LockedLongerThanTimeout_ReturnErrWithPath(t *testing.T) {
+	saved := lockTimeout
+	lockTimeout = 300 * time.Millisecond
+	defer func() { lockTimeout = saved }()
+	notified := false
+	SetReadyNotifier(func() { notified = true })
+	defer SetReadyNotifier(nil)
+
+	path := filepath.Join(t.TempDir(), "journal")
+	held := openLockTestFile(t, path)
+	defer held.Close()
+	assert.Nil(t, LockFile(context.Background(), held))
+
+	f := openLockTestFile(t, path)
+	defer f.Close()
+	err := LockFile(context.Background(), f)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), path)
+	assert.True(t, notified)
+}
+
+func TestLockFile_ReleasedWhileWaiting_Lock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	held := openLockTestFile(t, path)
+	assert.Nil(t, LockFile(context.Background(), held))
+	time.AfterFunc(200*time.Millisecond, func() { held.Close() })
+
+	f := openLockTestFile(t, path)
+	defer f.Close()
+	assert.Nil(t, LockFile(context.Background(), f))
+}
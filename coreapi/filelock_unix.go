@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package coreapi
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLockFile takes exclusive lock of the file without waiting, false is returned if another process holds it
+func tryLockFile(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,416 @@
+package coreapi
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorCodeMetadata is the trailer of failed gRPC calls with the code of APIError
+const ErrorCodeMetadata = "x-virgil-error-code"
+
+var (
+	grpcCertificate string
+	grpcPrivateKey  string
+	grpcReflection  bool
+)
+
+func init() {
+	flag.StringVar(&grpcCertificate, "grpc-certificate", "", "The path of the certificate file of gRPC API (empty - gRPC API without TLS)")
+	flag.StringVar(&grpcPrivateKey, "grpc-private-key", "", "The path of private key file of gRPC API")
+	flag.BoolVar(&grpcReflection, "grpc-reflection", true, "Serve gRPC server reflection")
+}
+
+// grpcAPI applies to gRPC calls the same request context and policies as to HTTP requests:
+// request id, logger, hops, tenant, rate limits and deadlines. Methods without route are called as is.
+type grpcAPI struct {
+	logger    Logger
+	tenants   *Reloadable[tenantSet]
+	rateLimit rateLimitFunc
+	deadlines deadlinePolicySource
+	self      string
+	maxHops   int
+	debug     bool
+
+	mu     sync.RWMutex
+	routes map[string]string
+}
+
+func newGRPCServer(a *grpcAPI) (*grpc.Server, error) {
+	opts := []grpc.ServerOption{grpc.UnaryInterceptor(a.unary), grpc.StreamInterceptor(a.stream)}
+	if grpcCertificate != "" {
+		creds, err := credentials.NewServerTLSFromFile(grpcCertificate, grpcPrivateKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "gRPC: load certificate")
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	s := grpc.NewServer(opts...)
+	if grpcReflection {
+		reflection.Register(s)
+	}
+	return s, nil
+}
+
+func (a *grpcAPI) setRoute(method, route string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.routes == nil {
+		a.routes = make(map[string]string)
+	}
+	a.routes[method] = route
+}
+
+func (a *grpcAPI) route(method string) (string, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	route, ok := a.routes[method]
+	return route, ok
+}
+
+func (a *grpcAPI) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var resp interface{}
+	err := a.serve(ctx, info.FullMethod, func(ctx context.Context, flush func()) (err error) {
+		resp, err = handler(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (a *grpcAPI) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return a.serve(ss.Context(), info.FullMethod, func(ctx context.Context, flush func()) error {
+		return handler(srv, &grpcStream{ServerStream: ss, ctx: ctx, flush: flush})
+	})
+}
+
+// serve calls the method with context of the API. Headers set by handlers are sent as header metadata,
+// errors are converted to gRPC statuses.
+func (a *grpcAPI) serve(ctx context.Context, method string, call func(ctx context.Context, flush func()) error) error {
+	route, ok := a.route(method)
+	if !ok {
+		return call(ctx, func() {})
+	}
+
+	start := time.Now()
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	ctx, span := otel.Tracer(tracerName).Start(ctx, route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.method", method),
+		))
+	defer span.End()
+
+	id := metadataValue(md, RequestIDHeader)
+	if id == "" {
+		id = newRequestID()
+	}
+	fields := Fields{"request_id": id, "route": route}
+	if span.SpanContext().IsValid() {
+		span.SetAttributes(attribute.String("virgild.request_id", id))
+		fields["trace_id"] = span.SpanContext().TraceID().String()
+	}
+	rl := WithFields(a.logger, fields)
+	ctx = SetRoute(SetLogger(SetRequestID(ctx, id), rl), route)
+	ctx, meta := withResponseMeta(ctx)
+	SetResponseHeader(ctx, RequestIDHeader, id)
+
+	h, err := checkHops(a.self, a.maxHops, metadataValue(md, ViaHeader), rl)
+	var once sync.Once
+	flush := func() {
+		once.Do(func() {
+			header := meta.metadata()
+			if a.debug {
+				header.Set(ChainHeader, h.chainHeader())
+			}
+			if len(header) != 0 {
+				grpc.SetHeader(ctx, header)
+			}
+		})
+	}
+
+	if err == nil {
+		ctx = context.WithValue(ctx, contextHopsKey{}, h)
+		auth := metadataValue(md, "Authorization")
+		if t := a.tenants.Current().byAuth(auth); t != nil {
+			ctx = SetTenant(ctx, t)
+		}
+		if a.rateLimit != nil {
+			ip := peerIP(ctx)
+			if trustedProxyHeader != "" {
+				if fip := forwardedIP(metadataValue(md, trustedProxyHeader)); fip != "" {
+					ip = fip
+				}
+			}
+			if allow, wait := a.rateLimit(ctx, route, ip, auth); !allow {
+				SetResponseHeader(ctx, "Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				err = TooManyRequestsErr
+			}
+		}
+	}
+	if err == nil {
+		if d := a.deadlines.Current().tenant(GetTenant(ctx)).deadline(route); d > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d)
+			defer cancel()
+		}
+		err = call(ctx, flush)
+	}
+	flush()
+
+	code := codes.OK
+	if err != nil {
+		err = grpcError(ctx, err)
+		code = status.Code(err)
+	}
+	if code != codes.OK && code != codes.NotFound {
+		span.SetStatus(otelcodes.Error, code.String())
+	}
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(code)))
+	grpcDurationMetric.WithLabelValues(route, code.String()).Observe(time.Since(start).Seconds())
+	Debug(WithFields(GetLogger(ctx), Fields{
+		"status":     code.String(),
+		"latency_ms": float64(time.Since(start)) / float64(time.Millisecond),
+	}), "gRPC request processed")
+	return err
+}
+
+// grpcError converts the error to gRPC status. The code of APIError is sent in ErrorCodeMetadata trailer.
+func grpcError(ctx context.Context, err error) error {
+	innerErr := errors.Cause(err)
+	if _, ok := innerErr.(interface{ GRPCStatus() *status.Status }); ok {
+		return innerErr
+	}
+	apiErr, ok := innerErr.(APIError)
+	if !ok {
+		apiErr, ok = contextErr(err)
+	}
+	if !ok {
+		GetLogger(ctx).Err("gRPC API: %+v", err)
+		apiErr = InternalServerErr
+	}
+	grpc.SetTrailer(ctx, metadata.Pairs(ErrorCodeMetadata, strconv.Itoa(apiErr.Code)))
+	return status.Error(grpcCode(apiErr.StatusCode), apiErr.Error())
+}
+
+// grpcCode maps HTTP status code of APIError to gRPC code
+func grpcCode(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case 499:
+		return codes.Canceled
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusLoopDetected:
+		return codes.Aborted
+	case http.StatusInternalServerError:
+		return codes.Internal
+	}
+	return codes.Unknown
+}
+
+// grpcStream sends header metadata before the first message and passes context of the API to the handler
+type grpcStream struct {
+	grpc.ServerStream
+	ctx   context.Context
+	flush func()
+}
+
+func (s *grpcStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *grpcStream) SendMsg(m interface{}) error {
+	s.flush()
+	return s.ServerStream.SendMsg(m)
+}
+
+// metadata returns headers as gRPC metadata, names are in lower case
+func (m *responseMeta) metadata() metadata.MD {
+	m.Lock()
+	defer m.Unlock()
+
+	md := metadata.MD{}
+	for name, values := range m.header {
+		md.Append(name, values...)
+	}
+	return md
+}
+
+func metadataValue(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) != 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// metadataCarrier adapts gRPC metadata to propagators of trace context
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	return metadataValue(metadata.MD(c), key)
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// grpcTransport serves operations as methods of services built from bindings. Methods of operations
+// get routes of the operations, so gRPC and HTTP share rate limits, deadlines and metric names.
+type grpcTransport struct {
+	api    *grpcAPI
+	server *grpc.Server
+}
+
+func (t *grpcTransport) register(ops []Operation) error {
+	services := make(map[string]*grpc.ServiceDesc)
+	var names []string
+	for _, op := range ops {
+		b := op.GRPC
+		if b == nil {
+			continue
+		}
+		if b.Service == "" || b.Method == "" || b.New == nil || (b.Encode == nil && b.Stream == nil) {
+			return errors.Errorf("operation %s: service, method, New and Encode or Stream of gRPC binding are required", op.Name)
+		}
+		sd, ok := services[b.Service]
+		if !ok {
+			sd = &grpc.ServiceDesc{ServiceName: b.Service, HandlerType: (*interface{})(nil)}
+			services[b.Service] = sd
+			names = append(names, b.Service)
+		}
+		if b.Stream != nil {
+			sd.Streams = append(sd.Streams, grpc.StreamDesc{StreamName: b.Method, Handler: t.streamHandler(op), ServerStreams: true})
+		} else {
+			sd.Methods = append(sd.Methods, grpc.MethodDesc{MethodName: b.Method, Handler: t.unaryHandler(op)})
+		}
+	}
+
+	registered := t.server.GetServiceInfo()
+	for _, name := range names {
+		if _, ok := registered[name]; ok {
+			return errors.Errorf("gRPC: service %s is already registered", name)
+		}
+	}
+	for _, op := range ops {
+		if op.GRPC != nil && !op.Plain {
+			t.api.setRoute("/"+op.GRPC.Service+"/"+op.GRPC.Method, op.Name)
+		}
+	}
+	for _, name := range names {
+		t.server.RegisterService(services[name], nil)
+	}
+	return nil
+}
+
+func (t *grpcTransport) unaryHandler(op Operation) grpc.MethodHandler {
+	b := op.GRPC
+	method := "/" + b.Service + "/" + b.Method
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := b.New()
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		call := func(ctx context.Context, msg interface{}) (interface{}, error) {
+			resp, err := t.call(ctx, op, msg)
+			resp, err = b.Encode(resp, err)
+			if err != nil && op.Plain {
+				return nil, grpcError(ctx, err)
+			}
+			return resp, err
+		}
+		if interceptor == nil {
+			return call(ctx, in)
+		}
+		return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: method}, call)
+	}
+}
+
+func (t *grpcTransport) streamHandler(op Operation) grpc.StreamHandler {
+	b := op.GRPC
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		in := b.New()
+		if err := stream.RecvMsg(in); err != nil {
+			return err
+		}
+		ctx := stream.Context()
+		if b.Prepare != nil {
+			ctx = b.Prepare(ctx, stream.SendMsg)
+		}
+		resp, err := t.call(ctx, op, in)
+		if err == nil {
+			err = b.Stream(ctx, resp, stream.SendMsg)
+		}
+		if err != nil && op.Plain {
+			return grpcError(stream.Context(), err)
+		}
+		return err
+	}
+}
+
+// call decodes the message and calls handler of the operation
+func (t *grpcTransport) call(ctx context.Context, op Operation, msg interface{}) (interface{}, error) {
+	req := msg
+	if op.GRPC.Decode != nil {
+		var err error
+		if req, err = op.GRPC.Decode(msg); err != nil {
+			return nil, err
+		}
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return op.Handler(SetAuthorization(ctx, metadataValue(md, "authorization")), req)
+}
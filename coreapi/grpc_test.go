@@ -0,0 +1,148 @@
+package coreapi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testMethod = "/test.Service/Method"
+
+func makeGRPCAPI(logger Logger) *grpcAPI {
+	a := &grpcAPI{logger: logger, tenants: NewReloadable(tenantSet{}), deadlines: deadlinePolicy{}, self: "self", maxHops: 8}
+	a.setRoute(testMethod, "test_route")
+	return a
+}
+
+func TestGRPCUnary_Route_SetRequestContext(t *testing.T) {
+	a := makeGRPCAPI(new(fakeLogger))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-virgil-request-id", "req-1"))
+	var id, route string
+
+	resp, err := a.unary(ctx, "req", &grpc.UnaryServerInfo{FullMethod: testMethod}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		id, route = GetRequestID(ctx), GetRoute(ctx)
+		return "resp", nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "resp", resp)
+	assert.Equal(t, "req-1", id)
+	assert.Equal(t, "test_route", route)
+}
+
+func TestGRPCUnary_NoRoute_CallAsIs(t *testing.T) {
+	a := makeGRPCAPI(new(fakeLogger))
+	var route string
+
+	_, err := a.unary(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: "/other.Service/Method"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		route = GetRoute(ctx)
+		return nil, errors.New("raw")
+	})
+
+	assert.EqualError(t, err, "raw")
+	assert.Empty(t, route)
+}
+
+func TestGRPCUnary_APIError_ReturnStatus(t *testing.T) {
+	a := makeGRPCAPI(new(fakeLogger))
+
+	_, err := a.unary(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: testMethod}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errors.Wrap(TooManyRequestsErr, "upstream")
+	})
+
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestGRPCUnary_UnknownError_ReturnInternal(t *testing.T) {
+	logger := new(fakeLogger)
+	logger.On("Err").Once()
+	a := makeGRPCAPI(logger)
+
+	_, err := a.unary(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: testMethod}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errors.New("broken")
+	})
+
+	assert.Equal(t, codes.Internal, status.Code(err))
+	logger.AssertExpectations(t)
+}
+
+func TestGRPCUnary_Loop_ReturnAborted(t *testing.T) {
+	logger := new(fakeLogger)
+	logger.On("Warn").Once()
+	a := makeGRPCAPI(logger)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-virgil-via", "edge-1, self"))
+
+	_, err := a.unary(ctx, "req", &grpc.UnaryServerInfo{FullMethod: testMethod}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		t.Fatal("handler is called")
+		return nil, nil
+	})
+
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	logger.AssertExpectations(t)
+}
+
+func TestGRPCUnary_RateLimited_ReturnResourceExhausted(t *testing.T) {
+	a := makeGRPCAPI(new(fakeLogger))
+	var limited string
+	a.rateLimit = func(ctx context.Context, route, ip, auth string) (bool, time.Duration) {
+		limited = route + " " + auth
+		return false, time.Second
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "VIRGIL token"))
+
+	_, err := a.unary(ctx, "req", &grpc.UnaryServerInfo{FullMethod: testMethod}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		t.Fatal("handler is called")
+		return nil, nil
+	})
+
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, "test_route VIRGIL token", limited)
+}
+
+func TestGRPCUnary_Deadline_ContextHasDeadline(t *testing.T) {
+	a := makeGRPCAPI(new(fakeLogger))
+	a.deadlines = deadlinePolicy{Default: time.Second}
+	var ok bool
+
+	a.unary(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: testMethod}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		_, ok = ctx.Deadline()
+		return nil, nil
+	})
+
+	assert.True(t, ok)
+}
+
+func TestGRPCCode(t *testing.T) {
+	table := map[int]codes.Code{
+		http.StatusBadRequest:          codes.InvalidArgument,
+		http.StatusUnauthorized:        codes.Unauthenticated,
+		http.StatusNotFound:            codes.NotFound,
+		http.StatusTooManyRequests:     codes.ResourceExhausted,
+		499:                            codes.Canceled,
+		http.StatusServiceUnavailable:  codes.Unavailable,
+		http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+		http.StatusLoopDetected:        codes.Aborted,
+		http.StatusInternalServerError: codes.Internal,
+		http.StatusAccepted:            codes.Unknown,
+	}
+	for statusCode, code := range table {
+		assert.Equal(t, code, grpcCode(statusCode), statusCode)
+	}
+}
+
+func TestGRPCError_ErrAfterCancel_NotCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := grpcError(ctx, errors.Wrap(EntityNotFoundErr, "get"))
+
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
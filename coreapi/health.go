@@ -0,0 +1,161 @@
+package coreapi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	virgil "gopkg.in/virgil.v4"
+)
+
+// HealthCheck reports state of a dependency. Details are added to the readiness report as is.
+type HealthCheck func(ctx context.Context) (details interface{}, err error)
+
+var (
+	healthChecksMu sync.RWMutex
+	healthChecks   = make(map[string]HealthCheck)
+)
+
+// RegisterHealthCheck registers readiness check of a dependency. Check with the same name is replaced.
+func RegisterHealthCheck(name string, check HealthCheck) {
+	healthChecksMu.Lock()
+	defer healthChecksMu.Unlock()
+
+	healthChecks[name] = check
+}
+
+// UnregisterHealthCheck removes readiness check, e.g. of a dependency removed by reload of configuration
+func UnregisterHealthCheck(name string) {
+	healthChecksMu.Lock()
+	defer healthChecksMu.Unlock()
+
+	delete(healthChecks, name)
+}
+
+const (
+	HealthOK   = "ok"
+	HealthFail = "fail"
+	// HealthDegraded means that a dependency fails but the instance serves without it
+	HealthDegraded = "degraded"
+)
+
+type degradedError struct {
+	error
+}
+
+// Degraded marks error of the check which doesn't make the instance not ready
+func Degraded(err error) error {
+	return degradedError{err}
+}
+
+type HealthStatus struct {
+	Status  string      `json:"status"`
+	Error   string      `json:"error,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+type HealthReport struct {
+	Status string                  `json:"status"`
+	Checks map[string]HealthStatus `json:"checks"`
+}
+
+// CheckHealth runs all registered checks concurrently. Checks which don't finish before timeout fail.
+// The report is degraded if no check fails but some of them are degraded.
+func CheckHealth(ctx context.Context, timeout time.Duration) HealthReport {
+	healthChecksMu.RLock()
+	names := make([]string, 0, len(healthChecks))
+	checks := make(map[string]HealthCheck, len(healthChecks))
+	for name, check := range healthChecks {
+		names = append(names, name)
+		checks[name] = check
+	}
+	healthChecksMu.RUnlock()
+	sort.Strings(names)
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type result struct {
+		name   string
+		status HealthStatus
+	}
+	results := make(chan result, len(names))
+	for _, name := range names {
+		go func(name string, check HealthCheck) {
+			details, err := check(ctx)
+			s := HealthStatus{Status: HealthOK, Details: details}
+			if err != nil {
+				s.Status = HealthFail
+				s.Error = err.Error()
+				if _, ok := err.(degradedError); ok {
+					s.Status = HealthDegraded
+				}
+			}
+			results <- result{name, s}
+		}(name, checks[name])
+	}
+
+	report := HealthReport{Status: HealthOK, Checks: make(map[string]HealthStatus, len(names))}
+	for range names {
+		var r result
+		select {
+		case r = <-results:
+		case <-ctx.Done():
+			for _, name := range names {
+				if _, ok := report.Checks[name]; !ok {
+					report.Checks[name] = HealthStatus{Status: HealthFail, Error: "check timed out"}
+				}
+			}
+			report.Status = HealthFail
+			return report
+		}
+		report.Checks[r.name] = r.status
+		switch {
+		case r.status.Status == HealthFail:
+			report.Status = HealthFail
+		case r.status.Status == HealthDegraded && report.Status == HealthOK:
+			report.Status = HealthDegraded
+		}
+	}
+	return report
+}
+
+const healthCheckCacheKey = "health_check"
+
+// cacheHealthCheck writes and reads probe value of the cache backend
+func cacheHealthCheck(cache RawCache) HealthCheck {
+	return func(ctx context.Context) (interface{}, error) {
+		now := time.Now().UnixNano()
+		if err := cache.Set(healthCheckCacheKey, now); err != nil {
+			return nil, errors.Wrap(err, "set probe value")
+		}
+		var v int64
+		has, err := cache.Get(healthCheckCacheKey, &v)
+		if err != nil {
+			return nil, errors.Wrap(err, "get probe value")
+		}
+		if !has {
+			return nil, fmt.Errorf("probe value is not found")
+		}
+		return nil, nil
+	}
+}
+
+// serviceKeyHealthCheck reports that response signing key is loaded
+func serviceKeyHealthCheck(signer *responseSigner, card *virgil.CardResponse) HealthCheck {
+	return func(ctx context.Context) (interface{}, error) {
+		if signer == nil || signer.key == nil {
+			return nil, fmt.Errorf("service key is not loaded")
+		}
+		if card == nil {
+			return nil, nil
+		}
+		return map[string]string{"card_id": card.ID}, nil
+	}
+}
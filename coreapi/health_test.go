@@ -0,0 +1,86 @@
+package coreapi
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func resetHealthChecks() {
+	healthChecksMu.Lock()
+	healthChecks = make(map[string]HealthCheck)
+	healthChecksMu.Unlock()
+}
+
+func TestCheckHealth_AllOk_ReturnOk(t *testing.T) {
+	resetHealthChecks()
+	RegisterHealthCheck("a", func(ctx context.Context) (interface{}, error) { return "details", nil })
+	RegisterHealthCheck("b", func(ctx context.Context) (interface{}, error) { return nil, nil })
+
+	report := CheckHealth(context.Background(), time.Second)
+
+	assert.Equal(t, HealthOK, report.Status)
+	assert.Equal(t, HealthStatus{Status: HealthOK, Details: "details"}, report.Checks["a"])
+	assert.Equal(t, HealthStatus{Status: HealthOK}, report.Checks["b"])
+}
+
+func TestCheckHealth_CheckFailed_ReturnFail(t *testing.T) {
+	resetHealthChecks()
+	RegisterHealthCheck("a", func(ctx context.Context) (interface{}, error) { return nil, nil })
+	RegisterHealthCheck("b", func(ctx context.Context) (interface{}, error) { return nil, fmt.Errorf("unreachable") })
+
+	report := CheckHealth(context.Background(), time.Second)
+
+	assert.Equal(t, HealthFail, report.Status)
+	assert.Equal(t, HealthOK, report.Checks["a"].Status)
+	assert.Equal(t, HealthStatus{Status: HealthFail, Error: "unreachable"}, report.Checks["b"])
+}
+
+func TestCheckHealth_CheckDegraded_ReturnDegraded(t *testing.T) {
+	resetHealthChecks()
+	RegisterHealthCheck("a", func(ctx context.Context) (interface{}, error) { return nil, nil })
+	RegisterHealthCheck("b", func(ctx context.Context) (interface{}, error) { return nil, Degraded(fmt.Errorf("unreachable")) })
+
+	report := CheckHealth(context.Background(), time.Second)
+
+	assert.Equal(t, HealthDegraded, report.Status)
+	assert.Equal(t, HealthStatus{Status: HealthDegraded, Error: "unreachable"}, report.Checks["b"])
+}
+
+func TestCheckHealth_DegradedAndFailed_ReturnFail(t *testing.T) {
+	resetHealthChecks()
+	RegisterHealthCheck("a", func(ctx context.Context) (interface{}, error) { return nil, fmt.Errorf("disconnected") })
+	RegisterHealthCheck("b", func(ctx context.Context) (interface{}, error) { return nil, Degraded(fmt.Errorf("unreachable")) })
+
+	report := CheckHealth(context.Background(), time.Second)
+
+	assert.Equal(t, HealthFail, report.Status)
+}
+
+func TestCheckHealth_CheckHangs_ReturnTimeout(t *testing.T) {
+	resetHealthChecks()
+	RegisterHealthCheck("slow", func(ctx context.Context) (interface{}, error) {
+		time.Sleep(time.Second)
+		return nil, nil
+	})
+
+	start := time.Now()
+	report := CheckHealth(context.Background(), 10*time.Millisecond)
+
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, HealthFail, report.Status)
+	assert.Equal(t, "check timed out", report.Checks["slow"].Error)
+}
+
+func TestCacheHealthCheck_SetErr_ReturnErr(t *testing.T) {
+	c := new(fakeCache)
+	c.On("Set", healthCheckCacheKey, mock.Anything).Return(fmt.Errorf("connection refused"))
+
+	_, err := cacheHealthCheck(c)(context.Background())
+
+	assert.NotNil(t, err)
+}
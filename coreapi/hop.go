@@ -0,0 +1,182 @@
+package coreapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/namsral/flag"
+)
+
+const (
+	// ViaHeader lists ids of VirgilD instances which forwarded the request, the nearest to the client is first.
+	// Clients may set it too, so it's advisory: it stops loops of chained instances, but isn't checked for authenticity.
+	ViaHeader = "X-Virgil-Via"
+	// ChainHeader is the debug header with the path of the request through chained instances
+	ChainHeader = "X-Virgil-Chain"
+)
+
+var (
+	instanceIDFlag string
+	maxHops        int
+	chainHeader    bool
+
+	instanceIDOnce sync.Once
+	instanceID     string
+)
+
+func init() {
+	flag.StringVar(&instanceIDFlag, "instance-id", "", "Id of the instance in chains of VirgilD (empty - random id)")
+	flag.IntVar(&maxHops, "hop-max", 8, "Maximum count of VirgilD instances which forwarded the request (0 - unlimited)")
+	flag.BoolVar(&chainHeader, "hop-debug-header", false, "Return path of the request through chained instances in "+ChainHeader+" header")
+}
+
+// InstanceID returns id of the instance which is sent to upstreams in ViaHeader
+func InstanceID() string {
+	instanceIDOnce.Do(func() {
+		instanceID = makeInstanceID(instanceIDFlag)
+	})
+	return instanceID
+}
+
+// makeInstanceID returns configured id or a random one. The id is sent to upstreams which may be outside
+// of the network of the instance, so the default doesn't contain the host name.
+func makeInstanceID(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "virgild-" + hex.EncodeToString(b)
+}
+
+// hops is the position of the request in the chain of instances
+type hops struct {
+	sync.Mutex
+	self  string
+	via   []string
+	chain string
+}
+
+type contextHopsKey struct{}
+
+func hopsFromContext(ctx context.Context) *hops {
+	h, _ := ctx.Value(contextHopsKey{}).(*hops)
+	return h
+}
+
+func parseVia(v string) []string {
+	var ids []string
+	for _, id := range strings.Split(v, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// path returns ids of instances passed by the request including the current one
+func (h *hops) path() []string {
+	path := make([]string, 0, len(h.via)+1)
+	path = append(path, h.via...)
+	return append(path, h.self)
+}
+
+// SetHopHeaders adds ViaHeader to the request to upstream. Upstream VirgilD rejects the request if it is already in the path.
+func SetHopHeaders(ctx context.Context, header http.Header) {
+	path := []string{InstanceID()}
+	if h := hopsFromContext(ctx); h != nil {
+		path = h.path()
+	}
+	header.Set(ViaHeader, strings.Join(path, ", "))
+}
+
+// SetUpstreamChain records the chain returned by upstream VirgilD, it is longer than the path known by the instance
+func SetUpstreamChain(ctx context.Context, chain string) {
+	h := hopsFromContext(ctx)
+	if h == nil || chain == "" {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+
+	h.chain = chain
+}
+
+func (h *hops) chainHeader() string {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.chain != "" {
+		return h.chain
+	}
+	return strings.Join(h.path(), ", ")
+}
+
+// chainWriter sets ChainHeader before the response is written
+type chainWriter struct {
+	http.ResponseWriter
+	hops *hops
+	done bool
+}
+
+func (w *chainWriter) WriteHeader(status int) {
+	if !w.done {
+		w.done = true
+		w.Header().Set(ChainHeader, w.hops.chainHeader())
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *chainWriter) Write(b []byte) (int, error) {
+	if !w.done {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends buffered data of streamed responses to the client
+func (w *chainWriter) Flush() {
+	if !w.done {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// hopMiddleware rejects requests which already passed the instance or too many instances
+func hopMiddleware(self string, max int, debug bool, logger Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h, err := checkHops(self, max, r.Header.Get(ViaHeader), logger)
+			if debug {
+				w = &chainWriter{ResponseWriter: w, hops: h}
+			}
+			if err != nil {
+				writeAPIError(w, r, err.(APIError))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextHopsKey{}, h)))
+		})
+	}
+}
+
+// checkHops returns position of the request in the chain, LoopDetectedErr or TooManyHopsErr
+func checkHops(self string, max int, via string, logger Logger) (*hops, error) {
+	h := &hops{self: self, via: parseVia(via)}
+	for _, id := range h.via {
+		if id == self {
+			logger.Warn("Hops: loop detected (%v: %v)", ViaHeader, strings.Join(h.via, ", "))
+			return h, LoopDetectedErr
+		}
+	}
+	if max > 0 && len(h.via) >= max {
+		logger.Warn("Hops: too many hops (%v: %v)", ViaHeader, strings.Join(h.via, ", "))
+		return h, TooManyHopsErr
+	}
+	return h, nil
+}
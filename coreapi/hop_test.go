@@ -0,0 +1,132 @@
+package coreapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHopMiddleware_Loop_ReturnLoopDetected(t *testing.T) {
+	logger := new(fakeLogger)
+	logger.On("Warn").Once()
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(ViaHeader, "edge-1, self, core-1")
+	w := httptest.NewRecorder()
+
+	hopMiddleware("self", 8, false, logger)(next).ServeHTTP(w, r)
+
+	assert.False(t, called)
+	assert.Equal(t, http.StatusLoopDetected, w.Code)
+	assert.JSONEq(t, `{"code":10005}`, w.Body.String())
+	logger.AssertExpectations(t)
+}
+
+func TestHopMiddleware_TooManyHops_ReturnErr(t *testing.T) {
+	logger := new(fakeLogger)
+	logger.On("Warn").Once()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(ViaHeader, "a, b")
+	w := httptest.NewRecorder()
+
+	hopMiddleware("self", 2, false, logger)(next).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusLoopDetected, w.Code)
+	assert.JSONEq(t, `{"code":10006}`, w.Body.String())
+}
+
+func TestHopMiddleware_Unlimited_CallNext(t *testing.T) {
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(ViaHeader, "a, b, c")
+
+	hopMiddleware("self", 0, false, new(fakeLogger))(next).ServeHTTP(httptest.NewRecorder(), r)
+
+	assert.True(t, called)
+}
+
+func TestHopMiddleware_UpstreamRequest_AppendSelfToVia(t *testing.T) {
+	upstream := make(http.Header)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetHopHeaders(r.Context(), upstream)
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(ViaHeader, "edge-1,edge-2")
+
+	hopMiddleware("self", 8, false, new(fakeLogger))(next).ServeHTTP(httptest.NewRecorder(), r)
+
+	assert.Equal(t, "edge-1, edge-2, self", upstream.Get(ViaHeader))
+}
+
+func TestSetHopHeaders_WithoutHops_SetInstanceID(t *testing.T) {
+	header := make(http.Header)
+
+	SetHopHeaders(context.Background(), header)
+
+	assert.Equal(t, InstanceID(), header.Get(ViaHeader))
+	assert.NotEmpty(t, InstanceID())
+}
+
+func TestMakeInstanceID_NotConfigured_ReturnRandom(t *testing.T) {
+	id1, id2 := makeInstanceID(""), makeInstanceID("")
+
+	assert.Regexp(t, "^virgild-[0-9a-f]{16}$", id1)
+	assert.NotEqual(t, id1, id2)
+	assert.Equal(t, "edge-1", makeInstanceID("edge-1"))
+}
+
+func TestHopMiddleware_Debug_ReturnChain(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(ViaHeader, "edge-1")
+	w := httptest.NewRecorder()
+
+	hopMiddleware("self", 8, true, new(fakeLogger))(next).ServeHTTP(w, r)
+
+	assert.Equal(t, "edge-1, self", w.Header().Get(ChainHeader))
+}
+
+func TestHopMiddleware_DebugUpstreamChain_ReturnUpstreamChain(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetUpstreamChain(r.Context(), "self, core-1")
+		w.Write([]byte("{}"))
+	})
+	w := httptest.NewRecorder()
+
+	hopMiddleware("self", 8, true, new(fakeLogger))(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, "self, core-1", w.Header().Get(ChainHeader))
+}
+
+func TestHopMiddleware_DebugDisabled_WithoutChain(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	w := httptest.NewRecorder()
+
+	hopMiddleware("self", 8, false, new(fakeLogger))(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Empty(t, w.Header().Get(ChainHeader))
+}
+
+func TestHopMiddleware_DebugStream_Flush(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, ok := w.(http.Flusher)
+		assert.True(t, ok)
+		f.Flush()
+	})
+	w := httptest.NewRecorder()
+
+	hopMiddleware("self", 8, true, new(fakeLogger))(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "self", w.Header().Get(ChainHeader))
+}
@@ -1,50 +1,121 @@
 package coreapi
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func wrapAPIHandler(logger Logger) func(fun APIHandler) http.Handler {
+func wrapAPIHandler(logger Logger, signer *responseSigner) func(fun APIHandler) http.Handler {
 	return func(handler APIHandler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			var ok bool
 			w.Header().Set("Content-Type", "application/json")
 
+			start := time.Now()
+			id := requestID(r)
+			accessEntryFromContext(r.Context()).set(func(e *accessEntry) { e.requestID = id })
+			fields := Fields{"request_id": id, "route": GetRoute(r.Context())}
+			if span := trace.SpanFromContext(r.Context()); span.SpanContext().IsValid() {
+				span.SetAttributes(attribute.String("virgild.request_id", id))
+				fields["trace_id"] = span.SpanContext().TraceID().String()
+			}
+			rl := WithFields(logger, fields)
+			ctx, upstream := withUpstreamResponse(SetLogger(SetRequestID(r.Context(), id), rl))
+			ctx, meta := withResponseMeta(ctx)
+			r = r.WithContext(ctx)
+
+			var body []byte
+			statusCode := http.StatusOK
+
 			seccess, err := handler(r)
+			if res, isRes := seccess.(httpResponse); isRes && err == nil {
+				statusCode, seccess = res.statusCode, res.body
+			}
 			if err != nil {
 				var apiErr APIError
 
 				innerErr := errors.Cause(err)
 				if apiErr, ok = innerErr.(APIError); !ok {
-					logger.Err("API wrapper: %+v", err)
+					apiErr, ok = contextErr(err)
+				}
+				if !ok {
+					GetLogger(r.Context()).Err("API wrapper: %+v", err)
 					apiErr = InternalServerErr
 				}
-				w.WriteHeader(apiErr.StatusCode)
+				statusCode = apiErr.StatusCode
+				body = apiErrorBody(apiErr)
+			} else if seccess != nil {
+				if body, ok = seccess.([]byte); !ok {
+					body, _ = json.Marshal(seccess)
+				}
+				// the signature of upstream is kept only for the upstream response which is the result
+				if header, upstreamBody, found := upstream.signedResult(seccess, body); found {
+					w.Header().Set(ResponseIDHeader, header.Get(ResponseIDHeader))
+					w.Header().Set(ResponseSignHeader, header.Get(ResponseSignHeader))
+					body = upstreamBody
+				}
+			}
 
-				if apiErr == EntityNotFoundErr {
-					return
+			w.Header().Set(RequestIDHeader, id)
+			meta.apply(w.Header())
+			if signer != nil {
+				if err = signer.sign(w.Header(), body); err != nil {
+					GetLogger(r.Context()).Err("API wrapper: %+v", err)
 				}
+			}
 
-				b, _ := json.Marshal(apiErr)
-				w.Write(b)
-				return
+			w.WriteHeader(statusCode)
+			if len(body) != 0 {
+				w.Write(body)
 			}
 
-			w.WriteHeader(http.StatusOK)
+			Debug(WithFields(GetLogger(r.Context()), Fields{
+				"status":     statusCode,
+				"latency_ms": float64(time.Since(start)) / float64(time.Millisecond),
+			}), "API request processed")
+		})
+	}
+}
 
-			if seccess == nil {
-				return
-			}
+// contextErr converts an error caused by finished request context to APIError. Other errors returned
+// after the context is done are reported as they are.
+func contextErr(err error) (APIError, bool) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return GatewayTimeoutErr, true
+	}
+	if errors.Is(err, context.Canceled) {
+		return ClientClosedRequestErr, true
+	}
+	return APIError{}, false
+}
 
-			var body []byte
+// writeAPIError writes errors of middlewares which respond before the API handler. The error is signed like responses of the handler.
+func writeAPIError(w http.ResponseWriter, r *http.Request, apiErr APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	body := apiErrorBody(apiErr)
+	if signer, ok := r.Context().Value(contextSignerKey{}).(*responseSigner); ok {
+		if err := signer.sign(w.Header(), body); err != nil {
+			GetLogger(r.Context()).Err("API error writer: %+v", err)
+		}
+	}
+	w.WriteHeader(apiErr.StatusCode)
 
-			if body, ok = seccess.([]byte); !ok {
-				body, _ = json.Marshal(seccess)
-			}
-			w.Write(body)
-		})
+	if len(body) != 0 {
+		w.Write(body)
+	}
+}
+
+func apiErrorBody(apiErr APIError) []byte {
+	if apiErr == EntityNotFoundErr {
+		return nil
 	}
+
+	b, _ := json.Marshal(apiErr)
+	return b
 }
@@ -21,7 +21,7 @@ func TestWrapperAPIHandlerServeHTTP_SeccessStruct(t *testing.T) {
 	w := &thttp.TestResponseWriter{}
 	r := httptest.NewRequest(http.MethodGet, "/", nil)
 
-	wrap := wrapAPIHandler(l)(handler)
+	wrap := wrapAPIHandler(l, nil)(handler)
 	wrap.ServeHTTP(w, r)
 
 	assert.Equal(t, http.StatusOK, w.StatusCode)
@@ -37,7 +37,7 @@ func TestWrapperAPIHandlerServeHTTP_SeccessNil(t *testing.T) {
 	w := &thttp.TestResponseWriter{}
 	r := httptest.NewRequest(http.MethodGet, "/", nil)
 
-	wrap := wrapAPIHandler(l)(handler)
+	wrap := wrapAPIHandler(l, nil)(handler)
 	wrap.ServeHTTP(w, r)
 
 	assert.Equal(t, http.StatusOK, w.StatusCode)
@@ -53,7 +53,7 @@ func TestWrapperAPIHandlerServeHTTP_SeccessByte(t *testing.T) {
 	w := &thttp.TestResponseWriter{}
 	r := httptest.NewRequest(http.MethodGet, "/", nil)
 
-	wrap := wrapAPIHandler(l)(handler)
+	wrap := wrapAPIHandler(l, nil)(handler)
 	wrap.ServeHTTP(w, r)
 
 	assert.Equal(t, http.StatusOK, w.StatusCode)
@@ -74,7 +74,7 @@ func TestWrapperAPIHandlerServeHTTP_APIError(t *testing.T) {
 	w := &thttp.TestResponseWriter{}
 	r := httptest.NewRequest(http.MethodGet, "/", nil)
 
-	wrap := wrapAPIHandler(l)(handler)
+	wrap := wrapAPIHandler(l, nil)(handler)
 	wrap.ServeHTTP(w, r)
 
 	assert.Equal(t, statusCode, w.StatusCode)
@@ -91,7 +91,7 @@ func TestWrapperAPIHandlerServeHTTP_InternalErr(t *testing.T) {
 	w := &thttp.TestResponseWriter{}
 	r := httptest.NewRequest(http.MethodGet, "/", nil)
 
-	wrap := wrapAPIHandler(l)(handler)
+	wrap := wrapAPIHandler(l, nil)(handler)
 	wrap.ServeHTTP(w, r)
 
 	assert.Equal(t, http.StatusInternalServerError, w.StatusCode)
@@ -108,8 +108,131 @@ func TestWrapperAPIHandlerServeHTTP_InternalErr_LogIt(t *testing.T) {
 	w := &thttp.TestResponseWriter{}
 	r := httptest.NewRequest(http.MethodGet, "/", nil)
 
-	wrap := wrapAPIHandler(l)(handler)
+	wrap := wrapAPIHandler(l, nil)(handler)
 	wrap.ServeHTTP(w, r)
 
 	l.AssertExpectations(t)
 }
+
+func TestWrapperAPIHandlerServeHTTP_RequestIDHeader_SetContext(t *testing.T) {
+	var id string
+	handler := func(req *http.Request) (interface{}, error) {
+		id = GetRequestID(req.Context())
+		return nil, nil
+	}
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(RequestIDHeader, "1234")
+
+	wrapAPIHandler(new(fakeLogger), nil)(handler).ServeHTTP(w, r)
+
+	assert.Equal(t, "1234", id)
+}
+
+func TestWrapperAPIHandlerServeHTTP_RequestIDHeaderEmpty_Generate(t *testing.T) {
+	var id string
+	handler := func(req *http.Request) (interface{}, error) {
+		id = GetRequestID(req.Context())
+		return nil, nil
+	}
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	wrapAPIHandler(new(fakeLogger), nil)(handler).ServeHTTP(w, r)
+
+	assert.Len(t, id, 32)
+}
+
+func TestWrapperAPIHandlerServeHTTP_UpstreamSigned_PassThrough(t *testing.T) {
+	handler := func(req *http.Request) (interface{}, error) {
+		h := http.Header{}
+		h.Set(ResponseIDHeader, "response-id")
+		h.Set(ResponseSignHeader, "sign")
+		SetUpstreamResponse(req.Context(), h, []byte(`{ "id" : "1" }`))
+		return map[string]string{"id": "1"}, nil
+	}
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	wrapAPIHandler(new(fakeLogger), nil)(handler).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.StatusCode)
+	assert.Equal(t, `{ "id" : "1" }`, w.Output)
+	assert.Equal(t, "response-id", w.Header().Get(ResponseIDHeader))
+	assert.Equal(t, "sign", w.Header().Get(ResponseSignHeader))
+}
+
+func TestWrapperAPIHandlerServeHTTP_UpstreamNotSigned_MarshalResult(t *testing.T) {
+	handler := func(req *http.Request) (interface{}, error) {
+		SetUpstreamResponse(req.Context(), http.Header{}, []byte(`{ "id" : "1" }`))
+		return map[string]string{"id": "1"}, nil
+	}
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	wrapAPIHandler(new(fakeLogger), nil)(handler).ServeHTTP(w, r)
+
+	assert.Equal(t, `{"id":"1"}`, w.Output)
+	assert.Equal(t, "", w.Header().Get(ResponseSignHeader))
+}
+
+func TestWrapperAPIHandlerServeHTTP_ResponseHeader_SetHeader(t *testing.T) {
+	handler := func(req *http.Request) (interface{}, error) {
+		SetResponseHeader(req.Context(), "X-Test", "value")
+		return []byte("seccess"), nil
+	}
+	w := &thttp.TestResponseWriter{}
+
+	wrapAPIHandler(new(fakeLogger), nil)(handler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusOK, w.StatusCode)
+	assert.Equal(t, "value", w.Header().Get("X-Test"))
+}
+
+func TestWrapperAPIHandlerServeHTTP_UpstreamSignedOtherResult_MarshalResult(t *testing.T) {
+	handler := func(req *http.Request) (interface{}, error) {
+		h := http.Header{}
+		h.Set(ResponseIDHeader, "response-id")
+		h.Set(ResponseSignHeader, "sign")
+		SetUpstreamResponse(req.Context(), h, []byte(`{ "id" : "1" }`))
+		return map[string]string{"id": "2"}, nil
+	}
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	wrapAPIHandler(new(fakeLogger), nil)(handler).ServeHTTP(w, r)
+
+	assert.Equal(t, `{"id":"2"}`, w.Output)
+	assert.Equal(t, "", w.Header().Get(ResponseSignHeader))
+}
+
+func TestWrapperAPIHandlerServeHTTP_SeveralUpstreams_PassThroughResult(t *testing.T) {
+	handler := func(req *http.Request) (interface{}, error) {
+		for _, id := range []string{"1", "2"} {
+			h := http.Header{}
+			h.Set(ResponseSignHeader, "sign-"+id)
+			SetUpstreamResponse(req.Context(), h, []byte(`{ "id" : "`+id+`" }`))
+		}
+		return map[string]string{"id": "1"}, nil
+	}
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	wrapAPIHandler(new(fakeLogger), nil)(handler).ServeHTTP(w, r)
+
+	assert.Equal(t, `{ "id" : "1" }`, w.Output)
+	assert.Equal(t, "sign-1", w.Header().Get(ResponseSignHeader))
+}
+
+func TestWrapperAPIHandlerServeHTTP_RequestID_EchoHeader(t *testing.T) {
+	handler := func(req *http.Request) (interface{}, error) {
+		return nil, nil
+	}
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(RequestIDHeader, "1234")
+
+	wrapAPIHandler(new(fakeLogger), nil)(handler).ServeHTTP(w, r)
+
+	assert.Equal(t, "1234", w.Header().Get(RequestIDHeader))
+}
@@ -1,22 +1,74 @@
 package coreapi
 
 import (
+	"context"
 	"log"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/bmizerany/pat"
 	"github.com/namsral/flag"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	virgil "gopkg.in/virgil.v4"
 )
 
 var (
 	loggerType string
 	cacheType  string
+
+	rateLimitEnabled bool
+	rateLimitType    string
+	rateLimits       rateLimitConfig
+
+	trustedProxyHeader string
+
+	deadlines deadlineConfig
+
+	serviceKey         string
+	serviceKeyPassword string
+	serviceCard        string
+
+	accessLogEnabled bool
+	accessLogFormat  string
+	accessLogFile    string
+
+	tracing tracingConfig
+
+	configWatchInterval time.Duration
+)
+
+var (
+	rateLimitFlags = []string{"ratelimit-token-rate", "ratelimit-token-burst", "ratelimit-ip-rate", "ratelimit-ip-burst", "ratelimit-routes"}
+	deadlineFlags  = []string{"http-deadline", "http-route-deadlines"}
 )
 
 func init() {
 	flag.StringVar(&loggerType, "logger-type", "file", "Logger type")
 	flag.StringVar(&cacheType, "cache-type", "mem", "Cache type")
+
+	flag.BoolVar(&rateLimitEnabled, "ratelimit-enabled", false, "Enable rate limiting of API requests")
+	flag.StringVar(&rateLimitType, "ratelimit-type", "mem", "Rate limiter type")
+	rateLimits.define(flag.CommandLine)
+	flag.StringVar(&trustedProxyHeader, "trusted-proxy-header", "", "Header with client address set by the trusted reverse proxy, e.g. X-Forwarded-For (empty - address of the connection)")
+
+	deadlines.define(flag.CommandLine)
+
+	flag.StringVar(&serviceKey, "service-private-key", "", "Path to private key of the service. Responses are signed by the key (empty - responses are not signed)")
+	flag.StringVar(&serviceKeyPassword, "service-private-key-password", "", "Password of private key of the service")
+	flag.StringVar(&serviceCard, "service-card", "", "Path to card of the service (JSON), it is published on /service/card")
+
+	flag.BoolVar(&accessLogEnabled, "accesslog-enabled", false, "Enable HTTP access log")
+	flag.StringVar(&accessLogFormat, "accesslog-format", "common", "Format of access log (common, combined, json)")
+	flag.StringVar(&accessLogFile, "accesslog-file", "-", "Path to access log file ('-' - special parameter for console output)")
+
+	flag.StringVar(&tracing.Exporter, "tracing-exporter", "", "Exporter of trace spans (enum: otlp, file; empty - tracing is disabled)")
+	flag.StringVar(&tracing.OTLPEndpoint, "tracing-otlp-endpoint", "localhost:4318", "Address of OTLP/HTTP collector")
+	flag.BoolVar(&tracing.OTLPInsecure, "tracing-otlp-insecure", false, "Send spans to OTLP collector without TLS")
+	flag.StringVar(&tracing.File, "tracing-file", "-", "Path to file of file exporter ('-' - special parameter for console output)")
+	flag.Float64Var(&tracing.SampleRatio, "tracing-sample-ratio", 1, "Ratio of sampled traces which are not sampled by the client")
+
+	flag.DurationVar(&configWatchInterval, "config-watch-interval", 0, "Interval of checks of the config file for changes (0 - reload on SIGHUP only)")
 }
 
 func Init() Core {
@@ -28,6 +80,14 @@ func Init() Core {
 	if err != nil {
 		log.Fatalln("Core.init: Cannot create logger:", err)
 	}
+	// the logger isn't closed by close hooks, so errors of shutdown can be logged
+	closeLogger, err := runPlugin(context.Background(), "logger", l)
+	if err != nil {
+		log.Fatalln("Core.init: Cannot start logger:", err)
+	}
+	if closeLogger == nil {
+		closeLogger = func(ctx context.Context) error { return nil }
+	}
 
 	cacheF, ok := cachers[cacheType]
 	if !ok {
@@ -39,23 +99,211 @@ func Init() Core {
 		l.Err("Core.init: Cannot create cache: %+v", err)
 		os.Exit(-1)
 	}
+	// health check of the plugin replaces the probe check
+	RegisterHealthCheck("cache", cacheHealthCheck(cache))
+	if err = startPlugin(context.Background(), "cache", cache); err != nil {
+		l.Err("Core.init: Cannot start cache: %+v", err)
+		closeAll(context.Background())
+		os.Exit(-1)
+	}
+
+	cm := &cacheManager{
+		logger: l,
+		cache:  cache,
+	}
+
+	ts, err := loadTenants(tenantsFile, rateLimitEnabled)
+	if err != nil {
+		l.Err("Core.init: Cannot load tenants: %+v", err)
+		os.Exit(-1)
+	}
+	tenants.Set(ts)
+	RegisterReloadHook("tenants", []string{TenantsFlag}, func(v ReloadValues) (func(), error) {
+		return func() { tenants.Set(v.tenants) }, nil
+	})
+	tenant := tenantMiddleware(tenants)
+
+	rateLimit := noRateLimit
+	var takeLimit rateLimitFunc
+	if rateLimitEnabled {
+		limiterF, ok := rateLimiters[rateLimitType]
+		if !ok {
+			l.Err("Core.init: Rate limiter type (%s) are not registred", rateLimitType)
+			os.Exit(-1)
+		}
+		limiter, err := limiterF(cm)
+		if err != nil {
+			l.Err("Core.init: Cannot create rate limiter: %+v", err)
+			os.Exit(-1)
+		}
+		if err = startPlugin(context.Background(), "rate_limiter", limiter); err != nil {
+			l.Err("Core.init: Cannot start rate limiter: %+v", err)
+			closeAll(context.Background())
+			os.Exit(-1)
+		}
+		p, err := makeRateLimitPolicy(rateLimits, Tenants())
+		if err != nil {
+			l.Err("Core.init: Cannot parse rate limits: %+v", err)
+			os.Exit(-1)
+		}
+		policy := NewReloadable(p)
+		RegisterReloadHook("rate limits", append(rateLimitFlags, TenantsFlag), func(v ReloadValues) (func(), error) {
+			var c rateLimitConfig
+			if err := v.Flags.Parse(c.define); err != nil {
+				return nil, err
+			}
+			p, err := makeRateLimitPolicy(c, v.Tenants())
+			if err != nil {
+				return nil, err
+			}
+			return func() { policy.Set(p) }, nil
+		})
+		rateLimit = rateLimitMiddleware(limiter, policy, l)
+		takeLimit = takeRateLimit(limiter, policy, l)
+	}
+
+	dp, err := makeDeadlinePolicy(deadlines, Tenants())
+	if err != nil {
+		l.Err("Core.init: Cannot parse route deadlines: %+v", err)
+		os.Exit(-1)
+	}
+	deadlinePolicy := NewReloadable(dp)
+	RegisterReloadHook("deadlines", append(deadlineFlags, TenantsFlag), func(v ReloadValues) (func(), error) {
+		var c deadlineConfig
+		if err := v.Flags.Parse(c.define); err != nil {
+			return nil, err
+		}
+		p, err := makeDeadlinePolicy(c, v.Tenants())
+		if err != nil {
+			return nil, err
+		}
+		return func() { deadlinePolicy.Set(p) }, nil
+	})
 
+	var signer *responseSigner
 	router := pat.New()
 	router.Get("/service/metrics", promhttp.Handler())
+	if serviceKey != "" {
+		var card *virgil.CardResponse
+		signer, card, err = loadServiceKey(serviceKey, serviceKeyPassword, serviceCard)
+		if err != nil {
+			l.Err("Core.init: Cannot load service key: %+v", err)
+			os.Exit(-1)
+		}
+		if card != nil {
+			router.Get("/service/card", serviceCardHandler(card))
+		}
+		RegisterHealthCheck("service_key", serviceKeyHealthCheck(signer, card))
+	}
+
+	accessLog := func(next http.Handler) http.Handler { return next }
+	if accessLogEnabled {
+		out, err := openAccessLog(accessLogFile)
+		if err != nil {
+			l.Err("Core.init: Cannot open access log: %+v", err)
+			os.Exit(-1)
+		}
+		accessLog, err = accessLogMiddleware(out, accessLogFormat)
+		if err != nil {
+			l.Err("Core.init: Cannot create access log: %+v", err)
+			os.Exit(-1)
+		}
+		if f, ok := out.(*reopenableFile); ok {
+			go reopenAccessLogOnSignal(l, f)
+			RegisterCloseHook("access_log", func(ctx context.Context) error { return f.Close() })
+		}
+	}
+
+	shutdown, err := initTracing(tracing)
+	if err != nil {
+		l.Err("Core.init: Cannot init tracing: %+v", err)
+		os.Exit(-1)
+	}
+	RegisterCloseHook("tracing", shutdown)
+
+	wrap := wrapAPIHandler(l, signer)
+	signed := signerMiddleware(signer)
+	deadline := deadlineMiddleware(deadlinePolicy)
+	hop := hopMiddleware(InstanceID(), maxHops, chainHeader, l)
+	handle := func(route string, h APIHandler) http.Handler {
+		return routeMiddleware(route)(signed(traceMiddleware(route)(hop(tenant(rateLimit(route)(deadline(route)(wrap(h))))))))
+	}
+	stream := func(route string, h http.Handler) http.Handler {
+		return routeMiddleware(route)(traceMiddleware(route)(hop(h)))
+	}
+
+	api := &grpcAPI{
+		logger:    l,
+		tenants:   tenants,
+		rateLimit: takeLimit,
+		deadlines: deadlinePolicy,
+		self:      InstanceID(),
+		maxHops:   maxHops,
+		debug:     chainHeader,
+	}
+	grpcServer, err := newGRPCServer(api)
+	if err != nil {
+		l.Err("Core.init: Cannot create gRPC server: %+v", err)
+		os.Exit(-1)
+	}
+	httpT := &httpTransport{router: router, handle: handle, wrap: wrap}
+	grpcT := &grpcTransport{api: api, server: grpcServer}
+
+	go reloadOnChange(l, configWatchInterval)
 
 	app := Core{
 		Common: Common{
-			Logger: l,
-			Cache: &cacheManager{
-				logger: l,
-				cache:  cache,
-			},
+			Logger:      l,
+			Cache:       cm,
+			Shutdown:    closeAll,
+			CloseLogger: closeLogger,
 		},
 		HTTP: HTTP{
-			Router:         router,
-			WrapAPIHandler: wrapAPIHandler(l),
+			Handler:        router,
+			Mount:          httpT.mount,
+			WrapAPIHandler: wrap,
+			RateLimit:      rateLimit,
+			Deadline:       deadline,
+			Handle:         handle,
+			Stream:         stream,
+			AccessLog:      accessLog,
+			Metrics:        metricsMiddleware,
 		},
+		GRPC: GRPC{
+			Server: grpcServer,
+		},
+		Register: registerOperations(httpT, grpcT),
 	}
 
 	return app
 }
+
+// makeRateLimitPolicy creates policy from flags and overrides of tenants
+func makeRateLimitPolicy(c rateLimitConfig, tenants []*Tenant) (rateLimitPolicy, error) {
+	routes, err := parseRouteLimits(c.Routes)
+	if err != nil {
+		return rateLimitPolicy{}, err
+	}
+	p := rateLimitPolicy{Token: c.Token, IP: c.IP, Routes: routes, Tenants: make(map[string]rateLimitPolicy)}
+	for _, t := range tenants {
+		if p.Tenants[t.Name], err = tenantRateLimitPolicy(p, t); err != nil {
+			return rateLimitPolicy{}, err
+		}
+	}
+	return p, nil
+}
+
+// makeDeadlinePolicy creates policy from flags and overrides of tenants
+func makeDeadlinePolicy(c deadlineConfig, tenants []*Tenant) (deadlinePolicy, error) {
+	routes, err := parseRouteDeadlines(c.Routes)
+	if err != nil {
+		return deadlinePolicy{}, err
+	}
+	p := deadlinePolicy{Default: c.Default, Routes: routes, Tenants: make(map[string]deadlinePolicy)}
+	for _, t := range tenants {
+		if p.Tenants[t.Name], err = tenantDeadlinePolicy(p, t); err != nil {
+			return deadlinePolicy{}, err
+		}
+	}
+	return p, nil
+}
@@ -1,24 +1,47 @@
 package coreapi
 
 import (
+	"context"
 	"net/http"
+	"time"
 
-	"github.com/bmizerany/pat"
+	"google.golang.org/grpc"
 )
 
 type Core struct {
 	Common Common
 	HTTP   HTTP
+	GRPC   GRPC
+	// Register exposes operations on every API (HTTP, gRPC) with bindings of the operation
+	Register func(ops ...Operation) error
 }
 
 type Common struct {
 	Logger Logger
 	Cache  Cache
+	// Shutdown calls close hooks of modules and plugins
+	Shutdown func(ctx context.Context) error
+	// CloseLogger closes the logger. It's called after Shutdown, so errors of shutdown can be logged.
+	CloseLogger func(ctx context.Context) error
 }
 
 type HTTP struct {
 	WrapAPIHandler func(fun APIHandler) http.Handler
-	Router         *pat.PatternServeMux
+	RateLimit      func(route string) Middleware
+	Deadline       func(route string) Middleware
+	Handle         func(route string, h APIHandler) http.Handler
+	AccessLog      Middleware
+	Metrics        Middleware
+	// Stream applies middlewares of API which don't buffer or time out the response: route, tracing and hop check
+	Stream func(route string, h http.Handler) http.Handler
+	// Mount serves the handler as is, without middlewares of API (e.g. streams)
+	Mount func(method, path string, h http.Handler)
+	// Handler serves all routes of HTTP API
+	Handler http.Handler
+}
+
+type GRPC struct {
+	Server *grpc.Server
 }
 
 // API declaration
@@ -37,3 +60,9 @@ type Cache interface {
 	Set(key string, val interface{})
 	Del(key string)
 }
+
+// TTLCache sets entries with own TTL. Caches which don't support it use the configured TTL
+type TTLCache interface {
+	Cache
+	SetTTL(key string, val interface{}, ttl time.Duration)
+}
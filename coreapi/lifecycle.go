@@ -0,0 +1,61 @@
+package coreapi
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// Plugins (loggers, caches, rate limiters) may implement any of the lifecycle interfaces below.
+// Init starts plugins in order of creation, stops them in reverse order on shutdown
+// and adds their health to the readiness report.
+
+// Starter is implemented by plugins which run background work. Start is called once, right after the plugin is made.
+type Starter interface {
+	Start(ctx context.Context) error
+}
+
+// Stopper is implemented by plugins which must finish background work on shutdown. If a plugin implements
+// both Stopper and Closer only Stop is called.
+type Stopper interface {
+	Stop(ctx context.Context) error
+}
+
+// HealthChecker is implemented by plugins which depend on external resources (connections, files).
+type HealthChecker interface {
+	Health(ctx context.Context) error
+}
+
+// startPlugin starts the plugin and registers its stop and health hooks under the name
+func startPlugin(ctx context.Context, name string, plugin interface{}) error {
+	stop, err := runPlugin(ctx, name, plugin)
+	if err != nil {
+		return err
+	}
+	if stop != nil {
+		RegisterCloseHook(name, stop)
+	}
+	return nil
+}
+
+// runPlugin starts the plugin and registers its health hook under the name. It returns the stop hook of the plugin
+// (nil - the plugin has nothing to stop).
+func runPlugin(ctx context.Context, name string, plugin interface{}) (func(ctx context.Context) error, error) {
+	if s, ok := plugin.(Starter); ok {
+		if err := s.Start(ctx); err != nil {
+			return nil, errors.Wrapf(err, "Start %v", name)
+		}
+	}
+
+	if h, ok := plugin.(HealthChecker); ok {
+		RegisterHealthCheck(name, func(ctx context.Context) (interface{}, error) { return nil, h.Health(ctx) })
+	}
+
+	switch p := plugin.(type) {
+	case Stopper:
+		return p.Stop, nil
+	case Closer:
+		return func(ctx context.Context) error { return p.Close() }, nil
+	}
+	return nil, nil
+}
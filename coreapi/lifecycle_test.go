@@ -0,0 +1,110 @@
+package coreapi
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCloser struct {
+	closed bool
+}
+
+func (c *fakeCloser) Close() error {
+	c.closed = true
+	return nil
+}
+
+type fakePlugin struct {
+	fakeCloser
+	events    []string
+	startErr  error
+	healthErr error
+}
+
+func (p *fakePlugin) Start(ctx context.Context) error {
+	p.events = append(p.events, "start")
+	return p.startErr
+}
+
+func (p *fakePlugin) Stop(ctx context.Context) error {
+	p.events = append(p.events, "stop")
+	return nil
+}
+
+func (p *fakePlugin) Health(ctx context.Context) error {
+	return p.healthErr
+}
+
+func TestStartPlugin_Closer_ClosedOnShutdown(t *testing.T) {
+	defer resetCloseHooks()()
+	c := new(fakeCloser)
+
+	err := startPlugin(context.Background(), "plugin", c)
+	closeAll(context.Background())
+
+	assert.NoError(t, err)
+	assert.True(t, c.closed)
+}
+
+func TestStartPlugin_NoLifecycle_NothingRegistered(t *testing.T) {
+	defer resetCloseHooks()()
+	resetHealthChecks()
+
+	err := startPlugin(context.Background(), "plugin", "plugin")
+
+	assert.NoError(t, err)
+	assert.Len(t, closeHooks, 0)
+	assert.Len(t, healthChecks, 0)
+}
+
+func TestStartPlugin_Stopper_StartedAndStoppedNotClosed(t *testing.T) {
+	defer resetCloseHooks()()
+	p := new(fakePlugin)
+
+	err := startPlugin(context.Background(), "plugin", p)
+	closeAll(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"start", "stop"}, p.events)
+	assert.False(t, p.closed)
+}
+
+func TestStartPlugin_StartFailed_ReturnErr(t *testing.T) {
+	defer resetCloseHooks()()
+	p := &fakePlugin{startErr: fmt.Errorf("error")}
+
+	err := startPlugin(context.Background(), "plugin", p)
+
+	assert.EqualError(t, err, "Start plugin: error")
+	assert.Len(t, closeHooks, 0)
+}
+
+func TestStartPlugin_HealthChecker_AddedToReport(t *testing.T) {
+	defer resetCloseHooks()()
+	resetHealthChecks()
+	RegisterHealthCheck("plugin", func(ctx context.Context) (interface{}, error) { return nil, nil })
+	p := &fakePlugin{healthErr: fmt.Errorf("disconnected")}
+
+	startPlugin(context.Background(), "plugin", p)
+	report := CheckHealth(context.Background(), time.Second)
+
+	assert.Equal(t, HealthFail, report.Status)
+	assert.Equal(t, HealthStatus{Status: HealthFail, Error: "disconnected"}, report.Checks["plugin"])
+}
+
+func TestRunPlugin_Closer_ReturnHookNotRegistered(t *testing.T) {
+	defer resetCloseHooks()()
+	c := new(fakeCloser)
+
+	closeFunc, err := runPlugin(context.Background(), "logger", c)
+	closeAll(context.Background())
+
+	assert.NoError(t, err)
+	assert.False(t, c.closed)
+	assert.NoError(t, closeFunc(context.Background()))
+	assert.True(t, c.closed)
+}
@@ -0,0 +1,120 @@
+package coreapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DebugLogger is implemented by loggers which write debug records. It isn't a part of Logger
+// to keep existing loggers compatible.
+type DebugLogger interface {
+	Logger
+	Debug(format string, args ...interface{})
+}
+
+// Debug writes debug record if the logger supports them. Records of other loggers are dropped.
+func Debug(l Logger, format string, args ...interface{}) {
+	if dl, ok := l.(DebugLogger); ok {
+		dl.Debug(format, args...)
+	}
+}
+
+// Fields are key/value pairs attached to log records
+type Fields map[string]interface{}
+
+// FieldLogger is implemented by loggers which support structured fields
+type FieldLogger interface {
+	Logger
+	WithFields(fields Fields) Logger
+}
+
+// WithFields returns logger which adds fields to every record.
+// Loggers without structured fields support get the fields as a prefix of the message.
+func WithFields(l Logger, fields Fields) Logger {
+	if fl, ok := l.(FieldLogger); ok {
+		return fl.WithFields(fields)
+	}
+	return newPrefixLogger(l, fields)
+}
+
+type prefixLogger struct {
+	logger Logger
+	fields Fields
+	prefix string
+}
+
+func newPrefixLogger(l Logger, fields Fields) prefixLogger {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%v=%v", k, fields[k]))
+	}
+	prefix := "[" + strings.Join(pairs, " ") + "] "
+
+	return prefixLogger{
+		logger: l,
+		fields: fields,
+		prefix: strings.Replace(prefix, "%", "%%", -1),
+	}
+}
+
+func (l prefixLogger) WithFields(fields Fields) Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return newPrefixLogger(l.logger, merged)
+}
+
+func (l prefixLogger) Debug(format string, args ...interface{}) {
+	Debug(l.logger, l.prefix+format, args...)
+}
+func (l prefixLogger) Info(format string, args ...interface{}) {
+	l.logger.Info(l.prefix+format, args...)
+}
+func (l prefixLogger) Warn(format string, args ...interface{}) {
+	l.logger.Warn(l.prefix+format, args...)
+}
+func (l prefixLogger) Err(format string, args ...interface{}) {
+	l.logger.Err(l.prefix+format, args...)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(format string, args ...interface{}) {}
+func (nopLogger) Info(format string, args ...interface{})  {}
+func (nopLogger) Warn(format string, args ...interface{})  {}
+func (nopLogger) Err(format string, args ...interface{})   {}
+
+var contextLoggerKey contextKey = "logger"
+
+// GetLogger returns request scoped logger. It never returns nil
+func GetLogger(ctx context.Context) Logger {
+	l, ok := ctx.Value(contextLoggerKey).(Logger)
+	if !ok {
+		return nopLogger{}
+	}
+	return l
+}
+
+func SetLogger(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, contextLoggerKey, l)
+}
+
+// HashToken returns short hash of access token which is safe to write to logs
+func HashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:8])
+}
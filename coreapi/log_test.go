@@ -0,0 +1,92 @@
+package coreapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordLogger struct {
+	records []string
+}
+
+func (l *recordLogger) Debug(format string, args ...interface{}) {
+	l.records = append(l.records, "debug: "+fmt.Sprintf(format, args...))
+}
+func (l *recordLogger) Info(format string, args ...interface{}) {
+	l.records = append(l.records, "info: "+fmt.Sprintf(format, args...))
+}
+func (l *recordLogger) Warn(format string, args ...interface{}) {
+	l.records = append(l.records, "warn: "+fmt.Sprintf(format, args...))
+}
+func (l *recordLogger) Err(format string, args ...interface{}) {
+	l.records = append(l.records, "err: "+fmt.Sprintf(format, args...))
+}
+
+func TestWithFields_PlainLogger_PrefixSortedFields(t *testing.T) {
+	l := new(recordLogger)
+	WithFields(l, Fields{"route": "get_card", "id": "100%"}).Info("msg %v", 1)
+
+	assert.Equal(t, []string{"info: [id=100% route=get_card] msg 1"}, l.records)
+}
+
+func TestWithFields_Nested_MergeFields(t *testing.T) {
+	l := new(recordLogger)
+	fl := WithFields(l, Fields{"a": 1, "b": 2})
+	WithFields(fl, Fields{"b": 3}).Err("msg")
+
+	assert.Equal(t, []string{"err: [a=1 b=3] msg"}, l.records)
+}
+
+func TestGetLogger_NotSet_ReturnNopLogger(t *testing.T) {
+	l := GetLogger(context.Background())
+	assert.NotNil(t, l)
+	l.Err("should not panic")
+}
+
+func TestHashToken_DoesNotContainToken(t *testing.T) {
+	h := HashToken("secret-token")
+	assert.Len(t, h, 16)
+	assert.NotContains(t, h, "secret-token")
+	assert.Equal(t, h, HashToken("secret-token"))
+}
+
+func TestWrapAPIHandler_RequestLogger_ContainsRequestIDAndRoute(t *testing.T) {
+	l := new(recordLogger)
+	handler := func(req *http.Request) (interface{}, error) {
+		GetLogger(req.Context()).Info("inside")
+		return nil, nil
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+
+	routeMiddleware("get_card")(wrapAPIHandler(l, nil)(handler)).ServeHTTP(w, r)
+
+	assert.Equal(t, "info: [request_id=req-1 route=get_card] inside", l.records[0])
+	assert.Contains(t, l.records[1], "debug: [latency_ms=")
+	assert.Contains(t, l.records[1], "request_id=req-1 route=get_card status=200] API request processed")
+}
+
+type infoLogger struct {
+	records []string
+}
+
+func (l *infoLogger) Info(format string, args ...interface{}) {
+	l.records = append(l.records, "info: "+fmt.Sprintf(format, args...))
+}
+func (l *infoLogger) Warn(format string, args ...interface{}) {}
+func (l *infoLogger) Err(format string, args ...interface{})  {}
+
+func TestDebug_LoggerWithoutDebug_RecordDropped(t *testing.T) {
+	l := new(infoLogger)
+	fl := WithFields(l, Fields{"route": "get_card"})
+	Debug(fl, "dropped")
+	fl.Info("kept")
+
+	assert.Equal(t, []string{"info: [route=get_card] kept"}, l.records)
+}
@@ -0,0 +1,73 @@
+package coreapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// routeOther is route label of requests which are not handled by API routes (metrics, health checks, not found)
+// and method label of non-standard methods
+const routeOther = "other"
+
+var httpDurationMetric = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:      "request_duration_seconds",
+	Subsystem: "http",
+	Namespace: "virgild",
+	Help:      "HTTP request latency in seconds by route, method and status code",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"route", "method", "status"})
+
+var grpcDurationMetric = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:      "request_duration_seconds",
+	Subsystem: "grpc",
+	Namespace: "virgild",
+	Help:      "gRPC call latency in seconds by route and status code",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"route", "code"})
+
+// metricMethods are methods which are used as method label, other methods are labeled "other" (a client could
+// create a time series per arbitrary method)
+var metricMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+func init() {
+	prometheus.MustRegister(httpDurationMetric, grpcDurationMetric)
+}
+
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r, entry := withAccessEntry(r)
+		sw := &statusWriter{ResponseWriter: w}
+
+		next.ServeHTTP(sw, r)
+
+		entry.Lock()
+		route := entry.route
+		entry.Unlock()
+		if route == "" {
+			route = routeOther
+		}
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		method := r.Method
+		if !metricMethods[method] {
+			method = routeOther
+		}
+		httpDurationMetric.WithLabelValues(route, method, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	})
+}
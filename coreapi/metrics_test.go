@@ -0,0 +1,50 @@
+package coreapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleCount(o prometheus.Observer) uint64 {
+	m := new(dto.Metric)
+	o.(prometheus.Metric).Write(m)
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestMetricsMiddleware_APIRoute_ObserveRouteAndStatus(t *testing.T) {
+	handler := func(req *http.Request) (interface{}, error) {
+		return nil, TooManyRequestsErr
+	}
+	h := metricsMiddleware(routeMiddleware("metrics_test")(wrapAPIHandler(new(fakeLogger), nil)(handler)))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+
+	assert.Equal(t, uint64(1), sampleCount(httpDurationMetric.WithLabelValues("metrics_test", http.MethodPost, "429")))
+}
+
+func TestMetricsMiddleware_NotAPIRoute_ObserveOther(t *testing.T) {
+	before := sampleCount(httpDurationMetric.WithLabelValues(routeOther, http.MethodGet, "200"))
+	h := metricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health/status", nil))
+
+	assert.Equal(t, before+1, sampleCount(httpDurationMetric.WithLabelValues(routeOther, http.MethodGet, "200")))
+}
+
+func TestMetricsMiddleware_NonStandardMethod_ObserveOther(t *testing.T) {
+	before := sampleCount(httpDurationMetric.WithLabelValues(routeOther, routeOther, "200"))
+	h := metricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("RANDOM123", "/", nil))
+
+	assert.Equal(t, before+1, sampleCount(httpDurationMetric.WithLabelValues(routeOther, routeOther, "200")))
+}
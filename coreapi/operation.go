@@ -0,0 +1,156 @@
+package coreapi
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// OperationHandler processes a request decoded by a transport. The response is encoded by the transport.
+type OperationHandler func(ctx context.Context, req interface{}) (interface{}, error)
+
+// Operation is an API operation independent of transports. Name is the route of the operation:
+// rate limits, deadlines, metrics and logs of all transports use it.
+type Operation struct {
+	Name    string
+	Handler OperationHandler
+	// Plain operations (e.g. probes) are served without tenants, rate limits, deadlines and hop checks
+	Plain bool
+	HTTP  []HTTPBinding
+	GRPC  *GRPCBinding
+}
+
+// HTTPBinding exposes the operation on the path of HTTP API. Parameters of the path are got by PathParam.
+type HTTPBinding struct {
+	Method string
+	Path   string
+	// Decode reads the request of the operation (nil - the operation gets nil request)
+	Decode func(r *http.Request) (interface{}, error)
+	// Encode returns status code and body of successful response (nil - 200 with the response as JSON).
+	// Body of []byte type is sent as is.
+	Encode func(resp interface{}) (statusCode int, body interface{})
+}
+
+// GRPCBinding exposes the operation as a method of gRPC service. Messages are generated protobuf messages.
+type GRPCBinding struct {
+	// Service is the full name of the service (package.Service)
+	Service string
+	Method  string
+	// New returns an empty request message
+	New func() interface{}
+	// Decode converts the request message to the request of the operation (nil - the message is passed as is)
+	Decode func(msg interface{}) (interface{}, error)
+	// Encode converts result of the operation to the response message. Errors are converted to statuses
+	// by the transport.
+	Encode func(resp interface{}, err error) (interface{}, error)
+	// Stream sends the response as server stream. Methods with Stream are server streaming, Encode isn't used.
+	// ctx is the context of the call returned by Prepare.
+	Stream func(ctx context.Context, resp interface{}, send func(msg interface{}) error) error
+	// Prepare returns context of the call of the streaming method, so the handler may send results before it returns
+	// (nil - results are sent by Stream only)
+	Prepare func(ctx context.Context, send func(msg interface{}) error) context.Context
+}
+
+// PathParam returns parameter of the path pattern of HTTPBinding (e.g. id of /v4/card/:id)
+func PathParam(r *http.Request, name string) string {
+	return r.URL.Query().Get(":" + name)
+}
+
+type contextAuthorizationKey struct{}
+
+// SetAuthorization puts the Authorization header (authorization metadata of gRPC) to the context
+func SetAuthorization(ctx context.Context, auth string) context.Context {
+	return context.WithValue(ctx, contextAuthorizationKey{}, auth)
+}
+
+// GetAuthorization returns the Authorization header of the request
+func GetAuthorization(ctx context.Context) string {
+	auth, _ := ctx.Value(contextAuthorizationKey{}).(string)
+	return auth
+}
+
+// transport exposes operations on one kind of API
+type transport interface {
+	register(ops []Operation) error
+}
+
+// registerOperations registers operations on every transport
+func registerOperations(transports ...transport) func(ops ...Operation) error {
+	return func(ops ...Operation) error {
+		for _, op := range ops {
+			if op.Name == "" || op.Handler == nil {
+				return errors.Errorf("operation %q: name and handler are required", op.Name)
+			}
+		}
+		for _, t := range transports {
+			if err := t.register(ops); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// httpResponse is a successful response with own status code
+type httpResponse struct {
+	statusCode int
+	body       interface{}
+}
+
+// httpTransport serves operations by the router of HTTP API. Operations get the same middlewares
+// as handlers created by HTTP.Handle.
+type httpTransport struct {
+	router interface {
+		Get(path string, h http.Handler)
+		Add(method, path string, h http.Handler)
+	}
+	handle func(route string, h APIHandler) http.Handler
+	wrap   func(fun APIHandler) http.Handler
+}
+
+func (t *httpTransport) register(ops []Operation) error {
+	for _, op := range ops {
+		for _, b := range op.HTTP {
+			if b.Method == "" || b.Path == "" {
+				return errors.Errorf("operation %s: method and path of HTTP binding are required", op.Name)
+			}
+			h := httpOperation(op.Handler, b)
+			if op.Plain {
+				t.mount(b.Method, b.Path, routeMiddleware(op.Name)(t.wrap(h)))
+			} else {
+				t.mount(b.Method, b.Path, t.handle(op.Name, h))
+			}
+		}
+	}
+	return nil
+}
+
+// mount serves the handler on the path. GET handlers serve HEAD requests as well.
+func (t *httpTransport) mount(method, path string, h http.Handler) {
+	if method == http.MethodGet {
+		t.router.Get(path, h)
+		return
+	}
+	t.router.Add(method, path, h)
+}
+
+func httpOperation(h OperationHandler, b HTTPBinding) APIHandler {
+	return func(r *http.Request) (interface{}, error) {
+		var (
+			req interface{}
+			err error
+		)
+		if b.Decode != nil {
+			if req, err = b.Decode(r); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := h(SetAuthorization(r.Context(), r.Header.Get("Authorization")), req)
+		if err != nil || b.Encode == nil {
+			return resp, err
+		}
+		statusCode, body := b.Encode(resp)
+		return httpResponse{statusCode: statusCode, body: body}, nil
+	}
+}
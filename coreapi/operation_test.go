@@ -0,0 +1,303 @@
+package coreapi
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type fakeRouter map[string]http.Handler
+
+func (r fakeRouter) Get(path string, h http.Handler) {
+	r["GET "+path] = h
+	r["HEAD "+path] = h
+}
+
+func (r fakeRouter) Add(method, path string, h http.Handler) {
+	r[method+" "+path] = h
+}
+
+func makeHTTPTransport(router fakeRouter) *httpTransport {
+	wrap := wrapAPIHandler(new(fakeLogger), nil)
+	return &httpTransport{
+		router: router,
+		handle: func(route string, h APIHandler) http.Handler { return routeMiddleware(route)(wrap(h)) },
+		wrap:   wrap,
+	}
+}
+
+func TestHTTPOperation_Decode_CallHandlerWithAuthorization(t *testing.T) {
+	var auth, id interface{}
+	h := httpOperation(func(ctx context.Context, req interface{}) (interface{}, error) {
+		auth, id = GetAuthorization(ctx), req
+		return "resp", nil
+	}, HTTPBinding{Decode: func(r *http.Request) (interface{}, error) { return PathParam(r, "id"), nil }})
+	r := httptest.NewRequest(http.MethodGet, "/?:id=card-1", nil)
+	r.Header.Set("Authorization", "VIRGIL token")
+
+	resp, err := h(r)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "resp", resp)
+	assert.Equal(t, "VIRGIL token", auth)
+	assert.Equal(t, "card-1", id)
+}
+
+func TestHTTPOperation_DecodeErr_ReturnErr(t *testing.T) {
+	h := httpOperation(func(ctx context.Context, req interface{}) (interface{}, error) {
+		t.Fatal("handler is called")
+		return nil, nil
+	}, HTTPBinding{Decode: func(r *http.Request) (interface{}, error) { return nil, TooManyRequestsErr }})
+
+	_, err := h(httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, TooManyRequestsErr, err)
+}
+
+func TestHTTPOperation_HandlerErr_ReturnErr(t *testing.T) {
+	h := httpOperation(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errors.New("ERROR")
+	}, HTTPBinding{Encode: func(resp interface{}) (int, interface{}) { return http.StatusOK, []byte("{}") }})
+
+	_, err := h(httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.EqualError(t, err, "ERROR")
+}
+
+func TestHTTPTransport_Encode_WriteStatusAndBody(t *testing.T) {
+	router := fakeRouter{}
+	err := makeHTTPTransport(router).register([]Operation{{
+		Name: "ready",
+		Handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+			return map[string]string{"status": "fail"}, nil
+		},
+		HTTP: []HTTPBinding{{
+			Method: http.MethodGet,
+			Path:   "/ready",
+			Encode: func(resp interface{}) (int, interface{}) { return http.StatusServiceUnavailable, resp },
+		}},
+	}})
+	assert.Nil(t, err)
+	w := httptest.NewRecorder()
+
+	router["HEAD /ready"].ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/ready", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"status":"fail"}`, w.Body.String())
+}
+
+func TestHTTPTransport_Operation_MountByMethod(t *testing.T) {
+	router := fakeRouter{}
+	h := func(ctx context.Context, req interface{}) (interface{}, error) { return GetRoute(ctx), nil }
+
+	err := makeHTTPTransport(router).register([]Operation{{
+		Name:    "create",
+		Handler: h,
+		HTTP:    []HTTPBinding{{Method: http.MethodPost, Path: "/v1/item"}, {Method: http.MethodPost, Path: "/v2/item"}},
+	}})
+	assert.Nil(t, err)
+	w := httptest.NewRecorder()
+	router["POST /v2/item"].ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v2/item", nil))
+
+	assert.Len(t, router, 2)
+	assert.Equal(t, `"create"`, w.Body.String())
+}
+
+func TestRegisterOperations_NoHandler_ReturnErr(t *testing.T) {
+	router := fakeRouter{}
+
+	err := registerOperations(makeHTTPTransport(router))(Operation{Name: "op", HTTP: []HTTPBinding{{Method: http.MethodGet, Path: "/op"}}})
+
+	assert.Error(t, err)
+	assert.Empty(t, router)
+}
+
+var (
+	testCheck = &GRPCBinding{
+		Service: healthpb.Health_ServiceDesc.ServiceName,
+		Method:  "Check",
+		New:     func() interface{} { return new(healthpb.HealthCheckRequest) },
+		Decode: func(msg interface{}) (interface{}, error) {
+			return msg.(*healthpb.HealthCheckRequest).GetService(), nil
+		},
+		Encode: func(resp interface{}, err error) (interface{}, error) {
+			if err != nil {
+				return nil, err
+			}
+			return &healthpb.HealthCheckResponse{Status: resp.(healthpb.HealthCheckResponse_ServingStatus)}, nil
+		},
+	}
+	testWatch = &GRPCBinding{
+		Service: healthpb.Health_ServiceDesc.ServiceName,
+		Method:  "Watch",
+		New:     func() interface{} { return new(healthpb.HealthCheckRequest) },
+		Stream: func(ctx context.Context, resp interface{}, send func(msg interface{}) error) error {
+			for _, s := range resp.([]healthpb.HealthCheckResponse_ServingStatus) {
+				if err := send(&healthpb.HealthCheckResponse{Status: s}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+)
+
+func dialOperations(t *testing.T, a *grpcAPI, ops ...Operation) (healthpb.HealthClient, func()) {
+	s := grpc.NewServer(grpc.UnaryInterceptor(a.unary), grpc.StreamInterceptor(a.stream))
+	assert.Nil(t, (&grpcTransport{api: a, server: s}).register(ops))
+	ln := bufconn.Listen(1024 * 1024)
+	go s.Serve(ln)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	return healthpb.NewHealthClient(conn), func() {
+		conn.Close()
+		s.Stop()
+	}
+}
+
+func TestGRPCTransport_Unary_CallWithRouteAndAuthorization(t *testing.T) {
+	var route, auth, service string
+	c, stop := dialOperations(t, makeGRPCAPI(new(fakeLogger)), Operation{
+		Name: "check",
+		Handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+			route, auth, service = GetRoute(ctx), GetAuthorization(ctx), req.(string)
+			return healthpb.HealthCheckResponse_SERVING, nil
+		},
+		GRPC: testCheck,
+	})
+	defer stop()
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "VIRGIL token")
+
+	resp, err := c.Check(ctx, &healthpb.HealthCheckRequest{Service: "cards"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+	assert.Equal(t, "check", route)
+	assert.Equal(t, "VIRGIL token", auth)
+	assert.Equal(t, "cards", service)
+}
+
+func TestGRPCTransport_APIError_ReturnStatus(t *testing.T) {
+	c, stop := dialOperations(t, makeGRPCAPI(new(fakeLogger)), Operation{
+		Name:    "check",
+		Handler: func(ctx context.Context, req interface{}) (interface{}, error) { return nil, EntityNotFoundErr },
+		GRPC:    testCheck,
+	})
+	defer stop()
+
+	_, err := c.Check(context.Background(), &healthpb.HealthCheckRequest{})
+
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGRPCTransport_PlainAPIError_ReturnStatus(t *testing.T) {
+	var route string
+	c, stop := dialOperations(t, makeGRPCAPI(new(fakeLogger)), Operation{
+		Name:  "check",
+		Plain: true,
+		Handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+			route = GetRoute(ctx)
+			return nil, EntityNotFoundErr
+		},
+		GRPC: testCheck,
+	})
+	defer stop()
+
+	_, err := c.Check(context.Background(), &healthpb.HealthCheckRequest{})
+
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Empty(t, route)
+}
+
+func TestGRPCTransport_Stream_SendMessages(t *testing.T) {
+	var route string
+	c, stop := dialOperations(t, makeGRPCAPI(new(fakeLogger)), Operation{
+		Name: "watch",
+		Handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+			route = GetRoute(ctx)
+			return []healthpb.HealthCheckResponse_ServingStatus{healthpb.HealthCheckResponse_NOT_SERVING, healthpb.HealthCheckResponse_SERVING}, nil
+		},
+		GRPC: testWatch,
+	})
+	defer stop()
+
+	stream, err := c.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Nil(t, err)
+	var statuses []healthpb.HealthCheckResponse_ServingStatus
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		statuses = append(statuses, resp.GetStatus())
+	}
+
+	assert.Equal(t, []healthpb.HealthCheckResponse_ServingStatus{healthpb.HealthCheckResponse_NOT_SERVING, healthpb.HealthCheckResponse_SERVING}, statuses)
+	assert.Equal(t, "watch", route)
+}
+
+type testSendKey struct{}
+
+func TestGRPCTransport_StreamPrepare_SendBeforeReturn(t *testing.T) {
+	received := make(chan struct{})
+	watch := *testWatch
+	watch.Prepare = func(ctx context.Context, send func(msg interface{}) error) context.Context {
+		return context.WithValue(ctx, testSendKey{}, send)
+	}
+	c, stop := dialOperations(t, makeGRPCAPI(new(fakeLogger)), Operation{
+		Name: "watch",
+		Handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+			send := ctx.Value(testSendKey{}).(func(msg interface{}) error)
+			if err := send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}); err != nil {
+				return nil, err
+			}
+			<-received
+			return []healthpb.HealthCheckResponse_ServingStatus{healthpb.HealthCheckResponse_SERVING}, nil
+		},
+		GRPC: &watch,
+	})
+	defer stop()
+
+	stream, err := c.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Nil(t, err)
+	first, err := stream.Recv()
+	assert.Nil(t, err)
+	close(received)
+	second, err := stream.Recv()
+	assert.Nil(t, err)
+
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, first.GetStatus())
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, second.GetStatus())
+}
+
+func TestGRPCTransport_ServiceRegistered_ReturnErr(t *testing.T) {
+	a := makeGRPCAPI(new(fakeLogger))
+	tr := &grpcTransport{api: a, server: grpc.NewServer()}
+	op := Operation{
+		Name:    "check",
+		Handler: func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil },
+		GRPC:    testCheck,
+	}
+	assert.Nil(t, tr.register([]Operation{op}))
+
+	err := tr.register([]Operation{op})
+
+	assert.Error(t, err)
+}
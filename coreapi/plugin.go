@@ -1,13 +1,17 @@
 package coreapi
 
+import "time"
+
 var (
-	loggers map[string]func() (Logger, error)
-	cachers map[string]func() (RawCache, error)
+	loggers      map[string]func() (Logger, error)
+	cachers      map[string]func() (RawCache, error)
+	rateLimiters map[string]func(cache Cache) (RateLimiter, error)
 )
 
 func init() {
 	loggers = make(map[string]func() (Logger, error))
 	cachers = make(map[string]func() (RawCache, error))
+	rateLimiters = make(map[string]func(cache Cache) (RateLimiter, error))
 }
 
 func RegisterLogger(key string, makeF func() (Logger, error)) {
@@ -18,8 +22,32 @@ func RegisterCache(key string, makeF func() (RawCache, error)) {
 	cachers[key] = makeF
 }
 
+// RegisterRateLimiter registers rate limiter backend. The factory receives configured cache so backends can share state between instances
+func RegisterRateLimiter(key string, makeF func(cache Cache) (RateLimiter, error)) {
+	rateLimiters[key] = makeF
+}
+
 type RawCache interface {
 	Get(key string, val interface{}) (bool, error)
 	Set(key string, val interface{}) error
 	Del(key string) error
 }
+
+// CheckedCache reports errors of the cache backend. The cache given to rate limiters implements it.
+type CheckedCache interface {
+	GetChecked(key string, val interface{}) (bool, error)
+	SetChecked(key string, val interface{}) error
+	// SetTTLChecked sets the entry with own TTL, caches which don't support it use the configured TTL
+	SetTTLChecked(key string, val interface{}, ttl time.Duration) error
+}
+
+// RawCacheTTL is implemented by caches which support own TTL of entries
+type RawCacheTTL interface {
+	SetTTL(key string, val interface{}, ttl time.Duration) error
+}
+
+type RateLimiter interface {
+	// Take removes one token from the bucket identified by key.
+	// If the bucket is empty it returns false and the time after which a token becomes available.
+	Take(key string, limit Limit) (bool, time.Duration, error)
+}
@@ -0,0 +1,254 @@
+package coreapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+)
+
+const (
+	limitByToken = "token"
+	limitByIP    = "ip"
+)
+
+// quotaRoute is used in keys of buckets of tenant quotas, the quota is shared by all routes
+const quotaRoute = "*"
+
+// Limit describes a token bucket: Rate tokens are added per second up to Burst tokens
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Unlimited returns true if the limit must not be applied
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+// Bucket is a state of token bucket. It is exported so rate limiter plugins can keep it in any storage
+type Bucket struct {
+	Tokens float64   `json:"tokens"`
+	Last   time.Time `json:"last"`
+}
+
+// Take refills the bucket for the time elapsed since the last call and removes one token.
+// If the bucket is empty it returns false and the duration after which a token becomes available.
+func (b *Bucket) Take(now time.Time, limit Limit) (bool, time.Duration) {
+	burst := math.Max(float64(limit.Burst), 1)
+	if b.Last.IsZero() {
+		b.Tokens = burst
+	} else if elapsed := now.Sub(b.Last).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(burst, b.Tokens+elapsed*limit.Rate)
+	}
+	b.Last = now
+
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return true, 0
+	}
+	wait := (1 - b.Tokens) / limit.Rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// Refill returns duration after which the bucket is full again, so it's equal to a new one and may be removed
+func (b Bucket) Refill(limit Limit) time.Duration {
+	burst := math.Max(float64(limit.Burst), 1)
+	if limit.Rate <= 0 || b.Tokens >= burst {
+		return 0
+	}
+	return time.Duration((burst - b.Tokens) / limit.Rate * float64(time.Second))
+}
+
+type rateLimitPolicy struct {
+	Token  Limit
+	IP     Limit
+	Routes map[string]map[string]Limit
+	// Quota limits all requests of the tenant, it's set in policies of tenants only
+	Quota Limit
+	// Tenants are policies of tenants by name
+	Tenants map[string]rateLimitPolicy
+}
+
+// tenant returns policy of the tenant of the request
+func (p rateLimitPolicy) tenant(t *Tenant) rateLimitPolicy {
+	if t == nil {
+		return p
+	}
+	if tp, ok := p.Tenants[t.Name]; ok {
+		return tp
+	}
+	return p
+}
+
+// Current makes static policy a source of policies
+func (p rateLimitPolicy) Current() rateLimitPolicy {
+	return p
+}
+
+type rateLimitPolicySource interface {
+	Current() rateLimitPolicy
+}
+
+type rateLimitConfig struct {
+	Token  Limit
+	IP     Limit
+	Routes string
+}
+
+func (c *rateLimitConfig) define(fs *flag.FlagSet) {
+	fs.Float64Var(&c.Token.Rate, "ratelimit-token-rate", 10, "Requests per second allowed for one access token (0 - unlimited)")
+	fs.IntVar(&c.Token.Burst, "ratelimit-token-burst", 20, "Burst of requests allowed for one access token")
+	fs.Float64Var(&c.IP.Rate, "ratelimit-ip-rate", 20, "Requests per second allowed for one IP address (0 - unlimited)")
+	fs.IntVar(&c.IP.Burst, "ratelimit-ip-burst", 40, "Burst of requests allowed for one IP address")
+	fs.StringVar(&c.Routes, "ratelimit-routes", "", "Per route limits in format route:kind=rate/burst separated by comma (kind: token, ip)")
+}
+
+func (p rateLimitPolicy) limit(route, kind string) Limit {
+	if l, ok := p.Routes[route][kind]; ok {
+		return l
+	}
+	if kind == limitByToken {
+		return p.Token
+	}
+	return p.IP
+}
+
+// parseRouteLimits parses overrides in format route:kind=rate/burst[,route:kind=rate/burst...]
+func parseRouteLimits(s string) (map[string]map[string]Limit, error) {
+	routes := make(map[string]map[string]Limit)
+	if strings.TrimSpace(s) == "" {
+		return routes, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("route limit (%v) must be in format route:kind=rate/burst", item)
+		}
+		rk := strings.SplitN(kv[0], ":", 2)
+		if len(rk) != 2 || (rk[1] != limitByToken && rk[1] != limitByIP) {
+			return nil, fmt.Errorf("route limit (%v) must be in format route:kind=rate/burst where kind is %v or %v", item, limitByToken, limitByIP)
+		}
+		rb := strings.SplitN(kv[1], "/", 2)
+		if len(rb) != 2 {
+			return nil, fmt.Errorf("route limit (%v) must be in format route:kind=rate/burst", item)
+		}
+		rate, err := strconv.ParseFloat(rb[0], 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "route limit (%v) has invalid rate", item)
+		}
+		burst, err := strconv.Atoi(rb[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "route limit (%v) has invalid burst", item)
+		}
+		if routes[rk[0]] == nil {
+			routes[rk[0]] = make(map[string]Limit)
+		}
+		routes[rk[0]][rk[1]] = Limit{Rate: rate, Burst: burst}
+	}
+	return routes, nil
+}
+
+func noRateLimit(route string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return next
+	}
+}
+
+// rateLimitFunc takes tokens of the request from buckets of the route. It returns time to wait if the request is not allowed.
+type rateLimitFunc func(ctx context.Context, route, ip, auth string) (bool, time.Duration)
+
+func rateLimitMiddleware(limiter RateLimiter, policies rateLimitPolicySource, logger Logger) func(route string) Middleware {
+	return rateLimitHTTP(takeRateLimit(limiter, policies, logger))
+}
+
+func rateLimitHTTP(take rateLimitFunc) func(route string) Middleware {
+	return func(route string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if allow, wait := take(r.Context(), route, remoteIP(r), r.Header.Get("Authorization")); !allow {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+					writeAPIError(w, r, TooManyRequestsErr)
+					return
+				}
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+}
+
+func takeRateLimit(limiter RateLimiter, policies rateLimitPolicySource, logger Logger) rateLimitFunc {
+	return func(ctx context.Context, route, ip, auth string) (bool, time.Duration) {
+		keys := map[string]string{
+			limitByIP: ip,
+		}
+		if auth != "" {
+			h := sha256.Sum256([]byte(auth))
+			keys[limitByToken] = hex.EncodeToString(h[:])
+		}
+
+		tenant := GetTenant(ctx)
+		policy := policies.Current().tenant(tenant)
+		type bucket struct {
+			key   string
+			limit Limit
+		}
+		// the narrowest bucket is taken first, so requests rejected by IP don't consume shared buckets
+		var buckets []bucket
+		for _, kind := range []string{limitByIP, limitByToken} {
+			if id, ok := keys[kind]; ok {
+				buckets = append(buckets, bucket{fmt.Sprintf("ratelimit_%v_%v_%v", route, kind, id), policy.limit(route, kind)})
+			}
+		}
+		if tenant != nil && !policy.Quota.Unlimited() {
+			buckets = append(buckets, bucket{fmt.Sprintf("ratelimit_%v_tenant_%v", quotaRoute, tenant.Name), policy.Quota})
+		}
+
+		for _, b := range buckets {
+			if b.limit.Unlimited() {
+				continue
+			}
+
+			allow, wait, err := limiter.Take(b.key, b.limit)
+			if err != nil {
+				logger.Err("Rate limit: %+v", err)
+				continue
+			}
+			if !allow {
+				return false, wait
+			}
+		}
+		return true, 0
+	}
+}
+
+// remoteIP returns address of the client. Behind a proxy it is taken from the configured header of the trusted proxy.
+func remoteIP(r *http.Request) string {
+	if trustedProxyHeader != "" {
+		if ip := forwardedIP(r.Header.Get(trustedProxyHeader)); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// forwardedIP returns the last address of the header. The trusted proxy appends the address of its client,
+// preceding addresses are set by clients and can be forged.
+func forwardedIP(header string) string {
+	items := strings.Split(header, ",")
+	return strings.TrimSpace(items[len(items)-1])
+}
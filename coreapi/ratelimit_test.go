@@ -0,0 +1,177 @@
+package coreapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	thttp "github.com/stretchr/testify/http"
+	"github.com/stretchr/testify/mock"
+)
+
+type fakeRateLimiter struct {
+	mock.Mock
+}
+
+func (f *fakeRateLimiter) Take(key string, limit Limit) (bool, time.Duration, error) {
+	args := f.Called(key, limit)
+	return args.Bool(0), args.Get(1).(time.Duration), args.Error(2)
+}
+
+func TestBucketTake_FirstCall_BucketFull(t *testing.T) {
+	var b Bucket
+	now := time.Now()
+	limit := Limit{Rate: 1, Burst: 2}
+
+	ok, _ := b.Take(now, limit)
+	assert.True(t, ok)
+	ok, _ = b.Take(now, limit)
+	assert.True(t, ok)
+	ok, wait := b.Take(now, limit)
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+}
+
+func TestBucketTake_TimeElapsed_Refilled(t *testing.T) {
+	var b Bucket
+	now := time.Now()
+	limit := Limit{Rate: 2, Burst: 1}
+
+	b.Take(now, limit)
+	ok, wait := b.Take(now, limit)
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	ok, _ = b.Take(now.Add(500*time.Millisecond), limit)
+	assert.True(t, ok)
+}
+
+func TestParseRouteLimits_Valid(t *testing.T) {
+	routes, err := parseRouteLimits("search:token=5/10, create_card:ip=0.5/1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]Limit{
+		"search":      {"token": {Rate: 5, Burst: 10}},
+		"create_card": {"ip": {Rate: 0.5, Burst: 1}},
+	}, routes)
+}
+
+func TestParseRouteLimits_Invalid_ReturnErr(t *testing.T) {
+	table := []string{
+		"search",
+		"search=5/10",
+		"search:user=5/10",
+		"search:ip=5",
+		"search:ip=a/10",
+		"search:ip=5/a",
+	}
+	for _, v := range table {
+		_, err := parseRouteLimits(v)
+		assert.Error(t, err, v)
+	}
+}
+
+func TestRateLimitPolicy_RouteOverride(t *testing.T) {
+	p := rateLimitPolicy{
+		Token: Limit{Rate: 1, Burst: 1},
+		IP:    Limit{Rate: 2, Burst: 2},
+		Routes: map[string]map[string]Limit{
+			"search": {"ip": {Rate: 3, Burst: 3}},
+		},
+	}
+
+	assert.Equal(t, Limit{Rate: 1, Burst: 1}, p.limit("search", limitByToken))
+	assert.Equal(t, Limit{Rate: 3, Burst: 3}, p.limit("search", limitByIP))
+	assert.Equal(t, Limit{Rate: 2, Burst: 2}, p.limit("get_card", limitByIP))
+}
+
+func TestRateLimitMiddleware_Allow_CallNext(t *testing.T) {
+	l := new(fakeRateLimiter)
+	l.On("Take", "ratelimit_search_ip_192.0.2.1", Limit{Rate: 1, Burst: 1}).Return(true, time.Duration(0), nil).Once()
+	var executed bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		executed = true
+	})
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+
+	m := rateLimitMiddleware(l, rateLimitPolicy{IP: Limit{Rate: 1, Burst: 1}}, new(fakeLogger))
+	m("search")(next).ServeHTTP(w, r)
+
+	assert.True(t, executed)
+	l.AssertExpectations(t)
+}
+
+func TestRateLimitMiddleware_TokenLimitExceeded_ReturnTooManyRequests(t *testing.T) {
+	l := new(fakeRateLimiter)
+	l.On("Take", mock.Anything, mock.Anything).Return(false, 1500*time.Millisecond, nil)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Function executed")
+	})
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Authorization", "VIRGIL 1234")
+
+	m := rateLimitMiddleware(l, rateLimitPolicy{Token: Limit{Rate: 1, Burst: 1}}, new(fakeLogger))
+	m("search")(next).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.StatusCode)
+	assert.Equal(t, `{"code":10001}`, w.Output)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+}
+
+func TestRateLimitMiddleware_LimiterReturnErr_LogErrAndCallNext(t *testing.T) {
+	l := new(fakeRateLimiter)
+	l.On("Take", mock.Anything, mock.Anything).Return(false, time.Duration(0), fmt.Errorf("ERROR"))
+	logger := new(fakeLogger)
+	logger.On("Err").Once()
+	var executed bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		executed = true
+	})
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+
+	m := rateLimitMiddleware(l, rateLimitPolicy{IP: Limit{Rate: 1, Burst: 1}}, logger)
+	m("search")(next).ServeHTTP(w, r)
+
+	assert.True(t, executed)
+	logger.AssertExpectations(t)
+}
+
+func TestRateLimitMiddleware_IPLimitExceeded_TokenBucketNotTaken(t *testing.T) {
+	l := new(fakeRateLimiter)
+	l.On("Take", "ratelimit_search_ip_192.0.2.1", mock.Anything).Return(false, time.Second, nil).Once()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Function executed")
+	})
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Authorization", "VIRGIL 1234")
+
+	m := rateLimitMiddleware(l, rateLimitPolicy{Token: Limit{Rate: 1, Burst: 1}, IP: Limit{Rate: 1, Burst: 1}}, new(fakeLogger))
+	m("search")(next).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.StatusCode)
+	l.AssertExpectations(t)
+}
+
+func TestRemoteIP_TrustedProxyHeader_ReturnLastAddress(t *testing.T) {
+	defer func(h string) { trustedProxyHeader = h }(trustedProxyHeader)
+	trustedProxyHeader = "X-Forwarded-For"
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-Forwarded-For", "203.0.113.9, 198.51.100.7")
+
+	assert.Equal(t, "198.51.100.7", remoteIP(r))
+}
+
+func TestRemoteIP_NoTrustedProxyHeader_ReturnRemoteAddr(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-Forwarded-For", "203.0.113.9")
+
+	assert.Equal(t, "192.0.2.1", remoteIP(r))
+}
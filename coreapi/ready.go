@@ -0,0 +1,30 @@
+package coreapi
+
+import "sync"
+
+var (
+	readyMu   sync.Mutex
+	readyFunc func()
+)
+
+// SetReadyNotifier sets function which tells the previous process (it handed off listening sockets) that this one
+// is ready to take over, so the previous one may drain and exit. The function is called at most once.
+func SetReadyNotifier(f func()) {
+	readyMu.Lock()
+	defer readyMu.Unlock()
+
+	readyFunc = f
+}
+
+// NotifyReady notifies the previous process that this one is ready. It is called when the process serves
+// requests or it waits for files which the previous process releases only on exit.
+func NotifyReady() {
+	readyMu.Lock()
+	f := readyFunc
+	readyFunc = nil
+	readyMu.Unlock()
+
+	if f != nil {
+		f()
+	}
+}
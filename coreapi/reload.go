@@ -0,0 +1,299 @@
+package coreapi
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	reloadTotalMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "reload_total",
+		Subsystem: "config",
+		Namespace: "virgild",
+		Help:      "Count of configuration reloads by result (success, failure)",
+	}, []string{"result"})
+	reloadSuccessMetric = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "last_reload_successful",
+		Subsystem: "config",
+		Namespace: "virgild",
+		Help:      "Whether the last configuration reload succeeded (1) or failed (0)",
+	})
+	reloadTimeMetric = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "last_reload_success_timestamp_seconds",
+		Subsystem: "config",
+		Namespace: "virgild",
+		Help:      "Time of the last successful configuration reload",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(reloadTotalMetric, reloadSuccessMetric, reloadTimeMetric)
+	reloadSuccessMetric.Set(1)
+}
+
+// ReloadHook builds components from values of flags and tenants after reload. The returned commit function swaps
+// the components, it is called only if all hooks affected by the reload succeed.
+type ReloadHook func(values ReloadValues) (commit func(), err error)
+
+type reloadHook struct {
+	name  string
+	flags []string
+	f     ReloadHook
+}
+
+var (
+	reloadMu    sync.Mutex
+	reloadHooks []reloadHook
+	// reloadedFlags are values of flags applied by the last reload (nil - values parsed on start)
+	reloadedFlags FlagValues
+)
+
+// RegisterReloadHook registers hook which is called when any of flags is changed by reload of the config file.
+// Changes of flags without hooks require restart.
+func RegisterReloadHook(name string, flags []string, f ReloadHook) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	reloadHooks = append(reloadHooks, reloadHook{name: name, flags: flags, f: f})
+}
+
+// ReloadValues are values of flags and tenants after reload. Reload doesn't change variables of flags
+// and Tenants, which are read by request goroutines, so hooks build components from ReloadValues.
+type ReloadValues struct {
+	Flags   FlagValues
+	tenants tenantSet
+}
+
+// Tenants returns tenants after reload ordered by name
+func (v ReloadValues) Tenants() []*Tenant {
+	return v.tenants.list
+}
+
+// FlagValues are values of all flags by name, hooks parse them into own variables
+type FlagValues map[string]string
+
+// Parse sets the values to flags which define registers on a new flag set
+func (v FlagValues) Parse(define func(fs *flag.FlagSet)) error {
+	fs := flag.NewFlagSet("reload", flag.ContinueOnError)
+	define(fs)
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if s, ok := v[f.Name]; ok && err == nil {
+			if err = fs.Set(f.Name, s); err != nil {
+				err = fmt.Errorf("invalid value of %v (%v): %v", f.Name, s, err)
+			}
+		}
+	})
+	return err
+}
+
+// Reloadable holds a component which is replaced by commit of a reload hook while requests read it
+type Reloadable[T any] struct {
+	v atomic.Value
+}
+
+func NewReloadable[T any](v T) *Reloadable[T] {
+	r := new(Reloadable[T])
+	r.v.Store(v)
+	return r
+}
+
+func (r *Reloadable[T]) Current() T {
+	return r.v.Load().(T)
+}
+
+func (r *Reloadable[T]) Set(v T) {
+	r.v.Store(v)
+}
+
+type ReloadResult struct {
+	// Changed are applied flags
+	Changed []string
+	// Restart are changed flags which are applied after restart only
+	Restart []string
+}
+
+// Reload reads the config file again and applies reloadable flags. Either all affected components are replaced or none.
+func Reload() (ReloadResult, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	res, values, err := reloadConfig(flag.CommandLine, configFile, pinnedFlags, ReloadValues{Flags: reloadedFlags, tenants: tenants.Current()})
+	if err != nil {
+		reloadTotalMetric.WithLabelValues("failure").Inc()
+		reloadSuccessMetric.Set(0)
+		return res, err
+	}
+	reloadedFlags = values.Flags
+	reloadTotalMetric.WithLabelValues("success").Inc()
+	reloadSuccessMetric.Set(1)
+	reloadTimeMetric.Set(float64(time.Now().Unix()))
+	return res, nil
+}
+
+// reloadConfig parses the config file and the tenants file into new values and calls hooks of changed flags.
+// current are values applied by the previous reload (nil flags - values of fs). It returns values applied by this reload.
+func reloadConfig(fs *flag.FlagSet, path string, pinned map[string]bool, current ReloadValues) (ReloadResult, ReloadValues, error) {
+	var res ReloadResult
+	b, err := readConfigFile(path, pinned["config"])
+	if err != nil {
+		return res, ReloadValues{}, err
+	}
+	values, problems, err := parseConfig(fs, b)
+	if err == nil && len(problems) != 0 {
+		err = fmt.Errorf("%v", strings.Join(problems, "; "))
+	}
+	if err != nil {
+		return res, ReloadValues{}, errors.Wrapf(err, "Config (%v)", path)
+	}
+
+	reloadable := make(map[string]bool)
+	for _, h := range reloadHooks {
+		for _, name := range h.flags {
+			reloadable[name] = true
+		}
+	}
+
+	next := ReloadValues{Flags: make(FlagValues), tenants: current.tenants}
+	changed := make(map[string]bool)
+	var flags []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, f)
+	})
+	for _, f := range flags {
+		prev, ok := current.Flags[f.Name]
+		if !ok {
+			prev = f.Value.String()
+		}
+		next.Flags[f.Name] = prev
+		if f.Name == "config" || pinned[f.Name] {
+			continue
+		}
+		// keys removed from the file return to defaults
+		v, ok := values[f.Name]
+		if !ok {
+			v = f.DefValue
+		}
+		v, err := canonicalValue(f, v)
+		if err != nil {
+			return res, ReloadValues{}, fmt.Errorf("Config (%v): invalid value of %v (%v): %v", path, f.Name, values[f.Name], err)
+		}
+		if v == prev {
+			continue
+		}
+		if !reloadable[f.Name] {
+			res.Restart = append(res.Restart, f.Name)
+			continue
+		}
+		next.Flags[f.Name] = v
+		changed[f.Name] = true
+		res.Changed = append(res.Changed, f.Name)
+	}
+	// the tenants file is read again if its path or content is changed
+	if reloadable[TenantsFlag] {
+		set, err := loadTenants(next.Flags[TenantsFlag], rateLimitEnabled)
+		if err != nil {
+			return res, ReloadValues{}, err
+		}
+		if !changed[TenantsFlag] && !reflect.DeepEqual(set.list, current.tenants.list) {
+			changed[TenantsFlag] = true
+			res.Changed = append(res.Changed, TenantsFlag)
+		}
+		next.tenants = set
+	}
+	sort.Strings(res.Changed)
+	sort.Strings(res.Restart)
+
+	var commits []func()
+	for _, h := range reloadHooks {
+		affected := false
+		for _, name := range h.flags {
+			affected = affected || changed[name]
+		}
+		if !affected {
+			continue
+		}
+		commit, err := h.f(next)
+		if err != nil {
+			return res, ReloadValues{}, errors.Wrapf(err, "Reload %v", h.name)
+		}
+		commits = append(commits, commit)
+	}
+	for _, commit := range commits {
+		commit()
+	}
+	return res, next, nil
+}
+
+// canonicalValue parses v by a new variable of the flag type, so values are compared regardless of format
+// (e.g. 1m and 60s) and the variable of the flag isn't changed
+func canonicalValue(f *flag.Flag, v string) (string, error) {
+	t := reflect.TypeOf(f.Value)
+	if t.Kind() != reflect.Ptr {
+		return v, nil
+	}
+	value, ok := reflect.New(t.Elem()).Interface().(flag.Value)
+	if !ok {
+		return v, nil
+	}
+	if err := value.Set(v); err != nil {
+		return "", err
+	}
+	return value.String(), nil
+}
+
+// reloadOnChange reloads configuration on SIGHUP and, if interval is set, when modification time of the config file changes
+// SIGHUP also reopens log files, reload of the unchanged file applies nothing.
+func reloadOnChange(logger Logger, interval time.Duration) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		tick = t.C
+	}
+	modTime := configModTime()
+	for {
+		select {
+		case <-c:
+		case <-tick:
+			mt := configModTime()
+			if mt.Equal(modTime) {
+				continue
+			}
+			modTime = mt
+		}
+
+		res, err := Reload()
+		if err != nil {
+			logger.Err("Reload config: %v", err)
+			continue
+		}
+		logger.Info("Reload config: changed %v", res.Changed)
+		if len(res.Restart) != 0 {
+			logger.Warn("Reload config: changes of %v are applied after restart", res.Restart)
+		}
+	}
+}
+
+func configModTime() time.Time {
+	info, err := os.Stat(configFile)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
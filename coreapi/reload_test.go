@@ -0,0 +1,196 @@
+package coreapi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/namsral/flag"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestConfig(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "virgild")
+	assert.NoError(t, err)
+	f.WriteString(content)
+	f.Close()
+	return f.Name()
+}
+
+type reloadTest struct {
+	fs      *flag.FlagSet
+	c       *testConfig
+	applied []int
+}
+
+// makeReloadTest registers hook of cache-mem-size which applies the value by commit
+func makeReloadTest(hookErr error) *reloadTest {
+	reloadHooks = nil
+	fs, c := makeTestFlagSet()
+	rt := &reloadTest{fs: fs, c: c}
+	RegisterReloadHook("cache", []string{"cache-mem-size"}, func(v ReloadValues) (func(), error) {
+		if hookErr != nil {
+			return nil, hookErr
+		}
+		var size int
+		if err := v.Flags.Parse(func(fs *flag.FlagSet) { fs.IntVar(&size, "cache-mem-size", 0, "") }); err != nil {
+			return nil, err
+		}
+		return func() { rt.applied = append(rt.applied, size) }, nil
+	})
+	return rt
+}
+
+func TestReloadConfig_ReloadableChanged_Applied(t *testing.T) {
+	rt := makeReloadTest(nil)
+	path := writeTestConfig(t, "cache-mem-size: 512\n")
+	defer os.Remove(path)
+
+	res, values, err := reloadConfig(rt.fs, path, nil, ReloadValues{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cache-mem-size"}, res.Changed)
+	assert.Equal(t, []int{512}, rt.applied)
+	assert.Equal(t, "512", values.Flags["cache-mem-size"])
+	assert.Equal(t, 1024, rt.c.size)
+}
+
+func TestReloadConfig_SameFileAgain_NothingChanged(t *testing.T) {
+	rt := makeReloadTest(nil)
+	path := writeTestConfig(t, "cache-mem-size: 512\nhttp-deadline: 1m\n")
+	defer os.Remove(path)
+	_, values, err := reloadConfig(rt.fs, path, nil, ReloadValues{})
+	assert.NoError(t, err)
+
+	res, _, err := reloadConfig(rt.fs, path, nil, values)
+
+	assert.NoError(t, err)
+	assert.Empty(t, res.Changed)
+	assert.Equal(t, []string{"http-deadline"}, res.Restart)
+	assert.Equal(t, []int{512}, rt.applied)
+}
+
+func TestReloadConfig_NotChanged_HookNotCalled(t *testing.T) {
+	rt := makeReloadTest(nil)
+	path := writeTestConfig(t, "cache-mem-size: 1024\n")
+	defer os.Remove(path)
+
+	res, _, err := reloadConfig(rt.fs, path, nil, ReloadValues{})
+
+	assert.NoError(t, err)
+	assert.Empty(t, res.Changed)
+	assert.Empty(t, rt.applied)
+}
+
+func TestReloadConfig_NotReloadableChanged_KeptAndReported(t *testing.T) {
+	rt := makeReloadTest(nil)
+	path := writeTestConfig(t, "address: \":9090\"\n")
+	defer os.Remove(path)
+
+	res, _, err := reloadConfig(rt.fs, path, nil, ReloadValues{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"address"}, res.Restart)
+	assert.Equal(t, ":8080", rt.c.address)
+}
+
+func TestReloadConfig_Pinned_NotChanged(t *testing.T) {
+	rt := makeReloadTest(nil)
+	path := writeTestConfig(t, "cache-mem-size: 512\n")
+	defer os.Remove(path)
+
+	res, _, err := reloadConfig(rt.fs, path, map[string]bool{"cache-mem-size": true}, ReloadValues{})
+
+	assert.NoError(t, err)
+	assert.Empty(t, res.Changed)
+	assert.Equal(t, 1024, rt.c.size)
+}
+
+func TestReloadConfig_KeyRemoved_ReturnToDefault(t *testing.T) {
+	rt := makeReloadTest(nil)
+	rt.fs.Set("cache-mem-size", "512")
+	path := writeTestConfig(t, "")
+	defer os.Remove(path)
+
+	_, _, err := reloadConfig(rt.fs, path, nil, ReloadValues{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1024}, rt.applied)
+}
+
+func TestReloadConfig_HookFailed_NothingApplied(t *testing.T) {
+	rt := makeReloadTest(fmt.Errorf("error"))
+	path := writeTestConfig(t, "cache-mem-size: 512\n")
+	defer os.Remove(path)
+
+	_, _, err := reloadConfig(rt.fs, path, nil, ReloadValues{})
+
+	assert.EqualError(t, err, "Reload cache: error")
+	assert.Equal(t, 1024, rt.c.size)
+	assert.Empty(t, rt.applied)
+}
+
+func TestReloadConfig_InvalidConfig_ReturnErr(t *testing.T) {
+	rt := makeReloadTest(nil)
+	path := writeTestConfig(t, "cache-mem-size: big\nunknown: 1\n")
+	defer os.Remove(path)
+
+	_, _, err := reloadConfig(rt.fs, path, nil, ReloadValues{})
+
+	assert.Error(t, err)
+	assert.Equal(t, 1024, rt.c.size)
+	assert.Empty(t, rt.applied)
+}
+
+func TestReloadConfig_TenantsFileChanged_HookGetsNewTenants(t *testing.T) {
+	reloadHooks = nil
+	fs, _ := makeTestFlagSet()
+	fs.String(TenantsFlag, "", "")
+	var applied [][]*Tenant
+	RegisterReloadHook("tenants", []string{TenantsFlag}, func(v ReloadValues) (func(), error) {
+		return func() { applied = append(applied, v.Tenants()) }, nil
+	})
+	tenantsPath := writeTestConfig(t, "team-a:\n  owners: [a1]\n")
+	defer os.Remove(tenantsPath)
+	fs.Set(TenantsFlag, tenantsPath)
+	path := writeTestConfig(t, "")
+	defer os.Remove(path)
+	pinned := map[string]bool{TenantsFlag: true}
+
+	res, values, err := reloadConfig(fs, path, pinned, ReloadValues{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{TenantsFlag}, res.Changed)
+	res, _, err = reloadConfig(fs, path, pinned, values)
+	assert.NoError(t, err)
+	assert.Empty(t, res.Changed)
+
+	assert.Len(t, applied, 1)
+	assert.Equal(t, "team-a", applied[0][0].Name)
+}
+
+func TestReloadable_Set_ReturnNewPolicy(t *testing.T) {
+	p := NewReloadable(deadlinePolicy{})
+
+	p.Set(deadlinePolicy{Routes: map[string]time.Duration{"search": time.Second}})
+
+	assert.Equal(t, time.Second, p.Current().deadline("search"))
+}
+
+func TestFlagValuesParse_InvalidValue_ReturnErr(t *testing.T) {
+	var c deadlineConfig
+
+	err := FlagValues{"http-deadline": "soon"}.Parse(c.define)
+
+	assert.Error(t, err)
+}
+
+func TestFlagValuesParse_Values_SetToNewVariables(t *testing.T) {
+	var c deadlineConfig
+
+	err := FlagValues{"http-deadline": "1m", "http-route-deadlines": "search=1s", "address": ":80"}.Parse(c.define)
+
+	assert.NoError(t, err)
+	assert.Equal(t, deadlineConfig{Default: time.Minute, Routes: "search=1s"}, c)
+}
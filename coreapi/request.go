@@ -0,0 +1,161 @@
+package coreapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+const (
+	RequestIDHeader    = "X-Virgil-Request-Id"
+	ResponseIDHeader   = "X-Virgil-Response-Id"
+	ResponseSignHeader = "X-Virgil-Response-Sign"
+)
+
+type contextKey string
+
+var (
+	contextRequestIDKey        contextKey = "request_id"
+	contextRouteKey            contextKey = "route"
+	contextUpstreamResponseKey contextKey = "upstream_response"
+	contextResponseMetaKey     contextKey = "response_meta"
+)
+
+// GetRequestID returns id of the request received from the client or generated by VirgilD
+func GetRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(contextRequestIDKey).(string)
+	return id
+}
+
+func SetRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextRequestIDKey, id)
+}
+
+// GetRoute returns name of the route which handles the request
+func GetRoute(ctx context.Context) string {
+	route, _ := ctx.Value(contextRouteKey).(string)
+	return route
+}
+
+func SetRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, contextRouteKey, route)
+}
+
+func routeMiddleware(route string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accessEntryFromContext(r.Context()).set(func(e *accessEntry) { e.route = route })
+			next.ServeHTTP(w, r.WithContext(SetRoute(r.Context(), route)))
+		})
+	}
+}
+
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(RequestIDHeader); id != "" {
+		return id
+	}
+	return newRequestID()
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// upstreamResponse holds signed responses of upstream services called during the request
+type upstreamResponse struct {
+	sync.Mutex
+	signed []signedResponse
+}
+
+type signedResponse struct {
+	header http.Header
+	body   []byte
+}
+
+func withUpstreamResponse(ctx context.Context) (context.Context, *upstreamResponse) {
+	u := new(upstreamResponse)
+	return context.WithValue(ctx, contextUpstreamResponseKey, u), u
+}
+
+// SetUpstreamResponse records the upstream response of the request. If the upstream signed the response and
+// it is the result of the request, the wrapper sends the body verbatim with the signature headers, so clients
+// can verify the signature.
+func SetUpstreamResponse(ctx context.Context, header http.Header, body []byte) {
+	u, ok := ctx.Value(contextUpstreamResponseKey).(*upstreamResponse)
+	if !ok || header == nil || header.Get(ResponseSignHeader) == "" {
+		return
+	}
+	u.Lock()
+	defer u.Unlock()
+
+	u.signed = append(u.signed, signedResponse{header: header, body: body})
+}
+
+// signedResult returns the last signed upstream response which decodes to the result (body is the encoded result)
+func (u *upstreamResponse) signedResult(result interface{}, body []byte) (http.Header, []byte, bool) {
+	u.Lock()
+	defer u.Unlock()
+
+	for i := len(u.signed) - 1; i >= 0; i-- {
+		if sameResult(u.signed[i].body, result, body) {
+			return u.signed[i].header, u.signed[i].body, true
+		}
+	}
+	return nil, nil, false
+}
+
+func sameResult(upstreamBody []byte, result interface{}, body []byte) bool {
+	if _, raw := result.([]byte); raw {
+		return bytes.Equal(upstreamBody, body)
+	}
+	t := reflect.TypeOf(result)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	v := reflect.New(t)
+	if err := json.Unmarshal(upstreamBody, v.Interface()); err != nil {
+		return false
+	}
+	decoded, err := json.Marshal(v.Interface())
+	return err == nil && bytes.Equal(decoded, body)
+}
+
+// responseMeta holds headers which handlers set for the response
+type responseMeta struct {
+	sync.Mutex
+	header http.Header
+}
+
+func withResponseMeta(ctx context.Context) (context.Context, *responseMeta) {
+	m := &responseMeta{header: make(http.Header)}
+	return context.WithValue(ctx, contextResponseMetaKey, m), m
+}
+
+// SetResponseHeader sets header of the response of the request
+func SetResponseHeader(ctx context.Context, name, value string) {
+	m, ok := ctx.Value(contextResponseMetaKey).(*responseMeta)
+	if !ok {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+
+	m.header.Set(name, value)
+}
+
+// apply copies headers to the response
+func (m *responseMeta) apply(h http.Header) {
+	m.Lock()
+	defer m.Unlock()
+
+	for name, values := range m.header {
+		h[name] = values
+	}
+}
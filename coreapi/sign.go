@@ -0,0 +1,106 @@
+package coreapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+	virgil "gopkg.in/virgil.v4"
+	"gopkg.in/virgil.v4/virgilcrypto"
+)
+
+// responseSigner signs response bodies with the service key.
+// The signature is calculated over concatenation of the response id and the body.
+type responseSigner struct {
+	key virgilcrypto.PrivateKey
+}
+
+func (s *responseSigner) sign(header http.Header, body []byte) error {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return errors.Wrap(err, "Response signer: generate response id")
+	}
+	id := hex.EncodeToString(b)
+
+	sign, err := virgil.Crypto().Sign(append([]byte(id), body...), s.key)
+	if err != nil {
+		return errors.Wrap(err, "Response signer: sign")
+	}
+	header.Set(ResponseIDHeader, id)
+	header.Set(ResponseSignHeader, base64.StdEncoding.EncodeToString(sign))
+	return nil
+}
+
+type contextSignerKey struct{}
+
+// signerMiddleware passes the signer to middlewares which respond before the API handler
+func signerMiddleware(signer *responseSigner) Middleware {
+	return func(next http.Handler) http.Handler {
+		if signer == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextSignerKey{}, signer)))
+		})
+	}
+}
+
+// loadServiceKey loads private key of the service and its card. The card must contain public key of the private key.
+func loadServiceKey(keyFile, password, cardFile string) (*responseSigner, *virgil.CardResponse, error) {
+	kb, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Load service key: read key file (%v)", keyFile)
+	}
+	key, err := virgil.Crypto().ImportPrivateKey(bytes.TrimSpace(kb), password)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Load service key: import private key")
+	}
+	signer := &responseSigner{key: key}
+	if cardFile == "" {
+		return signer, nil, nil
+	}
+
+	cb, err := ioutil.ReadFile(cardFile)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Load service key: read card file (%v)", cardFile)
+	}
+	card := new(virgil.CardResponse)
+	err = json.Unmarshal(cb, card)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Load service key: unmarshal card")
+	}
+	var info virgil.CardModel
+	err = json.Unmarshal(card.Snapshot, &info)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Load service key: unmarshal card snapshot")
+	}
+	pub, err := key.ExtractPublicKey()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Load service key: extract public key")
+	}
+	pb, err := virgil.Crypto().ExportPublicKey(pub)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Load service key: export public key")
+	}
+	if !bytes.Equal(pb, info.PublicKey) {
+		return nil, nil, fmt.Errorf("Load service key: card (%v) does not contain public key of the service key", card.ID)
+	}
+	return signer, card, nil
+}
+
+func serviceCardHandler(card *virgil.CardResponse) http.Handler {
+	body, _ := json.Marshal(card)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	})
+}
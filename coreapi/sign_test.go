@@ -0,0 +1,129 @@
+package coreapi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	thttp "github.com/stretchr/testify/http"
+	virgil "gopkg.in/virgil.v4"
+	"gopkg.in/virgil.v4/virgilcrypto"
+)
+
+func writeTempFile(t *testing.T, data []byte) string {
+	f, err := ioutil.TempFile("", "virgild")
+	assert.NoError(t, err)
+	f.Write(data)
+	f.Close()
+	return f.Name()
+}
+
+func makeServiceKey(t *testing.T) (virgilcrypto.Keypair, string) {
+	kp, err := virgil.Crypto().GenerateKeypair()
+	assert.NoError(t, err)
+	b, err := virgil.Crypto().ExportPrivateKey(kp.PrivateKey(), "pass")
+	assert.NoError(t, err)
+	return kp, writeTempFile(t, b)
+}
+
+func makeServiceCard(t *testing.T, pub virgilcrypto.PublicKey) string {
+	pb, _ := virgil.Crypto().ExportPublicKey(pub)
+	snapshot, _ := json.Marshal(virgil.CardModel{Identity: "virgild", IdentityType: "service", PublicKey: pb})
+	card, _ := json.Marshal(virgil.CardResponse{ID: "1234", Snapshot: snapshot})
+	return writeTempFile(t, card)
+}
+
+func TestWrapperAPIHandlerServeHTTP_Signer_SignResponse(t *testing.T) {
+	kp, _ := virgil.Crypto().GenerateKeypair()
+	handler := func(req *http.Request) (interface{}, error) {
+		return []byte("seccess"), nil
+	}
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	wrapAPIHandler(new(fakeLogger), &responseSigner{key: kp.PrivateKey()})(handler).ServeHTTP(w, r)
+
+	id := w.Header().Get(ResponseIDHeader)
+	sign, err := base64.StdEncoding.DecodeString(w.Header().Get(ResponseSignHeader))
+	assert.NoError(t, err)
+	ok, err := virgil.Crypto().Verify([]byte(id+"seccess"), sign, kp.PublicKey())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestWrapperAPIHandlerServeHTTP_SignerAndUpstreamSigned_Resign(t *testing.T) {
+	kp, _ := virgil.Crypto().GenerateKeypair()
+	handler := func(req *http.Request) (interface{}, error) {
+		h := http.Header{}
+		h.Set(ResponseIDHeader, "upstream-id")
+		h.Set(ResponseSignHeader, "upstream-sign")
+		SetUpstreamResponse(req.Context(), h, []byte(`{ "id" : "1" }`))
+		return map[string]string{"id": "1"}, nil
+	}
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	wrapAPIHandler(new(fakeLogger), &responseSigner{key: kp.PrivateKey()})(handler).ServeHTTP(w, r)
+
+	assert.Equal(t, `{ "id" : "1" }`, w.Output)
+	assert.NotEqual(t, "upstream-id", w.Header().Get(ResponseIDHeader))
+	assert.NotEqual(t, "upstream-sign", w.Header().Get(ResponseSignHeader))
+}
+
+func TestLoadServiceKey_CardMatchKey_ReturnCard(t *testing.T) {
+	kp, key := makeServiceKey(t)
+	defer os.Remove(key)
+	card := makeServiceCard(t, kp.PublicKey())
+	defer os.Remove(card)
+
+	signer, c, err := loadServiceKey(key, "pass", card)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, signer)
+	assert.Equal(t, "1234", c.ID)
+}
+
+func TestLoadServiceKey_CardNotMatchKey_ReturnErr(t *testing.T) {
+	_, key := makeServiceKey(t)
+	defer os.Remove(key)
+	other, _ := virgil.Crypto().GenerateKeypair()
+	card := makeServiceCard(t, other.PublicKey())
+	defer os.Remove(card)
+
+	_, _, err := loadServiceKey(key, "pass", card)
+
+	assert.Error(t, err)
+}
+
+func TestLoadServiceKey_KeyNotExist_ReturnErr(t *testing.T) {
+	_, _, err := loadServiceKey("not_exist_key", "", "")
+
+	assert.Error(t, err)
+}
+
+func TestSignerMiddleware_RateLimited_SignError(t *testing.T) {
+	kp, _ := virgil.Crypto().GenerateKeypair()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Function executed")
+	})
+	limit := rateLimitHTTP(func(ctx context.Context, route, ip, auth string) (bool, time.Duration) { return false, time.Second })
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	signerMiddleware(&responseSigner{key: kp.PrivateKey()})(limit("search")(next)).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.StatusCode)
+	id := w.Header().Get(ResponseIDHeader)
+	sign, err := base64.StdEncoding.DecodeString(w.Header().Get(ResponseSignHeader))
+	assert.NoError(t, err)
+	ok, err := virgil.Crypto().Verify([]byte(id+w.Output), sign, kp.PublicKey())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
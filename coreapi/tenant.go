@@ -0,0 +1,274 @@
+package coreapi
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Tenant is an application served by VirgilD with own configuration. Requests are assigned to tenants by owner
+// (hash of access token, see HashToken). Requests of other owners use global configuration.
+type Tenant struct {
+	Name   string
+	Owners []string
+	// Config overrides arguments for requests of the tenant. Keys are names of arguments
+	Config map[string]string
+}
+
+// TenantsFlag is the flag of the tenants file. Reload hooks which build components of tenants list it in
+// own flags, they are called when the file is changed.
+const TenantsFlag = "tenants-file"
+
+var (
+	tenantsFile string
+
+	tenantKeys = map[string]bool{"owners": true}
+	// tenants are replaced on reload of configuration
+	tenants = NewReloadable(tenantSet{})
+)
+
+// tenantSet are tenants ordered by name and indexed by owner
+type tenantSet struct {
+	list    []*Tenant
+	byOwner map[string]*Tenant
+}
+
+func init() {
+	flag.StringVar(&tenantsFile, TenantsFlag, "", "Path to configuration of tenants (YAML, empty - single tenant mode)")
+
+	RegisterTenantKeys(rateLimitFlags...)
+	RegisterTenantKeys(deadlineFlags...)
+	RegisterTenantKeys("quota-requests", "quota-period")
+}
+
+// RegisterTenantKeys registers keys which may be overridden by tenants. Other keys of tenant configuration are errors.
+// It must be called from init function of the module.
+func RegisterTenantKeys(keys ...string) {
+	for _, k := range keys {
+		tenantKeys[k] = true
+	}
+}
+
+// Tenants returns all configured tenants ordered by name
+func Tenants() []*Tenant {
+	return tenants.Current().list
+}
+
+// Value returns override of the argument
+func (t *Tenant) Value(key string) (string, bool) {
+	v, ok := t.Config[key]
+	return v, ok
+}
+
+// loadTenants reads configuration of tenants in format
+//
+//	name:
+//	  owners: [<owner>, ...]
+//	  <argument>: <value>
+//
+// Quotas are applied by the rate limiter, so they are errors if rate limiting is disabled.
+func loadTenants(path string, rateLimits bool) (tenantSet, error) {
+	set := tenantSet{byOwner: make(map[string]*Tenant)}
+	if path == "" {
+		return set, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return tenantSet{}, errors.Wrapf(err, "Tenants: read file (%v)", path)
+	}
+	if set.list, err = parseTenants(b); err != nil {
+		return tenantSet{}, errors.Wrapf(err, "Tenants (%v)", path)
+	}
+	for _, t := range set.list {
+		for _, o := range t.Owners {
+			if other, ok := set.byOwner[o]; ok {
+				return tenantSet{}, fmt.Errorf("Tenants (%v): owner (%v) belongs to %v and %v", path, o, other.Name, t.Name)
+			}
+			set.byOwner[o] = t
+		}
+		if _, ok := t.Value("quota-requests"); ok && !rateLimits {
+			return tenantSet{}, fmt.Errorf("Tenants (%v): quota of tenant %v requires ratelimit-enabled", path, t.Name)
+		}
+	}
+	return set, nil
+}
+
+func parseTenants(data []byte) ([]*Tenant, error) {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, errors.Wrap(err, "parse YAML")
+	}
+
+	var (
+		list     []*Tenant
+		problems []string
+	)
+	for name, v := range raw {
+		values := make(map[string]string)
+		if err := flattenConfig("", v, values); err != nil {
+			return nil, errors.Wrapf(err, "tenant %v", name)
+		}
+		t := &Tenant{Name: name, Config: make(map[string]string)}
+		for _, k := range sortedKeys(values) {
+			switch {
+			case k == "owners":
+				t.Owners = strings.Split(values[k], ",")
+			case tenantKeys[k]:
+				t.Config[k] = values[k]
+			default:
+				problems = append(problems, fmt.Sprintf("unknown key (%v) of tenant %v", k, name))
+			}
+		}
+		if len(t.Owners) == 0 || t.Owners[0] == "" {
+			problems = append(problems, fmt.Sprintf("tenant %v has no owners", name))
+		}
+		list = append(list, t)
+	}
+	if len(problems) != 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("%v", strings.Join(problems, "; "))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+type tenantContextKey struct{}
+
+// GetTenant returns tenant of the request, nil if the owner doesn't belong to any tenant
+func GetTenant(ctx context.Context) *Tenant {
+	t, _ := ctx.Value(tenantContextKey{}).(*Tenant)
+	return t
+}
+
+// SetTenant returns copy of ctx with the tenant
+func SetTenant(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, t)
+}
+
+// tenantMiddleware resolves tenant by owner of the request. Owner is the hash of the access token
+// which follows the scheme of Authorization header.
+func tenantMiddleware(tenants *Reloadable[tenantSet]) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if t := tenants.Current().byAuth(r.Header.Get("Authorization")); t != nil {
+				r = r.WithContext(SetTenant(r.Context(), t))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// byAuth returns tenant of the owner of the Authorization header, nil if the owner doesn't belong to any tenant
+func (s tenantSet) byAuth(auth string) *Tenant {
+	if len(s.byOwner) == 0 {
+		return nil
+	}
+	if i := strings.IndexByte(auth, ' '); i >= 0 {
+		return s.byOwner[HashToken(auth[i+1:])]
+	}
+	return nil
+}
+
+// tenantRateLimitPolicy overrides global limits by values of the tenant. Quota limits all requests of the tenant:
+// quota-requests are allowed per quota-period. Limiters keep the bucket until it's refilled, so any period is supported.
+func tenantRateLimitPolicy(global rateLimitPolicy, t *Tenant) (rateLimitPolicy, error) {
+	p := global
+	p.Tenants = nil
+	var err error
+	if p.Token.Rate, err = t.Float("ratelimit-token-rate", p.Token.Rate); err != nil {
+		return p, err
+	}
+	if p.Token.Burst, err = t.Int("ratelimit-token-burst", p.Token.Burst); err != nil {
+		return p, err
+	}
+	if p.IP.Rate, err = t.Float("ratelimit-ip-rate", p.IP.Rate); err != nil {
+		return p, err
+	}
+	if p.IP.Burst, err = t.Int("ratelimit-ip-burst", p.IP.Burst); err != nil {
+		return p, err
+	}
+	if v, ok := t.Value("ratelimit-routes"); ok {
+		if p.Routes, err = parseRouteLimits(v); err != nil {
+			return p, errors.Wrapf(err, "tenant %v", t.Name)
+		}
+	}
+
+	requests, err := t.Int("quota-requests", 0)
+	if err != nil {
+		return p, err
+	}
+	period, err := t.Duration("quota-period", 24*time.Hour)
+	if err != nil {
+		return p, err
+	}
+	if requests > 0 && period <= 0 {
+		return p, fmt.Errorf("tenant %v: quota-period (%v) is not positive", t.Name, period)
+	}
+	if requests > 0 {
+		p.Quota = Limit{Rate: float64(requests) / period.Seconds(), Burst: requests}
+	}
+	return p, nil
+}
+
+func tenantDeadlinePolicy(global deadlinePolicy, t *Tenant) (deadlinePolicy, error) {
+	p := global
+	p.Tenants = nil
+	var err error
+	if p.Default, err = t.Duration("http-deadline", p.Default); err != nil {
+		return p, err
+	}
+	if v, ok := t.Value("http-route-deadlines"); ok {
+		if p.Routes, err = parseRouteDeadlines(v); err != nil {
+			return p, errors.Wrapf(err, "tenant %v", t.Name)
+		}
+	}
+	return p, nil
+}
+
+// Float returns override of the argument or def
+func (t *Tenant) Float(key string, def float64) (float64, error) {
+	v, ok := t.Value(key)
+	if !ok {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return def, errors.Wrapf(err, "tenant %v: invalid %v (%v)", t.Name, key, v)
+	}
+	return f, nil
+}
+
+// Int returns override of the argument or def
+func (t *Tenant) Int(key string, def int) (int, error) {
+	v, ok := t.Value(key)
+	if !ok {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return def, errors.Wrapf(err, "tenant %v: invalid %v (%v)", t.Name, key, v)
+	}
+	return i, nil
+}
+
+// Duration returns override of the argument or def
+func (t *Tenant) Duration(key string, def time.Duration) (time.Duration, error) {
+	v, ok := t.Value(key)
+	if !ok {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return def, errors.Wrapf(err, "tenant %v: invalid %v (%v)", t.Name, key, v)
+	}
+	return d, nil
+}
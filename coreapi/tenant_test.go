@@ -0,0 +1,166 @@
+package coreapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	thttp "github.com/stretchr/testify/http"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseTenants_Valid_ReturnSortedTenants(t *testing.T) {
+	tenants, err := parseTenants([]byte(`
+team-b:
+  owners: [b1]
+team-a:
+  owners: [a1, a2]
+  ratelimit-token-rate: 5
+  quota:
+    requests: 100
+`))
+
+	assert.NoError(t, err)
+	assert.Len(t, tenants, 2)
+	assert.Equal(t, "team-a", tenants[0].Name)
+	assert.Equal(t, []string{"a1", "a2"}, tenants[0].Owners)
+	assert.Equal(t, map[string]string{"ratelimit-token-rate": "5", "quota-requests": "100"}, tenants[0].Config)
+	assert.Equal(t, "team-b", tenants[1].Name)
+}
+
+func TestParseTenants_UnknownKeyOrNoOwners_ReturnErr(t *testing.T) {
+	_, err := parseTenants([]byte(`
+team-a:
+  owners: [a1]
+  address: ":9090"
+team-b:
+  ratelimit-token-rate: 5
+`))
+
+	assert.EqualError(t, err, "tenant team-b has no owners; unknown key (address) of tenant team-a")
+}
+
+func TestTenantMiddleware_OwnerOfTenant_SetTenant(t *testing.T) {
+	tenant := &Tenant{Name: "team-a"}
+	var actual *Tenant
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actual = GetTenant(r.Context())
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "VIRGIL token")
+
+	tenantMiddleware(NewReloadable(tenantSet{byOwner: map[string]*Tenant{HashToken("token"): tenant}}))(next).ServeHTTP(&thttp.TestResponseWriter{}, r)
+
+	assert.Equal(t, tenant, actual)
+}
+
+func TestTenantMiddleware_UnknownOwner_TenantNil(t *testing.T) {
+	var actual *Tenant
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actual = GetTenant(r.Context())
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "VIRGIL other")
+
+	tenantMiddleware(NewReloadable(tenantSet{byOwner: map[string]*Tenant{HashToken("token"): {Name: "team-a"}}}))(next).ServeHTTP(&thttp.TestResponseWriter{}, r)
+
+	assert.Nil(t, actual)
+}
+
+func TestLoadTenants_QuotaWithoutRateLimits_ReturnErr(t *testing.T) {
+	path := writeTestConfig(t, "team-a:\n  owners: [a1]\n  quota-requests: 100\n")
+	defer os.Remove(path)
+
+	_, err := loadTenants(path, false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "quota of tenant team-a requires ratelimit-enabled")
+
+	set, err := loadTenants(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a", set.byOwner["a1"].Name)
+}
+
+func TestTenantRateLimitPolicy_Overrides_Applied(t *testing.T) {
+	global := rateLimitPolicy{Token: Limit{Rate: 10, Burst: 20}, IP: Limit{Rate: 20, Burst: 40}}
+	tenant := &Tenant{Name: "team-a", Config: map[string]string{
+		"ratelimit-token-rate": "5",
+		"quota-requests":       "3600",
+		"quota-period":         "1h",
+	}}
+
+	p, err := tenantRateLimitPolicy(global, tenant)
+
+	assert.NoError(t, err)
+	assert.Equal(t, Limit{Rate: 5, Burst: 20}, p.Token)
+	assert.Equal(t, global.IP, p.IP)
+	assert.Equal(t, Limit{Rate: 1, Burst: 3600}, p.Quota)
+}
+
+func TestTenantRateLimitPolicy_InvalidValue_ReturnErr(t *testing.T) {
+	_, err := tenantRateLimitPolicy(rateLimitPolicy{}, &Tenant{Name: "team-a", Config: map[string]string{"ratelimit-token-burst": "many"}})
+
+	assert.Error(t, err)
+}
+
+func TestTenantRateLimitPolicy_QuotaPeriodNotPositive_ReturnErr(t *testing.T) {
+	_, err := tenantRateLimitPolicy(rateLimitPolicy{}, &Tenant{Name: "team-a", Config: map[string]string{
+		"quota-requests": "100",
+		"quota-period":   "0s",
+	}})
+
+	assert.Error(t, err)
+}
+
+func TestRateLimitMiddleware_TenantQuotaExceeded_ReturnTooManyRequests(t *testing.T) {
+	l := new(fakeRateLimiter)
+	l.On("Take", "ratelimit_*_tenant_team-a", Limit{Rate: 1, Burst: 1}).Return(false, time.Second, nil)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Function executed")
+	})
+	tenant := &Tenant{Name: "team-a"}
+	policy := rateLimitPolicy{Tenants: map[string]rateLimitPolicy{"team-a": {Quota: Limit{Rate: 1, Burst: 1}}}}
+	w := &thttp.TestResponseWriter{}
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r = r.WithContext(SetTenant(r.Context(), tenant))
+
+	rateLimitMiddleware(l, policy, new(fakeLogger))("search")(next).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.StatusCode)
+	l.AssertExpectations(t)
+}
+
+func TestRateLimitMiddleware_TenantLimits_UseTenantPolicy(t *testing.T) {
+	l := new(fakeRateLimiter)
+	l.On("Take", mock.Anything, Limit{Rate: 1, Burst: 2}).Return(true, time.Duration(0), nil)
+	var executed bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		executed = true
+	})
+	policy := rateLimitPolicy{IP: Limit{Rate: 10, Burst: 20}, Tenants: map[string]rateLimitPolicy{"team-a": {IP: Limit{Rate: 1, Burst: 2}}}}
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r = r.WithContext(SetTenant(r.Context(), &Tenant{Name: "team-a"}))
+
+	rateLimitMiddleware(l, policy, new(fakeLogger))("search")(next).ServeHTTP(&thttp.TestResponseWriter{}, r)
+
+	assert.True(t, executed)
+	l.AssertExpectations(t)
+}
+
+func TestDeadlineMiddleware_Tenant_UseTenantDeadline(t *testing.T) {
+	var deadline time.Time
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, _ = r.Context().Deadline()
+	})
+	policy := deadlinePolicy{Default: time.Hour, Tenants: map[string]deadlinePolicy{"team-a": {Default: time.Second}}}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(SetTenant(context.Background(), &Tenant{Name: "team-a"}))
+
+	start := time.Now()
+	deadlineMiddleware(policy)("search")(next).ServeHTTP(&thttp.TestResponseWriter{}, r)
+
+	assert.WithinDuration(t, start.Add(time.Second), deadline, 500*time.Millisecond)
+}
@@ -0,0 +1,131 @@
+package coreapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracingExporterOTLP = "otlp"
+	tracingExporterFile = "file"
+
+	tracerName = "github.com/VirgilSecurity/virgild/coreapi"
+)
+
+type tracingConfig struct {
+	Exporter     string
+	OTLPEndpoint string
+	OTLPInsecure bool
+	File         string
+	SampleRatio  float64
+}
+
+// initTracing installs global tracer provider and W3C trace context propagator.
+// Without exporter spans are not recorded. The returned function flushes and stops the exporter and closes
+// the file of the file exporter.
+func initTracing(cfg tracingConfig) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var (
+		exporter sdktrace.SpanExporter
+		file     *os.File
+		err      error
+	)
+	switch cfg.Exporter {
+	case "":
+		return func(ctx context.Context) error { return nil }, nil
+	case tracingExporterOTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.OTLPEndpoint)}
+		if cfg.OTLPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	case tracingExporterFile:
+		out := os.Stdout
+		if cfg.File != "-" {
+			file, err = os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Init tracing: open file (%v)", cfg.File)
+			}
+			out = file
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(out))
+	default:
+		return nil, fmt.Errorf("Init tracing: unknown exporter (%v)", cfg.Exporter)
+	}
+	if err != nil {
+		closeFile(file)
+		return nil, errors.Wrapf(err, "Init tracing: create %v exporter", cfg.Exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", "virgild")))
+	if err != nil {
+		closeFile(file)
+		return nil, errors.Wrap(err, "Init tracing: create resource")
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	if file == nil {
+		return tp.Shutdown, nil
+	}
+	return func(ctx context.Context) error {
+		// pending spans are flushed to the file before it's closed
+		err := tp.Shutdown(ctx)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
+
+func closeFile(f *os.File) {
+	if f != nil {
+		f.Close()
+	}
+}
+
+// traceMiddleware starts server span of the route. Trace context of the client is taken from traceparent header.
+func traceMiddleware(route string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := otel.Tracer(tracerName).Start(ctx, route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("url.path", r.URL.Path),
+					attribute.String("http.route", route),
+				))
+			defer span.End()
+
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r.WithContext(ctx))
+
+			status := sw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			span.SetAttributes(attribute.Int("http.response.status_code", status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+		})
+	}
+}
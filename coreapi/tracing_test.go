@@ -0,0 +1,66 @@
+package coreapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestInitTracing_UnknownExporter_ReturnErr(t *testing.T) {
+	_, err := initTracing(tracingConfig{Exporter: "zipkin"})
+	assert.NotNil(t, err)
+}
+
+func TestInitTracing_FileExporter_FlushAndCloseFile(t *testing.T) {
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	dir, err := ioutil.TempDir("", "tracing")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spans.json")
+
+	shutdown, err := initTracing(tracingConfig{Exporter: tracingExporterFile, File: path, SampleRatio: 1})
+	assert.Nil(t, err)
+	_, span := otel.Tracer(tracerName).Start(context.Background(), "get_card")
+	span.End()
+
+	assert.Nil(t, shutdown(context.Background()))
+	b, _ := ioutil.ReadFile(path)
+	assert.Contains(t, string(b), `"Name":"get_card"`)
+	// the file is closed: the second close fails
+	assert.NotNil(t, shutdown(context.Background()))
+}
+
+func TestTraceMiddleware_Traceparent_ContinueClientTrace(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	handler := func(req *http.Request) (interface{}, error) {
+		return nil, InternalServerErr
+	}
+	r := httptest.NewRequest(http.MethodGet, "/v4/card/1", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.Header.Set(RequestIDHeader, "req-1")
+	traceMiddleware("get_card")(wrapAPIHandler(new(fakeLogger), nil)(handler)).ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := sr.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "get_card", spans[0].Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Contains(t, spans[0].Attributes(), attribute.Int("http.response.status_code", 500))
+	assert.Contains(t, spans[0].Attributes(), attribute.String("virgild.request_id", "req-1"))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/pkg/errors"
+)
+
+const (
+	// listenFDsEnv is set by the parent process which hands off listening sockets to an upgraded binary.
+	// It contains descriptors of the sockets by name, e.g. http=3,grpc=4
+	listenFDsEnv = "VIRGILD_LISTEN_FDS"
+	// readyFDEnv contains descriptor of the pipe which the new process writes to when it is ready to take over
+	readyFDEnv = "VIRGILD_READY_FD"
+	// systemd socket activation passes sockets starting from descriptor 3
+	systemdFirstFD = 3
+
+	httpListener = "http"
+	grpcListener = "grpc"
+)
+
+// inheritedListeners returns listening sockets handed off by the previous VirgilD process by name
+func inheritedListeners() (map[string]net.Listener, error) {
+	v := os.Getenv(listenFDsEnv)
+	os.Unsetenv(listenFDsEnv)
+	lns := make(map[string]net.Listener)
+	if v == "" {
+		return lns, nil
+	}
+	for _, pair := range strings.Split(v, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		var (
+			fd  int
+			err error
+		)
+		if len(parts) == 2 {
+			fd, err = strconv.Atoi(parts[1])
+		}
+		if len(parts) != 2 || err != nil {
+			closeListeners(lns)
+			return nil, fmt.Errorf("Listen: invalid %v (%v)", listenFDsEnv, v)
+		}
+		ln, err := fileListener(fd, "inherited "+parts[0])
+		if err != nil {
+			closeListeners(lns)
+			return nil, err
+		}
+		lns[parts[0]] = ln
+	}
+	return lns, nil
+}
+
+// listen returns listening socket inherited from the previous VirgilD process, passed by systemd or a new one.
+// systemd sockets are used for HTTP API only. The taken socket is removed from inherited.
+func listen(name, address string, inherited map[string]net.Listener) (net.Listener, error) {
+	if ln, ok := inherited[name]; ok {
+		delete(inherited, name)
+		return ln, nil
+	}
+
+	if pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID")); name == httpListener && pid == os.Getpid() {
+		count, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+		if count != 1 {
+			return nil, fmt.Errorf("Listen: systemd passed %v sockets, exactly one is supported", count)
+		}
+		return fileListener(systemdFirstFD, "systemd")
+	}
+
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Listen: address (%v)", address)
+	}
+	return ln, nil
+}
+
+func fileListener(fd int, name string) (net.Listener, error) {
+	f := os.NewFile(uintptr(fd), name)
+	if f == nil {
+		return nil, fmt.Errorf("Listen: invalid %v descriptor (%v)", name, fd)
+	}
+	defer f.Close()
+
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Listen: %v socket (%v)", name, fd)
+	}
+	return ln, nil
+}
+
+func closeListeners(lns map[string]net.Listener) {
+	for _, ln := range lns {
+		ln.Close()
+	}
+}
+
+// setReadyNotifier makes the process notify the previous one through the inherited pipe when it is ready
+func setReadyNotifier() error {
+	v := os.Getenv(readyFDEnv)
+	os.Unsetenv(readyFDEnv)
+	if v == "" {
+		return nil
+	}
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("Listen: invalid %v (%v)", readyFDEnv, v)
+	}
+	f := os.NewFile(uintptr(fd), "ready")
+	if f == nil {
+		return fmt.Errorf("Listen: invalid ready descriptor (%v)", fd)
+	}
+	coreapi.SetReadyNotifier(func() {
+		f.Write([]byte{1})
+		f.Close()
+	})
+	return nil
+}
@@ -0,0 +1,68 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// listenerFD returns duplicate of the socket descriptor which isn't owned by os.File
+func listenerFD(t *testing.T, ln net.Listener) int {
+	f, err := ln.(*net.TCPListener).File()
+	assert.Nil(t, err)
+	defer f.Close()
+	fd, err := syscall.Dup(int(f.Fd()))
+	assert.Nil(t, err)
+	return fd
+}
+
+func TestInheritedListeners_HTTPAndGRPC_ReturnByName(t *testing.T) {
+	httpLn, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer httpLn.Close()
+	grpcLn, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer grpcLn.Close()
+	os.Setenv(listenFDsEnv, fmt.Sprintf("http=%d,grpc=%d", listenerFD(t, httpLn), listenerFD(t, grpcLn)))
+
+	lns, err := inheritedListeners()
+	assert.Nil(t, err)
+	defer closeListeners(lns)
+
+	assert.Equal(t, "", os.Getenv(listenFDsEnv))
+	assert.Equal(t, httpLn.Addr().String(), lns[httpListener].Addr().String())
+	assert.Equal(t, grpcLn.Addr().String(), lns[grpcListener].Addr().String())
+}
+
+func TestInheritedListeners_Invalid_ReturnErr(t *testing.T) {
+	os.Setenv(listenFDsEnv, "http")
+
+	_, err := inheritedListeners()
+
+	assert.NotNil(t, err)
+}
+
+func TestListen_Inherited_TakeInheritedSocket(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer ln.Close()
+	inherited := map[string]net.Listener{grpcListener: ln}
+
+	got, err := listen(grpcListener, "127.0.0.1:0", inherited)
+
+	assert.Nil(t, err)
+	assert.Equal(t, ln, got)
+	assert.Empty(t, inherited)
+}
+
+func TestListen_NotInherited_ListenAddress(t *testing.T) {
+	ln, err := listen(grpcListener, "127.0.0.1:0", map[string]net.Listener{})
+	assert.Nil(t, err)
+	defer ln.Close()
+
+	assert.NotEqual(t, "127.0.0.1:0", ln.Addr().String())
+}
@@ -0,0 +1,94 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// handOffSignal makes VirgilD hand off listening sockets to a new process and exit
+var handOffSignal os.Signal = syscall.SIGUSR2
+
+// handOff starts the current binary (it may be replaced on disk by a new version) with the listening sockets.
+// The new process accepts connections on the same sockets, so the old one can drain and exit without downtime.
+// The returned channel receives nil when the new process is ready to take over, or an error if it exits before.
+func handOff(lns map[string]net.Listener) (*os.Process, <-chan error, error) {
+	names := make([]string, 0, len(lns))
+	for name := range lns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		files []*os.File
+		fds   []string
+	)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, name := range names {
+		tl, ok := lns[name].(*net.TCPListener)
+		if !ok {
+			return nil, nil, fmt.Errorf("Hand off: unsupported %v listener %T", name, lns[name])
+		}
+		f, err := tl.File()
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Hand off: get %v socket file", name)
+		}
+		// ExtraFiles[i] becomes descriptor 3+i in the child
+		fds = append(fds, fmt.Sprintf("%v=%d", name, systemdFirstFD+len(files)))
+		files = append(files, f)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Hand off: create ready pipe")
+	}
+	readyFD := systemdFirstFD + len(files)
+	files = append(files, w)
+
+	path, err := os.Executable()
+	if err != nil {
+		r.Close()
+		return nil, nil, errors.Wrap(err, "Hand off: get executable path")
+	}
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("%v=%v", listenFDsEnv, strings.Join(fds, ",")),
+		fmt.Sprintf("%v=%d", readyFDEnv, readyFD))
+	if err = cmd.Start(); err != nil {
+		r.Close()
+		return nil, nil, errors.Wrap(err, "Hand off: start process")
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		defer r.Close()
+		// the pipe is closed without data if the new process exits
+		if n, _ := r.Read(make([]byte, 1)); n == 1 {
+			ready <- nil
+			return
+		}
+		err := cmd.Wait()
+		if err == nil {
+			err = errors.New("exit status 0")
+		}
+		ready <- errors.Wrapf(err, "Hand off: process %v exited before it was ready", cmd.Process.Pid)
+	}()
+	return cmd.Process, ready, nil
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"net"
+	"os"
+)
+
+// handOffSignal is nil: there is no SIGUSR2 on Windows
+var handOffSignal os.Signal
+
+// handOff isn't supported on Windows: listening sockets can't be inherited by a new process
+func handOff(lns map[string]net.Listener) (*os.Process, <-chan error, error) {
+	return nil, nil, errors.New("Hand off: not supported on Windows")
+}
@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/VirgilSecurity/virgild/coreapi"
 	"github.com/VirgilSecurity/virgild/modules/card"
 	"github.com/VirgilSecurity/virgild/modules/healthcheck"
 	_ "github.com/VirgilSecurity/virgild/plugins/cache"
 	_ "github.com/VirgilSecurity/virgild/plugins/logs"
+	_ "github.com/VirgilSecurity/virgild/plugins/ratelimit"
 	"github.com/namsral/flag"
-	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
 )
 
 var (
@@ -17,58 +26,156 @@ var (
 	httpsEnabled     bool
 	httpsCertificate string
 	httpsPrivateKey  string
+	shutdownTimeout  time.Duration
+	grpcAddress      string
 )
-var rpc = prometheus.NewSummary(prometheus.SummaryOpts{
-	Name:      "duration_seconds",
-	Subsystem: "http",
-	Help:      "HTTP handler latency in seconds",
-	Namespace: "virgild",
-})
 
 func init() {
 	flag.StringVar(&address, "address", ":8080", "Address of service")
 	flag.BoolVar(&httpsEnabled, "https-enabled", false, "Enable HTTPS mode")
 	flag.StringVar(&httpsCertificate, "https-certificate", "", "The path of the certificate file")
 	flag.StringVar(&httpsPrivateKey, "https-private-key", "", "The path of private key file")
-
-	prometheus.MustRegister(rpc)
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "Time to finish in-flight requests on shutdown")
+	flag.StringVar(&grpcAddress, "grpc-address", "", "Address of gRPC API (empty - disabled)")
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		os.Exit(auditCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(configCommand(os.Args[2:]))
+	}
 	flag.Parse()
+	if err := loadConfig(); err != nil {
+		log.Fatalln(err)
+	}
+	if err := setReadyNotifier(); err != nil {
+		log.Fatalln(err)
+	}
 
 	c := coreapi.Init()
 	card.Init(c)
 	healthcheck.Init(c)
 
-	c.Common.Logger.Info("Start listening address %v ...", address)
+	inherited, err := inheritedListeners()
+	if err != nil {
+		c.Common.Logger.Err("%+v", err)
+		os.Exit(-1)
+	}
+	ln, err := listen(httpListener, address, inherited)
+	if err != nil {
+		c.Common.Logger.Err("%+v", err)
+		os.Exit(-1)
+	}
+	listeners := map[string]net.Listener{httpListener: ln}
+	c.Common.Logger.Info("Start listening address %v (instance %v) ...", ln.Addr(), coreapi.InstanceID())
+
+	srv := &http.Server{Handler: c.HTTP.AccessLog(c.HTTP.Metrics(corsHandler(c.HTTP.Handler)))}
+	srv.RegisterOnShutdown(coreapi.Drain)
+	serveErr := make(chan error, 1)
+	go func() {
+		if httpsEnabled {
+			serveErr <- srv.ServeTLS(ln, httpsCertificate, httpsPrivateKey)
+		} else {
+			serveErr <- srv.Serve(ln)
+		}
+	}()
+
+	grpcErr := make(chan error, 1)
+	if grpcAddress != "" {
+		gln, err := listen(grpcListener, grpcAddress, inherited)
+		if err != nil {
+			c.Common.Logger.Err("gRPC listen: %+v", err)
+			os.Exit(-1)
+		}
+		listeners[grpcListener] = gln
+		c.Common.Logger.Info("Start gRPC listening address %v ...", gln.Addr())
+		go func() {
+			grpcErr <- c.GRPC.Server.Serve(gln)
+		}()
+	}
+	// sockets of APIs which are disabled by the new configuration
+	closeListeners(inherited)
+	coreapi.NotifyReady()
 
-	http.Handle("/", corsHandler(httpDuration(c.HTTP.Router)))
-	var err error
-	if httpsEnabled {
-		err = http.ListenAndServeTLS(address, httpsCertificate, httpsPrivateKey, nil)
-	} else {
-		err = http.ListenAndServe(address, nil)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+	if handOffSignal != nil {
+		signal.Notify(sig, handOffSignal)
+	}
+	// handedOff receives the result of hand-off in progress, the process serves until the new one is ready
+	var handedOff <-chan error
+	for running := true; running; {
+		select {
+		case err = <-serveErr:
+			c.Common.Logger.Err("HTTP server return err: %v", err)
+			running = false
+		case err = <-grpcErr:
+			c.Common.Logger.Err("gRPC server return err: %v", err)
+			running = false
+		case err = <-handedOff:
+			handedOff = nil
+			if err != nil {
+				c.Common.Logger.Err("%+v, keep serving", err)
+				continue
+			}
+			c.Common.Logger.Info("Listening sockets are handed off, shutting down, drain timeout %v ...", shutdownTimeout)
+			running = false
+		case s := <-sig:
+			if s == handOffSignal {
+				if handedOff != nil {
+					c.Common.Logger.Warn("Hand-off is in progress, signal %v is ignored", s)
+					continue
+				}
+				p, ready, err := handOff(listeners)
+				if err != nil {
+					c.Common.Logger.Err("%+v", err)
+					continue
+				}
+				c.Common.Logger.Info("Handing off listening sockets to process %v, serve until it is ready ...", p.Pid)
+				handedOff = ready
+				continue
+			}
+			c.Common.Logger.Info("Shutting down (signal %v), drain timeout %v ...", s, shutdownTimeout)
+			running = false
+		}
 	}
 
-	if err != nil {
-		c.Common.Logger.Err("HTTP server return err: %v", err)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err = srv.Shutdown(ctx); err != nil {
+		c.Common.Logger.Err("HTTP server shutdown: %v", err)
+	}
+	stopGRPC(ctx, c.GRPC.Server)
+	if err = c.Common.Shutdown(ctx); err != nil {
+		c.Common.Logger.Err("Shutdown: %v", err)
+	}
+	if err = c.Common.CloseLogger(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "Shutdown: close logger:", err)
 	}
 }
 
-func httpDuration(hander http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		t := prometheus.NewTimer(rpc)
-		hander.ServeHTTP(w, r)
-		t.ObserveDuration()
-	})
+// stopGRPC waits for in-flight calls until ctx is done, then closes connections
+func stopGRPC(ctx context.Context, s *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.Stop()
+	}
 }
+
 func corsHandler(hander http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, DELETE, PUT")
-		w.Header().Set("Access-Control-Allow-Headers", "X-Virgil-Request-Id, X-Virgil-Request-Sign, X-Virgil-Response-Id, X-Virgil-Response-Sign, X-Virgil-Access-Token, X-Virgil-Application-Token, X-Virgil-Request-Uuid, X-Virgil-Request-Sign-Virgil-Card-ID, X-Virgil-Request-Sign-Pk-Id, X-Virgil-Authentication, Content-Type, User-Agent, Origin, Authorization, Accept, DNT, X-Requested-With, If-Modified-Since, Cache-Control")
-		w.Header().Set("Access-Control-Expose-Headers", "X-Virgil-Response-Id, X-Virgil-Response-Sign")
+		w.Header().Set("Access-Control-Allow-Headers", "X-Virgil-Request-Id, X-Virgil-Request-Sign, X-Virgil-Response-Id, X-Virgil-Response-Sign, X-Virgil-Access-Token, X-Virgil-Application-Token, X-Virgil-Request-Uuid, X-Virgil-Request-Sign-Virgil-Card-ID, X-Virgil-Request-Sign-Pk-Id, X-Virgil-Authentication, Content-Type, User-Agent, Origin, Authorization, Accept, DNT, X-Requested-With, If-Modified-Since, Cache-Control, traceparent, tracestate")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Virgil-Request-Id, X-Virgil-Response-Id, X-Virgil-Response-Sign, X-Virgil-Chain, X-Virgil-Offline, X-Virgil-Last-Sync")
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
@@ -0,0 +1,92 @@
+package card
+
+import (
+	"context"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/VirgilSecurity/virgild/modules/card/audit"
+	"github.com/VirgilSecurity/virgild/modules/card/core"
+	"github.com/pkg/errors"
+	virgil "gopkg.in/virgil.v4"
+)
+
+type auditAppender interface {
+	Append(r audit.Record) error
+}
+
+// auditCardMiddleware records every card changing operation and its outcome to the audit log
+type auditCardMiddleware struct {
+	log auditAppender
+}
+
+func (a *auditCardMiddleware) record(ctx context.Context, r audit.Record, err error) {
+	r.RequestID = coreapi.GetRequestID(ctx)
+	if owner := core.GetOwnerRequest(ctx); owner != "" {
+		r.Owner = coreapi.HashToken(owner)
+	}
+	r.Outcome = audit.OutcomeSuccess
+	if errors.Cause(err) == coreapi.RequestQueuedErr {
+		r.Outcome = audit.OutcomeQueued
+	} else if err != nil {
+		r.Outcome = audit.OutcomeFailure
+		if apiErr, ok := errors.Cause(err).(coreapi.APIError); ok {
+			r.ErrorCode = apiErr.Code
+		}
+	}
+	if aerr := a.log.Append(r); aerr != nil {
+		coreapi.GetLogger(ctx).Err("Audit %v: %+v", r.Operation, aerr)
+	}
+}
+
+func (a *auditCardMiddleware) CreateCard(f core.CreateCardHandler) core.CreateCardHandler {
+	return func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
+		card, err := f(ctx, req)
+		r := audit.Record{
+			Operation:    "create_card",
+			Identity:     req.Info.Identity,
+			IdentityType: req.Info.IdentityType,
+			Scope:        string(req.Info.Scope),
+		}
+		if card != nil {
+			r.CardID = card.ID
+		}
+		a.record(ctx, r, err)
+		return card, err
+	}
+}
+
+func (a *auditCardMiddleware) RevokeCard(f core.RevokeCardHandler) core.RevokeCardHandler {
+	return func(ctx context.Context, req *core.RevokeCardRequest) error {
+		err := f(ctx, req)
+		a.record(ctx, audit.Record{
+			Operation: "revoke_card",
+			CardID:    req.Info.ID,
+			Reason:    string(req.Info.RevocationReason),
+		}, err)
+		return err
+	}
+}
+
+func (a *auditCardMiddleware) CreateRelation(f core.CreateRelationHandler) core.CreateRelationHandler {
+	return func(ctx context.Context, req *core.CreateRelationRequest) (*virgil.CardResponse, error) {
+		card, err := f(ctx, req)
+		a.record(ctx, audit.Record{
+			Operation: "create_relation",
+			CardID:    req.ID,
+		}, err)
+		return card, err
+	}
+}
+
+func (a *auditCardMiddleware) RevokeRelation(f core.RevokeRelationHandler) core.RevokeRelationHandler {
+	return func(ctx context.Context, req *core.RevokeRelationRequest) (*virgil.CardResponse, error) {
+		card, err := f(ctx, req)
+		a.record(ctx, audit.Record{
+			Operation:      "revoke_relation",
+			CardID:         req.ID,
+			RelationCardID: req.Info.ID,
+			Reason:         string(req.Info.RevocationReason),
+		}, err)
+		return card, err
+	}
+}
@@ -0,0 +1,291 @@
+// Package audit implements append-only log of card operations.
+// Every record contains hash of the previous record, so a modified or removed record breaks the chain.
+// If the log is keyed, hashes are HMAC, so the chain cannot be recomputed without the key.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/pkg/errors"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	// OutcomeQueued is the outcome of an operation which is stored by offline mode and is sent to the upstream later
+	OutcomeQueued = "queued"
+)
+
+// GenesisHash is previous hash of the first record
+var GenesisHash = strings.Repeat("0", sha256.Size*2)
+
+type Record struct {
+	Seq            uint64 `json:"seq"`
+	Time           string `json:"time"`
+	Operation      string `json:"operation"`
+	RequestID      string `json:"request_id,omitempty"`
+	Owner          string `json:"owner,omitempty"`
+	CardID         string `json:"card_id,omitempty"`
+	Identity       string `json:"identity,omitempty"`
+	IdentityType   string `json:"identity_type,omitempty"`
+	Scope          string `json:"scope,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+	RelationCardID string `json:"relation_card_id,omitempty"`
+	Outcome        string `json:"outcome"`
+	ErrorCode      int    `json:"error_code,omitempty"`
+	PrevHash       string `json:"prev_hash"`
+	Hash           string `json:"hash,omitempty"`
+}
+
+// calcHash returns hash of the record without Hash field (HMAC-SHA256 if the key is set)
+func (r Record) calcHash(key []byte) (string, error) {
+	r.Hash = ""
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	if len(key) == 0 {
+		h := sha256.Sum256(b)
+		return hex.EncodeToString(h[:]), nil
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Log appends records to audit file
+type Log struct {
+	sync.Mutex
+	file     *os.File
+	path     string
+	key      []byte
+	size     int64
+	seq      uint64
+	prevHash string
+	// failed is set if a failed write could not be removed from the file. The chain is broken then,
+	// so records are not appended any more.
+	failed error
+	now    func() time.Time
+}
+
+// Open opens audit file for appending. The existing chain is verified before, so records are never appended
+// to a tampered log. The key of HMAC is optional (nil - records are hashed by SHA-256).
+func Open(ctx context.Context, path string, key []byte) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Open audit log (%v)", path)
+	}
+	// the previous process writes the file until it exits after hand off of listening sockets
+	if err = coreapi.LockFile(ctx, f); err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "Open audit log (%v)", path)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "Open audit log (%v)", path)
+	}
+	size, err := completeSize(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "Open audit log (%v)", path)
+	}
+	// the broken chain fails complete records only, the last line without newline is a write torn by a crash
+	count, last, err := Verify(io.NewSectionReader(f, 0, size), key)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "Open audit log (%v)", path)
+	}
+	if size != info.Size() {
+		if err = f.Truncate(size); err != nil {
+			f.Close()
+			return nil, errors.Wrapf(err, "Open audit log (%v): truncate torn record", path)
+		}
+		coreapi.GetLogger(ctx).Warn("Audit log (%v): torn record of %d bytes after record %d is truncated", path, info.Size()-size, last.Seq)
+	}
+	l := &Log{file: f, path: path, key: key, size: size, prevHash: GenesisHash, now: time.Now}
+	if count != 0 {
+		l.seq = last.Seq
+		l.prevHash = last.Hash
+	}
+	return l, nil
+}
+
+// completeSize returns size of the file without the trailing line which has no newline
+func completeSize(f *os.File, size int64) (int64, error) {
+	buf := make([]byte, 4096)
+	for end := size; end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		n, err := f.ReadAt(buf[:end-start], start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// ReadKey reads the secret key (of HMAC or of the offline queue) from the file. Leading and trailing white space
+// is ignored.
+func ReadKey(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Read key (%v)", path)
+	}
+	key := []byte(strings.TrimSpace(string(b)))
+	if len(key) == 0 {
+		return nil, fmt.Errorf("Read key (%v): file is empty", path)
+	}
+	return key, nil
+}
+
+// Head returns sequence number and hash of the last record. Store them outside of the host to detect
+// truncation of the log.
+func (l *Log) Head() (uint64, string) {
+	l.Lock()
+	defer l.Unlock()
+	return l.seq, l.prevHash
+}
+
+// Append chains the record to the log and writes it to disk
+func (l *Log) Append(r Record) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.failed != nil {
+		return errors.Wrap(l.failed, "Audit log: failed")
+	}
+	r.Seq = l.seq + 1
+	r.Time = l.now().UTC().Format(time.RFC3339Nano)
+	r.PrevHash = l.prevHash
+	h, err := r.calcHash(l.key)
+	if err != nil {
+		return errors.Wrap(err, "Audit log: hash record")
+	}
+	r.Hash = h
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "Audit log: marshal record")
+	}
+	b = append(b, '\n')
+	if _, err = l.file.Write(b); err != nil {
+		return l.rollback(errors.Wrap(err, "Audit log: write record"))
+	}
+	if err = l.file.Sync(); err != nil {
+		return l.rollback(errors.Wrap(err, "Audit log: sync"))
+	}
+	l.size += int64(len(b))
+	l.seq = r.Seq
+	l.prevHash = r.Hash
+	return nil
+}
+
+// rollback removes partially written record, so the file stays consistent with the chain in memory.
+// The log is marked failed if the file cannot be truncated.
+func (l *Log) rollback(err error) error {
+	if terr := l.file.Truncate(l.size); terr != nil {
+		l.failed = errors.Wrapf(terr, "truncate after failed append (%v)", err)
+		return errors.Wrap(l.failed, "Audit log")
+	}
+	return err
+}
+
+// Check reports whether records are still written to the audit file (it was not removed or replaced)
+func (l *Log) Check(ctx context.Context) (interface{}, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.failed != nil {
+		return nil, errors.Wrap(l.failed, "Audit log: failed")
+	}
+	opened, err := l.file.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "Audit log: stat opened file")
+	}
+	current, err := os.Stat(l.path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Audit log: stat file (%v)", l.path)
+	}
+	if !os.SameFile(opened, current) {
+		return nil, fmt.Errorf("Audit log: file (%v) was replaced", l.path)
+	}
+	return map[string]uint64{"records": l.seq}, nil
+}
+
+func (l *Log) Close() error {
+	l.Lock()
+	defer l.Unlock()
+
+	if err := l.file.Sync(); err != nil {
+		return errors.Wrap(err, "Audit log: sync")
+	}
+	return l.file.Close()
+}
+
+// Verify checks hash chain of the log with the key of HMAC (nil - SHA-256). It returns count of records and the last record.
+func Verify(r io.Reader, key []byte) (int, Record, error) {
+	return VerifyFunc(r, key, nil)
+}
+
+// VerifyFunc checks hash chain of the log like Verify and calls f for every valid record (e.g. to find the head
+// stored outside of the host)
+func VerifyFunc(r io.Reader, key []byte, f func(rec Record)) (int, Record, error) {
+	var (
+		count int
+		last  Record
+	)
+	prevHash := GenesisHash
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		line := count + 1
+		var rec Record
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			return count, last, errors.Wrapf(err, "Audit log: line %d: unmarshal record", line)
+		}
+		if rec.Seq != uint64(line) {
+			return count, last, fmt.Errorf("Audit log: line %d: unexpected sequence number %d", line, rec.Seq)
+		}
+		if rec.PrevHash != prevHash {
+			return count, last, fmt.Errorf("Audit log: line %d: previous hash mismatch", line)
+		}
+		h, err := rec.calcHash(key)
+		if err != nil {
+			return count, last, errors.Wrapf(err, "Audit log: line %d: hash record", line)
+		}
+		if rec.Hash != h {
+			return count, last, fmt.Errorf("Audit log: line %d: record hash mismatch (modified record or wrong key)", line)
+		}
+		if f != nil {
+			f(rec)
+		}
+		prevHash = rec.Hash
+		last = rec
+		count++
+	}
+	if err := s.Err(); err != nil {
+		return count, last, errors.Wrap(err, "Audit log: read")
+	}
+	return count, last, nil
+}
@@ -0,0 +1,265 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeLog(t *testing.T, records ...Record) string {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.Nil(t, err)
+	path := filepath.Join(dir, "audit.log")
+
+	l, err := Open(context.Background(), path, nil)
+	assert.Nil(t, err)
+	for _, r := range records {
+		assert.Nil(t, l.Append(r))
+	}
+	l.Close()
+	return path
+}
+
+func TestAppend_ChainRecords(t *testing.T) {
+	path := makeLog(t, Record{Operation: "create_card", CardID: "1"}, Record{Operation: "revoke_card", CardID: "1"})
+	defer os.RemoveAll(filepath.Dir(path))
+
+	f, _ := os.Open(path)
+	defer f.Close()
+	count, last, err := Verify(f, nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, uint64(2), last.Seq)
+	assert.Equal(t, "revoke_card", last.Operation)
+}
+
+func TestOpen_ExistedLog_ContinueChain(t *testing.T) {
+	path := makeLog(t, Record{Operation: "create_card"})
+	defer os.RemoveAll(filepath.Dir(path))
+
+	l, err := Open(context.Background(), path, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, l.Append(Record{Operation: "revoke_card"}))
+	l.Close()
+
+	b, _ := ioutil.ReadFile(path)
+	count, last, err := Verify(bytes.NewReader(b), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, uint64(2), last.Seq)
+}
+
+func TestVerify_ModifiedRecord_ReturnErr(t *testing.T) {
+	path := makeLog(t, Record{Operation: "create_card", Identity: "alice"}, Record{Operation: "revoke_card"})
+	defer os.RemoveAll(filepath.Dir(path))
+
+	b, _ := ioutil.ReadFile(path)
+	tampered := strings.Replace(string(b), "alice", "mallory", 1)
+	count, _, err := Verify(strings.NewReader(tampered), nil)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestVerify_RemovedRecord_ReturnErr(t *testing.T) {
+	path := makeLog(t, Record{Operation: "create_card"}, Record{Operation: "create_relation"}, Record{Operation: "revoke_card"})
+	defer os.RemoveAll(filepath.Dir(path))
+
+	b, _ := ioutil.ReadFile(path)
+	lines := strings.SplitAfter(string(b), "\n")
+	count, _, err := Verify(strings.NewReader(lines[0]+lines[2]), nil)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestOpen_TamperedLog_ReturnErr(t *testing.T) {
+	path := makeLog(t, Record{Operation: "create_card", Identity: "alice"})
+	defer os.RemoveAll(filepath.Dir(path))
+
+	b, _ := ioutil.ReadFile(path)
+	ioutil.WriteFile(path, []byte(strings.Replace(string(b), "alice", "mallory", 1)), 0600)
+
+	_, err := Open(context.Background(), path, nil)
+	assert.NotNil(t, err)
+}
+
+func TestOpen_TornLastRecord_TruncateRecord(t *testing.T) {
+	path := makeLog(t, Record{Operation: "create_card", CardID: "1"}, Record{Operation: "revoke_card", CardID: "1"})
+	defer os.RemoveAll(filepath.Dir(path))
+	b, _ := ioutil.ReadFile(path)
+	lines := strings.SplitAfter(string(b), "\n")
+	// the crash interrupted write of a copy of the second record
+	torn := lines[1][:len(lines[1])/2]
+	ioutil.WriteFile(path, append(b, torn...), 0600)
+
+	l, err := Open(context.Background(), path, nil)
+	assert.Nil(t, err)
+	seq, _ := l.Head()
+	assert.Equal(t, uint64(2), seq)
+	assert.Nil(t, l.Append(Record{Operation: "create_card", CardID: "2"}))
+	l.Close()
+
+	f, _ := os.Open(path)
+	defer f.Close()
+	count, _, err := Verify(f, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+}
+
+func TestCheck_FileRemoved_ReturnErr(t *testing.T) {
+	path := makeLog(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	l, err := Open(context.Background(), path, nil)
+	assert.Nil(t, err)
+	defer l.Close()
+
+	_, err = l.Check(context.Background())
+	assert.Nil(t, err)
+
+	os.Remove(path)
+	_, err = l.Check(context.Background())
+	assert.NotNil(t, err)
+}
+
+func TestVerify_KeyedLog_RequireKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	l, err := Open(context.Background(), path, []byte("secret"))
+	assert.Nil(t, err)
+	assert.Nil(t, l.Append(Record{Operation: "create_card"}))
+	l.Close()
+
+	b, _ := ioutil.ReadFile(path)
+	count, _, err := Verify(bytes.NewReader(b), []byte("secret"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	_, _, err = Verify(bytes.NewReader(b), nil)
+	assert.NotNil(t, err)
+	_, _, err = Verify(bytes.NewReader(b), []byte("other"))
+	assert.NotNil(t, err)
+}
+
+func TestOpen_KeyedLogRecomputedWithoutKey_ReturnErr(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	l, err := Open(context.Background(), path, []byte("secret"))
+	assert.Nil(t, err)
+	assert.Nil(t, l.Append(Record{Operation: "create_card", Identity: "alice"}))
+	l.Close()
+
+	// the chain is recomputed by somebody who doesn't know the key
+	forged := path + ".forged"
+	fl, err := Open(context.Background(), forged, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, fl.Append(Record{Operation: "create_card", Identity: "mallory"}))
+	fl.Close()
+	assert.Nil(t, os.Rename(forged, path))
+
+	_, err = Open(context.Background(), path, []byte("secret"))
+	assert.NotNil(t, err)
+}
+
+func TestVerifyFunc_CallForEveryRecord(t *testing.T) {
+	path := makeLog(t, Record{Operation: "create_card"}, Record{Operation: "revoke_card"})
+	defer os.RemoveAll(filepath.Dir(path))
+
+	b, _ := ioutil.ReadFile(path)
+	var seqs []uint64
+	_, last, err := VerifyFunc(bytes.NewReader(b), nil, func(r Record) { seqs = append(seqs, r.Seq) })
+
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2}, seqs)
+	assert.Equal(t, uint64(2), last.Seq)
+}
+
+func TestLogRollback_PartialRecord_Truncated(t *testing.T) {
+	path := makeLog(t, Record{Operation: "create_card"})
+	defer os.RemoveAll(filepath.Dir(path))
+	l, err := Open(context.Background(), path, nil)
+	assert.Nil(t, err)
+	defer l.Close()
+
+	// a record is written partially
+	l.file.Write([]byte(`{"seq":2,"operat`))
+	assert.NotNil(t, l.rollback(errors.New("write failed")))
+	assert.Nil(t, l.Append(Record{Operation: "revoke_card"}))
+
+	b, _ := ioutil.ReadFile(path)
+	count, _, err := Verify(bytes.NewReader(b), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestLogAppend_WriteAndTruncateFailed_LogFailed(t *testing.T) {
+	path := makeLog(t, Record{Operation: "create_card"})
+	defer os.RemoveAll(filepath.Dir(path))
+	l, err := Open(context.Background(), path, nil)
+	assert.Nil(t, err)
+	defer l.Close()
+	// read only file cannot be written and truncated
+	l.file.Close()
+	l.file, err = os.Open(path)
+	assert.Nil(t, err)
+
+	assert.NotNil(t, l.Append(Record{Operation: "revoke_card"}))
+	assert.NotNil(t, l.Append(Record{Operation: "revoke_card"}))
+	_, err = l.Check(context.Background())
+	assert.NotNil(t, err)
+	seq, _ := l.Head()
+	assert.Equal(t, uint64(1), seq)
+}
+
+// TestHelperProcessAppend appends a record as another process. It's started by TestOpen_LogOpenedByOtherProcess_WaitAndContinueChain.
+func TestHelperProcessAppend(t *testing.T) {
+	path := os.Getenv("AUDIT_HELPER_PATH")
+	if path == "" {
+		return
+	}
+	l, err := Open(context.Background(), path, nil)
+	if err != nil {
+		os.Exit(1)
+	}
+	if err = l.Append(Record{Operation: "revoke_card", CardID: "child"}); err != nil {
+		os.Exit(1)
+	}
+	l.Close()
+	os.Exit(0)
+}
+
+func TestOpen_LogOpenedByOtherProcess_WaitAndContinueChain(t *testing.T) {
+	path := makeLog(t, Record{Operation: "create_card"})
+	defer os.RemoveAll(filepath.Dir(path))
+	parent, err := Open(context.Background(), path, nil)
+	assert.Nil(t, err)
+
+	// the child opens the log while the parent still writes it, like the process started by hand off
+	child := exec.Command(os.Args[0], "-test.run=TestHelperProcessAppend")
+	child.Env = append(os.Environ(), "AUDIT_HELPER_PATH="+path)
+	assert.Nil(t, child.Start())
+	time.Sleep(200 * time.Millisecond)
+	assert.Nil(t, parent.Append(Record{Operation: "create_card", CardID: "parent"}))
+	assert.Nil(t, parent.Close())
+	assert.Nil(t, child.Wait())
+
+	b, _ := ioutil.ReadFile(path)
+	count, last, err := Verify(bytes.NewReader(b), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, "child", last.CardID)
+}
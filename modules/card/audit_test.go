@@ -0,0 +1,94 @@
+package card
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/VirgilSecurity/virgild/modules/card/audit"
+	"github.com/VirgilSecurity/virgild/modules/card/core"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/virgil.v4"
+)
+
+type fakeAuditLog struct {
+	records []audit.Record
+	err     error
+}
+
+func (f *fakeAuditLog) Append(r audit.Record) error {
+	f.records = append(f.records, r)
+	return f.err
+}
+
+func TestAuditCreateCard_Success_RecordCard(t *testing.T) {
+	l := new(fakeAuditLog)
+	a := auditCardMiddleware{log: l}
+	ctx := coreapi.SetRequestID(core.SetOwnerRequest(context.Background(), "token"), "req-1")
+	req := &core.CreateCardRequest{Info: virgil.CardModel{Identity: "alice", IdentityType: "email", Scope: virgil.CardScope.Application}}
+
+	_, err := a.CreateCard(func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
+		return &virgil.CardResponse{ID: "card-1"}, nil
+	})(ctx, req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []audit.Record{{
+		Operation:    "create_card",
+		RequestID:    "req-1",
+		Owner:        coreapi.HashToken("token"),
+		CardID:       "card-1",
+		Identity:     "alice",
+		IdentityType: "email",
+		Scope:        string(virgil.CardScope.Application),
+		Outcome:      audit.OutcomeSuccess,
+	}}, l.records)
+}
+
+func TestAuditRevokeCard_APIError_RecordFailureCode(t *testing.T) {
+	l := new(fakeAuditLog)
+	a := auditCardMiddleware{log: l}
+	req := &core.RevokeCardRequest{Info: virgil.RevokeCardRequest{ID: "card-1"}}
+
+	err := a.RevokeCard(func(ctx context.Context, req *core.RevokeCardRequest) error {
+		return core.RevocationReasonIsEmptyErr
+	})(context.Background(), req)
+
+	assert.Equal(t, core.RevocationReasonIsEmptyErr, err)
+	assert.Len(t, l.records, 1)
+	assert.Equal(t, "revoke_card", l.records[0].Operation)
+	assert.Equal(t, "card-1", l.records[0].CardID)
+	assert.Equal(t, audit.OutcomeFailure, l.records[0].Outcome)
+	assert.Equal(t, core.RevocationReasonIsEmptyErr.Code, l.records[0].ErrorCode)
+	assert.Empty(t, l.records[0].Owner)
+}
+
+func TestAuditRevokeCard_Queued_RecordQueued(t *testing.T) {
+	l := new(fakeAuditLog)
+	a := auditCardMiddleware{log: l}
+	req := &core.RevokeCardRequest{Info: virgil.RevokeCardRequest{ID: "card-1"}}
+
+	err := a.RevokeCard(func(ctx context.Context, req *core.RevokeCardRequest) error {
+		return coreapi.RequestQueuedErr
+	})(context.Background(), req)
+
+	assert.Equal(t, coreapi.RequestQueuedErr, err)
+	assert.Len(t, l.records, 1)
+	assert.Equal(t, audit.OutcomeQueued, l.records[0].Outcome)
+	assert.Zero(t, l.records[0].ErrorCode)
+}
+
+func TestAuditRevokeRelation_AppendFailed_ReturnResult(t *testing.T) {
+	l := &fakeAuditLog{err: fmt.Errorf("disk is full")}
+	a := auditCardMiddleware{log: l}
+	expected := &virgil.CardResponse{ID: "card-1"}
+	req := &core.RevokeRelationRequest{ID: "card-1", Info: virgil.RevokeCardRequest{ID: "card-2"}}
+
+	actual, err := a.RevokeRelation(func(ctx context.Context, req *core.RevokeRelationRequest) (*virgil.CardResponse, error) {
+		return expected, nil
+	})(context.Background(), req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, expected, actual)
+	assert.Equal(t, "card-2", l.records[0].RelationCardID)
+}
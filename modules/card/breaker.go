@@ -0,0 +1,148 @@
+package card
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var breakerStateMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name:      "circuit_breaker_state",
+	Subsystem: "cards",
+	Namespace: "virgild",
+	Help:      "State of circuit breaker by upstream endpoint (0 - closed, 1 - open, 2 - half-open)",
+}, []string{"upstream", "endpoint"})
+
+func init() {
+	prometheus.MustRegister(breakerStateMetric)
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker opens after Threshold consecutive failures and rejects calls during OpenTimeout.
+// After that one probe call is allowed: success closes the breaker, failure opens it again.
+// Nil breaker allows all calls.
+type circuitBreaker struct {
+	sync.Mutex
+	Upstream    string
+	Endpoint    string
+	Threshold   int
+	OpenTimeout time.Duration
+
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+func newCircuitBreaker(upstream, endpoint string, threshold int, openTimeout time.Duration) *circuitBreaker {
+	b := &circuitBreaker{
+		Upstream:    upstream,
+		Endpoint:    endpoint,
+		Threshold:   threshold,
+		OpenTimeout: openTimeout,
+		now:         time.Now,
+	}
+	breakerStateMetric.WithLabelValues(upstream, endpoint).Set(float64(breakerClosed))
+	return b
+}
+
+func (b *circuitBreaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.Lock()
+	defer b.Unlock()
+
+	if b.state == breakerOpen && b.now().Sub(b.openedAt) >= b.OpenTimeout {
+		b.setState(breakerHalfOpen)
+	}
+	switch b.state {
+	case breakerOpen:
+		return false
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+	}
+	return true
+}
+
+func (b *circuitBreaker) Success() {
+	if b == nil {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	b.setState(breakerClosed)
+}
+
+func (b *circuitBreaker) Failure() {
+	if b == nil {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == breakerHalfOpen || (b.Threshold > 0 && b.failures >= b.Threshold) {
+		b.openedAt = b.now()
+		b.setState(breakerOpen)
+	}
+}
+
+// Release frees the probe slot of half-open breaker if the call result is unknown (e.g. the call was cancelled)
+func (b *circuitBreaker) Release() {
+	if b == nil {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+
+	b.probing = false
+}
+
+func (b *circuitBreaker) State() breakerState {
+	if b == nil {
+		return breakerClosed
+	}
+	b.Lock()
+	defer b.Unlock()
+
+	if b.state == breakerOpen && b.now().Sub(b.openedAt) >= b.OpenTimeout {
+		return breakerHalfOpen
+	}
+	return b.state
+}
+
+func (b *circuitBreaker) setState(s breakerState) {
+	if b.state == s {
+		return
+	}
+	b.state = s
+	breakerStateMetric.WithLabelValues(b.Upstream, b.Endpoint).Set(float64(s))
+}
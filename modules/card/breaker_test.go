@@ -0,0 +1,77 @@
+package card
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeBreaker(threshold int, openTimeout time.Duration) (*circuitBreaker, *time.Time) {
+	now := time.Now()
+	b := newCircuitBreaker("test", "test-endpoint", threshold, openTimeout)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestCircuitBreaker_Nil_Allow(t *testing.T) {
+	var b *circuitBreaker
+	b.Failure()
+
+	assert.True(t, b.Allow())
+	assert.Equal(t, breakerClosed, b.State())
+}
+
+func TestCircuitBreaker_FailuresLessThreshold_Closed(t *testing.T) {
+	b, _ := makeBreaker(3, time.Second)
+	b.Failure()
+	b.Failure()
+	b.Success()
+	b.Failure()
+
+	assert.True(t, b.Allow())
+	assert.Equal(t, breakerClosed, b.State())
+}
+
+func TestCircuitBreaker_FailuresReachThreshold_Open(t *testing.T) {
+	b, _ := makeBreaker(2, time.Second)
+	b.Failure()
+	b.Failure()
+
+	assert.False(t, b.Allow())
+	assert.Equal(t, breakerOpen, b.State())
+}
+
+func TestCircuitBreaker_OpenTimeoutElapsed_AllowOneProbe(t *testing.T) {
+	b, now := makeBreaker(1, time.Second)
+	b.Failure()
+	*now = now.Add(time.Second)
+
+	assert.Equal(t, breakerHalfOpen, b.State())
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow())
+}
+
+func TestCircuitBreaker_ProbeSuccess_Closed(t *testing.T) {
+	b, now := makeBreaker(1, time.Second)
+	b.Failure()
+	*now = now.Add(time.Second)
+	b.Allow()
+	b.Success()
+
+	assert.Equal(t, breakerClosed, b.State())
+	assert.True(t, b.Allow())
+}
+
+func TestCircuitBreaker_ProbeFailed_Open(t *testing.T) {
+	b, now := makeBreaker(5, time.Second)
+	for i := 0; i < 5; i++ {
+		b.Failure()
+	}
+	*now = now.Add(time.Second)
+	b.Allow()
+	b.Failure()
+
+	assert.Equal(t, breakerOpen, b.State())
+	assert.False(t, b.Allow())
+}
@@ -5,15 +5,51 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/VirgilSecurity/virgild/coreapi"
 	"github.com/VirgilSecurity/virgild/modules/card/core"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	virgil "gopkg.in/virgil.v4"
 )
 
+var cacheRequestsMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name:      "cache_requests_total",
+	Subsystem: "cards",
+	Namespace: "virgild",
+	Help:      "Count of card cache lookups by operation and result (hit, miss)",
+}, []string{"operation", "result"})
+
+func init() {
+	prometheus.MustRegister(cacheRequestsMetric)
+}
+
+func cacheResult(op string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheRequestsMetric.WithLabelValues(op, result).Inc()
+}
+
 type cacheCardMiddleware struct {
 	cache coreapi.Cache
+	// ttls are TTL of cached cards by tenant, they are replaced on reload of tenants
+	ttls *coreapi.Reloadable[map[string]time.Duration]
+}
+
+// set caches the value with TTL of the tenant of the request
+func (c cacheCardMiddleware) set(ctx context.Context, key string, val interface{}) {
+	if t := coreapi.GetTenant(ctx); t != nil {
+		if ttl, ok := c.ttls.Current()[t.Name]; ok {
+			if tc, ok := c.cache.(coreapi.TTLCache); ok {
+				tc.SetTTL(key, val, ttl)
+				return
+			}
+		}
+	}
+	c.cache.Set(key, val)
 }
 
 func (c *cacheCardMiddleware) GetCard(f core.GetCardHandler) core.GetCardHandler {
@@ -21,6 +57,7 @@ func (c *cacheCardMiddleware) GetCard(f core.GetCardHandler) core.GetCardHandler
 		owner := core.GetOwnerRequest(ctx)
 		key := getCardKey(owner, id)
 		has := c.cache.Get(key, &card)
+		cacheResult("get_card", has)
 
 		if has {
 			return card, err
@@ -28,7 +65,7 @@ func (c *cacheCardMiddleware) GetCard(f core.GetCardHandler) core.GetCardHandler
 
 		card, err = f(ctx, id)
 		if err == nil {
-			c.cache.Set(key, card)
+			c.set(ctx, key, card)
 		}
 
 		return card, err
@@ -63,9 +100,11 @@ func (c *cacheCardMiddleware) SearchCards(f core.SearchCardsHandler) core.Search
 				cards = append(cards, *card)
 			}
 			if cachePass {
+				cacheResult("search", true)
 				return cards, nil
 			}
 		}
+		cacheResult("search", false)
 
 		cards, err = f(ctx, crit)
 		if err != nil {
@@ -73,11 +112,11 @@ func (c *cacheCardMiddleware) SearchCards(f core.SearchCardsHandler) core.Search
 		}
 
 		for _, card := range cards {
-			c.cache.Set(getCardKey(owner, card.ID), card)
+			c.set(ctx, getCardKey(owner, card.ID), card)
 			ids = append(ids, card.ID)
 		}
 
-		c.cache.Set(key, ids)
+		c.set(ctx, key, ids)
 
 		return cards, nil
 	}
@@ -90,7 +129,7 @@ func (c cacheCardMiddleware) CreateCard(f core.CreateCardHandler) core.CreateCar
 			return nil, errors.Wrap(err, "Cache.CreateCard(send)")
 		}
 		key := getCardKey(core.GetOwnerRequest(ctx), card.ID)
-		c.cache.Set(key, card)
+		c.set(ctx, key, card)
 
 		return card, err
 	}
@@ -117,7 +156,7 @@ func (c cacheCardMiddleware) CreateRelations(f core.CreateRelationHandler) core.
 			return nil, errors.Wrap(err, "Cache.CreateRelations(send)")
 		}
 		key := getCardKey(core.GetOwnerRequest(ctx), card.ID)
-		c.cache.Set(key, card)
+		c.set(ctx, key, card)
 		return card, nil
 	}
 }
@@ -130,7 +169,7 @@ func (c cacheCardMiddleware) RevokeRelations(f core.RevokeRelationHandler) core.
 			return nil, errors.Wrap(err, "Cache.RevokeRelations(send)")
 		}
 		key := getCardKey(core.GetOwnerRequest(ctx), card.ID)
-		c.cache.Set(key, card)
+		c.set(ctx, key, card)
 		return card, nil
 	}
 }
@@ -48,7 +48,7 @@ func TestCacheGetCard_KeyExist_ReturnVal(t *testing.T) {
 
 	ctx := core.SetOwnerRequest(context.Background(), owner)
 
-	cacheCard := cacheCardMiddleware{cache}
+	cacheCard := cacheCardMiddleware{cache: cache}
 	actual, err := cacheCard.GetCard(func(ctx context.Context, id string) (*virgil.CardResponse, error) {
 		t.Fatal("Function executed")
 		return nil, nil
@@ -70,7 +70,7 @@ func TestCacheGetCard_KeyNotExist_FuncExecuted(t *testing.T) {
 
 	ctx := core.SetOwnerRequest(context.Background(), owner)
 
-	cacheCard := cacheCardMiddleware{cache}
+	cacheCard := cacheCardMiddleware{cache: cache}
 	actual, err := cacheCard.GetCard(func(ctx context.Context, id string) (*virgil.CardResponse, error) {
 		return expected, fmt.Errorf("ERROR")
 	})(ctx, id)
@@ -92,7 +92,7 @@ func TestCacheGetCard_FuncExecuted_SetCache(t *testing.T) {
 
 	ctx := core.SetOwnerRequest(context.Background(), owner)
 
-	cacheCard := cacheCardMiddleware{cache}
+	cacheCard := cacheCardMiddleware{cache: cache}
 	cacheCard.GetCard(func(ctx context.Context, id string) (*virgil.CardResponse, error) {
 		return expected, nil
 	})(ctx, id)
@@ -109,7 +109,7 @@ func TestCacheSearchCards_CacheMiss_FuncExecuted(t *testing.T) {
 	cache.On("Get", mock.Anything).Return(false)
 	cache.On("Set", mock.Anything, mock.Anything)
 
-	cacheCard := cacheCardMiddleware{cache}
+	cacheCard := cacheCardMiddleware{cache: cache}
 	cards, err := cacheCard.SearchCards(func(ctx context.Context, crit *virgil.Criteria) ([]virgil.CardResponse, error) {
 		return expected, nil
 	})(context.Background(), &virgil.Criteria{})
@@ -138,7 +138,7 @@ func TestCacheSearchCards_FuncExecuted_CacheSet(t *testing.T) {
 	cache.On("Set", owner+"_"+card2.ID, card2).Once()
 	cache.On("Set", searchKey, []string{"1", "2"}).Once()
 
-	cacheCard := cacheCardMiddleware{cache}
+	cacheCard := cacheCardMiddleware{cache: cache}
 	cacheCard.SearchCards(func(ctx context.Context, crit *virgil.Criteria) ([]virgil.CardResponse, error) {
 		return expected, nil
 	})(core.SetOwnerRequest(context.Background(), owner), crit)
@@ -165,7 +165,7 @@ func TestCacheSearchCards_CacheExist(t *testing.T) {
 	cache.On("Get", owner+"_"+card1.ID).Return(true, &card1)
 	cache.On("Get", owner+"_"+card2.ID).Return(true, &card2)
 
-	cacheCard := cacheCardMiddleware{cache}
+	cacheCard := cacheCardMiddleware{cache: cache}
 	cards, err := cacheCard.SearchCards(func(ctx context.Context, crit *virgil.Criteria) ([]virgil.CardResponse, error) {
 		t.Fatal("Function executed")
 		return nil, nil
@@ -191,7 +191,7 @@ func TestCacheSearchCards_CacheExist_OneOfCardIsMiss(t *testing.T) {
 	cache.On("Get", owner+"_2").Return(false)
 
 	funcExecuted := false
-	cacheCard := cacheCardMiddleware{cache}
+	cacheCard := cacheCardMiddleware{cache: cache}
 	cacheCard.SearchCards(func(ctx context.Context, crit *virgil.Criteria) ([]virgil.CardResponse, error) {
 		funcExecuted = true
 		return nil, fmt.Errorf("ERROR")
@@ -205,7 +205,7 @@ func TestCacheSearchCards_CacheMiss_FuncExecutedReturnErr(t *testing.T) {
 	cache.On("Get", mock.Anything).Return(false)
 	cache.On("Set", mock.Anything, mock.Anything)
 
-	cacheCard := cacheCardMiddleware{cache}
+	cacheCard := cacheCardMiddleware{cache: cache}
 	cards, err := cacheCard.SearchCards(func(ctx context.Context, crit *virgil.Criteria) ([]virgil.CardResponse, error) {
 		return nil, fmt.Errorf("ERROR")
 	})(context.Background(), &virgil.Criteria{})
@@ -232,7 +232,7 @@ func TestCacheCreateCard_FuncReturnVal(t *testing.T) {
 	cache := new(fakeCache)
 	cache.On("Set", mock.Anything, mock.Anything).Once()
 
-	cacheCard := cacheCardMiddleware{cache}
+	cacheCard := cacheCardMiddleware{cache: cache}
 	actual, err := cacheCard.CreateCard(func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
 		return expected, nil
 	})(context.Background(), nil)
@@ -250,7 +250,7 @@ func TestCacheCreateCard_SetKey(t *testing.T) {
 	cache := new(fakeCache)
 	cache.On("Set", owner+"_"+expected.ID, expected).Once()
 
-	cacheCard := cacheCardMiddleware{cache}
+	cacheCard := cacheCardMiddleware{cache: cache}
 	cacheCard.CreateCard(func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
 		return expected, nil
 	})(core.SetOwnerRequest(context.Background(), owner), nil)
@@ -274,7 +274,7 @@ func TestCacheRevokeCard_DelKey(t *testing.T) {
 	cache := new(fakeCache)
 	cache.On("Del", owner+"_"+id).Once()
 
-	cacheCard := cacheCardMiddleware{cache}
+	cacheCard := cacheCardMiddleware{cache: cache}
 	cacheCard.RevokeCard(func(ctx context.Context, req *core.RevokeCardRequest) error {
 		return nil
 	})(core.SetOwnerRequest(context.Background(), owner), &core.RevokeCardRequest{
@@ -304,7 +304,7 @@ func TestCacheCreateRelation_FuncReturnVal(t *testing.T) {
 	cache := new(fakeCache)
 	cache.On("Set", mock.Anything, mock.Anything).Once()
 
-	cacheCard := cacheCardMiddleware{cache}
+	cacheCard := cacheCardMiddleware{cache: cache}
 	actual, err := cacheCard.CreateRelations(func(ctx context.Context, req *core.CreateRelationRequest) (*virgil.CardResponse, error) {
 		return expected, nil
 	})(context.Background(), nil)
@@ -322,7 +322,7 @@ func TestCacheCreateRelation_SetKey(t *testing.T) {
 	cache := new(fakeCache)
 	cache.On("Set", owner+"_"+expected.ID, expected).Once()
 
-	cacheCard := cacheCardMiddleware{cache}
+	cacheCard := cacheCardMiddleware{cache: cache}
 	cacheCard.CreateRelations(func(ctx context.Context, req *core.CreateRelationRequest) (*virgil.CardResponse, error) {
 		return expected, nil
 	})(core.SetOwnerRequest(context.Background(), owner), nil)
@@ -348,7 +348,7 @@ func TestCacheRevokeRelation_FuncReturnVal(t *testing.T) {
 	cache := new(fakeCache)
 	cache.On("Set", mock.Anything, mock.Anything).Once()
 
-	cacheCard := cacheCardMiddleware{cache}
+	cacheCard := cacheCardMiddleware{cache: cache}
 	actual, err := cacheCard.RevokeRelations(func(ctx context.Context, req *core.RevokeRelationRequest) (*virgil.CardResponse, error) {
 		return expected, nil
 	})(context.Background(), nil)
@@ -366,7 +366,7 @@ func TestCacheRevokeRelation_SetKey(t *testing.T) {
 	cache := new(fakeCache)
 	cache.On("Set", owner+"_"+expected.ID, expected).Once()
 
-	cacheCard := cacheCardMiddleware{cache}
+	cacheCard := cacheCardMiddleware{cache: cache}
 	cacheCard.RevokeRelations(func(ctx context.Context, req *core.RevokeRelationRequest) (*virgil.CardResponse, error) {
 		return expected, nil
 	})(core.SetOwnerRequest(context.Background(), owner), nil)
@@ -6,7 +6,10 @@ import (
 	"encoding/json"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
+	"strconv"
+	"time"
 
 	virgil "gopkg.in/virgil.v4"
 
@@ -14,32 +17,99 @@ import (
 	"github.com/VirgilSecurity/virgild/modules/card/core"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var cloudDurationMetrics = prometheus.NewSummaryVec(prometheus.SummaryOpts{
-	Name:      "cards_service",
-	Subsystem: "cards",
-	Namespace: "virgild",
-}, []string{"type"})
+var (
+	cloudDurationMetrics = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:      "upstream_duration_seconds",
+		Subsystem: "cards",
+		Namespace: "virgild",
+		Help:      "Latency of upstream calls by operation type and status",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"type", "status"})
+	cloudErrorsMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "upstream_errors_total",
+		Subsystem: "cards",
+		Namespace: "virgild",
+		Help:      "Count of upstream errors by operation type and error code",
+	}, []string{"type", "code"})
+)
+
+func init() {
+	prometheus.MustRegister(cloudDurationMetrics, cloudErrorsMetric)
+}
+
+// status labels of upstream calls without response
+const (
+	upstreamStatusTransportError = "transport_error"
+	upstreamStatusNoEndpoint     = "no_endpoint"
+	upstreamStatusTimeout        = "timeout"
+	upstreamStatusCanceled       = "canceled"
+)
+
+// observeUpstream records latency and error of the upstream call. Status is the status code of the last response
+// or the label of the failure without response. Not found cards and calls cancelled by the client aren't errors.
+func observeUpstream(op string, start time.Time, status string, err error) {
+	cloudDurationMetrics.WithLabelValues(op, status).Observe(time.Since(start).Seconds())
+	if err == nil || status == strconv.Itoa(http.StatusNotFound) || status == upstreamStatusCanceled {
+		return
+	}
+	code := status
+	if apiErr, ok := errors.Cause(err).(coreapi.APIError); ok && apiErr.Code != 0 {
+		code = strconv.Itoa(apiErr.Code)
+	}
+	cloudErrorsMetric.WithLabelValues(op, code).Inc()
+}
+
+// contextStatus returns status label of the call interrupted by the context
+func contextStatus(err error) string {
+	if err == context.DeadlineExceeded {
+		return upstreamStatusTimeout
+	}
+	return upstreamStatusCanceled
+}
 
 type client interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+type retryPolicy struct {
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// delay returns exponential backoff with full jitter for the retry attempt (starts from 0)
+func (p retryPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff << uint(attempt)
+	if p.MaxBackoff > 0 && (d > p.MaxBackoff || d <= 0) {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
 type cloudCard struct {
-	RAService    string
-	CardsService string
-	Client       client
+	RA     *upstreamPool
+	Cards  *upstreamPool
+	Client client
+	Retry  retryPolicy
+	// HealthCheckPath is requested on every endpoint of pools (empty - disabled)
+	HealthCheckPath     string
+	HealthCheckInterval time.Duration
 }
 
 func (c *cloudCard) getCard(ctx context.Context, id string) (*virgil.CardResponse, error) {
 	var body []byte
 	var err error
 
-	timer := prometheus.NewTimer(cloudDurationMetrics.WithLabelValues("get_card"))
-	body, err = c.send(ctx, http.MethodGet, c.CardsService+"/v4/card/"+id, nil)
-	timer.ObserveDuration()
-
+	body, err = c.send(ctx, "get_card", c.Cards, true, http.MethodGet, "/v4/card/"+id, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -52,26 +122,51 @@ func (c *cloudCard) searchCards(ctx context.Context, crit *virgil.Criteria) ([]v
 	var body []byte
 	var err error
 
-	timer := prometheus.NewTimer(cloudDurationMetrics.WithLabelValues("search"))
-	body, err = c.send(ctx, http.MethodPost, c.CardsService+"/v4/card/actions/search", crit)
-	timer.ObserveDuration()
-
+	body, err = c.send(ctx, "search", c.Cards, true, http.MethodPost, "/v4/card/actions/search", crit)
 	if err != nil {
 		return nil, err
 	}
+	sink := core.GetCardSink(ctx)
+	if sink == nil {
+		var cards []virgil.CardResponse
+		err = json.Unmarshal(body, &cards)
+		return cards, err
+	}
+	return decodeCards(body, sink)
+}
+
+// decodeCards decodes the array of cards and passes every card to the sink as soon as it's decoded
+func decodeCards(body []byte, sink core.CardSink) ([]virgil.CardResponse, error) {
+	d := json.NewDecoder(bytes.NewReader(body))
+	t, err := d.Token()
+	if err != nil {
+		return nil, errors.Wrap(err, "Cloud.searchCards(decode)")
+	}
+	if t == nil {
+		return nil, nil
+	}
+	if t != json.Delim('[') {
+		return nil, errors.Errorf("Cloud.searchCards(decode): unexpected %v", t)
+	}
 	var cards []virgil.CardResponse
-	err = json.Unmarshal(body, &cards)
-	return cards, err
+	for d.More() {
+		var card virgil.CardResponse
+		if err = d.Decode(&card); err != nil {
+			return nil, errors.Wrap(err, "Cloud.searchCards(decode)")
+		}
+		if err = sink(&card); err != nil {
+			return nil, err
+		}
+		cards = append(cards, card)
+	}
+	return cards, nil
 }
 
 func (c *cloudCard) createCard(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
 	var body []byte
 	var err error
 
-	timer := prometheus.NewTimer(cloudDurationMetrics.WithLabelValues("create_card"))
-	body, err = c.send(ctx, http.MethodPost, c.RAService+"/v1/card", req.Request)
-	timer.ObserveDuration()
-
+	body, err = c.send(ctx, "create_card", c.RA, false, http.MethodPost, "/v1/card", req.Request)
 	if err != nil {
 		return nil, err
 	}
@@ -83,10 +178,7 @@ func (c *cloudCard) createCard(ctx context.Context, req *core.CreateCardRequest)
 func (c *cloudCard) revokeCard(ctx context.Context, req *core.RevokeCardRequest) error {
 	var err error
 
-	timer := prometheus.NewTimer(cloudDurationMetrics.WithLabelValues("revoke_card"))
-	_, err = c.send(ctx, http.MethodDelete, c.RAService+"/v1/card/"+req.Info.ID, req.Request)
-	timer.ObserveDuration()
-
+	_, err = c.send(ctx, "revoke_card", c.RA, false, http.MethodDelete, "/v1/card/"+req.Info.ID, req.Request)
 	return err
 }
 
@@ -94,10 +186,7 @@ func (c *cloudCard) createRelation(ctx context.Context, req *core.CreateRelation
 	var body []byte
 	var err error
 
-	timer := prometheus.NewTimer(cloudDurationMetrics.WithLabelValues("create_relation"))
-	body, err = c.send(ctx, http.MethodPost, c.CardsService+"/v4/card/"+req.ID+"/collections/relations", req.Request)
-	timer.ObserveDuration()
-
+	body, err = c.send(ctx, "create_relation", c.Cards, false, http.MethodPost, "/v4/card/"+req.ID+"/collections/relations", req.Request)
 	if err != nil {
 		return nil, err
 	}
@@ -110,10 +199,7 @@ func (c *cloudCard) revokeRelation(ctx context.Context, req *core.RevokeRelation
 	var body []byte
 	var err error
 
-	timer := prometheus.NewTimer(cloudDurationMetrics.WithLabelValues("revoke_relation"))
-	body, err = c.send(ctx, http.MethodDelete, c.CardsService+"/v4/card/"+req.ID+"/collections/relations", req.Request)
-	timer.ObserveDuration()
-
+	body, err = c.send(ctx, "revoke_relation", c.Cards, false, http.MethodDelete, "/v4/card/"+req.ID+"/collections/relations", req.Request)
 	if err != nil {
 		return nil, err
 	}
@@ -122,45 +208,124 @@ func (c *cloudCard) revokeRelation(ctx context.Context, req *core.RevokeRelation
 	return card, err
 }
 
-func (c *cloudCard) send(ctx context.Context, method string, urlStr string, payload interface{}) ([]byte, error) {
-	var body io.Reader
+// send calls an endpoint of the upstream pool. Idempotent calls are retried on network errors and 5xx responses,
+// retries fail over to other endpoints of the pool. Latency and errors of the call are recorded as the op.
+func (c *cloudCard) send(ctx context.Context, op string, pool *upstreamPool, idempotent bool, method string, path string, payload interface{}) (body []byte, err error) {
+	var bp []byte
 	if payload != nil {
-		bp, err := json.Marshal(payload)
+		bp, err = json.Marshal(payload)
 		if err != nil {
 			return nil, errors.Wrapf(err, "Cloud.Send(cannot marshal payload [payload: %v])", payload)
 		}
-		body = bytes.NewReader(bp)
 	}
-	req, err := http.NewRequest(method, urlStr, body)
+
+	start := time.Now()
+	status := upstreamStatusTransportError
+	defer func() {
+		observeUpstream(op, start, status, err)
+	}()
+
+	attempts := 1
+	if idempotent {
+		attempts += c.Retry.Retries
+	}
+
+	tried := make(map[*endpoint]bool)
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				status = contextStatus(ctx.Err())
+				return nil, errors.Wrap(ctx.Err(), "Cloud.Send(wait retry)")
+			case <-time.After(c.Retry.delay(i - 1)):
+			}
+		}
+		e := pool.pick(tried)
+		if e == nil {
+			status = upstreamStatusNoEndpoint
+			return nil, coreapi.UpstreamUnavailableErr
+		}
+		tried[e] = true
+
+		var (
+			statusCode int
+			retry      bool
+		)
+		callStart := time.Now()
+		body, statusCode, retry, err = c.do(ctx, method, e.URL+path, bp)
+		if err != nil && ctx.Err() != nil {
+			// the call was interrupted by the caller, it says nothing about upstream health
+			e.Breaker.Release()
+			status = contextStatus(ctx.Err())
+			return nil, errors.Wrap(ctx.Err(), "Cloud.Send(request context done)")
+		}
+		status = upstreamStatusTransportError
+		if statusCode != 0 {
+			status = strconv.Itoa(statusCode)
+		}
+		if !retry {
+			e.success(time.Since(callStart))
+			return body, err
+		}
+		e.failure()
+	}
+	return nil, err
+}
+
+// do executes one upstream call. It returns status code of the response (0 - no response) and retry=true
+// if the upstream failed and the call may be repeated
+func (c *cloudCard) do(ctx context.Context, method string, urlStr string, payload []byte) (respBody []byte, statusCode int, retry bool, err error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, urlStr, body)
 	if err != nil {
-		return nil, errors.Wrap(err, "Cloud.Send(cannot create request)")
+		return nil, 0, false, errors.Wrap(err, "Cloud.Send(cannot create request)")
 	}
 	auth := core.GetAuthHeader(ctx)
 	req.Header.Set("Authorization", auth)
+	if id := coreapi.GetRequestID(ctx); id != "" {
+		req.Header.Set(coreapi.RequestIDHeader, id)
+	}
+	coreapi.SetHopHeaders(ctx, req.Header)
+
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "upstream "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.request.method", method), attribute.String("url.full", urlStr)))
+	defer func() {
+		endSpan(span, err)
+	}()
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	resp, err := c.Client.Do(req)
 	if err != nil {
-		return nil, errors.Wrap(err, "Cloud.Send(default client send req)")
+		return nil, 0, true, errors.Wrap(err, "Cloud.Send(default client send req)")
 	}
-	respBody, err := ioutil.ReadAll(resp.Body)
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	coreapi.SetUpstreamChain(ctx, resp.Header.Get(coreapi.ChainHeader))
+	respBody, err = ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
 	if err != nil {
-		return nil, errors.Wrap(err, "Cloud.Send(read reasponse)")
+		return nil, 0, true, errors.Wrap(err, "Cloud.Send(read reasponse)")
 	}
 	if resp.StatusCode == http.StatusOK {
-		return respBody, nil
+		coreapi.SetUpstreamResponse(ctx, resp.Header, respBody)
+		return respBody, resp.StatusCode, false, nil
 	}
 	if resp.StatusCode == http.StatusNotFound {
-		return nil, coreapi.EntityNotFoundErr
+		return nil, resp.StatusCode, false, coreapi.EntityNotFoundErr
 	}
 
+	// the loop or the hop limit is a misconfiguration of chained instances, other upstreams fail the same way
+	retry = resp.StatusCode >= http.StatusInternalServerError && resp.StatusCode != http.StatusLoopDetected
 	verr := new(virgilError)
 	err = json.Unmarshal(respBody, verr)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Cloud.Send(unmarshal error [body: %s])", respBody)
+		return nil, resp.StatusCode, retry, errors.Wrapf(err, "Cloud.Send(unmarshal error [body: %s])", respBody)
 	}
 
-	return nil, coreapi.APIError{
+	return nil, resp.StatusCode, retry, coreapi.APIError{
 		Code:       verr.Code,
 		StatusCode: resp.StatusCode,
 	}
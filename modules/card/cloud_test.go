@@ -9,11 +9,13 @@ import (
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"gopkg.in/virgil.v4"
 
 	"github.com/VirgilSecurity/virgild/coreapi"
 	"github.com/VirgilSecurity/virgild/modules/card/core"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -58,7 +60,7 @@ func TestCloudTable_ClientReturnErr_ReturnErr(t *testing.T) {
 
 	f := new(fakeHttpClient)
 	f.On("Do", mock.Anything).Return(nil, fmt.Errorf("ERROR"))
-	cloud := cloudCard{RAService: "ra-service", CardsService: "cards-service", Client: f}
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service"), Client: f}
 	for name, function := range table {
 		err := function(&cloud)
 		assert.Error(t, err, "ERROR", name)
@@ -98,7 +100,7 @@ func TestCloudTable_ClientReturnOtherErr_ReturnVirgilErr(t *testing.T) {
 		Body:       ioutil.NopCloser(strings.NewReader(`{"code":1234}`)),
 	}
 	f.On("Do", mock.Anything).Return(resp, nil)
-	cloud := cloudCard{RAService: "ra-service", CardsService: "cards-service", Client: f}
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service"), Client: f}
 
 	for name, function := range table {
 		err := function(&cloud)
@@ -139,7 +141,7 @@ func TestCloudTable_ClientReturnOkBodyInvalid_ReturnErr(t *testing.T) {
 		Body:       ioutil.NopCloser(strings.NewReader(`asdf: fasd`)),
 	}
 	f.On("Do", mock.Anything).Return(resp, nil)
-	cloud := cloudCard{RAService: "ra-service", CardsService: "cards-service", Client: f}
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service"), Client: f}
 
 	for name, function := range table {
 		err := function(&cloud)
@@ -154,15 +156,17 @@ func TestCloudGetCard_ClientReturn404_ReturnVirgilErr(t *testing.T) {
 		Body:       ioutil.NopCloser(strings.NewReader("")),
 	}
 	f.On("Do", mock.Anything).Return(resp, nil)
-	cloud := cloudCard{RAService: "ra-service", CardsService: "cards-service", Client: f}
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service"), Client: f}
 	_, err := cloud.getCard(context.Background(), "1234")
 	assert.Error(t, err, coreapi.EntityNotFoundErr)
 }
 
 func TestCloudGetCard_ClientReturnOk_ReturnVal(t *testing.T) {
 	const authHeader = "header"
-	expectedReq, _ := http.NewRequest(http.MethodGet, "cards-service/v4/card/1234", nil)
+	ctx := core.SetAuthHeader(context.Background(), authHeader)
+	expectedReq, _ := http.NewRequestWithContext(ctx, http.MethodGet, "cards-service/v4/card/1234", nil)
 	expectedReq.Header.Set("Authorization", authHeader)
+	expectedReq.Header.Set(coreapi.ViaHeader, coreapi.InstanceID())
 
 	expectedCard := &virgil.CardResponse{
 		Snapshot: []byte(`snapshot`),
@@ -176,9 +180,8 @@ func TestCloudGetCard_ClientReturnOk_ReturnVal(t *testing.T) {
 	}
 	f := new(fakeHttpClient)
 	f.On("Do", expectedReq).Return(resp, nil)
-	cloud := cloudCard{RAService: "ra-service", CardsService: "cards-service", Client: f}
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service"), Client: f}
 
-	ctx := core.SetAuthHeader(context.Background(), authHeader)
 	card, err := cloud.getCard(ctx, "1234")
 
 	assert.NoError(t, err)
@@ -213,7 +216,7 @@ func TestCloudSearchCards_ClientReturnOk_ReturnVal(t *testing.T) {
 
 	f := new(fakeHttpClient)
 	f.On("Do", mock.MatchedBy(matchReq)).Return(resp, nil)
-	cloud := cloudCard{RAService: "ra-service", CardsService: "cards-service", Client: f}
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service"), Client: f}
 
 	ctx := core.SetAuthHeader(context.Background(), authHeader)
 	card, err := cloud.searchCards(ctx, crit)
@@ -222,6 +225,33 @@ func TestCloudSearchCards_ClientReturnOk_ReturnVal(t *testing.T) {
 	assert.Equal(t, expectedCard, card)
 }
 
+func TestDecodeCards_Sink_PassEveryCard(t *testing.T) {
+	body, _ := json.Marshal([]virgil.CardResponse{{ID: "1"}, {ID: "2"}})
+	var ids []string
+
+	cards, err := decodeCards(body, func(card *virgil.CardResponse) error {
+		ids = append(ids, card.ID)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, ids)
+	assert.Len(t, cards, 2)
+}
+
+func TestDecodeCards_SinkFailed_ReturnErr(t *testing.T) {
+	body, _ := json.Marshal([]virgil.CardResponse{{ID: "1"}, {ID: "2"}})
+	calls := 0
+
+	_, err := decodeCards(body, func(card *virgil.CardResponse) error {
+		calls++
+		return errors.New("closed")
+	})
+
+	assert.EqualError(t, err, "closed")
+	assert.Equal(t, 1, calls)
+}
+
 func TestCloudCreateCard_ClientReturnOk_ReturnVal(t *testing.T) {
 	const authHeader = "header"
 	signableRequest := virgil.SignableRequest{
@@ -255,7 +285,7 @@ func TestCloudCreateCard_ClientReturnOk_ReturnVal(t *testing.T) {
 	}
 	f := new(fakeHttpClient)
 	f.On("Do", mock.MatchedBy(matchReq)).Return(resp, nil)
-	cloud := cloudCard{RAService: "ra-service", CardsService: "cards-service", Client: f}
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service"), Client: f}
 
 	ctx := core.SetAuthHeader(context.Background(), authHeader)
 	card, err := cloud.createCard(ctx, createCard)
@@ -291,7 +321,7 @@ func TestCloudRevokeCard_ClientReturnOk_ReturnVal(t *testing.T) {
 	}
 	f := new(fakeHttpClient)
 	f.On("Do", mock.MatchedBy(matchReq)).Return(resp, nil)
-	cloud := cloudCard{RAService: "ra-service", CardsService: "cards-service", Client: f}
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service"), Client: f}
 
 	ctx := core.SetAuthHeader(context.Background(), authHeader)
 	err := cloud.revokeCard(ctx, revokeCard)
@@ -332,7 +362,7 @@ func TestCloudCreateRelations_ClientReturnOk_ReturnVal(t *testing.T) {
 	}
 	f := new(fakeHttpClient)
 	f.On("Do", mock.MatchedBy(matchReq)).Return(resp, nil)
-	cloud := cloudCard{RAService: "ra-service", CardsService: "cards-service", Client: f}
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service"), Client: f}
 
 	ctx := core.SetAuthHeader(context.Background(), authHeader)
 	card, err := cloud.createRelation(ctx, createRelation)
@@ -374,7 +404,7 @@ func TestCloudRevokeRelations_ClientReturnOk_ReturnVal(t *testing.T) {
 	}
 	f := new(fakeHttpClient)
 	f.On("Do", mock.MatchedBy(matchReq)).Return(resp, nil)
-	cloud := cloudCard{RAService: "ra-service", CardsService: "cards-service", Client: f}
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service"), Client: f}
 
 	ctx := core.SetAuthHeader(context.Background(), authHeader)
 	card, err := cloud.revokeRelation(ctx, revokeRelation)
@@ -382,3 +412,104 @@ func TestCloudRevokeRelations_ClientReturnOk_ReturnVal(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, expectedCard, card)
 }
+
+func TestCloudGetCard_ClientReturn5xx_Retry(t *testing.T) {
+	f := new(fakeHttpClient)
+	f.On("Do", mock.Anything).Return(&http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"code":10000}`)),
+	}, nil).Once()
+	f.On("Do", mock.Anything).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"id":"1234"}`)),
+	}, nil).Once()
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service"), Client: f, Retry: retryPolicy{Retries: 2}}
+
+	card, err := cloud.getCard(context.Background(), "1234")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", card.ID)
+	f.AssertNumberOfCalls(t, "Do", 2)
+}
+
+func TestCloudGetCard_ClientReturn4xx_NotRetry(t *testing.T) {
+	f := new(fakeHttpClient)
+	f.On("Do", mock.Anything).Return(&http.Response{
+		StatusCode: http.StatusBadRequest,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"code":1234}`)),
+	}, nil)
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service"), Client: f, Retry: retryPolicy{Retries: 2}}
+
+	_, err := cloud.getCard(context.Background(), "1234")
+
+	assert.Equal(t, coreapi.APIError{Code: 1234, StatusCode: http.StatusBadRequest}, err)
+	f.AssertNumberOfCalls(t, "Do", 1)
+}
+
+func TestCloudCreateCard_ClientReturnErr_NotRetry(t *testing.T) {
+	f := new(fakeHttpClient)
+	f.On("Do", mock.Anything).Return(nil, fmt.Errorf("ERROR"))
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service"), Client: f, Retry: retryPolicy{Retries: 2}}
+
+	_, err := cloud.createCard(context.Background(), &core.CreateCardRequest{Request: virgil.SignableRequest{Snapshot: []byte(`Snapshot`)}})
+
+	assert.Error(t, err)
+	f.AssertNumberOfCalls(t, "Do", 1)
+}
+
+func TestCloudGetCard_BreakerOpen_ReturnUpstreamUnavailable(t *testing.T) {
+	f := new(fakeHttpClient)
+	f.On("Do", mock.Anything).Return(nil, fmt.Errorf("ERROR"))
+	b, _ := makeBreaker(2, time.Minute)
+	cards := makePool("cards", "cards-service")
+	cards.Endpoints[0].Breaker = b
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: cards, Client: f, Retry: retryPolicy{Retries: 5}}
+
+	_, err := cloud.getCard(context.Background(), "1234")
+
+	assert.Equal(t, coreapi.UpstreamUnavailableErr, err)
+	f.AssertNumberOfCalls(t, "Do", 2)
+}
+
+func TestRetryPolicyDelay_LimitedByMaxBackoff(t *testing.T) {
+	p := retryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+
+	for i := 0; i < 100; i++ {
+		assert.True(t, p.delay(i%40) < 300*time.Millisecond)
+	}
+	assert.Equal(t, time.Duration(0), retryPolicy{}.delay(3))
+}
+
+func TestCloudGetCard_ContextCancelled_NotRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	f := new(fakeHttpClient)
+	f.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		cancel()
+		return req.Context() == ctx
+	})).Return(nil, fmt.Errorf("ERROR"))
+	b, _ := makeBreaker(1, time.Minute)
+	cards := makePool("cards", "cards-service")
+	cards.Endpoints[0].Breaker = b
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: cards, Client: f, Retry: retryPolicy{Retries: 2}}
+
+	_, err := cloud.getCard(ctx, "1234")
+
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+	assert.Equal(t, breakerClosed, b.State())
+	f.AssertNumberOfCalls(t, "Do", 1)
+}
+
+func TestCloudGetCard_RequestID_ForwardUpstream(t *testing.T) {
+	f := new(fakeHttpClient)
+	f.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return req.Header.Get(coreapi.RequestIDHeader) == "1234"
+	})).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"id":"1234"}`)),
+	}, nil)
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service"), Client: f}
+
+	_, err := cloud.getCard(coreapi.SetRequestID(context.Background(), "1234"), "1234")
+
+	assert.NoError(t, err)
+}
@@ -0,0 +1,70 @@
+package card
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/VirgilSecurity/virgild/modules/card/audit"
+	"github.com/VirgilSecurity/virgild/modules/card/validator"
+)
+
+// validateConfig checks values of card flags which can't be checked by their types.
+// Overrides of tenants are checked on Init because tenants are loaded by coreapi.Init.
+func validateConfig() error {
+	var problems []string
+	cardsURLs, raURLs := parseUpstreams(upstream.CardsService), parseUpstreams(upstream.RAService)
+	if len(cardsURLs) == 0 {
+		problems = append(problems, "card-cardsservice: no upstream")
+	}
+	if len(raURLs) == 0 {
+		problems = append(problems, "card-raservice: no upstream")
+	}
+	switch upstream.Balancing {
+	case balancingRoundRobin, balancingLatency:
+	default:
+		problems = append(problems, fmt.Sprintf("card-upstream-balancing: unknown balancing (%v)", upstream.Balancing))
+	}
+	if r := upstream.Retry; r.Retries < 0 {
+		problems = append(problems, fmt.Sprintf("card-upstream-retries: %v is negative", r.Retries))
+	}
+	if r := upstream.Retry; r.Backoff < 0 || r.MaxBackoff < r.Backoff {
+		problems = append(problems, fmt.Sprintf("card-upstream-retry-backoff: %v is negative or greater than card-upstream-retry-max-backoff (%v)", r.Backoff, r.MaxBackoff))
+	}
+	if upstream.BreakerThreshold < 0 {
+		problems = append(problems, fmt.Sprintf("card-breaker-threshold: %v is negative", upstream.BreakerThreshold))
+	}
+	if _, err := hostPins(make(map[string][]string), cardsURLs, upstream.CardsPins); err != nil {
+		problems = append(problems, fmt.Sprintf("card-cardsservice-pins: %v", err))
+	}
+	if _, err := hostPins(make(map[string][]string), raURLs, upstream.RAPins); err != nil {
+		problems = append(problems, fmt.Sprintf("card-raservice-pins: %v", err))
+	}
+	if _, err := validator.ParseTrustedRA(raKeys); err != nil {
+		problems = append(problems, fmt.Sprintf("card-ra-keys: %v", err))
+	}
+	if _, err := makeTransport(upstream.Transport, nil); err != nil {
+		problems = append(problems, fmt.Sprintf("card-upstream transport: %v", err))
+	}
+	if auditKeyFile != "" {
+		if _, err := audit.ReadKey(auditKeyFile); err != nil {
+			problems = append(problems, fmt.Sprintf("card-audit-key-file: %v", err))
+		}
+	}
+	if replicationParent != "" && replicationFile == "" {
+		problems = append(problems, "card-replication-parent: requires card-replication-file")
+	}
+	if offlineEnabled && offlineQueueFile != "" && offlineReplayInterval <= 0 {
+		problems = append(problems, fmt.Sprintf("card-offline-replay-interval: %v is not positive", offlineReplayInterval))
+	}
+	if offlineEnabled && offlineQueueFile != "" {
+		if offlineQueueKeyFile == "" {
+			problems = append(problems, "card-offline-queue-file: requires card-offline-queue-key-file")
+		} else if _, err := audit.ReadKey(offlineQueueKeyFile); err != nil {
+			problems = append(problems, fmt.Sprintf("card-offline-queue-key-file: %v", err))
+		}
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("%v", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package card
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateConfig_Defaults_ReturnNil(t *testing.T) {
+	err := validateConfig()
+
+	assert.NoError(t, err)
+}
+
+func TestValidateConfig_InvalidCardFlags_ReturnErr(t *testing.T) {
+	defer func(u upstreamConfig, p string) {
+		upstream, replicationParent = u, p
+	}(upstream, replicationParent)
+	upstream.Balancing, upstream.Retry.Retries, replicationParent = "random", -1, "https://parent.com"
+
+	err := validateConfig()
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "card-upstream-balancing: unknown balancing (random)")
+	assert.Contains(t, err.Error(), "card-upstream-retries: -1 is negative")
+	assert.Contains(t, err.Error(), "card-replication-parent: requires card-replication-file")
+}
+
+func TestValidateConfig_QueueWithoutKey_ReturnErr(t *testing.T) {
+	defer func(e bool, f string) { offlineEnabled, offlineQueueFile = e, f }(offlineEnabled, offlineQueueFile)
+	offlineEnabled, offlineQueueFile = true, "queue.log"
+
+	err := validateConfig()
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "card-offline-queue-file: requires card-offline-queue-key-file")
+}
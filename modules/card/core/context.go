@@ -1,6 +1,10 @@
 package core
 
-import "context"
+import (
+	"context"
+
+	virgil "gopkg.in/virgil.v4"
+)
 
 type contextKey string
 
@@ -8,8 +12,12 @@ var (
 	contextCardIDKey     contextKey = "card_id"
 	contextOwnerKey      contextKey = "owner"
 	contextAuthHeaderKey contextKey = "authHeader"
+	contextCardSinkKey   contextKey = "cardSink"
 )
 
+// CardSink receives found cards as soon as they are decoded, e.g. to stream them to the client
+type CardSink func(card *virgil.CardResponse) error
+
 func GetURLCardID(ctx context.Context) string {
 	id, _ := ctx.Value(contextCardIDKey).(string)
 	return id
@@ -35,3 +43,12 @@ func GetAuthHeader(ctx context.Context) string {
 func SetAuthHeader(ctx context.Context, authHeader string) context.Context {
 	return context.WithValue(ctx, contextAuthHeaderKey, authHeader)
 }
+
+func GetCardSink(ctx context.Context) CardSink {
+	sink, _ := ctx.Value(contextCardSinkKey).(CardSink)
+	return sink
+}
+
+func SetCardSink(ctx context.Context, sink CardSink) context.Context {
+	return context.WithValue(ctx, contextCardSinkKey, sink)
+}
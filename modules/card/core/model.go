@@ -13,6 +13,7 @@ type CreateCardRequest struct {
 }
 
 type RevokeCardRequest struct {
+	ID      string
 	Info    virgil.RevokeCardRequest
 	Request virgil.SignableRequest
 }
@@ -0,0 +1,189 @@
+// Package grpc binds card operations to methods of service virgild.card.v4.Cards
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/VirgilSecurity/virgild/modules/card/core"
+	"github.com/VirgilSecurity/virgild/modules/card/grpc/pb"
+	"github.com/pkg/errors"
+	virgil "gopkg.in/virgil.v4"
+)
+
+var service = pb.Cards_ServiceDesc.ServiceName
+
+var GetCard = &coreapi.GRPCBinding{
+	Service: service,
+	Method:  "GetCard",
+	New:     func() interface{} { return new(pb.GetCardRequest) },
+	Decode: func(msg interface{}) (interface{}, error) {
+		return msg.(*pb.GetCardRequest).GetId(), nil
+	},
+	Encode: encodeCard,
+}
+
+// SearchCards streams found cards one by one. Cards of upstreams are sent as soon as they are decoded,
+// the rest (e.g. cached cards) are sent when the search returns.
+var SearchCards = &coreapi.GRPCBinding{
+	Service: service,
+	Method:  "SearchCards",
+	New:     func() interface{} { return new(pb.SearchCardsRequest) },
+	Decode: func(msg interface{}) (interface{}, error) {
+		req := msg.(*pb.SearchCardsRequest)
+		return &virgil.Criteria{
+			Identities:   req.GetIdentities(),
+			IdentityType: req.GetIdentityType(),
+			Scope:        virgil.Enum(req.GetScope()),
+		}, nil
+	},
+	Prepare: func(ctx context.Context, send func(msg interface{}) error) context.Context {
+		s := &cardSink{send: send, sent: make(map[string]bool)}
+		return context.WithValue(core.SetCardSink(ctx, s.card), cardSinkKey{}, s)
+	},
+	Stream: func(ctx context.Context, resp interface{}, send func(msg interface{}) error) error {
+		s, _ := ctx.Value(cardSinkKey{}).(*cardSink)
+		cards := resp.([]virgil.CardResponse)
+		for i := range cards {
+			if s != nil && s.sent[cards[i].ID] {
+				continue
+			}
+			if err := send(toCard(&cards[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+type cardSinkKey struct{}
+
+// cardSink sends cards found by upstreams before the search returns and remembers them, so Stream doesn't repeat them
+type cardSink struct {
+	send func(msg interface{}) error
+	sent map[string]bool
+}
+
+func (s *cardSink) card(card *virgil.CardResponse) error {
+	if err := s.send(toCard(card)); err != nil {
+		return err
+	}
+	s.sent[card.ID] = true
+	return nil
+}
+
+// CreateCard returns queued response if the request is queued in offline mode
+var CreateCard = &coreapi.GRPCBinding{
+	Service: service,
+	Method:  "CreateCard",
+	New:     func() interface{} { return new(pb.SignableRequest) },
+	Decode: func(msg interface{}) (interface{}, error) {
+		createReq := fromSignableRequest(msg.(*pb.SignableRequest))
+		var info virgil.CardModel
+		if err := json.Unmarshal(createReq.Snapshot, &info); err != nil {
+			return nil, core.SnapshotIncorrectErr
+		}
+		return &core.CreateCardRequest{Info: info, Request: createReq}, nil
+	},
+	Encode: func(resp interface{}, err error) (interface{}, error) {
+		if errors.Cause(err) == coreapi.RequestQueuedErr {
+			return &pb.CreateCardResponse{Queued: true}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &pb.CreateCardResponse{Card: toCard(resp.(*virgil.CardResponse))}, nil
+	},
+}
+
+// RevokeCard returns queued response if the request is queued in offline mode
+var RevokeCard = &coreapi.GRPCBinding{
+	Service: service,
+	Method:  "RevokeCard",
+	New:     func() interface{} { return new(pb.RevokeCardRequest) },
+	Decode: func(msg interface{}) (interface{}, error) {
+		req := msg.(*pb.RevokeCardRequest)
+		revokeReq := fromSignableRequest(req.GetRequest())
+		var info virgil.RevokeCardRequest
+		if err := json.Unmarshal(revokeReq.Snapshot, &info); err != nil {
+			return nil, core.SnapshotIncorrectErr
+		}
+		return &core.RevokeCardRequest{ID: req.GetId(), Info: info, Request: revokeReq}, nil
+	},
+	Encode: func(resp interface{}, err error) (interface{}, error) {
+		if errors.Cause(err) == coreapi.RequestQueuedErr {
+			return &pb.RevokeCardResponse{Queued: true}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &pb.RevokeCardResponse{}, nil
+	},
+}
+
+var CreateRelation = &coreapi.GRPCBinding{
+	Service: service,
+	Method:  "CreateRelation",
+	New:     func() interface{} { return new(pb.CreateRelationRequest) },
+	Decode: func(msg interface{}) (interface{}, error) {
+		req := msg.(*pb.CreateRelationRequest)
+		return &core.CreateRelationRequest{
+			ID:      req.GetId(),
+			Request: fromSignableRequest(req.GetRequest()),
+		}, nil
+	},
+	Encode: encodeCard,
+}
+
+var RevokeRelation = &coreapi.GRPCBinding{
+	Service: service,
+	Method:  "RevokeRelation",
+	New:     func() interface{} { return new(pb.RevokeRelationRequest) },
+	Decode: func(msg interface{}) (interface{}, error) {
+		req := msg.(*pb.RevokeRelationRequest)
+		revokeReq := fromSignableRequest(req.GetRequest())
+		var info virgil.RevokeCardRequest
+		if err := json.Unmarshal(revokeReq.Snapshot, &info); err != nil {
+			return nil, core.SnapshotIncorrectErr
+		}
+		return &core.RevokeRelationRequest{ID: req.GetId(), Info: info, Request: revokeReq}, nil
+	},
+	Encode: encodeCard,
+}
+
+func encodeCard(resp interface{}, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return toCard(resp.(*virgil.CardResponse)), nil
+}
+
+func toCard(c *virgil.CardResponse) *pb.Card {
+	if c == nil {
+		return nil
+	}
+	return &pb.Card{
+		Id:              c.ID,
+		ContentSnapshot: c.Snapshot,
+		Meta: &pb.CardMeta{
+			CreatedAt:   c.Meta.CreatedAt,
+			CardVersion: c.Meta.CardVersion,
+			Signs:       c.Meta.Signatures,
+			Relations:   c.Meta.Relations,
+		},
+	}
+}
+
+func fromSignableRequest(r *pb.SignableRequest) virgil.SignableRequest {
+	req := virgil.SignableRequest{
+		Snapshot: r.GetContentSnapshot(),
+		Meta: virgil.RequestMeta{
+			Signatures: r.GetMeta().GetSigns(),
+		},
+	}
+	if v := r.GetMeta().GetValidation(); v != nil {
+		req.Meta.Validation = &virgil.ValidationInfo{Token: v.GetToken()}
+	}
+	return req
+}
@@ -0,0 +1,120 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/VirgilSecurity/virgild/modules/card/core"
+	"github.com/VirgilSecurity/virgild/modules/card/grpc/pb"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	virgil "gopkg.in/virgil.v4"
+)
+
+func TestGetCard_Card_ReturnMessage(t *testing.T) {
+	id, err := GetCard.Decode(&pb.GetCardRequest{Id: "card-1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "card-1", id)
+
+	msg, err := GetCard.Encode(&virgil.CardResponse{ID: "card-1", Snapshot: []byte("snapshot"), Meta: virgil.ResponseMeta{CardVersion: "4.0"}}, nil)
+
+	assert.Nil(t, err)
+	card := msg.(*pb.Card)
+	assert.Equal(t, "card-1", card.GetId())
+	assert.Equal(t, []byte("snapshot"), card.GetContentSnapshot())
+	assert.Equal(t, "4.0", card.GetMeta().GetCardVersion())
+}
+
+func TestGetCard_Err_ReturnErr(t *testing.T) {
+	_, err := GetCard.Encode(nil, core.UnsupportedAuthTypeErr)
+
+	assert.Equal(t, core.UnsupportedAuthTypeErr, err)
+}
+
+func TestSearchCards_StreamCards(t *testing.T) {
+	crit, err := SearchCards.Decode(&pb.SearchCardsRequest{Identities: []string{"alice"}, Scope: "global"})
+	assert.Nil(t, err)
+	assert.Equal(t, &virgil.Criteria{Identities: []string{"alice"}, Scope: virgil.CardScope.Global}, crit)
+
+	var ids []string
+	err = SearchCards.Stream(context.Background(), []virgil.CardResponse{{ID: "card-1"}, {ID: "card-2"}}, func(msg interface{}) error {
+		ids = append(ids, msg.(*pb.Card).GetId())
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"card-1", "card-2"}, ids)
+}
+
+func TestSearchCards_SendFailed_ReturnErr(t *testing.T) {
+	err := SearchCards.Stream(context.Background(), []virgil.CardResponse{{ID: "card-1"}, {ID: "card-2"}}, func(msg interface{}) error {
+		return errors.New("closed")
+	})
+
+	assert.EqualError(t, err, "closed")
+}
+
+func TestSearchCards_SentBySink_NotRepeated(t *testing.T) {
+	var ids []string
+	send := func(msg interface{}) error {
+		ids = append(ids, msg.(*pb.Card).GetId())
+		return nil
+	}
+	ctx := SearchCards.Prepare(context.Background(), send)
+
+	err := core.GetCardSink(ctx)(&virgil.CardResponse{ID: "card-1"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"card-1"}, ids)
+	err = SearchCards.Stream(ctx, []virgil.CardResponse{{ID: "card-1"}, {ID: "card-2"}}, send)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"card-1", "card-2"}, ids)
+}
+
+func TestCreateCard_ParseSnapshot(t *testing.T) {
+	snapshot, _ := json.Marshal(virgil.CardModel{Identity: "alice", IdentityType: "email"})
+
+	req, err := CreateCard.Decode(&pb.SignableRequest{
+		ContentSnapshot: snapshot,
+		Meta:            &pb.RequestMeta{Signs: map[string][]byte{"id": []byte("sign")}},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", req.(*core.CreateCardRequest).Info.Identity)
+	assert.Equal(t, map[string][]byte{"id": []byte("sign")}, req.(*core.CreateCardRequest).Request.Meta.Signatures)
+
+	resp, err := CreateCard.Encode(&virgil.CardResponse{ID: "card-1"}, nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "card-1", resp.(*pb.CreateCardResponse).GetCard().GetId())
+	assert.False(t, resp.(*pb.CreateCardResponse).GetQueued())
+}
+
+func TestCreateCard_InvalidSnapshot_ReturnErr(t *testing.T) {
+	_, err := CreateCard.Decode(&pb.SignableRequest{ContentSnapshot: []byte("{")})
+
+	assert.Equal(t, core.SnapshotIncorrectErr, err)
+}
+
+func TestCreateCard_Queued_ReturnQueued(t *testing.T) {
+	resp, err := CreateCard.Encode(nil, errors.Wrap(coreapi.RequestQueuedErr, "offline"))
+
+	assert.Nil(t, err)
+	assert.True(t, resp.(*pb.CreateCardResponse).GetQueued())
+}
+
+func TestRevokeCard_Queued_ReturnQueued(t *testing.T) {
+	snapshot, _ := json.Marshal(virgil.RevokeCardRequest{ID: "card-1"})
+
+	req, err := RevokeCard.Decode(&pb.RevokeCardRequest{Id: "card-1", Request: &pb.SignableRequest{ContentSnapshot: snapshot}})
+	assert.Nil(t, err)
+	assert.Equal(t, "card-1", req.(*core.RevokeCardRequest).ID)
+	assert.Equal(t, "card-1", req.(*core.RevokeCardRequest).Info.ID)
+
+	resp, err := RevokeCard.Encode(nil, coreapi.RequestQueuedErr)
+
+	assert.Nil(t, err)
+	assert.True(t, resp.(*pb.RevokeCardResponse).GetQueued())
+}
@@ -0,0 +1,811 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: card.proto
+
+// Cards service of VirgilD. Messages follow JSON models of Cards Service v4, snapshots and signatures are raw bytes.
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Card struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Id              string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	ContentSnapshot []byte                 `protobuf:"bytes,2,opt,name=content_snapshot,json=contentSnapshot,proto3" json:"content_snapshot,omitempty"`
+	Meta            *CardMeta              `protobuf:"bytes,3,opt,name=meta,proto3" json:"meta,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Card) Reset() {
+	*x = Card{}
+	mi := &file_card_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Card) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Card) ProtoMessage() {}
+
+func (x *Card) ProtoReflect() protoreflect.Message {
+	mi := &file_card_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Card.ProtoReflect.Descriptor instead.
+func (*Card) Descriptor() ([]byte, []int) {
+	return file_card_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Card) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Card) GetContentSnapshot() []byte {
+	if x != nil {
+		return x.ContentSnapshot
+	}
+	return nil
+}
+
+func (x *Card) GetMeta() *CardMeta {
+	if x != nil {
+		return x.Meta
+	}
+	return nil
+}
+
+type CardMeta struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CreatedAt     string                 `protobuf:"bytes,1,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	CardVersion   string                 `protobuf:"bytes,2,opt,name=card_version,json=cardVersion,proto3" json:"card_version,omitempty"`
+	Signs         map[string][]byte      `protobuf:"bytes,3,rep,name=signs,proto3" json:"signs,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Relations     map[string][]byte      `protobuf:"bytes,4,rep,name=relations,proto3" json:"relations,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CardMeta) Reset() {
+	*x = CardMeta{}
+	mi := &file_card_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CardMeta) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CardMeta) ProtoMessage() {}
+
+func (x *CardMeta) ProtoReflect() protoreflect.Message {
+	mi := &file_card_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CardMeta.ProtoReflect.Descriptor instead.
+func (*CardMeta) Descriptor() ([]byte, []int) {
+	return file_card_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CardMeta) GetCreatedAt() string {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return ""
+}
+
+func (x *CardMeta) GetCardVersion() string {
+	if x != nil {
+		return x.CardVersion
+	}
+	return ""
+}
+
+func (x *CardMeta) GetSigns() map[string][]byte {
+	if x != nil {
+		return x.Signs
+	}
+	return nil
+}
+
+func (x *CardMeta) GetRelations() map[string][]byte {
+	if x != nil {
+		return x.Relations
+	}
+	return nil
+}
+
+type SignableRequest struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	ContentSnapshot []byte                 `protobuf:"bytes,1,opt,name=content_snapshot,json=contentSnapshot,proto3" json:"content_snapshot,omitempty"`
+	Meta            *RequestMeta           `protobuf:"bytes,2,opt,name=meta,proto3" json:"meta,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *SignableRequest) Reset() {
+	*x = SignableRequest{}
+	mi := &file_card_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SignableRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SignableRequest) ProtoMessage() {}
+
+func (x *SignableRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_card_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SignableRequest.ProtoReflect.Descriptor instead.
+func (*SignableRequest) Descriptor() ([]byte, []int) {
+	return file_card_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SignableRequest) GetContentSnapshot() []byte {
+	if x != nil {
+		return x.ContentSnapshot
+	}
+	return nil
+}
+
+func (x *SignableRequest) GetMeta() *RequestMeta {
+	if x != nil {
+		return x.Meta
+	}
+	return nil
+}
+
+type RequestMeta struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Signs         map[string][]byte      `protobuf:"bytes,1,rep,name=signs,proto3" json:"signs,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Validation    *ValidationInfo        `protobuf:"bytes,2,opt,name=validation,proto3" json:"validation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RequestMeta) Reset() {
+	*x = RequestMeta{}
+	mi := &file_card_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RequestMeta) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RequestMeta) ProtoMessage() {}
+
+func (x *RequestMeta) ProtoReflect() protoreflect.Message {
+	mi := &file_card_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RequestMeta.ProtoReflect.Descriptor instead.
+func (*RequestMeta) Descriptor() ([]byte, []int) {
+	return file_card_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RequestMeta) GetSigns() map[string][]byte {
+	if x != nil {
+		return x.Signs
+	}
+	return nil
+}
+
+func (x *RequestMeta) GetValidation() *ValidationInfo {
+	if x != nil {
+		return x.Validation
+	}
+	return nil
+}
+
+type ValidationInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ValidationInfo) Reset() {
+	*x = ValidationInfo{}
+	mi := &file_card_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ValidationInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ValidationInfo) ProtoMessage() {}
+
+func (x *ValidationInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_card_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ValidationInfo.ProtoReflect.Descriptor instead.
+func (*ValidationInfo) Descriptor() ([]byte, []int) {
+	return file_card_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ValidationInfo) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+type GetCardRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetCardRequest) Reset() {
+	*x = GetCardRequest{}
+	mi := &file_card_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCardRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCardRequest) ProtoMessage() {}
+
+func (x *GetCardRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_card_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCardRequest.ProtoReflect.Descriptor instead.
+func (*GetCardRequest) Descriptor() ([]byte, []int) {
+	return file_card_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetCardRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type SearchCardsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Identities    []string               `protobuf:"bytes,1,rep,name=identities,proto3" json:"identities,omitempty"`
+	IdentityType  string                 `protobuf:"bytes,2,opt,name=identity_type,json=identityType,proto3" json:"identity_type,omitempty"`
+	Scope         string                 `protobuf:"bytes,3,opt,name=scope,proto3" json:"scope,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchCardsRequest) Reset() {
+	*x = SearchCardsRequest{}
+	mi := &file_card_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchCardsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchCardsRequest) ProtoMessage() {}
+
+func (x *SearchCardsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_card_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchCardsRequest.ProtoReflect.Descriptor instead.
+func (*SearchCardsRequest) Descriptor() ([]byte, []int) {
+	return file_card_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SearchCardsRequest) GetIdentities() []string {
+	if x != nil {
+		return x.Identities
+	}
+	return nil
+}
+
+func (x *SearchCardsRequest) GetIdentityType() string {
+	if x != nil {
+		return x.IdentityType
+	}
+	return ""
+}
+
+func (x *SearchCardsRequest) GetScope() string {
+	if x != nil {
+		return x.Scope
+	}
+	return ""
+}
+
+type CreateCardResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Card  *Card                  `protobuf:"bytes,1,opt,name=card,proto3" json:"card,omitempty"`
+	// queued is set if upstreams are unreachable and the request will be sent later (offline mode)
+	Queued        bool `protobuf:"varint,2,opt,name=queued,proto3" json:"queued,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateCardResponse) Reset() {
+	*x = CreateCardResponse{}
+	mi := &file_card_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateCardResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateCardResponse) ProtoMessage() {}
+
+func (x *CreateCardResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_card_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateCardResponse.ProtoReflect.Descriptor instead.
+func (*CreateCardResponse) Descriptor() ([]byte, []int) {
+	return file_card_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *CreateCardResponse) GetCard() *Card {
+	if x != nil {
+		return x.Card
+	}
+	return nil
+}
+
+func (x *CreateCardResponse) GetQueued() bool {
+	if x != nil {
+		return x.Queued
+	}
+	return false
+}
+
+type RevokeCardRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Request       *SignableRequest       `protobuf:"bytes,2,opt,name=request,proto3" json:"request,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RevokeCardRequest) Reset() {
+	*x = RevokeCardRequest{}
+	mi := &file_card_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RevokeCardRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RevokeCardRequest) ProtoMessage() {}
+
+func (x *RevokeCardRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_card_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RevokeCardRequest.ProtoReflect.Descriptor instead.
+func (*RevokeCardRequest) Descriptor() ([]byte, []int) {
+	return file_card_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *RevokeCardRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *RevokeCardRequest) GetRequest() *SignableRequest {
+	if x != nil {
+		return x.Request
+	}
+	return nil
+}
+
+type RevokeCardResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// queued is set if upstreams are unreachable and the request will be sent later (offline mode)
+	Queued        bool `protobuf:"varint,1,opt,name=queued,proto3" json:"queued,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RevokeCardResponse) Reset() {
+	*x = RevokeCardResponse{}
+	mi := &file_card_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RevokeCardResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RevokeCardResponse) ProtoMessage() {}
+
+func (x *RevokeCardResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_card_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RevokeCardResponse.ProtoReflect.Descriptor instead.
+func (*RevokeCardResponse) Descriptor() ([]byte, []int) {
+	return file_card_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *RevokeCardResponse) GetQueued() bool {
+	if x != nil {
+		return x.Queued
+	}
+	return false
+}
+
+type CreateRelationRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Request       *SignableRequest       `protobuf:"bytes,2,opt,name=request,proto3" json:"request,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateRelationRequest) Reset() {
+	*x = CreateRelationRequest{}
+	mi := &file_card_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateRelationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateRelationRequest) ProtoMessage() {}
+
+func (x *CreateRelationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_card_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateRelationRequest.ProtoReflect.Descriptor instead.
+func (*CreateRelationRequest) Descriptor() ([]byte, []int) {
+	return file_card_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *CreateRelationRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *CreateRelationRequest) GetRequest() *SignableRequest {
+	if x != nil {
+		return x.Request
+	}
+	return nil
+}
+
+type RevokeRelationRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Request       *SignableRequest       `protobuf:"bytes,2,opt,name=request,proto3" json:"request,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RevokeRelationRequest) Reset() {
+	*x = RevokeRelationRequest{}
+	mi := &file_card_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RevokeRelationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RevokeRelationRequest) ProtoMessage() {}
+
+func (x *RevokeRelationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_card_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RevokeRelationRequest.ProtoReflect.Descriptor instead.
+func (*RevokeRelationRequest) Descriptor() ([]byte, []int) {
+	return file_card_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *RevokeRelationRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *RevokeRelationRequest) GetRequest() *SignableRequest {
+	if x != nil {
+		return x.Request
+	}
+	return nil
+}
+
+var File_card_proto protoreflect.FileDescriptor
+
+const file_card_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"card.proto\x12\x0fvirgild.card.v4\"p\n" +
+	"\x04Card\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12)\n" +
+	"\x10content_snapshot\x18\x02 \x01(\fR\x0fcontentSnapshot\x12-\n" +
+	"\x04meta\x18\x03 \x01(\v2\x19.virgild.card.v4.CardMetaR\x04meta\"\xc8\x02\n" +
+	"\bCardMeta\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\x01 \x01(\tR\tcreatedAt\x12!\n" +
+	"\fcard_version\x18\x02 \x01(\tR\vcardVersion\x12:\n" +
+	"\x05signs\x18\x03 \x03(\v2$.virgild.card.v4.CardMeta.SignsEntryR\x05signs\x12F\n" +
+	"\trelations\x18\x04 \x03(\v2(.virgild.card.v4.CardMeta.RelationsEntryR\trelations\x1a8\n" +
+	"\n" +
+	"SignsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\fR\x05value:\x028\x01\x1a<\n" +
+	"\x0eRelationsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\fR\x05value:\x028\x01\"n\n" +
+	"\x0fSignableRequest\x12)\n" +
+	"\x10content_snapshot\x18\x01 \x01(\fR\x0fcontentSnapshot\x120\n" +
+	"\x04meta\x18\x02 \x01(\v2\x1c.virgild.card.v4.RequestMetaR\x04meta\"\xc7\x01\n" +
+	"\vRequestMeta\x12=\n" +
+	"\x05signs\x18\x01 \x03(\v2'.virgild.card.v4.RequestMeta.SignsEntryR\x05signs\x12?\n" +
+	"\n" +
+	"validation\x18\x02 \x01(\v2\x1f.virgild.card.v4.ValidationInfoR\n" +
+	"validation\x1a8\n" +
+	"\n" +
+	"SignsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\fR\x05value:\x028\x01\"&\n" +
+	"\x0eValidationInfo\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\" \n" +
+	"\x0eGetCardRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"o\n" +
+	"\x12SearchCardsRequest\x12\x1e\n" +
+	"\n" +
+	"identities\x18\x01 \x03(\tR\n" +
+	"identities\x12#\n" +
+	"\ridentity_type\x18\x02 \x01(\tR\fidentityType\x12\x14\n" +
+	"\x05scope\x18\x03 \x01(\tR\x05scope\"W\n" +
+	"\x12CreateCardResponse\x12)\n" +
+	"\x04card\x18\x01 \x01(\v2\x15.virgild.card.v4.CardR\x04card\x12\x16\n" +
+	"\x06queued\x18\x02 \x01(\bR\x06queued\"_\n" +
+	"\x11RevokeCardRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12:\n" +
+	"\arequest\x18\x02 \x01(\v2 .virgild.card.v4.SignableRequestR\arequest\",\n" +
+	"\x12RevokeCardResponse\x12\x16\n" +
+	"\x06queued\x18\x01 \x01(\bR\x06queued\"c\n" +
+	"\x15CreateRelationRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12:\n" +
+	"\arequest\x18\x02 \x01(\v2 .virgild.card.v4.SignableRequestR\arequest\"c\n" +
+	"\x15RevokeRelationRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12:\n" +
+	"\arequest\x18\x02 \x01(\v2 .virgild.card.v4.SignableRequestR\arequest2\xe5\x03\n" +
+	"\x05Cards\x12A\n" +
+	"\aGetCard\x12\x1f.virgild.card.v4.GetCardRequest\x1a\x15.virgild.card.v4.Card\x12K\n" +
+	"\vSearchCards\x12#.virgild.card.v4.SearchCardsRequest\x1a\x15.virgild.card.v4.Card0\x01\x12S\n" +
+	"\n" +
+	"CreateCard\x12 .virgild.card.v4.SignableRequest\x1a#.virgild.card.v4.CreateCardResponse\x12U\n" +
+	"\n" +
+	"RevokeCard\x12\".virgild.card.v4.RevokeCardRequest\x1a#.virgild.card.v4.RevokeCardResponse\x12O\n" +
+	"\x0eCreateRelation\x12&.virgild.card.v4.CreateRelationRequest\x1a\x15.virgild.card.v4.Card\x12O\n" +
+	"\x0eRevokeRelation\x12&.virgild.card.v4.RevokeRelationRequest\x1a\x15.virgild.card.v4.CardB8Z6github.com/VirgilSecurity/virgild/modules/card/grpc/pbb\x06proto3"
+
+var (
+	file_card_proto_rawDescOnce sync.Once
+	file_card_proto_rawDescData []byte
+)
+
+func file_card_proto_rawDescGZIP() []byte {
+	file_card_proto_rawDescOnce.Do(func() {
+		file_card_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_card_proto_rawDesc), len(file_card_proto_rawDesc)))
+	})
+	return file_card_proto_rawDescData
+}
+
+var file_card_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_card_proto_goTypes = []any{
+	(*Card)(nil),                  // 0: virgild.card.v4.Card
+	(*CardMeta)(nil),              // 1: virgild.card.v4.CardMeta
+	(*SignableRequest)(nil),       // 2: virgild.card.v4.SignableRequest
+	(*RequestMeta)(nil),           // 3: virgild.card.v4.RequestMeta
+	(*ValidationInfo)(nil),        // 4: virgild.card.v4.ValidationInfo
+	(*GetCardRequest)(nil),        // 5: virgild.card.v4.GetCardRequest
+	(*SearchCardsRequest)(nil),    // 6: virgild.card.v4.SearchCardsRequest
+	(*CreateCardResponse)(nil),    // 7: virgild.card.v4.CreateCardResponse
+	(*RevokeCardRequest)(nil),     // 8: virgild.card.v4.RevokeCardRequest
+	(*RevokeCardResponse)(nil),    // 9: virgild.card.v4.RevokeCardResponse
+	(*CreateRelationRequest)(nil), // 10: virgild.card.v4.CreateRelationRequest
+	(*RevokeRelationRequest)(nil), // 11: virgild.card.v4.RevokeRelationRequest
+	nil,                           // 12: virgild.card.v4.CardMeta.SignsEntry
+	nil,                           // 13: virgild.card.v4.CardMeta.RelationsEntry
+	nil,                           // 14: virgild.card.v4.RequestMeta.SignsEntry
+}
+var file_card_proto_depIdxs = []int32{
+	1,  // 0: virgild.card.v4.Card.meta:type_name -> virgild.card.v4.CardMeta
+	12, // 1: virgild.card.v4.CardMeta.signs:type_name -> virgild.card.v4.CardMeta.SignsEntry
+	13, // 2: virgild.card.v4.CardMeta.relations:type_name -> virgild.card.v4.CardMeta.RelationsEntry
+	3,  // 3: virgild.card.v4.SignableRequest.meta:type_name -> virgild.card.v4.RequestMeta
+	14, // 4: virgild.card.v4.RequestMeta.signs:type_name -> virgild.card.v4.RequestMeta.SignsEntry
+	4,  // 5: virgild.card.v4.RequestMeta.validation:type_name -> virgild.card.v4.ValidationInfo
+	0,  // 6: virgild.card.v4.CreateCardResponse.card:type_name -> virgild.card.v4.Card
+	2,  // 7: virgild.card.v4.RevokeCardRequest.request:type_name -> virgild.card.v4.SignableRequest
+	2,  // 8: virgild.card.v4.CreateRelationRequest.request:type_name -> virgild.card.v4.SignableRequest
+	2,  // 9: virgild.card.v4.RevokeRelationRequest.request:type_name -> virgild.card.v4.SignableRequest
+	5,  // 10: virgild.card.v4.Cards.GetCard:input_type -> virgild.card.v4.GetCardRequest
+	6,  // 11: virgild.card.v4.Cards.SearchCards:input_type -> virgild.card.v4.SearchCardsRequest
+	2,  // 12: virgild.card.v4.Cards.CreateCard:input_type -> virgild.card.v4.SignableRequest
+	8,  // 13: virgild.card.v4.Cards.RevokeCard:input_type -> virgild.card.v4.RevokeCardRequest
+	10, // 14: virgild.card.v4.Cards.CreateRelation:input_type -> virgild.card.v4.CreateRelationRequest
+	11, // 15: virgild.card.v4.Cards.RevokeRelation:input_type -> virgild.card.v4.RevokeRelationRequest
+	0,  // 16: virgild.card.v4.Cards.GetCard:output_type -> virgild.card.v4.Card
+	0,  // 17: virgild.card.v4.Cards.SearchCards:output_type -> virgild.card.v4.Card
+	7,  // 18: virgild.card.v4.Cards.CreateCard:output_type -> virgild.card.v4.CreateCardResponse
+	9,  // 19: virgild.card.v4.Cards.RevokeCard:output_type -> virgild.card.v4.RevokeCardResponse
+	0,  // 20: virgild.card.v4.Cards.CreateRelation:output_type -> virgild.card.v4.Card
+	0,  // 21: virgild.card.v4.Cards.RevokeRelation:output_type -> virgild.card.v4.Card
+	16, // [16:22] is the sub-list for method output_type
+	10, // [10:16] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_card_proto_init() }
+func file_card_proto_init() {
+	if File_card_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_card_proto_rawDesc), len(file_card_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   15,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_card_proto_goTypes,
+		DependencyIndexes: file_card_proto_depIdxs,
+		MessageInfos:      file_card_proto_msgTypes,
+	}.Build()
+	File_card_proto = out.File
+	file_card_proto_goTypes = nil
+	file_card_proto_depIdxs = nil
+}
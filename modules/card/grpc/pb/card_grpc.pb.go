@@ -0,0 +1,319 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: card.proto
+
+// Cards service of VirgilD. Messages follow JSON models of Cards Service v4, snapshots and signatures are raw bytes.
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Cards_GetCard_FullMethodName        = "/virgild.card.v4.Cards/GetCard"
+	Cards_SearchCards_FullMethodName    = "/virgild.card.v4.Cards/SearchCards"
+	Cards_CreateCard_FullMethodName     = "/virgild.card.v4.Cards/CreateCard"
+	Cards_RevokeCard_FullMethodName     = "/virgild.card.v4.Cards/RevokeCard"
+	Cards_CreateRelation_FullMethodName = "/virgild.card.v4.Cards/CreateRelation"
+	Cards_RevokeRelation_FullMethodName = "/virgild.card.v4.Cards/RevokeRelation"
+)
+
+// CardsClient is the client API for Cards service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CardsClient interface {
+	GetCard(ctx context.Context, in *GetCardRequest, opts ...grpc.CallOption) (*Card, error)
+	// SearchCards streams found cards one by one
+	SearchCards(ctx context.Context, in *SearchCardsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Card], error)
+	CreateCard(ctx context.Context, in *SignableRequest, opts ...grpc.CallOption) (*CreateCardResponse, error)
+	RevokeCard(ctx context.Context, in *RevokeCardRequest, opts ...grpc.CallOption) (*RevokeCardResponse, error)
+	CreateRelation(ctx context.Context, in *CreateRelationRequest, opts ...grpc.CallOption) (*Card, error)
+	RevokeRelation(ctx context.Context, in *RevokeRelationRequest, opts ...grpc.CallOption) (*Card, error)
+}
+
+type cardsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCardsClient(cc grpc.ClientConnInterface) CardsClient {
+	return &cardsClient{cc}
+}
+
+func (c *cardsClient) GetCard(ctx context.Context, in *GetCardRequest, opts ...grpc.CallOption) (*Card, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Card)
+	err := c.cc.Invoke(ctx, Cards_GetCard_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cardsClient) SearchCards(ctx context.Context, in *SearchCardsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Card], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Cards_ServiceDesc.Streams[0], Cards_SearchCards_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SearchCardsRequest, Card]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Cards_SearchCardsClient = grpc.ServerStreamingClient[Card]
+
+func (c *cardsClient) CreateCard(ctx context.Context, in *SignableRequest, opts ...grpc.CallOption) (*CreateCardResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateCardResponse)
+	err := c.cc.Invoke(ctx, Cards_CreateCard_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cardsClient) RevokeCard(ctx context.Context, in *RevokeCardRequest, opts ...grpc.CallOption) (*RevokeCardResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RevokeCardResponse)
+	err := c.cc.Invoke(ctx, Cards_RevokeCard_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cardsClient) CreateRelation(ctx context.Context, in *CreateRelationRequest, opts ...grpc.CallOption) (*Card, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Card)
+	err := c.cc.Invoke(ctx, Cards_CreateRelation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cardsClient) RevokeRelation(ctx context.Context, in *RevokeRelationRequest, opts ...grpc.CallOption) (*Card, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Card)
+	err := c.cc.Invoke(ctx, Cards_RevokeRelation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CardsServer is the server API for Cards service.
+// All implementations must embed UnimplementedCardsServer
+// for forward compatibility.
+type CardsServer interface {
+	GetCard(context.Context, *GetCardRequest) (*Card, error)
+	// SearchCards streams found cards one by one
+	SearchCards(*SearchCardsRequest, grpc.ServerStreamingServer[Card]) error
+	CreateCard(context.Context, *SignableRequest) (*CreateCardResponse, error)
+	RevokeCard(context.Context, *RevokeCardRequest) (*RevokeCardResponse, error)
+	CreateRelation(context.Context, *CreateRelationRequest) (*Card, error)
+	RevokeRelation(context.Context, *RevokeRelationRequest) (*Card, error)
+	mustEmbedUnimplementedCardsServer()
+}
+
+// UnimplementedCardsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCardsServer struct{}
+
+func (UnimplementedCardsServer) GetCard(context.Context, *GetCardRequest) (*Card, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCard not implemented")
+}
+func (UnimplementedCardsServer) SearchCards(*SearchCardsRequest, grpc.ServerStreamingServer[Card]) error {
+	return status.Errorf(codes.Unimplemented, "method SearchCards not implemented")
+}
+func (UnimplementedCardsServer) CreateCard(context.Context, *SignableRequest) (*CreateCardResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateCard not implemented")
+}
+func (UnimplementedCardsServer) RevokeCard(context.Context, *RevokeCardRequest) (*RevokeCardResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeCard not implemented")
+}
+func (UnimplementedCardsServer) CreateRelation(context.Context, *CreateRelationRequest) (*Card, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateRelation not implemented")
+}
+func (UnimplementedCardsServer) RevokeRelation(context.Context, *RevokeRelationRequest) (*Card, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeRelation not implemented")
+}
+func (UnimplementedCardsServer) mustEmbedUnimplementedCardsServer() {}
+func (UnimplementedCardsServer) testEmbeddedByValue()               {}
+
+// UnsafeCardsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CardsServer will
+// result in compilation errors.
+type UnsafeCardsServer interface {
+	mustEmbedUnimplementedCardsServer()
+}
+
+func RegisterCardsServer(s grpc.ServiceRegistrar, srv CardsServer) {
+	// If the following call pancis, it indicates UnimplementedCardsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Cards_ServiceDesc, srv)
+}
+
+func _Cards_GetCard_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCardRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CardsServer).GetCard(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cards_GetCard_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CardsServer).GetCard(ctx, req.(*GetCardRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cards_SearchCards_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SearchCardsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CardsServer).SearchCards(m, &grpc.GenericServerStream[SearchCardsRequest, Card]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Cards_SearchCardsServer = grpc.ServerStreamingServer[Card]
+
+func _Cards_CreateCard_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignableRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CardsServer).CreateCard(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cards_CreateCard_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CardsServer).CreateCard(ctx, req.(*SignableRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cards_RevokeCard_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeCardRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CardsServer).RevokeCard(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cards_RevokeCard_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CardsServer).RevokeCard(ctx, req.(*RevokeCardRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cards_CreateRelation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRelationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CardsServer).CreateRelation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cards_CreateRelation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CardsServer).CreateRelation(ctx, req.(*CreateRelationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cards_RevokeRelation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeRelationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CardsServer).RevokeRelation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cards_RevokeRelation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CardsServer).RevokeRelation(ctx, req.(*RevokeRelationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Cards_ServiceDesc is the grpc.ServiceDesc for Cards service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Cards_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "virgild.card.v4.Cards",
+	HandlerType: (*CardsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetCard",
+			Handler:    _Cards_GetCard_Handler,
+		},
+		{
+			MethodName: "CreateCard",
+			Handler:    _Cards_CreateCard_Handler,
+		},
+		{
+			MethodName: "RevokeCard",
+			Handler:    _Cards_RevokeCard_Handler,
+		},
+		{
+			MethodName: "CreateRelation",
+			Handler:    _Cards_CreateRelation_Handler,
+		},
+		{
+			MethodName: "RevokeRelation",
+			Handler:    _Cards_RevokeRelation_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SearchCards",
+			Handler:       _Cards_SearchCards_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "card.proto",
+}
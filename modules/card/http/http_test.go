@@ -1,7 +1,6 @@
 package http
 
 import (
-	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -23,23 +22,16 @@ func TestGetCard_SetContext(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	req.URL.RawQuery = ":id=test_id"
 
-	h := func(ctx context.Context, id string) (*virgil.CardResponse, error) {
-		assert.Equal(t, "test_id", id)
+	id, err := DecodeGetCard(req)
 
-		return nil, nil
-	}
-
-	GetCard(h)(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "test_id", id)
 }
 
 func TestSearchCards_BodyBroken_ReturnErr(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/", brokenReader{})
 
-	h := func(ctx context.Context, crit *virgil.Criteria) ([]virgil.CardResponse, error) {
-		return nil, nil
-	}
-
-	_, err := SearchCards(h)(req)
+	_, err := DecodeSearchCards(req)
 
 	assert.Equal(t, core.JSONInvalidErr, err)
 }
@@ -47,11 +39,7 @@ func TestSearchCards_BodyBroken_ReturnErr(t *testing.T) {
 func TestSearchCards_BodyInvalidJSON_ReturnErr(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 
-	h := func(ctx context.Context, crit *virgil.Criteria) ([]virgil.CardResponse, error) {
-		return nil, nil
-	}
-
-	_, err := SearchCards(h)(req)
+	_, err := DecodeSearchCards(req)
 
 	assert.Equal(t, core.JSONInvalidErr, err)
 }
@@ -64,23 +52,16 @@ func TestSearchCards_JSONCorrectPars(t *testing.T) {
 	}
 	req := httptest.NewRequest(http.MethodGet, "/", strings.NewReader(`{"identities":["bob","alice"],"identity_type":"test","scope":"application"}`))
 
-	h := func(ctx context.Context, crit *virgil.Criteria) ([]virgil.CardResponse, error) {
-		assert.Equal(t, expected, crit)
-
-		return nil, nil
-	}
+	got, err := DecodeSearchCards(req)
 
-	SearchCards(h)(req)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, got)
 }
 
 func TestCreateCard_BodyBroken_ReturnErr(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/", brokenReader{})
 
-	h := func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
-		return nil, nil
-	}
-
-	_, err := CreateCard(h)(req)
+	_, err := DecodeCreateCard(req)
 
 	assert.Equal(t, core.JSONInvalidErr, err)
 }
@@ -88,11 +69,7 @@ func TestCreateCard_BodyBroken_ReturnErr(t *testing.T) {
 func TestCreateCard_BodyInvalidJSON_ReturnErr(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 
-	h := func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
-		return nil, nil
-	}
-
-	_, err := CreateCard(h)(req)
+	_, err := DecodeCreateCard(req)
 
 	assert.Equal(t, core.JSONInvalidErr, err)
 }
@@ -102,11 +79,7 @@ func TestCreateCard_SnapshotInvalid(t *testing.T) {
   "content_snapshot": "eyJwdWJsaWMiOiJNQ293QlFZREsyVndBeUVBTTh6UGx6VUNWOC9SVGREQXVDeXBmenR0V280OFZ0U0k2YUVCYTdPcnEwYz0iLCJpZGVudGl0eSI6MTQ5MjQ5NjE4MDczNkBtYWlsaW5hdG9yLmNvbSwiaWRlbnRpdHlfdHlwZSI6ImVtYWlsIiwic2NvcGUiOiJnbG9iYWwiLCJpbmZvIjp7ImRldmljZSI6Im1hYyIsImRldmljZV9uYW1lIjoibWFjYm9vayBwcm8ifSwiZGF0YSI6eyJ2aXJnaWxfYXV0b3Rlc3QiOiJ2aXJnaWxfYXV0b3Rlc3QifX0=",
   "meta": {"signs": { } }}`))
 
-	h := func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
-		return nil, nil
-	}
-
-	_, err := CreateCard(h)(req)
+	_, err := DecodeCreateCard(req)
 
 	assert.Equal(t, core.SnapshotIncorrectErr, err)
 }
@@ -143,23 +116,16 @@ func TestCreateCard_JSONCorrectPars(t *testing.T) {
   "content_snapshot": "eyJwdWJsaWNfa2V5IjoiY0hWaWJHbGpYMnRsZVE9PSIsImlkZW50aXR5IjoiaXMgZW1haWwiLCJpZGVudGl0eV90eXBlIjoiZW1haWwiLCJzY29wZSI6Imdsb2JhbCIsImluZm8iOnsiZGV2aWNlIjoibWFjIiwiZGV2aWNlX25hbWUiOiJtYWNib29rIHBybyJ9LCJkYXRhIjp7InZpcmdpbF9kYXRhIjoidmlyZ2lsX2RhdGEifX0=",
   "meta": { "signs": {"c84ba35ed7af45948495659ce0bbdfd0db82f745d9e1436548474edd1bcf7a75": "Oik=" },"validation": { "token": "validation token" } }}`))
 
-	h := func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
-		assert.Equal(t, expected, req)
+	got, err := DecodeCreateCard(req)
 
-		return nil, nil
-	}
-
-	CreateCard(h)(req)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, got)
 }
 
 func TestRevokeCard_BodyBroken_ReturnErr(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/", brokenReader{})
 
-	h := func(ctx context.Context, req *core.RevokeCardRequest) error {
-		return nil
-	}
-
-	_, err := RevokeCard(h)(req)
+	_, err := DecodeRevokeCard(req)
 
 	assert.Equal(t, core.JSONInvalidErr, err)
 }
@@ -167,11 +133,7 @@ func TestRevokeCard_BodyBroken_ReturnErr(t *testing.T) {
 func TestRevokeCard_BodyInvalidJSON_ReturnErr(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 
-	h := func(ctx context.Context, req *core.RevokeCardRequest) error {
-		return nil
-	}
-
-	_, err := RevokeCard(h)(req)
+	_, err := DecodeRevokeCard(req)
 
 	assert.Equal(t, core.JSONInvalidErr, err)
 }
@@ -181,17 +143,14 @@ func TestRevokeCard_SnapshotInvalid(t *testing.T) {
   "content_snapshot": "eyJwdWJsaWMiOiJNQ293QlFZREsyVndBeUVBTTh6UGx6VUNWOC9SVGREQXVDeXBmenR0V280OFZ0U0k2YUVCYTdPcnEwYz0iLCJpZGVudGl0eSI6MTQ5MjQ5NjE4MDczNkBtYWlsaW5hdG9yLmNvbSwiaWRlbnRpdHlfdHlwZSI6ImVtYWlsIiwic2NvcGUiOiJnbG9iYWwiLCJpbmZvIjp7ImRldmljZSI6Im1hYyIsImRldmljZV9uYW1lIjoibWFjYm9vayBwcm8ifSwiZGF0YSI6eyJ2aXJnaWxfYXV0b3Rlc3QiOiJ2aXJnaWxfYXV0b3Rlc3QifX0=",
   "meta": {"signs": { } }}`))
 
-	h := func(ctx context.Context, req *core.RevokeCardRequest) error {
-		return nil
-	}
-
-	_, err := RevokeCard(h)(req)
+	_, err := DecodeRevokeCard(req)
 
 	assert.Equal(t, core.SnapshotIncorrectErr, err)
 }
 
 func TestRevokeCard_JSONCorrectPars(t *testing.T) {
 	expected := &core.RevokeCardRequest{
+		ID: "1234",
 		Info: virgil.RevokeCardRequest{
 			ID:               "1234",
 			RevocationReason: virgil.RevocationReason.Compromised,
@@ -209,52 +168,25 @@ func TestRevokeCard_JSONCorrectPars(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/", strings.NewReader(`{
   "content_snapshot": "eyJjYXJkX2lkIjoiMTIzNCIsInJldm9jYXRpb25fcmVhc29uIjoiY29tcHJvbWlzZWQifQ==",
   "meta": { "signs": {"c84ba35ed7af45948495659ce0bbdfd0db82f745d9e1436548474edd1bcf7a75": "Oik=" } }}`))
+	req.URL.RawQuery = ":id=1234"
 
-	h := func(ctx context.Context, req *core.RevokeCardRequest) error {
-		assert.Equal(t, expected, req)
+	got, err := DecodeRevokeCard(req)
 
-		return nil
-	}
-
-	RevokeCard(h)(req)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, got)
 }
 
 func TestRevokeCard_ReturnEmptyObject(t *testing.T) {
-	req := httptest.NewRequest(http.MethodGet, "/", strings.NewReader(`{
-  "content_snapshot": "eyJjYXJkX2lkIjoiMTIzNCIsInJldm9jYXRpb25fcmVhc29uIjoiY29tcHJvbWlzZWQifQ==",
-  "meta": { "signs": {"c84ba35ed7af45948495659ce0bbdfd0db82f745d9e1436548474edd1bcf7a75": "Oik=" } }}`))
-
-	h := func(ctx context.Context, req *core.RevokeCardRequest) error {
-		return nil
-	}
-
-	seccess, _ := RevokeCard(h)(req)
+	statusCode, seccess := EncodeRevokeCard(nil)
 
+	assert.Equal(t, http.StatusOK, statusCode)
 	assert.Equal(t, []byte(`{}`), seccess)
 }
 
-func TestRevokeCard_ReturnErr(t *testing.T) {
-	req := httptest.NewRequest(http.MethodGet, "/", strings.NewReader(`{
-  "content_snapshot": "eyJjYXJkX2lkIjoiMTIzNCIsInJldm9jYXRpb25fcmVhc29uIjoiY29tcHJvbWlzZWQifQ==",
-  "meta": { "signs": {"c84ba35ed7af45948495659ce0bbdfd0db82f745d9e1436548474edd1bcf7a75": "Oik=" } }}`))
-
-	h := func(ctx context.Context, req *core.RevokeCardRequest) error {
-		return fmt.Errorf("ERROR")
-	}
-
-	_, err := RevokeCard(h)(req)
-
-	assert.Error(t, err, "ERROR")
-}
-
 func TestCreateRelation_BodyBroken_ReturnErr(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/", brokenReader{})
 
-	h := func(ctx context.Context, req *core.CreateRelationRequest) (*virgil.CardResponse, error) {
-		return nil, nil
-	}
-
-	_, err := CreateRelation(h)(req)
+	_, err := DecodeCreateRelation(req)
 
 	assert.Equal(t, core.JSONInvalidErr, err)
 }
@@ -262,11 +194,7 @@ func TestCreateRelation_BodyBroken_ReturnErr(t *testing.T) {
 func TestCreateRelation_BodyInvalidJSON_ReturnErr(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 
-	h := func(ctx context.Context, req *core.CreateRelationRequest) (*virgil.CardResponse, error) {
-		return nil, nil
-	}
-
-	_, err := CreateRelation(h)(req)
+	_, err := DecodeCreateRelation(req)
 
 	assert.Equal(t, core.JSONInvalidErr, err)
 }
@@ -292,23 +220,16 @@ func TestCreateRelation_JSONCorrectPars(t *testing.T) {
   "meta": { "signs": {"c84ba35ed7af45948495659ce0bbdfd0db82f745d9e1436548474edd1bcf7a75": "Oik=" },"validation": { "token": "validation token" } }}`))
 
 	req.URL.RawQuery = ":id=1234"
-	h := func(ctx context.Context, req *core.CreateRelationRequest) (*virgil.CardResponse, error) {
-		assert.Equal(t, expected, req)
+	got, err := DecodeCreateRelation(req)
 
-		return nil, nil
-	}
-
-	CreateRelation(h)(req)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, got)
 }
 
 func TestRevokeRelation_BodyBroken_ReturnErr(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/", brokenReader{})
 
-	h := func(ctx context.Context, req *core.RevokeRelationRequest) (*virgil.CardResponse, error) {
-		return nil, nil
-	}
-
-	_, err := RevokeRelation(h)(req)
+	_, err := DecodeRevokeRelation(req)
 
 	assert.Equal(t, core.JSONInvalidErr, err)
 }
@@ -316,11 +237,7 @@ func TestRevokeRelation_BodyBroken_ReturnErr(t *testing.T) {
 func TestRevokeRelation_BodyInvalidJSON_ReturnErr(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 
-	h := func(ctx context.Context, req *core.RevokeRelationRequest) (*virgil.CardResponse, error) {
-		return nil, nil
-	}
-
-	_, err := RevokeRelation(h)(req)
+	_, err := DecodeRevokeRelation(req)
 
 	assert.Equal(t, core.JSONInvalidErr, err)
 }
@@ -330,11 +247,7 @@ func TestRevokeRelation_SnapshotInvalid(t *testing.T) {
   "content_snapshot": "eyJwdWJsaWMiOiJNQ293QlFZREsyVndBeUVBTTh6UGx6VUNWOC9SVGREQXVDeXBmenR0V280OFZ0U0k2YUVCYTdPcnEwYz0iLCJpZGVudGl0eSI6MTQ5MjQ5NjE4MDczNkBtYWlsaW5hdG9yLmNvbSwiaWRlbnRpdHlfdHlwZSI6ImVtYWlsIiwic2NvcGUiOiJnbG9iYWwiLCJpbmZvIjp7ImRldmljZSI6Im1hYyIsImRldmljZV9uYW1lIjoibWFjYm9vayBwcm8ifSwiZGF0YSI6eyJ2aXJnaWxfYXV0b3Rlc3QiOiJ2aXJnaWxfYXV0b3Rlc3QifX0=",
   "meta": {"signs": { } }}`))
 
-	h := func(ctx context.Context, req *core.RevokeRelationRequest) (*virgil.CardResponse, error) {
-		return nil, nil
-	}
-
-	_, err := RevokeRelation(h)(req)
+	_, err := DecodeRevokeRelation(req)
 
 	assert.Equal(t, core.SnapshotIncorrectErr, err)
 }
@@ -361,11 +274,8 @@ func TestRevokeRelation_JSONCorrectPars(t *testing.T) {
     "meta": { "signs": {"c84ba35ed7af45948495659ce0bbdfd0db82f745d9e1436548474edd1bcf7a75": "Oik=" } }}`))
 	req.URL.RawQuery = ":id=4321"
 
-	h := func(ctx context.Context, req *core.RevokeRelationRequest) (*virgil.CardResponse, error) {
-		assert.Equal(t, expected, req)
-
-		return nil, nil
-	}
+	got, err := DecodeRevokeRelation(req)
 
-	RevokeRelation(h)(req)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, got)
 }
@@ -1,48 +1,397 @@
 package card
 
 import (
+	"context"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/VirgilSecurity/virgild/coreapi"
-	vhttp "github.com/VirgilSecurity/virgild/modules/card/http"
-	"github.com/VirgilSecurity/virgild/modules/card/middleware"
+	"github.com/VirgilSecurity/virgild/modules/card/audit"
+	"github.com/VirgilSecurity/virgild/modules/card/core"
+	"github.com/VirgilSecurity/virgild/modules/card/offline"
+	"github.com/VirgilSecurity/virgild/modules/card/replica"
 	"github.com/VirgilSecurity/virgild/modules/card/validator"
 	"github.com/namsral/flag"
+	"github.com/pkg/errors"
 )
 
 var (
-	raService    string
-	cardsService string
+	upstream upstreamConfig
+	raKeys   string
+
+	auditFile    string
+	auditKeyFile string
+
+	replicationFile      string
+	replicationParent    string
+	replicationSecret    string
+	replicationHeartbeat time.Duration
+
+	offlineEnabled        bool
+	offlineQueueFile      string
+	offlineQueueKeyFile   string
+	offlineReplayInterval time.Duration
 )
 
+// upstreamConfig are flags of clients of upstream services, they are applied on reload of configuration without restart
+type upstreamConfig struct {
+	RAService    string
+	CardsService string
+
+	Timeout            time.Duration
+	Retry              retryPolicy
+	BreakerThreshold   int
+	BreakerOpenTimeout time.Duration
+
+	Balancing           string
+	HealthCheckPath     string
+	HealthCheckInterval time.Duration
+
+	Transport transportConfig
+	CardsPins string
+	RAPins    string
+}
+
+func (c *upstreamConfig) define(fs *flag.FlagSet) {
+	fs.StringVar(&c.RAService, "card-raservice", "https://ra.virgilsecurity.com", "Addres of Registration authority (comma separated list for several instances)")
+	fs.StringVar(&c.CardsService, "card-cardsservice", "https://cards.virgilsecurity.com", "Addres of Cards (comma separated list for several instances)")
+	fs.StringVar(&c.Balancing, "card-upstream-balancing", balancingRoundRobin, "Selection of upstream instance (enum: round-robin, latency)")
+	fs.StringVar(&c.HealthCheckPath, "card-upstream-healthcheck-path", "", "Path requested on every upstream instance to check its health (empty - disabled)")
+	fs.DurationVar(&c.HealthCheckInterval, "card-upstream-healthcheck-interval", 10*time.Second, "Interval of upstream health checks")
+
+	fs.DurationVar(&c.Timeout, "card-upstream-timeout", 10*time.Second, "Timeout of one request to upstream service")
+	fs.IntVar(&c.Retry.Retries, "card-upstream-retries", 2, "Count of retries of idempotent requests (get, search) to upstream service")
+	fs.DurationVar(&c.Retry.Backoff, "card-upstream-retry-backoff", 100*time.Millisecond, "Initial backoff between retries")
+	fs.DurationVar(&c.Retry.MaxBackoff, "card-upstream-retry-max-backoff", 2*time.Second, "Maximum backoff between retries")
+	fs.IntVar(&c.BreakerThreshold, "card-breaker-threshold", 5, "Count of consecutive upstream failures which opens circuit breaker (0 - disabled)")
+	fs.DurationVar(&c.BreakerOpenTimeout, "card-breaker-open-timeout", 30*time.Second, "Time while open circuit breaker rejects requests")
+
+	fs.StringVar(&c.Transport.Proxy, "card-upstream-proxy", "", "HTTP proxy for upstream requests (empty - use HTTP_PROXY/HTTPS_PROXY environment)")
+	fs.StringVar(&c.Transport.CAFile, "card-upstream-ca-file", "", "Path to PEM bundle of CA certificates trusted for upstream services (empty - system pool)")
+	fs.StringVar(&c.CardsPins, "card-cardsservice-pins", "", "Comma separated pins of Cards service certificates (sha256/<base64 SPKI hash> or cert-sha256/<base64 certificate hash>)")
+	fs.StringVar(&c.RAPins, "card-raservice-pins", "", "Comma separated pins of Registration authority certificates (sha256/<base64 SPKI hash> or cert-sha256/<base64 certificate hash>)")
+	fs.IntVar(&c.Transport.MaxIdleConns, "card-upstream-max-idle-conns", 100, "Maximum idle (keep-alive) connections to all upstreams")
+	fs.IntVar(&c.Transport.MaxIdleConnsPerHost, "card-upstream-max-idle-conns-per-host", 10, "Maximum idle (keep-alive) connections to one upstream host")
+	fs.DurationVar(&c.Transport.IdleConnTimeout, "card-upstream-idle-conn-timeout", 90*time.Second, "Time after which idle connection is closed")
+	fs.BoolVar(&c.Transport.DisableKeepAlives, "card-upstream-disable-keepalives", false, "Disable keep-alive connections to upstreams")
+	fs.BoolVar(&c.Transport.HTTP2, "card-upstream-http2", true, "Use HTTP/2 for upstreams which support it")
+}
+
+func defineRAKeys(keys *string) func(fs *flag.FlagSet) {
+	return func(fs *flag.FlagSet) {
+		fs.StringVar(keys, "card-ra-keys", "", "Trusted registration authorities in format id=<base64 public key> separated by comma. Create and revoke requests must be signed by one of them (empty - not required)")
+	}
+}
+
+// upstreamFlags are applied on reload of configuration without restart
+var upstreamFlags = []string{
+	"card-raservice", "card-cardsservice", "card-upstream-balancing", "card-upstream-healthcheck-path", "card-upstream-healthcheck-interval",
+	"card-upstream-timeout", "card-upstream-retries", "card-upstream-retry-backoff", "card-upstream-retry-max-backoff",
+	"card-breaker-threshold", "card-breaker-open-timeout", "card-upstream-proxy", "card-upstream-ca-file",
+	"card-cardsservice-pins", "card-raservice-pins", "card-upstream-max-idle-conns", "card-upstream-max-idle-conns-per-host",
+	"card-upstream-idle-conn-timeout", "card-upstream-disable-keepalives", "card-upstream-http2",
+}
+
 func init() {
-	flag.StringVar(&raService, "card-raservice", "https://ra.virgilsecurity.com", "Addres of Registration authority")
-	flag.StringVar(&cardsService, "card-cardsservice", "https://cards.virgilsecurity.com", "Addres of Cards")
+	upstream.define(flag.CommandLine)
+	defineRAKeys(&raKeys)(flag.CommandLine)
+
+	flag.StringVar(&auditFile, "card-audit-file", "", "Path to audit log of card operations (empty - disabled)")
+	flag.StringVar(&auditKeyFile, "card-audit-key-file", "", "Path to file with HMAC key of records of the audit log (empty - records are hashed by SHA-256)")
+
+	flag.StringVar(&replicationFile, "card-replication-file", "", "Path to journal of card events for replication. The replica holds only cards changed through the root instance, it is not seeded from upstreams (empty - disabled)")
+	flag.StringVar(&replicationParent, "card-replication-parent", "", "Address of parent VirgilD to replicate cards from (empty - the instance journals card operations it handles, the replica doesn't contain cards changed bypassing it)")
+	flag.StringVar(&replicationSecret, "card-replication-secret", "", "Secret of the stream of card events shared by parent and children (empty - the stream is not served)")
+	flag.DurationVar(&replicationHeartbeat, "card-replication-heartbeat", 15*time.Second, "Interval of heartbeats of the stream of card events")
+
+	flag.BoolVar(&offlineEnabled, "card-offline-enabled", false, "Answer get and search from the replica and queue create and revoke requests while upstreams are unreachable")
+	flag.StringVar(&offlineQueueFile, "card-offline-queue-file", "", "Path to queue of create and revoke requests received while upstreams are unreachable (empty - the requests fail)")
+	flag.StringVar(&offlineQueueKeyFile, "card-offline-queue-key-file", "", "Path to file with key which encrypts access tokens of queued requests (required by card-offline-queue-file)")
+	flag.DurationVar(&offlineReplayInterval, "card-offline-replay-interval", 10*time.Second, "Interval of attempts to send queued requests upstream")
+
+	coreapi.RegisterConfigValidator(validateConfig)
 }
 
 func Init(c coreapi.Core) {
-	apiWrap := c.HTTP.WrapAPIHandler
-	cache := cacheCardMiddleware{cache: c.Common.Cache}
-	cloud := cloudCard{
-		CardsService: cardsService,
-		RAService:    raService,
-		Client:       http.DefaultClient,
-	}
-
-	hGet := middleware.RequestOwner(vhttp.GetCard(cache.GetCard(cloud.getCard)))
-	hSearch := middleware.RequestOwner(vhttp.SearchCards(middleware.SetApplicationScopForSearch(validator.SearchCards(cache.SearchCards(cloud.searchCards)))))
-	hCreateCard := middleware.RequestOwner(vhttp.CreateCard(validator.CreateCard(cache.CreateCard(cloud.createCard))))
-	hRevokeCard := middleware.RequestOwner(vhttp.RevokeCard(validator.RevokeCard(cache.RevokeCard(cloud.revokeCard))))
-	hCreateRelation := middleware.RequestOwner(vhttp.CreateRelation(cache.CreateRelations(cloud.createRelation)))
-	hRevokeRelation := middleware.RequestOwner(vhttp.RevokeRelation(cache.RevokeRelations(cloud.revokeRelation)))
-
-	r := c.HTTP.Router
-	r.Post("/v1/card", apiWrap(hCreateCard))
-	r.Del("/v1/card/:id", apiWrap(hRevokeCard))
-	r.Post("/v4/card", apiWrap(hCreateCard))
-	r.Post("/v4/card/actions/search", apiWrap(hSearch))
-	r.Del("/v4/card/:id", apiWrap(hRevokeCard))
-	r.Get("/v4/card/:id", apiWrap(hGet))
-	r.Post("/v4/card/:id/collections/relations", apiWrap(hCreateRelation))
-	r.Del("/v4/card/:id/collections/relations", apiWrap(hRevokeRelation))
+	ttls, err := makeTenantTTLs(coreapi.Tenants())
+	if err != nil {
+		c.Common.Logger.Err("Card.init: Cannot parse cache TTL: %+v", err)
+		os.Exit(-1)
+	}
+	cache := cacheCardMiddleware{cache: c.Common.Cache, ttls: coreapi.NewReloadable(ttls)}
+	coreapi.RegisterReloadHook("card cache TTL", []string{coreapi.TenantsFlag}, func(v coreapi.ReloadValues) (func(), error) {
+		ttls, err := makeTenantTTLs(v.Tenants())
+		if err != nil {
+			return nil, err
+		}
+		return func() { cache.ttls.Set(ttls) }, nil
+	})
+
+	ra, err := makeTrustedRA(raKeys, coreapi.Tenants())
+	if err != nil {
+		c.Common.Logger.Err("Card.init: Cannot parse trusted RA: %+v", err)
+		os.Exit(-1)
+	}
+	ras := coreapi.NewReloadable(ra)
+	coreapi.RegisterReloadHook("trusted RA", []string{"card-ra-keys", coreapi.TenantsFlag}, func(v coreapi.ReloadValues) (func(), error) {
+		var keys string
+		if err := v.Flags.Parse(defineRAKeys(&keys)); err != nil {
+			return nil, err
+		}
+		ra, err := makeTrustedRA(keys, v.Tenants())
+		if err != nil {
+			return nil, err
+		}
+		return func() { ras.Set(ra) }, nil
+	})
+
+	def, tenants, err := makeClouds(upstream, coreapi.Tenants())
+	if err != nil {
+		c.Common.Logger.Err("Card.init: %+v", err)
+		os.Exit(-1)
+	}
+	rc := newReloadableCloud(def, tenants)
+	coreapi.RegisterReloadHook("card upstreams", append(upstreamFlags, coreapi.TenantsFlag), func(v coreapi.ReloadValues) (func(), error) {
+		var u upstreamConfig
+		if err := v.Flags.Parse(u.define); err != nil {
+			return nil, err
+		}
+		def, next, err := makeClouds(u, v.Tenants())
+		if err != nil {
+			return nil, err
+		}
+		return func() {
+			prev := rc.v.Load().(clouds).tenants
+			rc.set(def, next)
+			registerTenantHealthChecks(rc, prev, next)
+		}, nil
+	})
+
+	// journals are locked, the wait for the previous process is logged
+	lockCtx := coreapi.SetLogger(context.Background(), c.Common.Logger)
+	var (
+		rep *replica.Replica
+		sub *replica.Subscriber
+	)
+	if replicationFile != "" {
+		if rep, sub, err = initReplication(lockCtx, c); err != nil {
+			c.Common.Logger.Err("Card.init: %+v", err)
+			os.Exit(-1)
+		}
+	} else if replicationParent != "" {
+		c.Common.Logger.Err("Card.init: card-replication-parent requires card-replication-file")
+		os.Exit(-1)
+	}
+	off, err := makeOffline(lockCtx, rep, sub)
+	if err != nil {
+		c.Common.Logger.Err("Card.init: %+v", err)
+		os.Exit(-1)
+	}
+
+	// every layer of the chain gets own span, the http layer span is started by the core
+	vt, ct, ut := layerTracer{"validator"}, layerTracer{"cache"}, layerTracer{"cloud"}
+	getCard := off.GetCard(ct.GetCard(cache.GetCard(ut.GetCard(rc.getCard))))
+	searchCards := vt.SearchCards(validator.SearchCards(off.SearchCards(ct.SearchCards(cache.SearchCards(ut.SearchCards(rc.searchCards))))))
+	createCard := vt.CreateCard(validator.CreateCard(off.CreateCard(ct.CreateCard(cache.CreateCard(ut.CreateCard(rc.createCard)))), createCardSigned(ras)))
+	revokeCard := vt.RevokeCard(validator.RevokeCard(off.RevokeCard(ct.RevokeCard(cache.RevokeCard(ut.RevokeCard(rc.revokeCard)))), revokeCardSigned(ras)))
+	createRelation := ct.CreateRelation(cache.CreateRelations(ut.CreateRelation(rc.createRelation)))
+	revokeRelation := ct.RevokeRelation(cache.RevokeRelations(ut.RevokeRelation(rc.revokeRelation)))
+	if auditFile != "" {
+		var key []byte
+		if auditKeyFile != "" {
+			if key, err = audit.ReadKey(auditKeyFile); err != nil {
+				c.Common.Logger.Err("Card.init: Cannot read audit key: %+v", err)
+				os.Exit(-1)
+			}
+		} else {
+			c.Common.Logger.Warn("Card.init: Audit log isn't keyed (card-audit-key-file), the chain can be recomputed by anyone who can write the file")
+		}
+		l, err := audit.Open(lockCtx, auditFile, key)
+		if err != nil {
+			c.Common.Logger.Err("Card.init: Cannot open audit log: %+v", err)
+			os.Exit(-1)
+		}
+		seq, hash := l.Head()
+		c.Common.Logger.Info("Card.init: Audit log opened at record %d (hash %v)", seq, hash)
+		coreapi.RegisterHealthCheck("audit_log", l.Check)
+		coreapi.RegisterCloseHook("audit log", func(ctx context.Context) error {
+			seq, hash := l.Head()
+			c.Common.Logger.Info("Audit log: closed at record %d (hash %v)", seq, hash)
+			return l.Close()
+		})
+		a := auditCardMiddleware{log: l}
+		createCard = a.CreateCard(createCard)
+		revokeCard = a.RevokeCard(revokeCard)
+		createRelation = a.CreateRelation(createRelation)
+		revokeRelation = a.RevokeRelation(revokeRelation)
+	}
+	// children get own operations back from the parent
+	if rep != nil && replicationParent == "" {
+		m := replicationCardMiddleware{journal: rep}
+		createCard = m.CreateCard(createCard)
+		revokeCard = m.RevokeCard(revokeCard)
+		createRelation = m.CreateRelation(createRelation)
+		revokeRelation = m.RevokeRelation(revokeRelation)
+	}
+	if offlineEnabled {
+		startOffline(c, off, createCard, revokeCard)
+	}
+
+	err = c.Register(operations(cardChains{
+		getCard:        getCard,
+		searchCards:    searchCards,
+		createCard:     createCard,
+		revokeCard:     revokeCard,
+		createRelation: createRelation,
+		revokeRelation: revokeRelation,
+	})...)
+	if err != nil {
+		c.Common.Logger.Err("Card.init: Cannot register operations: %+v", err)
+		os.Exit(-1)
+	}
+
+	coreapi.RegisterHealthCheck("upstream_cards", offlineHealthCheck(rc.healthCheck("", cardsPool)))
+	coreapi.RegisterHealthCheck("upstream_ra", offlineHealthCheck(rc.healthCheck("", raPool)))
+	registerTenantHealthChecks(rc, nil, tenants)
+}
+
+// initReplication opens the journal of card events, serves the stream of events to children and subscribes
+// to the parent
+func initReplication(lockCtx context.Context, c coreapi.Core) (*replica.Replica, *replica.Subscriber, error) {
+	rep, err := replica.Open(lockCtx, replicationFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	coreapi.RegisterHealthCheck("replica", rep.Check)
+	coreapi.RegisterCloseHook("replica", func(ctx context.Context) error { return rep.Close() })
+
+	if replicationSecret != "" {
+		c.HTTP.Mount(http.MethodGet, replica.EventsPath, c.HTTP.Stream("replication_events", &replica.Publisher{
+			Replica:   rep,
+			Secret:    replicationSecret,
+			Heartbeat: replicationHeartbeat,
+			Draining:  coreapi.Draining(),
+			Logger:    c.Common.Logger,
+		}))
+	}
+	if replicationParent == "" {
+		return rep, nil, nil
+	}
+
+	t, err := makeTransport(upstream.Transport, nil)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Cannot create replication transport")
+	}
+	s := &replica.Subscriber{
+		URL:       replicationParent,
+		Secret:    replicationSecret,
+		Client:    &http.Client{Transport: t},
+		Replica:   rep,
+		Heartbeat: replicationHeartbeat,
+		Backoff:   time.Second,
+		Logger:    c.Common.Logger,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	coreapi.RegisterHealthCheck("replication_parent", offlineHealthCheck(s.Check))
+	// the subscriber stops before the journal is closed
+	coreapi.RegisterCloseHook("replication subscriber", stopHook(cancel, done))
+	return rep, s, nil
+}
+
+// makeOffline creates middleware of offline mode. It passes requests through if offline mode is disabled.
+func makeOffline(lockCtx context.Context, rep *replica.Replica, sub *replica.Subscriber) (*offlineCardMiddleware, error) {
+	m := &offlineCardMiddleware{now: time.Now}
+	if !offlineEnabled {
+		return m, nil
+	}
+	if rep != nil {
+		m.replica = rep
+	}
+	if sub != nil {
+		m.synced = sub.LastSync
+	}
+	if offlineQueueFile != "" {
+		if offlineReplayInterval <= 0 {
+			return nil, errors.Errorf("card-offline-replay-interval: %v is not positive", offlineReplayInterval)
+		}
+		if offlineQueueKeyFile == "" {
+			return nil, errors.New("card-offline-queue-file requires card-offline-queue-key-file")
+		}
+		key, err := audit.ReadKey(offlineQueueKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		q, err := offline.Open(lockCtx, offlineQueueFile, key)
+		if err != nil {
+			return nil, err
+		}
+		coreapi.RegisterCloseHook("offline queue", func(ctx context.Context) error { return q.Close() })
+		if m.conflicts, err = q.Conflicts(maxConflicts); err != nil {
+			return nil, err
+		}
+		m.queue = q
+	}
+	return m, nil
+}
+
+// startOffline starts replay of queued operations by complete chains of operations
+func startOffline(c coreapi.Core, m *offlineCardMiddleware, createCard core.CreateCardHandler, revokeCard core.RevokeCardHandler) {
+	coreapi.RegisterHealthCheck("offline", m.check)
+	if m.queue == nil {
+		return
+	}
+	m.createCard, m.revokeCard = createCard, revokeCard
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.run(ctx, c.Common.Logger, offlineReplayInterval)
+	}()
+	// replay stops before the queue is closed
+	coreapi.RegisterCloseHook("offline replay", stopHook(cancel, done))
+}
+
+// stopHook cancels the background goroutine and waits until it closes done or the hook times out
+func stopHook(cancel context.CancelFunc, done <-chan struct{}) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// makeCloud creates client of upstream services from flags
+func makeCloud(c upstreamConfig, cardsService, raService string) (*cloudCard, error) {
+	cardsURLs, raURLs := parseUpstreams(cardsService), parseUpstreams(raService)
+	pins, err := hostPins(make(map[string][]string), cardsURLs, c.CardsPins)
+	if err == nil {
+		pins, err = hostPins(pins, raURLs, c.RAPins)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot parse pins")
+	}
+	t, err := makeTransport(c.Transport, pins)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot create upstream transport")
+	}
+
+	return &cloudCard{
+		Cards:               newUpstreamPool("cards", cardsURLs, c.Balancing, c.BreakerThreshold, c.BreakerOpenTimeout),
+		RA:                  newUpstreamPool("ra", raURLs, c.Balancing, c.BreakerThreshold, c.BreakerOpenTimeout),
+		Client:              &http.Client{Timeout: c.Timeout, Transport: t},
+		Retry:               c.Retry,
+		HealthCheckPath:     c.HealthCheckPath,
+		HealthCheckInterval: c.HealthCheckInterval,
+	}, nil
 }
@@ -0,0 +1,78 @@
+package card
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gopkg.in/virgil.v4"
+)
+
+func TestObserveUpstream_APIError_CountErrorCode(t *testing.T) {
+	err := errors.Wrap(coreapi.APIError{Code: 30000, StatusCode: 400}, "send")
+	before := testutil.ToFloat64(cloudErrorsMetric.WithLabelValues("metrics_test", "30000"))
+
+	observeUpstream("metrics_test", time.Now(), "400", err)
+
+	assert.Equal(t, before+1, testutil.ToFloat64(cloudErrorsMetric.WithLabelValues("metrics_test", "30000")))
+}
+
+func TestCloudGetCard_TransportError_CountTransportError(t *testing.T) {
+	f := new(fakeHttpClient)
+	f.On("Do", mock.Anything).Return(nil, fmt.Errorf("connection refused"))
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service"), Client: f}
+	before := testutil.ToFloat64(cloudErrorsMetric.WithLabelValues("get_card", upstreamStatusTransportError))
+
+	_, err := cloud.getCard(context.Background(), "1234")
+
+	assert.Error(t, err)
+	assert.Equal(t, before+1, testutil.ToFloat64(cloudErrorsMetric.WithLabelValues("get_card", upstreamStatusTransportError)))
+}
+
+func TestCloudGetCard_NotFound_StatusCodeWithoutError(t *testing.T) {
+	f := new(fakeHttpClient)
+	f.On("Do", mock.Anything).Return(&http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil)
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service"), Client: f}
+	beforeErrors := testutil.ToFloat64(cloudErrorsMetric.WithLabelValues("get_card", "0"))
+	beforeNotFound := testutil.ToFloat64(cloudErrorsMetric.WithLabelValues("get_card", "404"))
+
+	_, err := cloud.getCard(context.Background(), "1234")
+
+	assert.Equal(t, coreapi.EntityNotFoundErr, err)
+	assert.Equal(t, beforeErrors, testutil.ToFloat64(cloudErrorsMetric.WithLabelValues("get_card", "0")))
+	assert.Equal(t, beforeNotFound, testutil.ToFloat64(cloudErrorsMetric.WithLabelValues("get_card", "404")))
+}
+
+func TestObserveUpstream_WithoutVirgilCode_CountStatus(t *testing.T) {
+	observeUpstream("metrics_status_test", time.Now(), "503", coreapi.APIError{StatusCode: 503})
+	observeUpstream("metrics_status_test", time.Now(), upstreamStatusNoEndpoint, coreapi.UpstreamUnavailableErr)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(cloudErrorsMetric.WithLabelValues("metrics_status_test", "503")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(cloudErrorsMetric.WithLabelValues("metrics_status_test", "10002")))
+}
+
+func TestCacheGetCard_Miss_CountMiss(t *testing.T) {
+	cache := new(fakeCache)
+	cache.On("Get", "_id").Return(false)
+	cache.On("Set", "_id", mock.Anything)
+	before := testutil.ToFloat64(cacheRequestsMetric.WithLabelValues("get_card", "miss"))
+
+	cacheCard := cacheCardMiddleware{cache: cache}
+	cacheCard.GetCard(func(ctx context.Context, id string) (*virgil.CardResponse, error) {
+		return &virgil.CardResponse{ID: id}, nil
+	})(context.Background(), "id")
+
+	assert.Equal(t, before+1, testutil.ToFloat64(cacheRequestsMetric.WithLabelValues("get_card", "miss")))
+}
@@ -1,7 +1,7 @@
 package middleware
 
 import (
-	"net/http"
+	"context"
 	"strings"
 
 	"github.com/VirgilSecurity/virgild/coreapi"
@@ -10,24 +10,33 @@ import (
 
 var tokenType = "VIRGIL "
 
-func RequestOwner(next coreapi.APIHandler) coreapi.APIHandler {
-	return func(req *http.Request) (interface{}, error) {
-		authHeader := req.Header.Get("Authorization")
-
-		// maybe it's global request
-		if len(authHeader) == 0 {
-			return next(req)
-		}
-
-		if !strings.HasPrefix(authHeader, tokenType) {
-			return nil, core.UnsupportedAuthTypeErr
+// RequestOwner sets owner of the request by Authorization of any transport
+func RequestOwner(next coreapi.OperationHandler) coreapi.OperationHandler {
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, err := SetOwner(ctx, coreapi.GetAuthorization(ctx))
+		if err != nil {
+			return nil, err
 		}
+		return next(ctx, req)
+	}
+}
 
-		token := string(authHeader[len(tokenType):])
-		ctx := core.SetAuthHeader(req.Context(), authHeader)
-		ctx = core.SetOwnerRequest(ctx, token)
-		req = req.WithContext(ctx)
+// SetOwner puts the access token of Authorization header to the context. Requests without the header are global.
+func SetOwner(ctx context.Context, authHeader string) (context.Context, error) {
+	// maybe it's global request
+	if len(authHeader) == 0 {
+		return ctx, nil
+	}
 
-		return next(req)
+	if !strings.HasPrefix(authHeader, tokenType) {
+		return nil, core.UnsupportedAuthTypeErr
 	}
+
+	token := string(authHeader[len(tokenType):])
+	ctx = core.SetAuthHeader(ctx, authHeader)
+	ctx = core.SetOwnerRequest(ctx, token)
+	owner := coreapi.HashToken(token)
+	ctx = coreapi.SetLogger(ctx, coreapi.WithFields(coreapi.GetLogger(ctx), coreapi.Fields{"owner": owner}))
+	coreapi.SetAccessOwner(ctx, owner)
+	return ctx, nil
 }
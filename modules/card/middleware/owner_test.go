@@ -1,10 +1,10 @@
 package middleware
 
 import (
-	"net/http"
-	"net/http/httptest"
+	"context"
 	"testing"
 
+	"github.com/VirgilSecurity/virgild/coreapi"
 	"github.com/VirgilSecurity/virgild/modules/card/core"
 	"github.com/stretchr/testify/assert"
 )
@@ -13,15 +13,14 @@ func TestRequestOwner_AuthHeaderEmpty_ContextIsNotSet(t *testing.T) {
 	var token string
 	var authHeader string
 
-	h := func(req *http.Request) (interface{}, error) {
-		token = core.GetOwnerRequest(req.Context())
-		authHeader = core.GetAuthHeader(req.Context())
+	h := func(ctx context.Context, req interface{}) (interface{}, error) {
+		token = core.GetOwnerRequest(ctx)
+		authHeader = core.GetAuthHeader(ctx)
 
 		return nil, nil
 	}
 
-	req := httptest.NewRequest(http.MethodGet, "/", nil)
-	RequestOwner(h)(req)
+	RequestOwner(h)(context.Background(), nil)
 
 	assert.Equal(t, "", token)
 	assert.Equal(t, "", authHeader)
@@ -29,13 +28,12 @@ func TestRequestOwner_AuthHeaderEmpty_ContextIsNotSet(t *testing.T) {
 
 func TestRequestOwner_AuthHeaderInvalid_ReturnErr(t *testing.T) {
 
-	h := func(req *http.Request) (interface{}, error) {
+	h := func(ctx context.Context, req interface{}) (interface{}, error) {
 		return nil, nil
 	}
 
-	req := httptest.NewRequest(http.MethodGet, "/", nil)
-	req.Header.Set("Authorization", "berrer 1234")
-	_, err := RequestOwner(h)(req)
+	ctx := coreapi.SetAuthorization(context.Background(), "berrer 1234")
+	_, err := RequestOwner(h)(ctx, nil)
 
 	assert.Equal(t, core.UnsupportedAuthTypeErr, err)
 }
@@ -44,16 +42,15 @@ func TestRequestOwner_AuthHeaderExist_ContextIsSet(t *testing.T) {
 	var token string
 	var authHeader string
 
-	h := func(req *http.Request) (interface{}, error) {
-		token = core.GetOwnerRequest(req.Context())
-		authHeader = core.GetAuthHeader(req.Context())
+	h := func(ctx context.Context, req interface{}) (interface{}, error) {
+		token = core.GetOwnerRequest(ctx)
+		authHeader = core.GetAuthHeader(ctx)
 
 		return nil, nil
 	}
 
-	req := httptest.NewRequest(http.MethodGet, "/", nil)
-	req.Header.Set("Authorization", "VIRGIL 1234")
-	RequestOwner(h)(req)
+	ctx := coreapi.SetAuthorization(context.Background(), "VIRGIL 1234")
+	RequestOwner(h)(ctx, nil)
 
 	assert.Equal(t, "1234", token)
 	assert.Equal(t, "VIRGIL 1234", authHeader)
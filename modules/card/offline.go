@@ -0,0 +1,380 @@
+package card
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/VirgilSecurity/virgild/modules/card/core"
+	"github.com/VirgilSecurity/virgild/modules/card/offline"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	virgil "gopkg.in/virgil.v4"
+)
+
+const (
+	// OfflineHeader marks responses of offline mode: replica - the result is read from the replica,
+	// queued - the request is queued and will be sent upstream later
+	OfflineHeader = "X-Virgil-Offline"
+	// LastSyncHeader is the time of the last data received from upstreams (RFC 3339), it tells freshness of the replica
+	LastSyncHeader = "X-Virgil-Last-Sync"
+
+	offlineReplica = "replica"
+	offlineQueued  = "queued"
+
+	// maxConflicts is count of the last conflicts reported by the health check
+	maxConflicts = 20
+)
+
+var (
+	offlineQueueMetric = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "queue_length",
+		Subsystem: "offline",
+		Namespace: "virgild",
+		Help:      "Count of queued card operations which are not sent upstream yet",
+	})
+	offlineReplayMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "replayed_total",
+		Subsystem: "offline",
+		Namespace: "virgild",
+		Help:      "Count of replayed card operations by outcome (applied, conflict, unknown)",
+	}, []string{"outcome"})
+	offlineReadsMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "reads_total",
+		Subsystem: "offline",
+		Namespace: "virgild",
+		Help:      "Count of requests answered from the replica while upstreams are unreachable",
+	}, []string{"operation"})
+)
+
+func init() {
+	prometheus.MustRegister(offlineQueueMetric, offlineReplayMetric, offlineReadsMetric)
+}
+
+type cardReplica interface {
+	Get(owner, id string) (*virgil.CardResponse, bool)
+	Search(owner string, crit *virgil.Criteria) []virgil.CardResponse
+}
+
+type operationQueue interface {
+	Push(op offline.Operation) (offline.Operation, error)
+	Peek() (offline.Operation, bool)
+	Done(r offline.Result) error
+	Len() int
+}
+
+// offlineCardMiddleware answers get and search from the replica and queues create and revoke requests
+// while upstreams are unreachable. Without replica or queue requests fail as usual.
+type offlineCardMiddleware struct {
+	replica cardReplica
+	queue   operationQueue
+	// synced returns time of the last data received from the parent of replication
+	synced func() time.Time
+	now    func() time.Time
+
+	// createCard and revokeCard are complete chains of operations, queued operations are replayed by them
+	createCard core.CreateCardHandler
+	revokeCard core.RevokeCardHandler
+
+	mu         sync.Mutex
+	lastOnline time.Time
+	conflicts  []offline.Result
+}
+
+type replayContextKey struct{}
+
+func isReplay(ctx context.Context) bool {
+	replay, _ := ctx.Value(replayContextKey{}).(bool)
+	return replay
+}
+
+// isOffline reports whether the error means that upstreams are unreachable
+func isOffline(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	cause := errors.Cause(err)
+	if apiErr, ok := cause.(coreapi.APIError); ok {
+		switch apiErr.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	_, ok := cause.(net.Error)
+	return ok
+}
+
+// unsent reports whether the write certainly didn't reach upstreams: no endpoint is available, the connection
+// is refused or the upstream answers 503. Writes which may be applied (timeouts, 502, 504) aren't queued,
+// their replay would duplicate them.
+func unsent(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	if apiErr, ok := errors.Cause(err).(coreapi.APIError); ok {
+		return apiErr.StatusCode == http.StatusServiceUnavailable
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func ownerHash(ctx context.Context) string {
+	if owner := core.GetOwnerRequest(ctx); owner != "" {
+		return coreapi.HashToken(owner)
+	}
+	return ""
+}
+
+func (m *offlineCardMiddleware) online() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastOnline = m.now()
+}
+
+func (m *offlineCardMiddleware) lastSync() time.Time {
+	m.mu.Lock()
+	last := m.lastOnline
+	m.mu.Unlock()
+
+	if m.synced != nil {
+		if t := m.synced(); t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+func (m *offlineCardMiddleware) markOffline(ctx context.Context, kind string) {
+	coreapi.SetResponseHeader(ctx, OfflineHeader, kind)
+	if t := m.lastSync(); !t.IsZero() {
+		coreapi.SetResponseHeader(ctx, LastSyncHeader, t.UTC().Format(time.RFC3339))
+	}
+}
+
+func (m *offlineCardMiddleware) GetCard(f core.GetCardHandler) core.GetCardHandler {
+	return func(ctx context.Context, id string) (*virgil.CardResponse, error) {
+		card, err := f(ctx, id)
+		if err == nil {
+			m.online()
+		}
+		if m.replica == nil || !isOffline(ctx, err) {
+			return card, err
+		}
+		c, ok := m.replica.Get(ownerHash(ctx), id)
+		if !ok {
+			return nil, err
+		}
+		offlineReadsMetric.WithLabelValues("get_card").Inc()
+		m.markOffline(ctx, offlineReplica)
+		return c, nil
+	}
+}
+
+func (m *offlineCardMiddleware) SearchCards(f core.SearchCardsHandler) core.SearchCardsHandler {
+	return func(ctx context.Context, crit *virgil.Criteria) ([]virgil.CardResponse, error) {
+		cards, err := f(ctx, crit)
+		if err == nil {
+			m.online()
+		}
+		if m.replica == nil || !isOffline(ctx, err) {
+			return cards, err
+		}
+		offlineReadsMetric.WithLabelValues("search").Inc()
+		m.markOffline(ctx, offlineReplica)
+		return m.replica.Search(ownerHash(ctx), crit), nil
+	}
+}
+
+// CreateCard queues the request if upstreams are unreachable. Requests are queued while the queue is not empty,
+// so they reach upstreams in order of arrival.
+func (m *offlineCardMiddleware) CreateCard(f core.CreateCardHandler) core.CreateCardHandler {
+	return func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
+		if m.queue == nil || isReplay(ctx) {
+			return f(ctx, req)
+		}
+		if m.queue.Len() != 0 {
+			return nil, m.enqueue(ctx, offline.Operation{Type: offline.OperationCreateCard, Create: req})
+		}
+		card, err := f(ctx, req)
+		if err == nil {
+			m.online()
+		}
+		if !unsent(ctx, err) {
+			return card, err
+		}
+		return nil, m.enqueue(ctx, offline.Operation{Type: offline.OperationCreateCard, Create: req})
+	}
+}
+
+func (m *offlineCardMiddleware) RevokeCard(f core.RevokeCardHandler) core.RevokeCardHandler {
+	return func(ctx context.Context, req *core.RevokeCardRequest) error {
+		if m.queue == nil || isReplay(ctx) {
+			return f(ctx, req)
+		}
+		if m.queue.Len() != 0 {
+			return m.enqueue(ctx, offline.Operation{Type: offline.OperationRevokeCard, Revoke: req})
+		}
+		err := f(ctx, req)
+		if err == nil {
+			m.online()
+		}
+		if !unsent(ctx, err) {
+			return err
+		}
+		return m.enqueue(ctx, offline.Operation{Type: offline.OperationRevokeCard, Revoke: req})
+	}
+}
+
+// enqueue stores the operation and returns RequestQueuedErr, so layers above (audit, replication, cache)
+// don't take the operation as done
+func (m *offlineCardMiddleware) enqueue(ctx context.Context, op offline.Operation) error {
+	op.RequestID = coreapi.GetRequestID(ctx)
+	op.Owner = core.GetOwnerRequest(ctx)
+	op.Auth = core.GetAuthHeader(ctx)
+	if t := coreapi.GetTenant(ctx); t != nil {
+		op.Tenant = t.Name
+	}
+	op, err := m.queue.Push(op)
+	if err != nil {
+		return errors.Wrap(err, "Offline.enqueue")
+	}
+	offlineQueueMetric.Set(float64(m.queue.Len()))
+	coreapi.GetLogger(ctx).Warn("Offline: %v is queued (%d)", op.Type, op.Seq)
+	m.markOffline(ctx, offlineQueued)
+	return coreapi.RequestQueuedErr
+}
+
+// run replays queued operations every interval until ctx is done
+func (m *offlineCardMiddleware) run(ctx context.Context, logger coreapi.Logger, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		m.replay(ctx, logger)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// replay sends queued operations upstream in order until the queue is empty or upstreams are unreachable.
+// Operations rejected by upstreams are conflicts, they are removed from the queue and reported. Operations which
+// may have reached upstreams without response (timeouts, 502, 504) aren't repeated, their outcome is unknown.
+func (m *offlineCardMiddleware) replay(ctx context.Context, logger coreapi.Logger) {
+	for {
+		op, ok := m.queue.Peek()
+		if !ok {
+			return
+		}
+		rctx := replayContext(ctx, op, logger)
+		res := offline.Result{Seq: op.Seq, Type: op.Type, RequestID: op.RequestID, Outcome: offline.OutcomeApplied}
+		var err error
+		switch {
+		case op.Type == offline.OperationCreateCard && op.Create != nil:
+			var card *virgil.CardResponse
+			if card, err = m.createCard(rctx, op.Create); card != nil {
+				res.CardID = card.ID
+			}
+		case op.Type == offline.OperationRevokeCard && op.Revoke != nil:
+			res.CardID = op.Revoke.Info.ID
+			err = m.revokeCard(rctx, op.Revoke)
+		default:
+			err = fmt.Errorf("invalid operation (%v)", op.Type)
+		}
+		if ctx.Err() != nil || unsent(rctx, err) {
+			return
+		}
+
+		if err != nil {
+			res.Outcome = offline.OutcomeConflict
+			if isOffline(rctx, err) {
+				res.Outcome = offline.OutcomeUnknown
+			}
+			res.Error = err.Error()
+			if apiErr, ok := errors.Cause(err).(coreapi.APIError); ok {
+				res.ErrorCode = apiErr.Code
+			}
+			logger.Warn("Offline: %v of queued %v (%d, request %v): %v", res.Outcome, op.Type, op.Seq, op.RequestID, err)
+			m.conflict(res)
+		} else {
+			m.online()
+			logger.Info("Offline: queued %v (%d, request %v) is applied", op.Type, op.Seq, op.RequestID)
+		}
+		if err = m.queue.Done(res); err != nil {
+			logger.Err("Offline: %+v", err)
+			return
+		}
+		offlineReplayMetric.WithLabelValues(res.Outcome).Inc()
+		offlineQueueMetric.Set(float64(m.queue.Len()))
+	}
+}
+
+// replayContext restores the context of the queued request
+func replayContext(ctx context.Context, op offline.Operation, logger coreapi.Logger) context.Context {
+	ctx = context.WithValue(ctx, replayContextKey{}, true)
+	ctx = coreapi.SetRequestID(ctx, op.RequestID)
+	ctx = coreapi.SetLogger(ctx, coreapi.WithFields(logger, coreapi.Fields{"request_id": op.RequestID, "replay": op.Seq}))
+	if op.Owner != "" {
+		ctx = core.SetOwnerRequest(ctx, op.Owner)
+		ctx = core.SetAuthHeader(ctx, op.Auth)
+	}
+	// the id of the path is validated to be equal to the id of the request before the operation is queued
+	if op.Revoke != nil {
+		ctx = core.SetURLCardID(ctx, op.Revoke.Info.ID)
+	}
+	for _, t := range coreapi.Tenants() {
+		if t.Name == op.Tenant {
+			ctx = coreapi.SetTenant(ctx, t)
+		}
+	}
+	return ctx
+}
+
+// offlineHealthCheck reports failures of upstreams and of the parent as degraded while offline mode serves
+// requests without them
+func offlineHealthCheck(check coreapi.HealthCheck) coreapi.HealthCheck {
+	if !offlineEnabled || (replicationFile == "" && offlineQueueFile == "") {
+		return check
+	}
+	return func(ctx context.Context) (interface{}, error) {
+		details, err := check(ctx)
+		if err != nil {
+			err = coreapi.Degraded(err)
+		}
+		return details, err
+	}
+}
+
+func (m *offlineCardMiddleware) conflict(r offline.Result) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.conflicts = append(m.conflicts, r)
+	if len(m.conflicts) > maxConflicts {
+		m.conflicts = m.conflicts[len(m.conflicts)-maxConflicts:]
+	}
+}
+
+// check reports queued operations, the last conflicts and the time of the last data from upstreams
+func (m *offlineCardMiddleware) check(ctx context.Context) (interface{}, error) {
+	info := make(map[string]interface{})
+	if m.queue != nil {
+		info["queued"] = m.queue.Len()
+	}
+	if t := m.lastSync(); !t.IsZero() {
+		info["last_sync"] = t.UTC().Format(time.RFC3339)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info["conflicts"] = append([]offline.Result{}, m.conflicts...)
+	return info, nil
+}
@@ -0,0 +1,367 @@
+// Package offline implements durable queue of card operations which are received while upstreams are unreachable.
+// Operations are replayed in order of arrival, the file is truncated when all of them are replayed. Conflicts are
+// appended to a separate file, so they outlive the truncation.
+package offline
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/VirgilSecurity/virgild/modules/card/core"
+	"github.com/pkg/errors"
+)
+
+const (
+	OperationCreateCard = "create_card"
+	OperationRevokeCard = "revoke_card"
+
+	OutcomeApplied  = "applied"
+	OutcomeConflict = "conflict"
+	// OutcomeUnknown means that the operation may have reached upstreams without response, it isn't repeated
+	OutcomeUnknown = "unknown"
+)
+
+type Operation struct {
+	Seq       uint64 `json:"seq"`
+	Time      string `json:"time"`
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+	Tenant    string `json:"tenant,omitempty"`
+	// Owner and Auth are the access token and Authorization header of the client, they are sent upstream on replay.
+	// They are encrypted by the key of the queue on disk.
+	Owner  string                  `json:"owner,omitempty"`
+	Auth   string                  `json:"auth,omitempty"`
+	Create *core.CreateCardRequest `json:"create,omitempty"`
+	Revoke *core.RevokeCardRequest `json:"revoke,omitempty"`
+}
+
+// Result is the outcome of the replayed operation
+type Result struct {
+	Seq       uint64 `json:"seq"`
+	Time      string `json:"time"`
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+	CardID    string `json:"card_id,omitempty"`
+	Outcome   string `json:"outcome"`
+	ErrorCode int    `json:"error_code,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type record struct {
+	Operation *Operation `json:"operation,omitempty"`
+	Result    *Result    `json:"result,omitempty"`
+}
+
+type Queue struct {
+	sync.Mutex
+	file      *lineFile
+	conflicts *lineFile
+	aead      cipher.AEAD
+	seq       uint64
+	pending   []Operation
+	now       func() time.Time
+}
+
+// Open opens the queue and loads operations which are not replayed yet. Conflicts are stored to path.conflicts.
+// Access tokens of operations are encrypted by the key.
+func Open(ctx context.Context, path string, key []byte) (*Queue, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("Open offline queue (%v): key is required", path)
+	}
+	// the key file may contain any secret, AES-256 key is derived from it
+	k := sha256.Sum256(key)
+	block, err := aes.NewCipher(k[:])
+	if err != nil {
+		return nil, errors.Wrapf(err, "Open offline queue (%v)", path)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Open offline queue (%v)", path)
+	}
+
+	f, err := openLineFile(ctx, path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Open offline queue (%v)", path)
+	}
+	q := &Queue{file: f, aead: aead, now: time.Now}
+	if err = q.load(); err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "Open offline queue (%v)", path)
+	}
+	if q.conflicts, err = openLineFile(ctx, path+".conflicts"); err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "Open offline queue (%v)", path)
+	}
+	// only the size is needed to append conflicts
+	if err = q.conflicts.scan(func(line int, b []byte) error { return nil }); err != nil {
+		f.Close()
+		q.conflicts.Close()
+		return nil, errors.Wrapf(err, "Open offline queue (%v)", path)
+	}
+	return q, nil
+}
+
+func (q *Queue) load() error {
+	return q.file.scan(func(line int, b []byte) error {
+		var r record
+		if err := json.Unmarshal(b, &r); err != nil {
+			return errors.Wrapf(err, "line %d: unmarshal", line)
+		}
+		switch {
+		case r.Operation != nil:
+			op := *r.Operation
+			var err error
+			if op.Owner, err = q.open(op.Owner); err != nil {
+				return errors.Wrapf(err, "line %d: decrypt owner", line)
+			}
+			if op.Auth, err = q.open(op.Auth); err != nil {
+				return errors.Wrapf(err, "line %d: decrypt auth", line)
+			}
+			q.pending = append(q.pending, op)
+			q.seq = op.Seq
+		case r.Result != nil:
+			if len(q.pending) == 0 || q.pending[0].Seq != r.Result.Seq {
+				return fmt.Errorf("line %d: result of unexpected operation %d", line, r.Result.Seq)
+			}
+			q.pending = q.pending[1:]
+		}
+		return nil
+	})
+}
+
+// seal encrypts the token, nonce is prepended to the ciphertext
+func (q *Queue) seal(token string) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+	nonce := make([]byte, q.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.Wrap(err, "Offline queue: nonce")
+	}
+	return base64.StdEncoding.EncodeToString(q.aead.Seal(nonce, nonce, []byte(token), nil)), nil
+}
+
+func (q *Queue) open(sealed string) (string, error) {
+	if sealed == "" {
+		return "", nil
+	}
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(b) < q.aead.NonceSize() {
+		return "", fmt.Errorf("ciphertext is too short")
+	}
+	token, err := q.aead.Open(nil, b[:q.aead.NonceSize()], b[q.aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(token), nil
+}
+
+// Push stores the operation at the end of the queue
+func (q *Queue) Push(op Operation) (Operation, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	op.Seq = q.seq + 1
+	op.Time = q.now().UTC().Format(time.RFC3339Nano)
+	stored := op
+	var err error
+	if stored.Owner, err = q.seal(op.Owner); err != nil {
+		return op, err
+	}
+	if stored.Auth, err = q.seal(op.Auth); err != nil {
+		return op, err
+	}
+	if err = q.file.write(record{Operation: &stored}); err != nil {
+		return op, err
+	}
+	q.seq = op.Seq
+	q.pending = append(q.pending, op)
+	return op, nil
+}
+
+// Peek returns the first operation of the queue
+func (q *Queue) Peek() (Operation, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	if len(q.pending) == 0 {
+		return Operation{}, false
+	}
+	return q.pending[0], true
+}
+
+// Done removes the first operation from the queue. Results which aren't applied are stored to conflicts before
+// the operation is removed.
+func (q *Queue) Done(r Result) error {
+	q.Lock()
+	defer q.Unlock()
+
+	if len(q.pending) == 0 || q.pending[0].Seq != r.Seq {
+		return fmt.Errorf("Offline queue: operation %d is not the first", r.Seq)
+	}
+	r.Time = q.now().UTC().Format(time.RFC3339Nano)
+	if r.Outcome != OutcomeApplied {
+		if err := q.conflicts.write(r); err != nil {
+			return err
+		}
+	}
+	if err := q.file.write(record{Result: &r}); err != nil {
+		return err
+	}
+	q.pending = q.pending[1:]
+	if len(q.pending) == 0 {
+		// all operations are replayed, conflicts are kept in the separate file
+		if err := q.file.truncate(0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Conflicts returns up to n last results which aren't applied
+func (q *Queue) Conflicts(n int) ([]Result, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	var conflicts []Result
+	err := q.conflicts.scan(func(line int, b []byte) error {
+		var r Result
+		if err := json.Unmarshal(b, &r); err != nil {
+			return errors.Wrapf(err, "line %d: unmarshal", line)
+		}
+		conflicts = append(conflicts, r)
+		if len(conflicts) > n {
+			conflicts = conflicts[1:]
+		}
+		return nil
+	})
+	return conflicts, errors.Wrap(err, "Offline queue: conflicts")
+}
+
+// Len returns count of operations which are not replayed yet
+func (q *Queue) Len() int {
+	q.Lock()
+	defer q.Unlock()
+
+	return len(q.pending)
+}
+
+func (q *Queue) Close() error {
+	q.Lock()
+	defer q.Unlock()
+
+	err := q.file.Close()
+	if cerr := q.conflicts.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// lineFile is a locked file of JSON lines. A failed write is truncated, so the file ends with the last
+// complete line.
+type lineFile struct {
+	*os.File
+	size int64
+}
+
+func openLineFile(ctx context.Context, path string) (*lineFile, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	// the previous process writes the file until it exits after hand off of listening sockets
+	if err = coreapi.LockFile(ctx, f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &lineFile{File: f}, nil
+}
+
+// scan calls f for every line from the start of the file. The last line without line feed is a torn write
+// of the crashed process, it's dropped from the file.
+func (f *lineFile) scan(fn func(line int, b []byte) error) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "seek")
+	}
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	s.Split(scanLines)
+	f.size = 0
+	for line := 1; s.Scan(); line++ {
+		b := s.Bytes()
+		if b[len(b)-1] != '\n' {
+			return f.truncate(f.size)
+		}
+		if err := fn(line, b); err != nil {
+			return err
+		}
+		f.size += int64(len(b))
+	}
+	return errors.Wrap(s.Err(), "read")
+}
+
+// scanLines splits the file into lines keeping the line feed, so the torn last line is recognized
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i+1], nil
+	}
+	if atEOF && len(data) != 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func (f *lineFile) write(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "Offline queue: marshal")
+	}
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		return f.rollback(errors.Wrap(err, "Offline queue: write"))
+	}
+	if err = f.Sync(); err != nil {
+		return f.rollback(errors.Wrap(err, "Offline queue: sync"))
+	}
+	f.size += int64(len(b)) + 1
+	return nil
+}
+
+// rollback truncates the partially written line
+func (f *lineFile) rollback(err error) error {
+	if terr := f.File.Truncate(f.size); terr != nil {
+		return errors.Wrapf(err, "Offline queue: truncate (%v)", terr)
+	}
+	return err
+}
+
+func (f *lineFile) truncate(size int64) error {
+	if err := f.File.Truncate(size); err != nil {
+		return errors.Wrap(err, "Offline queue: truncate")
+	}
+	f.size = size
+	return nil
+}
+
+func (f *lineFile) Close() error {
+	if err := f.Sync(); err != nil {
+		f.File.Close()
+		return errors.Wrap(err, "Offline queue: sync")
+	}
+	return f.File.Close()
+}
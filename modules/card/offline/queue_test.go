@@ -0,0 +1,204 @@
+package offline
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testKey = []byte("queue key")
+
+func openQueue(t *testing.T) (*Queue, string) {
+	dir, err := ioutil.TempDir("", "offline")
+	assert.Nil(t, err)
+	path := filepath.Join(dir, "queue.log")
+
+	q, err := Open(context.Background(), path, testKey)
+	assert.Nil(t, err)
+	return q, path
+}
+
+func TestPush_AssignSeq(t *testing.T) {
+	q, path := openQueue(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer q.Close()
+
+	first, err := q.Push(Operation{Type: OperationCreateCard, RequestID: "1"})
+	assert.Nil(t, err)
+	second, err := q.Push(Operation{Type: OperationRevokeCard, RequestID: "2"})
+	assert.Nil(t, err)
+
+	assert.Equal(t, uint64(1), first.Seq)
+	assert.Equal(t, uint64(2), second.Seq)
+	assert.NotEmpty(t, first.Time)
+	assert.Equal(t, 2, q.Len())
+	op, ok := q.Peek()
+	assert.True(t, ok)
+	assert.Equal(t, "1", op.RequestID)
+}
+
+func TestDone_RemoveFirstOperation(t *testing.T) {
+	q, path := openQueue(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer q.Close()
+	q.Push(Operation{Type: OperationCreateCard, RequestID: "1"})
+	q.Push(Operation{Type: OperationRevokeCard, RequestID: "2"})
+
+	err := q.Done(Result{Seq: 1, Outcome: OutcomeApplied})
+
+	assert.Nil(t, err)
+	op, ok := q.Peek()
+	assert.True(t, ok)
+	assert.Equal(t, "2", op.RequestID)
+}
+
+func TestDone_NotFirstOperation_ReturnErr(t *testing.T) {
+	q, path := openQueue(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer q.Close()
+	q.Push(Operation{Type: OperationCreateCard})
+	q.Push(Operation{Type: OperationRevokeCard})
+
+	err := q.Done(Result{Seq: 2, Outcome: OutcomeApplied})
+
+	assert.Error(t, err)
+	assert.Equal(t, 2, q.Len())
+}
+
+func TestDone_LastOperation_TruncateFile(t *testing.T) {
+	q, path := openQueue(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer q.Close()
+	q.Push(Operation{Type: OperationCreateCard})
+
+	err := q.Done(Result{Seq: 1, Outcome: OutcomeConflict})
+
+	assert.Nil(t, err)
+	_, ok := q.Peek()
+	assert.False(t, ok)
+	fi, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), fi.Size())
+}
+
+func TestOpen_Existing_LoadPendingOperations(t *testing.T) {
+	q, path := openQueue(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	q.Push(Operation{Type: OperationCreateCard, RequestID: "1"})
+	q.Push(Operation{Type: OperationRevokeCard, RequestID: "2"})
+	q.Done(Result{Seq: 1, Outcome: OutcomeApplied})
+	q.Close()
+
+	q, err := Open(context.Background(), path, testKey)
+
+	assert.Nil(t, err)
+	defer q.Close()
+	assert.Equal(t, 1, q.Len())
+	op, _ := q.Peek()
+	assert.Equal(t, "2", op.RequestID)
+	op, err = q.Push(Operation{Type: OperationCreateCard})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), op.Seq)
+}
+
+func TestPush_Tokens_EncryptedOnDisk(t *testing.T) {
+	q, path := openQueue(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	q.Push(Operation{Type: OperationCreateCard, Owner: "owner-token", Auth: "VIRGIL owner-token"})
+	q.Close()
+
+	b, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(b), "owner-token")
+
+	q, err = Open(context.Background(), path, testKey)
+	assert.Nil(t, err)
+	defer q.Close()
+	op, _ := q.Peek()
+	assert.Equal(t, "owner-token", op.Owner)
+	assert.Equal(t, "VIRGIL owner-token", op.Auth)
+}
+
+func TestOpen_WrongKey_ReturnErr(t *testing.T) {
+	q, path := openQueue(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	q.Push(Operation{Type: OperationCreateCard, Owner: "owner-token"})
+	q.Close()
+
+	_, err := Open(context.Background(), path, []byte("other key"))
+
+	assert.Error(t, err)
+}
+
+func TestOpen_NoKey_ReturnErr(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "offline")
+	defer os.RemoveAll(dir)
+
+	_, err := Open(context.Background(), filepath.Join(dir, "queue.log"), nil)
+
+	assert.Error(t, err)
+}
+
+func TestOpen_TornLastLine_DropLine(t *testing.T) {
+	q, path := openQueue(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	q.Push(Operation{Type: OperationCreateCard, RequestID: "1"})
+	q.Close()
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString(`{"operation":{"seq":2,"ty`)
+	f.Close()
+
+	q, err := Open(context.Background(), path, testKey)
+
+	assert.Nil(t, err)
+	defer q.Close()
+	assert.Equal(t, 1, q.Len())
+	op, err := q.Push(Operation{Type: OperationRevokeCard, RequestID: "2"})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), op.Seq)
+	q.Close()
+	q, err = Open(context.Background(), path, testKey)
+	assert.Nil(t, err)
+	defer q.Close()
+	assert.Equal(t, 2, q.Len())
+}
+
+func TestDone_Conflict_KeepAfterTruncate(t *testing.T) {
+	q, path := openQueue(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	q.Push(Operation{Type: OperationCreateCard, RequestID: "1"})
+	q.Push(Operation{Type: OperationRevokeCard, RequestID: "2"})
+	q.Done(Result{Seq: 1, RequestID: "1", Outcome: OutcomeConflict})
+	q.Done(Result{Seq: 2, RequestID: "2", Outcome: OutcomeApplied})
+	q.Close()
+
+	q, err := Open(context.Background(), path, testKey)
+	assert.Nil(t, err)
+	defer q.Close()
+	conflicts, err := q.Conflicts(20)
+
+	assert.Nil(t, err)
+	assert.Len(t, conflicts, 1)
+	assert.Equal(t, "1", conflicts[0].RequestID)
+	assert.Equal(t, OutcomeConflict, conflicts[0].Outcome)
+}
+
+func TestConflicts_MoreThanN_ReturnLast(t *testing.T) {
+	q, path := openQueue(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer q.Close()
+	for i := 1; i <= 3; i++ {
+		op, _ := q.Push(Operation{Type: OperationCreateCard})
+		q.Done(Result{Seq: op.Seq, Outcome: OutcomeUnknown})
+	}
+
+	conflicts, err := q.Conflicts(2)
+
+	assert.Nil(t, err)
+	assert.Len(t, conflicts, 2)
+	assert.Equal(t, uint64(3), conflicts[1].Seq)
+}
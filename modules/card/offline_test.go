@@ -0,0 +1,286 @@
+package card
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/VirgilSecurity/virgild/modules/card/core"
+	"github.com/VirgilSecurity/virgild/modules/card/offline"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/virgil.v4"
+)
+
+type fakeReplica struct {
+	owner string
+	cards map[string]*virgil.CardResponse
+}
+
+func (f *fakeReplica) Get(owner, id string) (*virgil.CardResponse, bool) {
+	f.owner = owner
+	c, ok := f.cards[id]
+	return c, ok
+}
+
+func (f *fakeReplica) Search(owner string, crit *virgil.Criteria) []virgil.CardResponse {
+	f.owner = owner
+	var cards []virgil.CardResponse
+	for _, c := range f.cards {
+		cards = append(cards, *c)
+	}
+	return cards
+}
+
+type fakeQueue struct {
+	ops     []offline.Operation
+	results []offline.Result
+}
+
+func (f *fakeQueue) Push(op offline.Operation) (offline.Operation, error) {
+	op.Seq = uint64(len(f.ops) + len(f.results) + 1)
+	f.ops = append(f.ops, op)
+	return op, nil
+}
+
+func (f *fakeQueue) Peek() (offline.Operation, bool) {
+	if len(f.ops) == 0 {
+		return offline.Operation{}, false
+	}
+	return f.ops[0], true
+}
+
+func (f *fakeQueue) Done(r offline.Result) error {
+	f.ops = f.ops[1:]
+	f.results = append(f.results, r)
+	return nil
+}
+
+func (f *fakeQueue) Len() int {
+	return len(f.ops)
+}
+
+type nopTestLogger struct{}
+
+func (nopTestLogger) Debug(format string, args ...interface{}) {}
+func (nopTestLogger) Info(format string, args ...interface{})  {}
+func (nopTestLogger) Warn(format string, args ...interface{})  {}
+func (nopTestLogger) Err(format string, args ...interface{})   {}
+
+var unreachableErr = errors.Wrap(&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "Cloud.do")
+
+func TestIsOffline(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	table := map[string]struct {
+		ctx      context.Context
+		err      error
+		expected bool
+	}{
+		"nil":         {context.Background(), nil, false},
+		"network":     {context.Background(), unreachableErr, true},
+		"unavailable": {context.Background(), errors.Wrap(coreapi.UpstreamUnavailableErr, "upstream"), true},
+		"not found":   {context.Background(), coreapi.EntityNotFoundErr, false},
+		"canceled":    {canceled, unreachableErr, false},
+	}
+	for name, v := range table {
+		assert.Equal(t, v.expected, isOffline(v.ctx, v.err), name)
+	}
+}
+
+func TestOfflineGetCard_Unreachable_ReturnCardFromReplica(t *testing.T) {
+	card := &virgil.CardResponse{ID: "card-1"}
+	r := &fakeReplica{cards: map[string]*virgil.CardResponse{"card-1": card}}
+	m := &offlineCardMiddleware{replica: r, now: time.Now}
+	ctx := core.SetOwnerRequest(context.Background(), "token")
+
+	c, err := m.GetCard(func(ctx context.Context, id string) (*virgil.CardResponse, error) {
+		return nil, unreachableErr
+	})(ctx, "card-1")
+
+	assert.Nil(t, err)
+	assert.Equal(t, card, c)
+	assert.Equal(t, coreapi.HashToken("token"), r.owner)
+}
+
+func TestOfflineGetCard_NotInReplica_ReturnErr(t *testing.T) {
+	m := &offlineCardMiddleware{replica: &fakeReplica{}, now: time.Now}
+
+	_, err := m.GetCard(func(ctx context.Context, id string) (*virgil.CardResponse, error) {
+		return nil, unreachableErr
+	})(context.Background(), "card-1")
+
+	assert.Equal(t, unreachableErr, err)
+}
+
+func TestOfflineGetCard_OtherErr_ReturnErr(t *testing.T) {
+	card := &virgil.CardResponse{ID: "card-1"}
+	m := &offlineCardMiddleware{replica: &fakeReplica{cards: map[string]*virgil.CardResponse{"card-1": card}}, now: time.Now}
+
+	_, err := m.GetCard(func(ctx context.Context, id string) (*virgil.CardResponse, error) {
+		return nil, coreapi.EntityNotFoundErr
+	})(context.Background(), "card-1")
+
+	assert.Equal(t, coreapi.EntityNotFoundErr, err)
+}
+
+func TestOfflineSearchCards_Unreachable_ReturnCardsFromReplica(t *testing.T) {
+	card := &virgil.CardResponse{ID: "card-1"}
+	m := &offlineCardMiddleware{replica: &fakeReplica{cards: map[string]*virgil.CardResponse{"card-1": card}}, now: time.Now}
+
+	cards, err := m.SearchCards(func(ctx context.Context, crit *virgil.Criteria) ([]virgil.CardResponse, error) {
+		return nil, coreapi.UpstreamUnavailableErr
+	})(context.Background(), &virgil.Criteria{Identities: []string{"alice"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []virgil.CardResponse{*card}, cards)
+}
+
+func TestOfflineCreateCard_Unreachable_Queue(t *testing.T) {
+	q := new(fakeQueue)
+	m := &offlineCardMiddleware{queue: q, now: time.Now}
+	req := &core.CreateCardRequest{}
+	ctx := core.SetOwnerRequest(coreapi.SetRequestID(context.Background(), "req-1"), "token")
+
+	_, err := m.CreateCard(func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
+		return nil, unreachableErr
+	})(ctx, req)
+
+	assert.Equal(t, coreapi.RequestQueuedErr, err)
+	assert.Len(t, q.ops, 1)
+	assert.Equal(t, offline.OperationCreateCard, q.ops[0].Type)
+	assert.Equal(t, "req-1", q.ops[0].RequestID)
+	assert.Equal(t, "token", q.ops[0].Owner)
+	assert.Equal(t, req, q.ops[0].Create)
+}
+
+func TestOfflineRevokeCard_QueueNotEmpty_QueueWithoutUpstream(t *testing.T) {
+	q := &fakeQueue{ops: []offline.Operation{{Seq: 1, Type: offline.OperationCreateCard}}}
+	m := &offlineCardMiddleware{queue: q, now: time.Now}
+
+	err := m.RevokeCard(func(ctx context.Context, req *core.RevokeCardRequest) error {
+		t.Fatal("upstream is called")
+		return nil
+	})(context.Background(), &core.RevokeCardRequest{})
+
+	assert.Equal(t, coreapi.RequestQueuedErr, err)
+	assert.Len(t, q.ops, 2)
+}
+
+func TestOfflineCreateCard_MayReachUpstream_ReturnErr(t *testing.T) {
+	q := new(fakeQueue)
+	m := &offlineCardMiddleware{queue: q, now: time.Now}
+
+	_, err := m.CreateCard(func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
+		return nil, coreapi.APIError{Code: 20000, StatusCode: http.StatusGatewayTimeout}
+	})(context.Background(), &core.CreateCardRequest{})
+
+	assert.Equal(t, coreapi.APIError{Code: 20000, StatusCode: http.StatusGatewayTimeout}, err)
+	assert.Empty(t, q.ops)
+}
+
+func TestUnsent(t *testing.T) {
+	table := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"dial":        {unreachableErr, true},
+		"unavailable": {errors.Wrap(coreapi.UpstreamUnavailableErr, "upstream"), true},
+		"read":        {errors.Wrap(&net.OpError{Op: "read", Err: errors.New("connection reset")}, "Cloud.do"), false},
+		"bad gateway": {coreapi.APIError{StatusCode: http.StatusBadGateway}, false},
+		"timeout":     {coreapi.GatewayTimeoutErr, false},
+	}
+	for name, v := range table {
+		assert.Equal(t, v.expected, unsent(context.Background(), v.err), name)
+	}
+}
+
+func TestOfflineCreateCard_NoQueue_ReturnErr(t *testing.T) {
+	m := &offlineCardMiddleware{now: time.Now}
+
+	_, err := m.CreateCard(func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
+		return nil, unreachableErr
+	})(context.Background(), &core.CreateCardRequest{})
+
+	assert.Equal(t, unreachableErr, err)
+}
+
+func TestOfflineReplay_AppliedAndConflict_EmptyQueue(t *testing.T) {
+	q := &fakeQueue{ops: []offline.Operation{
+		{Seq: 1, Type: offline.OperationCreateCard, RequestID: "req-1", Owner: "token", Create: &core.CreateCardRequest{}},
+		{Seq: 2, Type: offline.OperationRevokeCard, RequestID: "req-2", Revoke: &core.RevokeCardRequest{Info: virgil.RevokeCardRequest{ID: "card-2"}}},
+	}}
+	m := &offlineCardMiddleware{queue: q, now: time.Now}
+	m.createCard = m.CreateCard(func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
+		assert.Equal(t, "req-1", coreapi.GetRequestID(ctx))
+		assert.Equal(t, "token", core.GetOwnerRequest(ctx))
+		return &virgil.CardResponse{ID: "card-1"}, nil
+	})
+	var urlID string
+	m.revokeCard = m.RevokeCard(func(ctx context.Context, req *core.RevokeCardRequest) error {
+		urlID = core.GetURLCardID(ctx)
+		return coreapi.EntityNotFoundErr
+	})
+
+	m.replay(context.Background(), nopTestLogger{})
+
+	assert.Equal(t, "card-2", urlID)
+	assert.Empty(t, q.ops)
+	assert.Equal(t, []offline.Result{
+		{Seq: 1, Type: offline.OperationCreateCard, RequestID: "req-1", CardID: "card-1", Outcome: offline.OutcomeApplied},
+		{Seq: 2, Type: offline.OperationRevokeCard, RequestID: "req-2", CardID: "card-2", Outcome: offline.OutcomeConflict,
+			ErrorCode: coreapi.EntityNotFoundErr.Code, Error: coreapi.EntityNotFoundErr.Error()},
+	}, q.results)
+	info, _ := m.check(context.Background())
+	assert.Len(t, info.(map[string]interface{})["conflicts"], 1)
+}
+
+func TestOfflineReplay_MayReachUpstream_ReportUnknown(t *testing.T) {
+	q := &fakeQueue{ops: []offline.Operation{{Seq: 1, Type: offline.OperationCreateCard, Create: &core.CreateCardRequest{}}}}
+	m := &offlineCardMiddleware{queue: q, now: time.Now}
+	m.createCard = m.CreateCard(func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
+		return nil, coreapi.GatewayTimeoutErr
+	})
+
+	m.replay(context.Background(), nopTestLogger{})
+
+	assert.Empty(t, q.ops)
+	assert.Len(t, q.results, 1)
+	assert.Equal(t, offline.OutcomeUnknown, q.results[0].Outcome)
+}
+
+func TestOfflineHealthCheck_OfflineMode_ReturnDegraded(t *testing.T) {
+	defer func(e bool, f string) { offlineEnabled, replicationFile = e, f }(offlineEnabled, replicationFile)
+	offlineEnabled, replicationFile = true, "replica.log"
+
+	_, err := offlineHealthCheck(func(ctx context.Context) (interface{}, error) {
+		return nil, coreapi.UpstreamUnavailableErr
+	})(context.Background())
+
+	assert.Equal(t, coreapi.Degraded(coreapi.UpstreamUnavailableErr), err)
+}
+
+func TestOfflineHealthCheck_Disabled_ReturnErr(t *testing.T) {
+	_, err := offlineHealthCheck(func(ctx context.Context) (interface{}, error) {
+		return nil, coreapi.UpstreamUnavailableErr
+	})(context.Background())
+
+	assert.Equal(t, coreapi.UpstreamUnavailableErr, err)
+}
+
+func TestOfflineReplay_Unreachable_KeepQueue(t *testing.T) {
+	q := &fakeQueue{ops: []offline.Operation{{Seq: 1, Type: offline.OperationCreateCard, Create: &core.CreateCardRequest{}}}}
+	m := &offlineCardMiddleware{queue: q, now: time.Now}
+	m.createCard = m.CreateCard(func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
+		return nil, unreachableErr
+	})
+
+	m.replay(context.Background(), nopTestLogger{})
+
+	assert.Len(t, q.ops, 1)
+	assert.Empty(t, q.results)
+}
@@ -0,0 +1,117 @@
+package card
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/VirgilSecurity/virgild/modules/card/core"
+	vgrpc "github.com/VirgilSecurity/virgild/modules/card/grpc"
+	vhttp "github.com/VirgilSecurity/virgild/modules/card/http"
+	"github.com/VirgilSecurity/virgild/modules/card/middleware"
+	virgil "gopkg.in/virgil.v4"
+)
+
+// cardChains are complete chains of card operations
+type cardChains struct {
+	getCard        core.GetCardHandler
+	searchCards    core.SearchCardsHandler
+	createCard     core.CreateCardHandler
+	revokeCard     core.RevokeCardHandler
+	createRelation core.CreateRelationHandler
+	revokeRelation core.RevokeRelationHandler
+}
+
+// operations exposes the chains on HTTP and gRPC APIs. Owner of the request is set for every operation.
+func operations(c cardChains) []coreapi.Operation {
+	return []coreapi.Operation{
+		{
+			Name:    "create_card",
+			Handler: middleware.RequestOwner(createCardOperation(c.createCard)),
+			HTTP: []coreapi.HTTPBinding{
+				{Method: http.MethodPost, Path: "/v1/card", Decode: vhttp.DecodeCreateCard},
+				{Method: http.MethodPost, Path: "/v4/card", Decode: vhttp.DecodeCreateCard},
+			},
+			GRPC: vgrpc.CreateCard,
+		},
+		{
+			Name:    "revoke_card",
+			Handler: middleware.RequestOwner(revokeCardOperation(c.revokeCard)),
+			HTTP: []coreapi.HTTPBinding{
+				{Method: http.MethodDelete, Path: "/v1/card/:id", Decode: vhttp.DecodeRevokeCard, Encode: vhttp.EncodeRevokeCard},
+				{Method: http.MethodDelete, Path: "/v4/card/:id", Decode: vhttp.DecodeRevokeCard, Encode: vhttp.EncodeRevokeCard},
+			},
+			GRPC: vgrpc.RevokeCard,
+		},
+		{
+			Name:    "search",
+			Handler: middleware.RequestOwner(searchCardsOperation(middleware.SetApplicationScopForSearch(c.searchCards))),
+			HTTP: []coreapi.HTTPBinding{
+				{Method: http.MethodPost, Path: "/v4/card/actions/search", Decode: vhttp.DecodeSearchCards},
+			},
+			GRPC: vgrpc.SearchCards,
+		},
+		{
+			Name:    "get_card",
+			Handler: middleware.RequestOwner(getCardOperation(c.getCard)),
+			HTTP: []coreapi.HTTPBinding{
+				{Method: http.MethodGet, Path: "/v4/card/:id", Decode: vhttp.DecodeGetCard},
+			},
+			GRPC: vgrpc.GetCard,
+		},
+		{
+			Name:    "create_relation",
+			Handler: middleware.RequestOwner(createRelationOperation(c.createRelation)),
+			HTTP: []coreapi.HTTPBinding{
+				{Method: http.MethodPost, Path: "/v4/card/:id/collections/relations", Decode: vhttp.DecodeCreateRelation},
+			},
+			GRPC: vgrpc.CreateRelation,
+		},
+		{
+			Name:    "revoke_relation",
+			Handler: middleware.RequestOwner(revokeRelationOperation(c.revokeRelation)),
+			HTTP: []coreapi.HTTPBinding{
+				{Method: http.MethodDelete, Path: "/v4/card/:id/collections/relations", Decode: vhttp.DecodeRevokeRelation},
+			},
+			GRPC: vgrpc.RevokeRelation,
+		},
+	}
+}
+
+func getCardOperation(f core.GetCardHandler) coreapi.OperationHandler {
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		return f(ctx, req.(string))
+	}
+}
+
+func searchCardsOperation(f core.SearchCardsHandler) coreapi.OperationHandler {
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		return f(ctx, req.(*virgil.Criteria))
+	}
+}
+
+func createCardOperation(f core.CreateCardHandler) coreapi.OperationHandler {
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		return f(ctx, req.(*core.CreateCardRequest))
+	}
+}
+
+// revokeCardOperation puts id of the revoked card to the context, validator checks it against the snapshot
+func revokeCardOperation(f core.RevokeCardHandler) coreapi.OperationHandler {
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		r := req.(*core.RevokeCardRequest)
+		return nil, f(core.SetURLCardID(ctx, r.ID), r)
+	}
+}
+
+func createRelationOperation(f core.CreateRelationHandler) coreapi.OperationHandler {
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		return f(ctx, req.(*core.CreateRelationRequest))
+	}
+}
+
+func revokeRelationOperation(f core.RevokeRelationHandler) coreapi.OperationHandler {
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		return f(ctx, req.(*core.RevokeRelationRequest))
+	}
+}
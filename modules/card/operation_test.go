@@ -0,0 +1,60 @@
+package card
+
+import (
+	"context"
+	"testing"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/VirgilSecurity/virgild/modules/card/core"
+	"github.com/stretchr/testify/assert"
+	virgil "gopkg.in/virgil.v4"
+)
+
+func findOperation(ops []coreapi.Operation, name string) coreapi.Operation {
+	for _, op := range ops {
+		if op.Name == name {
+			return op
+		}
+	}
+	return coreapi.Operation{}
+}
+
+func TestOperations_RevokeCard_SetURLCardIDAndOwner(t *testing.T) {
+	var id, owner string
+	ops := operations(cardChains{revokeCard: func(ctx context.Context, req *core.RevokeCardRequest) error {
+		id, owner = core.GetURLCardID(ctx), core.GetOwnerRequest(ctx)
+		return nil
+	}})
+	ctx := coreapi.SetAuthorization(context.Background(), "VIRGIL token")
+
+	resp, err := findOperation(ops, "revoke_card").Handler(ctx, &core.RevokeCardRequest{ID: "card-1"})
+
+	assert.Nil(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, "card-1", id)
+	assert.Equal(t, "token", owner)
+}
+
+func TestOperations_UnsupportedAuthorization_ReturnErr(t *testing.T) {
+	ops := operations(cardChains{getCard: func(ctx context.Context, id string) (*virgil.CardResponse, error) {
+		t.Fatal("handler is called")
+		return nil, nil
+	}})
+	ctx := coreapi.SetAuthorization(context.Background(), "Bearer token")
+
+	_, err := findOperation(ops, "get_card").Handler(ctx, "card-1")
+
+	assert.Equal(t, core.UnsupportedAuthTypeErr, err)
+}
+
+func TestOperations_Search_SetApplicationScope(t *testing.T) {
+	var scope virgil.Enum
+	ops := operations(cardChains{searchCards: func(ctx context.Context, crit *virgil.Criteria) ([]virgil.CardResponse, error) {
+		scope = crit.Scope
+		return nil, nil
+	}})
+
+	findOperation(ops, "search").Handler(context.Background(), &virgil.Criteria{Identities: []string{"alice"}})
+
+	assert.Equal(t, virgil.CardScope.Application, scope)
+}
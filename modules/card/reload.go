@@ -0,0 +1,157 @@
+package card
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/VirgilSecurity/virgild/modules/card/core"
+	virgil "gopkg.in/virgil.v4"
+)
+
+// reloadableCloud passes calls to the current cloud client of the tenant of the request. Clients are replaced
+// on reload of configuration, calls in flight finish with the previous ones.
+type reloadableCloud struct {
+	v atomic.Value
+
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+// clouds are the default client and clients of tenants with own upstreams
+type clouds struct {
+	def     *cloudCard
+	tenants map[string]*cloudCard
+}
+
+func (c clouds) all() []*cloudCard {
+	all := []*cloudCard{c.def}
+	for _, t := range c.tenants {
+		all = append(all, t)
+	}
+	return all
+}
+
+func newReloadableCloud(def *cloudCard, tenants map[string]*cloudCard) *reloadableCloud {
+	r := new(reloadableCloud)
+	r.set(def, tenants)
+	return r
+}
+
+// current returns client of the tenant of the request
+func (r *reloadableCloud) current(ctx context.Context) *cloudCard {
+	c := r.v.Load().(clouds)
+	if t := coreapi.GetTenant(ctx); t != nil {
+		if tc, ok := c.tenants[t.Name]; ok {
+			return tc
+		}
+	}
+	return c.def
+}
+
+// set replaces clients and restarts health checks of upstreams
+func (r *reloadableCloud) set(def *cloudCard, tenants map[string]*cloudCard) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next := clouds{def: def, tenants: tenants}
+	if r.stop != nil {
+		close(r.stop)
+		prev := r.v.Load().(clouds)
+		removeBreakerMetrics(prev.all(), next.all())
+		for _, c := range prev.all() {
+			if hc, ok := c.Client.(*http.Client); ok {
+				hc.CloseIdleConnections()
+			}
+		}
+	}
+	r.v.Store(next)
+	r.stop = make(chan struct{})
+	for _, c := range next.all() {
+		if c.HealthCheckPath != "" {
+			go c.Cards.healthCheck(c.Client, c.HealthCheckPath, c.HealthCheckInterval, r.stop)
+			go c.RA.healthCheck(c.Client, c.HealthCheckPath, c.HealthCheckInterval, r.stop)
+		}
+	}
+}
+
+// removeBreakerMetrics deletes state of circuit breakers of endpoints which are removed from all pools
+func removeBreakerMetrics(prev, next []*cloudCard) {
+	type key struct{ pool, url string }
+	keys := func(cs []*cloudCard) map[key]bool {
+		m := make(map[key]bool)
+		for _, c := range cs {
+			for _, p := range []*upstreamPool{c.Cards, c.RA} {
+				for _, e := range p.Endpoints {
+					m[key{p.Name, e.URL}] = true
+				}
+			}
+		}
+		return m
+	}
+	used := keys(next)
+	for k := range keys(prev) {
+		if !used[k] {
+			breakerStateMetric.DeleteLabelValues(k.pool, k.url)
+		}
+	}
+}
+
+func (r *reloadableCloud) getCard(ctx context.Context, id string) (*virgil.CardResponse, error) {
+	return r.current(ctx).getCard(ctx, id)
+}
+
+func (r *reloadableCloud) searchCards(ctx context.Context, crit *virgil.Criteria) ([]virgil.CardResponse, error) {
+	return r.current(ctx).searchCards(ctx, crit)
+}
+
+func (r *reloadableCloud) createCard(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
+	return r.current(ctx).createCard(ctx, req)
+}
+
+func (r *reloadableCloud) revokeCard(ctx context.Context, req *core.RevokeCardRequest) error {
+	return r.current(ctx).revokeCard(ctx, req)
+}
+
+func (r *reloadableCloud) createRelation(ctx context.Context, req *core.CreateRelationRequest) (*virgil.CardResponse, error) {
+	return r.current(ctx).createRelation(ctx, req)
+}
+
+func (r *reloadableCloud) revokeRelation(ctx context.Context, req *core.RevokeRelationRequest) (*virgil.CardResponse, error) {
+	return r.current(ctx).revokeRelation(ctx, req)
+}
+
+// healthCheck reports state of the upstream pool of the default client or of the tenant
+func (r *reloadableCloud) healthCheck(tenant string, pool func(c *cloudCard) *upstreamPool) coreapi.HealthCheck {
+	return func(ctx context.Context) (interface{}, error) {
+		c := r.v.Load().(clouds)
+		cloud := c.def
+		if tenant != "" {
+			if cloud = c.tenants[tenant]; cloud == nil {
+				// the check is being removed with the tenant
+				return nil, nil
+			}
+		}
+		return pool(cloud).healthCheckStatus(ctx)
+	}
+}
+
+// registerTenantHealthChecks registers readiness checks of upstreams of tenants with own upstreams
+// and removes checks of tenants which don't have them after reload
+func registerTenantHealthChecks(r *reloadableCloud, prev, next map[string]*cloudCard) {
+	for name := range prev {
+		if _, ok := next[name]; !ok {
+			coreapi.UnregisterHealthCheck("upstream_cards_" + name)
+			coreapi.UnregisterHealthCheck("upstream_ra_" + name)
+		}
+	}
+	for name := range next {
+		coreapi.RegisterHealthCheck("upstream_cards_"+name, offlineHealthCheck(r.healthCheck(name, cardsPool)))
+		coreapi.RegisterHealthCheck("upstream_ra_"+name, offlineHealthCheck(r.healthCheck(name, raPool)))
+	}
+}
+
+func cardsPool(c *cloudCard) *upstreamPool { return c.Cards }
+func raPool(c *cloudCard) *upstreamPool    { return c.RA }
@@ -0,0 +1,40 @@
+package card
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestReloadableCloudGetCard_Replaced_CallNewUpstream(t *testing.T) {
+	f := new(fakeHttpClient)
+	f.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.HasPrefix(req.URL.String(), "cards-new")
+	})).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"id":"1234"}`)),
+	}, nil)
+	rc := newReloadableCloud(&cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-old"), Client: f}, nil)
+
+	rc.set(&cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-new"), Client: f}, nil)
+	card, err := rc.getCard(context.Background(), "1234")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", card.ID)
+	f.AssertExpectations(t)
+}
+
+func TestReloadableCloudHealthCheck_Replaced_ReportNewEndpoints(t *testing.T) {
+	rc := newReloadableCloud(&cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-old")}, nil)
+
+	rc.set(&cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-new")}, nil)
+	details, err := rc.healthCheck("", cardsPool)(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, "cards-new", details.([]endpointStatus)[0].URL)
+}
@@ -0,0 +1,319 @@
+// Package replica implements replication of cards between VirgilD instances.
+// The parent instance appends card events to the journal and streams them to children. Children append received
+// events to own journal with the same offsets, so they resume from the last stored offset and hold a replica of cards.
+// The replica holds only cards changed through the root instance.
+package replica
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	virgil "gopkg.in/virgil.v4"
+)
+
+const (
+	EventCreateCard = "create_card"
+	EventRevokeCard = "revoke_card"
+	// EventUpdateCard replaces the card, e.g. after change of relations
+	EventUpdateCard = "update_card"
+)
+
+var offsetMetric = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name:      "offset",
+	Subsystem: "replication",
+	Namespace: "virgild",
+	Help:      "Offset of the last card event in the replication journal",
+})
+
+func init() {
+	prometheus.MustRegister(offsetMetric)
+}
+
+type Event struct {
+	Offset uint64 `json:"offset"`
+	Time   string `json:"time"`
+	Type   string `json:"type"`
+	// Owner is hash of access token which created the card, application cards are visible to the owner only
+	Owner  string               `json:"owner,omitempty"`
+	CardID string               `json:"card_id"`
+	Card   *virgil.CardResponse `json:"card,omitempty"`
+}
+
+type entry struct {
+	card  *virgil.CardResponse
+	owner string
+	info  virgil.CardModel
+}
+
+// Replica is the journal of card events and the index of cards built from it
+type Replica struct {
+	sync.RWMutex
+	file *os.File
+	// positions are offsets of events in the file, positions[i] is the event with offset i+1
+	positions []int64
+	size      int64
+	changed   chan struct{}
+	now       func() time.Time
+
+	cards      map[string]*entry
+	byIdentity map[string]map[string]bool
+}
+
+// Open opens the journal for appending and loads cards from it
+func Open(ctx context.Context, path string) (*Replica, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Open replica (%v)", path)
+	}
+	// the previous process writes the file until it exits after hand off of listening sockets
+	if err = coreapi.LockFile(ctx, f); err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "Open replica (%v)", path)
+	}
+	r := &Replica{
+		file:       f,
+		changed:    make(chan struct{}),
+		now:        time.Now,
+		cards:      make(map[string]*entry),
+		byIdentity: make(map[string]map[string]bool),
+	}
+	if err = r.load(); err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "Open replica (%v)", path)
+	}
+	offsetMetric.Set(float64(len(r.positions)))
+	return r, nil
+}
+
+// load reads events of the journal. The last line without line feed is a torn write of the crashed process,
+// it's dropped from the file.
+func (r *Replica) load() error {
+	s := bufio.NewScanner(r.file)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	s.Split(scanEvents)
+	for s.Scan() {
+		if s.Bytes()[len(s.Bytes())-1] != '\n' {
+			if err := r.file.Truncate(r.size); err != nil {
+				return errors.Wrap(err, "truncate torn event")
+			}
+			break
+		}
+		var e Event
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return errors.Wrapf(err, "event %d: unmarshal", len(r.positions)+1)
+		}
+		if e.Offset != uint64(len(r.positions)+1) {
+			return fmt.Errorf("event %d: unexpected offset %d", len(r.positions)+1, e.Offset)
+		}
+		r.positions = append(r.positions, r.size)
+		r.size += int64(len(s.Bytes()))
+		r.apply(e)
+	}
+	return errors.Wrap(s.Err(), "read")
+}
+
+// scanEvents splits the journal into lines keeping the line feed, so the torn last line is recognized
+func scanEvents(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i+1], nil
+	}
+	if atEOF && len(data) != 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Offset returns offset of the last event
+func (r *Replica) Offset() uint64 {
+	r.RLock()
+	defer r.RUnlock()
+
+	return uint64(len(r.positions))
+}
+
+// Changed returns channel which is closed when the next event is appended
+func (r *Replica) Changed() <-chan struct{} {
+	r.RLock()
+	defer r.RUnlock()
+
+	return r.changed
+}
+
+// Append writes the event to the journal and applies it to cards. Event without offset gets the next one,
+// received events must continue the journal.
+func (r *Replica) Append(e Event) (Event, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	next := uint64(len(r.positions) + 1)
+	if e.Offset == 0 {
+		e.Offset = next
+	}
+	if e.Offset != next {
+		return e, fmt.Errorf("Replica: offset %d doesn't follow %d", e.Offset, next-1)
+	}
+	if e.Time == "" {
+		e.Time = r.now().UTC().Format(time.RFC3339Nano)
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return e, errors.Wrap(err, "Replica: marshal event")
+	}
+	if _, err = r.file.Write(append(b, '\n')); err != nil {
+		return e, r.rollback(errors.Wrap(err, "Replica: write event"))
+	}
+	if err = r.file.Sync(); err != nil {
+		return e, r.rollback(errors.Wrap(err, "Replica: sync"))
+	}
+	r.positions = append(r.positions, r.size)
+	r.size += int64(len(b)) + 1
+	r.apply(e)
+
+	close(r.changed)
+	r.changed = make(chan struct{})
+	offsetMetric.Set(float64(e.Offset))
+	return e, nil
+}
+
+// rollback truncates the partially written event, so the journal ends with the last applied event
+func (r *Replica) rollback(err error) error {
+	if terr := r.file.Truncate(r.size); terr != nil {
+		return errors.Wrapf(err, "Replica: truncate (%v)", terr)
+	}
+	return err
+}
+
+// Since returns up to limit events after the offset
+func (r *Replica) Since(offset uint64, limit int) ([]Event, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	last := uint64(len(r.positions))
+	if offset > last {
+		return nil, fmt.Errorf("Replica: offset %d is ahead of the journal (%d)", offset, last)
+	}
+	end := last
+	if limit > 0 && end-offset > uint64(limit) {
+		end = offset + uint64(limit)
+	}
+	if end == offset {
+		return nil, nil
+	}
+
+	start, stop := r.positions[offset], r.size
+	if end < last {
+		stop = r.positions[end]
+	}
+	b := make([]byte, stop-start)
+	if _, err := r.file.ReadAt(b, start); err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "Replica: read events")
+	}
+
+	events := make([]Event, 0, end-offset)
+	d := json.NewDecoder(bytes.NewReader(b))
+	for d.More() {
+		var e Event
+		if err := d.Decode(&e); err != nil {
+			return nil, errors.Wrap(err, "Replica: unmarshal event")
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// apply changes the index of cards, it is called under lock
+func (r *Replica) apply(e Event) {
+	if prev, ok := r.cards[e.CardID]; ok {
+		delete(r.byIdentity[prev.info.Identity], e.CardID)
+		if len(r.byIdentity[prev.info.Identity]) == 0 {
+			delete(r.byIdentity, prev.info.Identity)
+		}
+	}
+	if e.Type == EventRevokeCard || e.Card == nil {
+		delete(r.cards, e.CardID)
+		return
+	}
+
+	en := &entry{card: e.Card, owner: e.Owner}
+	if prev, ok := r.cards[e.CardID]; ok && e.Type == EventUpdateCard {
+		en.owner = prev.owner
+	}
+	// snapshot is validated by the parent, a broken one leaves the card out of search results
+	json.Unmarshal(e.Card.Snapshot, &en.info)
+	r.cards[e.CardID] = en
+	ids, ok := r.byIdentity[en.info.Identity]
+	if !ok {
+		ids = make(map[string]bool)
+		r.byIdentity[en.info.Identity] = ids
+	}
+	ids[e.CardID] = true
+}
+
+// Get returns the card by id. Application cards are returned to their owner only.
+func (r *Replica) Get(owner, id string) (*virgil.CardResponse, bool) {
+	r.RLock()
+	defer r.RUnlock()
+
+	e, ok := r.cards[id]
+	if !ok || (e.info.Scope != virgil.CardScope.Global && e.owner != owner) {
+		return nil, false
+	}
+	return e.card, true
+}
+
+// Search returns cards matched the criteria. Application cards are returned to their owner only.
+func (r *Replica) Search(owner string, crit *virgil.Criteria) []virgil.CardResponse {
+	r.RLock()
+	defer r.RUnlock()
+
+	scope := crit.Scope
+	if scope == "" {
+		scope = virgil.CardScope.Application
+	}
+	cards := make([]virgil.CardResponse, 0)
+	seen := make(map[string]bool)
+	for _, identity := range crit.Identities {
+		for id := range r.byIdentity[identity] {
+			e := r.cards[id]
+			if seen[id] || e.info.Scope != scope || (crit.IdentityType != "" && e.info.IdentityType != crit.IdentityType) {
+				continue
+			}
+			if scope == virgil.CardScope.Application && e.owner != owner {
+				continue
+			}
+			seen[id] = true
+			cards = append(cards, *e.card)
+		}
+	}
+	sort.Slice(cards, func(i, j int) bool { return cards[i].ID < cards[j].ID })
+	return cards
+}
+
+// Check reports offset of the journal and count of cards
+func (r *Replica) Check(ctx context.Context) (interface{}, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	return map[string]interface{}{"offset": len(r.positions), "cards": len(r.cards)}, nil
+}
+
+func (r *Replica) Close() error {
+	r.Lock()
+	defer r.Unlock()
+
+	if err := r.file.Sync(); err != nil {
+		return errors.Wrap(err, "Replica: sync")
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,204 @@
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	virgil "gopkg.in/virgil.v4"
+)
+
+func makeCard(id, identity string, scope virgil.Enum) *virgil.CardResponse {
+	snapshot, _ := json.Marshal(virgil.CardModel{Identity: identity, IdentityType: "email", Scope: scope})
+	return &virgil.CardResponse{ID: id, Snapshot: snapshot}
+}
+
+func openReplica(t *testing.T) (*Replica, string) {
+	dir, err := ioutil.TempDir("", "replica")
+	assert.Nil(t, err)
+	path := filepath.Join(dir, "replica.log")
+
+	r, err := Open(context.Background(), path)
+	assert.Nil(t, err)
+	return r, path
+}
+
+func TestAppend_AssignOffsetsAndIndexCards(t *testing.T) {
+	r, path := openReplica(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer r.Close()
+
+	e, err := r.Append(Event{Type: EventCreateCard, CardID: "1", Card: makeCard("1", "alice", virgil.CardScope.Global)})
+
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), e.Offset)
+	assert.NotEmpty(t, e.Time)
+	assert.Equal(t, uint64(1), r.Offset())
+	card, ok := r.Get("", "1")
+	assert.True(t, ok)
+	assert.Equal(t, "1", card.ID)
+}
+
+func TestAppend_OffsetGap_ReturnErr(t *testing.T) {
+	r, path := openReplica(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer r.Close()
+
+	_, err := r.Append(Event{Offset: 2, Type: EventRevokeCard, CardID: "1"})
+
+	assert.Error(t, err)
+	assert.Equal(t, uint64(0), r.Offset())
+}
+
+func TestAppend_RevokeCard_RemoveCard(t *testing.T) {
+	r, path := openReplica(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer r.Close()
+	r.Append(Event{Type: EventCreateCard, CardID: "1", Card: makeCard("1", "alice", virgil.CardScope.Global)})
+
+	r.Append(Event{Type: EventRevokeCard, CardID: "1"})
+
+	_, ok := r.Get("", "1")
+	assert.False(t, ok)
+	assert.Empty(t, r.Search("", &virgil.Criteria{Identities: []string{"alice"}, Scope: virgil.CardScope.Global}))
+}
+
+func TestAppend_Changed_Closed(t *testing.T) {
+	r, path := openReplica(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer r.Close()
+	changed := r.Changed()
+
+	r.Append(Event{Type: EventRevokeCard, CardID: "1"})
+
+	select {
+	case <-changed:
+	default:
+		t.Fatal("changed is not closed")
+	}
+}
+
+func TestOpen_Existing_LoadCards(t *testing.T) {
+	r, path := openReplica(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	r.Append(Event{Type: EventCreateCard, CardID: "1", Card: makeCard("1", "alice", virgil.CardScope.Global)})
+	r.Append(Event{Type: EventCreateCard, CardID: "2", Card: makeCard("2", "bob", virgil.CardScope.Global)})
+	r.Append(Event{Type: EventRevokeCard, CardID: "1"})
+	r.Close()
+
+	r, err := Open(context.Background(), path)
+
+	assert.Nil(t, err)
+	defer r.Close()
+	assert.Equal(t, uint64(3), r.Offset())
+	_, ok := r.Get("", "1")
+	assert.False(t, ok)
+	_, ok = r.Get("", "2")
+	assert.True(t, ok)
+}
+
+func TestOpen_BrokenOffsets_ReturnErr(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "replica")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "replica.log")
+	ioutil.WriteFile(path, []byte(`{"offset":1,"type":"revoke_card","card_id":"1"}`+"\n"+`{"offset":3,"type":"revoke_card","card_id":"2"}`+"\n"), 0600)
+
+	_, err := Open(context.Background(), path)
+
+	assert.Error(t, err)
+}
+
+func TestOpen_TornLastEvent_DropEvent(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "replica")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "replica.log")
+	ioutil.WriteFile(path, []byte(`{"offset":1,"type":"revoke_card","card_id":"1"}`+"\n"+`{"offset":2,"type":"rev`), 0600)
+
+	r, err := Open(context.Background(), path)
+	assert.Nil(t, err)
+	defer r.Close()
+	assert.Equal(t, uint64(1), r.Offset())
+	e, err := r.Append(Event{Type: EventRevokeCard, CardID: "2"})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), e.Offset)
+	events, err := r.Since(0, 0)
+	assert.Nil(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "2", events[1].CardID)
+}
+
+func TestSince_ReturnEventsAfterOffset(t *testing.T) {
+	r, path := openReplica(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer r.Close()
+	for _, id := range []string{"1", "2", "3"} {
+		r.Append(Event{Type: EventRevokeCard, CardID: id})
+	}
+
+	events, err := r.Since(1, 1)
+	assert.Nil(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "2", events[0].CardID)
+
+	events, err = r.Since(1, 0)
+	assert.Nil(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, uint64(3), events[1].Offset)
+
+	events, err = r.Since(3, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, events)
+
+	_, err = r.Since(4, 0)
+	assert.Error(t, err)
+}
+
+func TestSearch_ApplicationCards_ReturnOwnerCardsOnly(t *testing.T) {
+	r, path := openReplica(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer r.Close()
+	r.Append(Event{Type: EventCreateCard, Owner: "owner-1", CardID: "1", Card: makeCard("1", "alice", virgil.CardScope.Application)})
+	r.Append(Event{Type: EventCreateCard, Owner: "owner-2", CardID: "2", Card: makeCard("2", "alice", virgil.CardScope.Application)})
+	r.Append(Event{Type: EventCreateCard, Owner: "owner-2", CardID: "3", Card: makeCard("3", "alice", virgil.CardScope.Global)})
+
+	cards := r.Search("owner-1", &virgil.Criteria{Identities: []string{"alice", "alice"}})
+
+	assert.Len(t, cards, 1)
+	assert.Equal(t, "1", cards[0].ID)
+
+	cards = r.Search("owner-1", &virgil.Criteria{Identities: []string{"alice"}, IdentityType: "email", Scope: virgil.CardScope.Global})
+
+	assert.Len(t, cards, 1)
+	assert.Equal(t, "3", cards[0].ID)
+}
+
+func TestAppend_UpdateCard_KeepOwner(t *testing.T) {
+	r, path := openReplica(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer r.Close()
+	r.Append(Event{Type: EventCreateCard, Owner: "owner-1", CardID: "1", Card: makeCard("1", "alice", virgil.CardScope.Application)})
+
+	updated := makeCard("1", "alice", virgil.CardScope.Application)
+	updated.Meta.Relations = map[string][]byte{"2": []byte("sign")}
+	r.Append(Event{Type: EventUpdateCard, Owner: "owner-2", CardID: "1", Card: updated})
+
+	cards := r.Search("owner-1", &virgil.Criteria{Identities: []string{"alice"}})
+	assert.Len(t, cards, 1)
+	assert.Equal(t, updated.Meta.Relations, cards[0].Meta.Relations)
+}
+
+func TestGet_ApplicationCardOfOtherOwner_NotFound(t *testing.T) {
+	r, path := openReplica(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer r.Close()
+	r.Append(Event{Type: EventCreateCard, Owner: "owner-1", CardID: "1", Card: makeCard("1", "alice", virgil.CardScope.Application)})
+
+	_, ok := r.Get("owner-2", "1")
+	assert.False(t, ok)
+	_, ok = r.Get("owner-1", "1")
+	assert.True(t, ok)
+}
@@ -0,0 +1,287 @@
+package replica
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// EventsPath is the path of the stream of card events on the parent instance
+	EventsPath = "/replication/events"
+
+	batchSize  = 100
+	maxBackoff = 30 * time.Second
+)
+
+var subscribersMetric = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name:      "subscribers",
+	Subsystem: "replication",
+	Namespace: "virgild",
+	Help:      "Count of child instances connected to the stream of card events",
+})
+
+func init() {
+	prometheus.MustRegister(subscribersMetric)
+}
+
+// Publisher streams events of the replica to child instances as server-sent events. The stream starts after
+// the offset in query parameter offset (or Last-Event-ID header) and ends on shutdown, children reconnect
+// with the last received offset.
+type Publisher struct {
+	Replica *Replica
+	// Secret is shared with children, they send it in Authorization header (Bearer <secret>)
+	Secret    string
+	Heartbeat time.Duration
+	Draining  <-chan struct{}
+	Logger    coreapi.Logger
+}
+
+func (p *Publisher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+p.Secret)) != 1 {
+		http.Error(w, "invalid replication secret", http.StatusUnauthorized)
+		return
+	}
+	offset, err := requestOffset(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if last := p.Replica.Offset(); offset > last {
+		http.Error(w, fmt.Sprintf("offset %d is ahead of the journal (%d)", offset, last), http.StatusConflict)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	subscribersMetric.Inc()
+	defer subscribersMetric.Dec()
+	heartbeat := time.NewTicker(p.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		changed := p.Replica.Changed()
+		events, err := p.Replica.Since(offset, batchSize)
+		if err != nil {
+			p.Logger.Err("Replication stream: %+v", err)
+			return
+		}
+		for _, e := range events {
+			b, err := json.Marshal(e)
+			if err != nil {
+				p.Logger.Err("Replication stream: marshal event %d: %v", e.Offset, err)
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: card\ndata: %s\n\n", e.Offset, b)
+			offset = e.Offset
+		}
+		if len(events) != 0 {
+			flusher.Flush()
+		}
+		if len(events) == batchSize {
+			continue
+		}
+
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-p.Draining:
+			return
+		}
+	}
+}
+
+func requestOffset(r *http.Request) (uint64, error) {
+	v := r.URL.Query().Get("offset")
+	if v == "" {
+		v = r.Header.Get("Last-Event-ID")
+	}
+	if v == "" {
+		return 0, nil
+	}
+	offset, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid offset (%v)", v)
+	}
+	return offset, nil
+}
+
+// Subscriber appends events of the parent instance to the replica. It resumes from the last offset of the replica
+// after reconnects and restarts.
+type Subscriber struct {
+	// URL is the address of the parent instance
+	URL     string
+	Secret  string
+	Client  *http.Client
+	Replica *Replica
+	// Heartbeat is the interval of heartbeats of the parent, the connection without data for 3 heartbeats is reestablished
+	Heartbeat time.Duration
+	Backoff   time.Duration
+	Logger    coreapi.Logger
+
+	mu        sync.Mutex
+	connected bool
+	lastErr   error
+	lastSync  time.Time
+}
+
+// Run receives events until ctx is done
+func (s *Subscriber) Run(ctx context.Context) {
+	backoff := s.Backoff
+	for {
+		err := s.stream(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		s.setState(false, err)
+		if err != nil {
+			s.Logger.Err("Replication: %+v", err)
+		} else {
+			backoff = s.Backoff
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// stream receives events of one connection. It returns nil if the parent closed the stream.
+func (s *Subscriber) stream(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	offset := s.Replica.Offset()
+	url := strings.TrimSuffix(s.URL, "/") + EventsPath + "?offset=" + strconv.FormatUint(offset, 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+	req.Header.Set("Authorization", "Bearer "+s.Secret)
+	req.Header.Set("Accept", "text/event-stream")
+	coreapi.SetHopHeaders(ctx, req.Header)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "connect (%v)", s.URL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("parent (%v) returned %v: %s", s.URL, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	s.setState(true, nil)
+	s.Logger.Info("Replication: connected to %v from offset %d", s.URL, offset)
+
+	var expired int32
+	idle := time.AfterFunc(3*s.Heartbeat, func() {
+		atomic.StoreInt32(&expired, 1)
+		cancel()
+	})
+	defer idle.Stop()
+
+	var event, data string
+	br := bufio.NewReader(resp.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if atomic.LoadInt32(&expired) == 1 {
+				return fmt.Errorf("no data from parent (%v) for %v", s.URL, 3*s.Heartbeat)
+			}
+			return errors.Wrap(err, "read stream")
+		}
+		idle.Reset(3 * s.Heartbeat)
+		s.synced()
+
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			if event == "card" && data != "" {
+				var e Event
+				if err = json.Unmarshal([]byte(data), &e); err != nil {
+					return errors.Wrap(err, "unmarshal event")
+				}
+				if _, err = s.Replica.Append(e); err != nil {
+					return err
+				}
+			}
+			event, data = "", ""
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+}
+
+func (s *Subscriber) synced() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastSync = time.Now()
+}
+
+// LastSync returns time of the last data (event or heartbeat) received from the parent
+func (s *Subscriber) LastSync() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastSync
+}
+
+func (s *Subscriber) setState(connected bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connected = connected
+	s.lastErr = err
+}
+
+// Check fails while the subscriber is disconnected from the parent
+func (s *Subscriber) Check(ctx context.Context) (interface{}, error) {
+	s.mu.Lock()
+	connected, lastErr := s.connected, s.lastErr
+	s.mu.Unlock()
+
+	if !connected {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("not connected")
+		}
+		return nil, errors.Wrapf(lastErr, "Replication (%v)", s.URL)
+	}
+	return map[string]interface{}{"parent": s.URL, "offset": s.Replica.Offset()}, nil
+}
@@ -0,0 +1,113 @@
+package replica
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	virgil "gopkg.in/virgil.v4"
+)
+
+type fakeLogger struct{}
+
+func (fakeLogger) Debug(format string, args ...interface{}) {}
+func (fakeLogger) Info(format string, args ...interface{})  {}
+func (fakeLogger) Warn(format string, args ...interface{})  {}
+func (fakeLogger) Err(format string, args ...interface{})   {}
+
+func TestPublisher_InvalidSecret_ReturnUnauthorized(t *testing.T) {
+	r, path := openReplica(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer r.Close()
+	p := &Publisher{Replica: r, Secret: "secret", Heartbeat: time.Second, Logger: fakeLogger{}}
+	req := httptest.NewRequest(http.MethodGet, EventsPath, nil)
+	req.Header.Set("Authorization", "Bearer other")
+	w := httptest.NewRecorder()
+
+	p.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestPublisher_OffsetAhead_ReturnConflict(t *testing.T) {
+	r, path := openReplica(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer r.Close()
+	p := &Publisher{Replica: r, Secret: "secret", Heartbeat: time.Second, Logger: fakeLogger{}}
+	req := httptest.NewRequest(http.MethodGet, EventsPath+"?offset=5", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+
+	p.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestPublisher_Draining_StreamEventsAfterOffset(t *testing.T) {
+	r, path := openReplica(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer r.Close()
+	r.Append(Event{Type: EventRevokeCard, CardID: "1"})
+	r.Append(Event{Type: EventRevokeCard, CardID: "2"})
+	draining := make(chan struct{})
+	close(draining)
+	p := &Publisher{Replica: r, Secret: "secret", Heartbeat: time.Second, Draining: draining, Logger: fakeLogger{}}
+	req := httptest.NewRequest(http.MethodGet, EventsPath, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Last-Event-ID", "1")
+	w := httptest.NewRecorder()
+
+	p.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, 1, strings.Count(w.Body.String(), "event: card"))
+	assert.Contains(t, w.Body.String(), "id: 2\n")
+}
+
+func TestSubscriber_ReplicateEvents(t *testing.T) {
+	parent, parentPath := openReplica(t)
+	defer os.RemoveAll(filepath.Dir(parentPath))
+	defer parent.Close()
+	child, childPath := openReplica(t)
+	defer os.RemoveAll(filepath.Dir(childPath))
+	defer child.Close()
+	parent.Append(Event{Type: EventCreateCard, CardID: "1", Card: makeCard("1", "alice", virgil.CardScope.Global)})
+
+	draining := make(chan struct{})
+	srv := httptest.NewServer(&Publisher{Replica: parent, Secret: "secret", Heartbeat: time.Second, Draining: draining, Logger: fakeLogger{}})
+	defer srv.Close()
+	defer close(draining)
+	s := &Subscriber{URL: srv.URL, Secret: "secret", Client: srv.Client(), Replica: child, Heartbeat: time.Second, Backoff: 10 * time.Millisecond, Logger: fakeLogger{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	parent.Append(Event{Type: EventCreateCard, CardID: "2", Card: makeCard("2", "bob", virgil.CardScope.Global)})
+	assert.Eventually(t, func() bool { return child.Offset() == 2 }, 5*time.Second, 10*time.Millisecond)
+	_, err := s.Check(ctx)
+	assert.Nil(t, err)
+	_, ok := child.Get("", "2")
+	assert.True(t, ok)
+	assert.False(t, s.LastSync().IsZero())
+
+	cancel()
+	<-done
+}
+
+func TestSubscriber_NotConnected_CheckReturnErr(t *testing.T) {
+	s := &Subscriber{URL: "http://parent"}
+
+	_, err := s.Check(context.Background())
+
+	assert.Error(t, err)
+}
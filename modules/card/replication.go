@@ -0,0 +1,70 @@
+package card
+
+import (
+	"context"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/VirgilSecurity/virgild/modules/card/core"
+	"github.com/VirgilSecurity/virgild/modules/card/replica"
+	virgil "gopkg.in/virgil.v4"
+)
+
+type eventAppender interface {
+	Append(e replica.Event) (replica.Event, error)
+}
+
+// replicationCardMiddleware records successful card changing operations to the journal of replication.
+// Only operations handled by this instance are recorded, the journal isn't reconciled with upstreams.
+// Failures of the journal don't fail operations, the card is already changed by the upstream.
+type replicationCardMiddleware struct {
+	journal eventAppender
+}
+
+func (m *replicationCardMiddleware) record(ctx context.Context, e replica.Event) {
+	if owner := core.GetOwnerRequest(ctx); owner != "" {
+		e.Owner = coreapi.HashToken(owner)
+	}
+	if _, err := m.journal.Append(e); err != nil {
+		coreapi.GetLogger(ctx).Err("Replication %v: %+v", e.Type, err)
+	}
+}
+
+func (m *replicationCardMiddleware) CreateCard(f core.CreateCardHandler) core.CreateCardHandler {
+	return func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
+		card, err := f(ctx, req)
+		if err == nil && card != nil {
+			m.record(ctx, replica.Event{Type: replica.EventCreateCard, CardID: card.ID, Card: card})
+		}
+		return card, err
+	}
+}
+
+func (m *replicationCardMiddleware) RevokeCard(f core.RevokeCardHandler) core.RevokeCardHandler {
+	return func(ctx context.Context, req *core.RevokeCardRequest) error {
+		err := f(ctx, req)
+		if err == nil {
+			m.record(ctx, replica.Event{Type: replica.EventRevokeCard, CardID: req.Info.ID})
+		}
+		return err
+	}
+}
+
+func (m *replicationCardMiddleware) CreateRelation(f core.CreateRelationHandler) core.CreateRelationHandler {
+	return func(ctx context.Context, req *core.CreateRelationRequest) (*virgil.CardResponse, error) {
+		card, err := f(ctx, req)
+		if err == nil && card != nil {
+			m.record(ctx, replica.Event{Type: replica.EventUpdateCard, CardID: card.ID, Card: card})
+		}
+		return card, err
+	}
+}
+
+func (m *replicationCardMiddleware) RevokeRelation(f core.RevokeRelationHandler) core.RevokeRelationHandler {
+	return func(ctx context.Context, req *core.RevokeRelationRequest) (*virgil.CardResponse, error) {
+		card, err := f(ctx, req)
+		if err == nil && card != nil {
+			m.record(ctx, replica.Event{Type: replica.EventUpdateCard, CardID: card.ID, Card: card})
+		}
+		return card, err
+	}
+}
@@ -0,0 +1,77 @@
+package card
+
+import (
+	"context"
+	"testing"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/VirgilSecurity/virgild/modules/card/core"
+	"github.com/VirgilSecurity/virgild/modules/card/replica"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/virgil.v4"
+)
+
+type fakeJournal struct {
+	events []replica.Event
+}
+
+func (f *fakeJournal) Append(e replica.Event) (replica.Event, error) {
+	f.events = append(f.events, e)
+	return e, nil
+}
+
+func TestReplicationCreateCard_Success_RecordEvent(t *testing.T) {
+	j := new(fakeJournal)
+	m := replicationCardMiddleware{journal: j}
+	card := &virgil.CardResponse{ID: "card-1"}
+	ctx := core.SetOwnerRequest(context.Background(), "token")
+
+	_, err := m.CreateCard(func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
+		return card, nil
+	})(ctx, &core.CreateCardRequest{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []replica.Event{{
+		Type:   replica.EventCreateCard,
+		Owner:  coreapi.HashToken("token"),
+		CardID: "card-1",
+		Card:   card,
+	}}, j.events)
+}
+
+func TestReplicationRevokeCard_Failure_NotRecord(t *testing.T) {
+	j := new(fakeJournal)
+	m := replicationCardMiddleware{journal: j}
+
+	err := m.RevokeCard(func(ctx context.Context, req *core.RevokeCardRequest) error {
+		return core.RevocationReasonIsEmptyErr
+	})(context.Background(), &core.RevokeCardRequest{Info: virgil.RevokeCardRequest{ID: "card-1"}})
+
+	assert.Equal(t, core.RevocationReasonIsEmptyErr, err)
+	assert.Empty(t, j.events)
+}
+
+func TestReplicationRevokeCard_Success_RecordEvent(t *testing.T) {
+	j := new(fakeJournal)
+	m := replicationCardMiddleware{journal: j}
+
+	err := m.RevokeCard(func(ctx context.Context, req *core.RevokeCardRequest) error {
+		return nil
+	})(context.Background(), &core.RevokeCardRequest{Info: virgil.RevokeCardRequest{ID: "card-1"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []replica.Event{{Type: replica.EventRevokeCard, CardID: "card-1"}}, j.events)
+}
+
+func TestReplicationCreateRelation_Success_RecordUpdate(t *testing.T) {
+	j := new(fakeJournal)
+	m := replicationCardMiddleware{journal: j}
+	card := &virgil.CardResponse{ID: "card-1"}
+
+	_, err := m.CreateRelation(func(ctx context.Context, req *core.CreateRelationRequest) (*virgil.CardResponse, error) {
+		return card, nil
+	})(context.Background(), &core.CreateRelationRequest{ID: "card-1"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []replica.Event{{Type: replica.EventUpdateCard, CardID: "card-1", Card: card}}, j.events)
+}
@@ -0,0 +1,123 @@
+package card
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/VirgilSecurity/virgild/modules/card/core"
+	"github.com/VirgilSecurity/virgild/modules/card/validator"
+)
+
+func init() {
+	coreapi.RegisterTenantKeys("card-cardsservice", "card-raservice", "card-ra-keys", "card-cache-ttl")
+}
+
+// makeClouds creates the default client of upstream services and clients of tenants which override upstreams
+func makeClouds(c upstreamConfig, ts []*coreapi.Tenant) (*cloudCard, map[string]*cloudCard, error) {
+	def, err := makeCloud(c, c.CardsService, c.RAService)
+	if err != nil {
+		return nil, nil, err
+	}
+	tenants := make(map[string]*cloudCard)
+	for _, t := range ts {
+		cards, hasCards := t.Value("card-cardsservice")
+		ra, hasRA := t.Value("card-raservice")
+		if !hasCards && !hasRA {
+			continue
+		}
+		if !hasCards {
+			cards = c.CardsService
+		}
+		if !hasRA {
+			ra = c.RAService
+		}
+		if tenants[t.Name], err = makeCloud(c, cards, ra); err != nil {
+			return nil, nil, err
+		}
+	}
+	return def, tenants, nil
+}
+
+// trustedRA are registration authorities trusted by default (card-ra-keys) and by tenants. Create and revoke
+// requests must be signed by one of them, if any are set.
+type trustedRA struct {
+	Default validator.TrustedRA
+	Tenants map[string]validator.TrustedRA
+}
+
+func makeTrustedRA(keys string, tenants []*coreapi.Tenant) (trustedRA, error) {
+	def, err := validator.ParseTrustedRA(keys)
+	if err != nil {
+		return trustedRA{}, err
+	}
+	ras := trustedRA{Default: def, Tenants: make(map[string]validator.TrustedRA)}
+	for _, t := range tenants {
+		v, ok := t.Value("card-ra-keys")
+		if !ok {
+			continue
+		}
+		if ras.Tenants[t.Name], err = validator.ParseTrustedRA(v); err != nil {
+			return trustedRA{}, err
+		}
+	}
+	return ras, nil
+}
+
+func (t trustedRA) createCard(ctx context.Context, req *core.CreateCardRequest) (bool, error) {
+	if ra := t.of(ctx); len(ra) != 0 {
+		return ra.Signed(&req.Request)
+	}
+	return true, nil
+}
+
+func (t trustedRA) revokeCard(ctx context.Context, req *core.RevokeCardRequest) (bool, error) {
+	if ra := t.of(ctx); len(ra) != 0 {
+		return ra.Signed(&req.Request)
+	}
+	return true, nil
+}
+
+// of returns authorities trusted for the tenant of the request
+func (t trustedRA) of(ctx context.Context) validator.TrustedRA {
+	if tenant := coreapi.GetTenant(ctx); tenant != nil {
+		if ra, ok := t.Tenants[tenant.Name]; ok {
+			return ra
+		}
+	}
+	return t.Default
+}
+
+// createCardSigned validates requests by the current authorities, they are replaced on reload of configuration
+func createCardSigned(ras *coreapi.Reloadable[trustedRA]) func(ctx context.Context, req *core.CreateCardRequest) (bool, error) {
+	return func(ctx context.Context, req *core.CreateCardRequest) (bool, error) {
+		return ras.Current().createCard(ctx, req)
+	}
+}
+
+func revokeCardSigned(ras *coreapi.Reloadable[trustedRA]) func(ctx context.Context, req *core.RevokeCardRequest) (bool, error) {
+	return func(ctx context.Context, req *core.RevokeCardRequest) (bool, error) {
+		return ras.Current().revokeCard(ctx, req)
+	}
+}
+
+// makeTenantTTLs returns TTL of cached cards by tenant. Caches count TTL in seconds and keep entries
+// with zero TTL forever, so TTL under a second is an error.
+func makeTenantTTLs(tenants []*coreapi.Tenant) (map[string]time.Duration, error) {
+	ttls := make(map[string]time.Duration)
+	for _, t := range tenants {
+		if _, ok := t.Value("card-cache-ttl"); !ok {
+			continue
+		}
+		ttl, err := t.Duration("card-cache-ttl", 0)
+		if err != nil {
+			return nil, err
+		}
+		if ttl < time.Second {
+			return nil, fmt.Errorf("tenant %v: card-cache-ttl (%v) is less than 1s", t.Name, ttl)
+		}
+		ttls[t.Name] = ttl
+	}
+	return ttls, nil
+}
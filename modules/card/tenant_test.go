@@ -0,0 +1,135 @@
+package card
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/VirgilSecurity/virgild/modules/card/core"
+	"github.com/VirgilSecurity/virgild/modules/card/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gopkg.in/virgil.v4"
+)
+
+type fakeTTLCache struct {
+	fakeCache
+}
+
+func (f *fakeTTLCache) SetTTL(key string, val interface{}, ttl time.Duration) {
+	f.Called(key, val, ttl)
+}
+
+func tenantContext(name string) context.Context {
+	return coreapi.SetTenant(context.Background(), &coreapi.Tenant{Name: name})
+}
+
+func makeRATestRequest(t *testing.T, raID string) (*core.CreateCardRequest, validator.TrustedRA) {
+	kp, err := virgil.Crypto().GenerateKeypair()
+	assert.NoError(t, err)
+	req := &core.CreateCardRequest{Request: virgil.SignableRequest{Snapshot: []byte("snapshot"), Meta: virgil.RequestMeta{Signatures: make(map[string][]byte)}}}
+	signer := virgil.RequestSigner{}
+	signer.AuthoritySign(&req.Request, raID, kp.PrivateKey())
+	return req, validator.TrustedRA{"trusted": kp.PublicKey()}
+}
+
+func TestTrustedRACreateCard_SignedByTrusted_ReturnTrue(t *testing.T) {
+	req, ra := makeRATestRequest(t, "trusted")
+	ras := trustedRA{Tenants: map[string]validator.TrustedRA{"team-a": ra}}
+
+	ok, err := ras.createCard(tenantContext("team-a"), req)
+
+	assert.True(t, ok)
+	assert.NoError(t, err)
+}
+
+func TestTrustedRACreateCard_NotSignedByTrusted_ReturnErr(t *testing.T) {
+	req, ra := makeRATestRequest(t, "other")
+	ras := trustedRA{Tenants: map[string]validator.TrustedRA{"team-a": ra}}
+
+	ok, err := ras.createCard(tenantContext("team-a"), req)
+
+	assert.False(t, ok)
+	assert.Equal(t, core.VRASignInvalidErr, err)
+}
+
+func TestTrustedRACreateCard_TenantWithoutRA_ReturnTrue(t *testing.T) {
+	req, ra := makeRATestRequest(t, "other")
+	ras := trustedRA{Tenants: map[string]validator.TrustedRA{"team-a": ra}}
+
+	ok, err := ras.createCard(tenantContext("team-b"), req)
+
+	assert.True(t, ok)
+	assert.NoError(t, err)
+}
+
+func TestTrustedRACreateCard_DefaultRANotSigned_ReturnErr(t *testing.T) {
+	req, ra := makeRATestRequest(t, "other")
+	ras := trustedRA{Default: ra}
+
+	ok, err := ras.createCard(tenantContext("team-b"), req)
+
+	assert.False(t, ok)
+	assert.Equal(t, core.VRASignInvalidErr, err)
+}
+
+func TestCreateCardSigned_RAReplaced_ValidateByNewRA(t *testing.T) {
+	req, ra := makeRATestRequest(t, "trusted")
+	ras := coreapi.NewReloadable(trustedRA{})
+	validate := createCardSigned(ras)
+
+	ras.Set(trustedRA{Default: validator.TrustedRA{"other": ra["trusted"]}})
+	ok, err := validate(context.Background(), req)
+
+	assert.False(t, ok)
+	assert.Equal(t, core.VRASignInvalidErr, err)
+}
+
+func TestMakeTenantTTLs_TTLUnderSecond_ReturnErr(t *testing.T) {
+	tenants := []*coreapi.Tenant{{Name: "team-a", Config: map[string]string{"card-cache-ttl": "500ms"}}}
+
+	_, err := makeTenantTTLs(tenants)
+
+	assert.EqualError(t, err, "tenant team-a: card-cache-ttl (500ms) is less than 1s")
+}
+
+func TestMakeTenantTTLs_Valid_ReturnTTLs(t *testing.T) {
+	tenants := []*coreapi.Tenant{{Name: "team-a", Config: map[string]string{"card-cache-ttl": "1m"}}, {Name: "team-b"}}
+
+	ttls, err := makeTenantTTLs(tenants)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{"team-a": time.Minute}, ttls)
+}
+
+func TestCacheSet_TenantWithTTL_SetTTL(t *testing.T) {
+	cache := new(fakeTTLCache)
+	cache.On("SetTTL", "key", "val", time.Minute).Once()
+	c := cacheCardMiddleware{cache: cache, ttls: coreapi.NewReloadable(map[string]time.Duration{"team-a": time.Minute})}
+
+	c.set(tenantContext("team-a"), "key", "val")
+
+	cache.AssertExpectations(t)
+}
+
+func TestCacheSet_NoTenant_Set(t *testing.T) {
+	cache := new(fakeTTLCache)
+	cache.On("Set", "key", "val").Once()
+	c := cacheCardMiddleware{cache: cache, ttls: coreapi.NewReloadable(map[string]time.Duration{"team-a": time.Minute})}
+
+	c.set(context.Background(), "key", "val")
+
+	cache.AssertExpectations(t)
+	cache.AssertNotCalled(t, "SetTTL", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestReloadableCloudCurrent_TenantWithUpstreams_ReturnTenantCloud(t *testing.T) {
+	def := &cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service")}
+	tenant := &cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-team-a")}
+	rc := newReloadableCloud(def, map[string]*cloudCard{"team-a": tenant})
+
+	assert.Equal(t, tenant, rc.current(tenantContext("team-a")))
+	assert.Equal(t, def, rc.current(tenantContext("team-b")))
+	assert.Equal(t, def, rc.current(context.Background()))
+}
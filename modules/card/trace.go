@@ -0,0 +1,91 @@
+package card
+
+import (
+	"context"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/VirgilSecurity/virgild/modules/card/core"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	virgil "gopkg.in/virgil.v4"
+)
+
+const tracerName = "github.com/VirgilSecurity/virgild/modules/card"
+
+// layerTracer starts a span around a layer of the handler chain. Span name is card.<layer>.<operation>
+type layerTracer struct {
+	layer string
+}
+
+func (t layerTracer) start(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, "card."+t.layer+"."+op, trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	// the operation stored by offline mode isn't failed
+	if errors.Cause(err) == coreapi.RequestQueuedErr {
+		span.SetAttributes(attribute.Bool("virgild.queued", true))
+	} else if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t layerTracer) GetCard(f core.GetCardHandler) core.GetCardHandler {
+	return func(ctx context.Context, id string) (*virgil.CardResponse, error) {
+		ctx, span := t.start(ctx, "get_card", attribute.String("virgild.card_id", id))
+		card, err := f(ctx, id)
+		endSpan(span, err)
+		return card, err
+	}
+}
+
+func (t layerTracer) SearchCards(f core.SearchCardsHandler) core.SearchCardsHandler {
+	return func(ctx context.Context, crit *virgil.Criteria) ([]virgil.CardResponse, error) {
+		ctx, span := t.start(ctx, "search", attribute.String("virgild.scope", string(crit.Scope)))
+		cards, err := f(ctx, crit)
+		span.SetAttributes(attribute.Int("virgild.cards", len(cards)))
+		endSpan(span, err)
+		return cards, err
+	}
+}
+
+func (t layerTracer) CreateCard(f core.CreateCardHandler) core.CreateCardHandler {
+	return func(ctx context.Context, req *core.CreateCardRequest) (*virgil.CardResponse, error) {
+		ctx, span := t.start(ctx, "create_card")
+		card, err := f(ctx, req)
+		endSpan(span, err)
+		return card, err
+	}
+}
+
+func (t layerTracer) RevokeCard(f core.RevokeCardHandler) core.RevokeCardHandler {
+	return func(ctx context.Context, req *core.RevokeCardRequest) error {
+		ctx, span := t.start(ctx, "revoke_card", attribute.String("virgild.card_id", req.Info.ID))
+		err := f(ctx, req)
+		endSpan(span, err)
+		return err
+	}
+}
+
+func (t layerTracer) CreateRelation(f core.CreateRelationHandler) core.CreateRelationHandler {
+	return func(ctx context.Context, req *core.CreateRelationRequest) (*virgil.CardResponse, error) {
+		ctx, span := t.start(ctx, "create_relation", attribute.String("virgild.card_id", req.ID))
+		card, err := f(ctx, req)
+		endSpan(span, err)
+		return card, err
+	}
+}
+
+func (t layerTracer) RevokeRelation(f core.RevokeRelationHandler) core.RevokeRelationHandler {
+	return func(ctx context.Context, req *core.RevokeRelationRequest) (*virgil.CardResponse, error) {
+		ctx, span := t.start(ctx, "revoke_relation", attribute.String("virgild.card_id", req.ID))
+		card, err := f(ctx, req)
+		endSpan(span, err)
+		return card, err
+	}
+}
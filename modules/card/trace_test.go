@@ -0,0 +1,61 @@
+package card
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gopkg.in/virgil.v4"
+)
+
+func makeRecorder() *tracetest.SpanRecorder {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return sr
+}
+
+func TestLayerTracer_Err_RecordErrorSpan(t *testing.T) {
+	sr := makeRecorder()
+
+	_, err := layerTracer{"cache"}.GetCard(func(ctx context.Context, id string) (*virgil.CardResponse, error) {
+		return nil, assert.AnError
+	})(context.Background(), "1234")
+
+	assert.Equal(t, assert.AnError, err)
+	spans := sr.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "card.cache.get_card", spans[0].Name())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+}
+
+func TestCloudGetCard_Tracing_PropagateTraceparent(t *testing.T) {
+	sr := makeRecorder()
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+
+	f := new(fakeHttpClient)
+	f.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.Contains(req.Header.Get("traceparent"), parent.SpanContext().TraceID().String())
+	})).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"id":"1234"}`)),
+	}, nil)
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-service"), Client: f}
+
+	_, err := cloud.getCard(ctx, "1234")
+	parent.End()
+
+	assert.NoError(t, err)
+	spans := sr.Ended()
+	assert.Equal(t, "upstream GET", spans[0].Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+}
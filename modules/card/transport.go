@@ -0,0 +1,139 @@
+package card
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	pinPublicKey   = "sha256/"
+	pinCertificate = "cert-sha256/"
+)
+
+type transportConfig struct {
+	Proxy               string
+	CAFile              string
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	DisableKeepAlives   bool
+	HTTP2               bool
+}
+
+// makeTransport creates transport for upstream calls. Pins map upstream host (or IP) to accepted pins,
+// every client gets own set of pins.
+func makeTransport(cfg transportConfig, pins map[string][]string) (*http.Transport, error) {
+	proxy := http.ProxyFromEnvironment
+	if cfg.Proxy != "" {
+		u, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Make transport: parse proxy address (%v)", cfg.Proxy)
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	tlsConfig := &tls.Config{}
+	if cfg.CAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Make transport: read CA file (%v)", cfg.CAFile)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("Make transport: CA file (%v) does not contain PEM certificates", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(pins) != 0 {
+		for host, hp := range pins {
+			for _, p := range hp {
+				if !strings.HasPrefix(p, pinPublicKey) && !strings.HasPrefix(p, pinCertificate) {
+					return nil, fmt.Errorf("Make transport: pin (%v) of host (%v) must start with %v or %v", p, host, pinPublicKey, pinCertificate)
+				}
+			}
+		}
+		tlsConfig.VerifyConnection = verifyPins(pins)
+	}
+
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     cfg.HTTP2,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		DisableKeepAlives:     cfg.DisableKeepAlives,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}, nil
+}
+
+// verifyPins rejects connections to pinned hosts if no certificate of the verified chain matches a pin.
+// Hosts without pins are accepted. TLS does not send server name for IP addresses, such upstreams are
+// recognized by IP addresses of the verified certificate (the dialed IP is one of them).
+func verifyPins(pins map[string][]string) func(cs tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		hostPins, ok := pins[cs.ServerName]
+		if cs.ServerName == "" && len(cs.PeerCertificates) != 0 {
+			for _, ip := range cs.PeerCertificates[0].IPAddresses {
+				if p, found := pins[ip.String()]; found {
+					hostPins, ok = append(hostPins, p...), true
+				}
+			}
+		}
+		if !ok {
+			return nil
+		}
+		for _, cert := range cs.PeerCertificates {
+			spki := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			der := sha256.Sum256(cert.Raw)
+			for _, p := range hostPins {
+				if p == pinPublicKey+base64.StdEncoding.EncodeToString(spki[:]) ||
+					p == pinCertificate+base64.StdEncoding.EncodeToString(der[:]) {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("Upstream (%v) certificate does not match pinned keys", cs.ServerName)
+	}
+}
+
+// hostPins assigns comma separated pins to hosts of every upstream address
+func hostPins(pins map[string][]string, urls []string, s string) (map[string][]string, error) {
+	var list []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			list = append(list, p)
+		}
+	}
+	if len(list) == 0 {
+		return pins, nil
+	}
+	for _, u := range urls {
+		pu, err := url.Parse(u)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Parse upstream address (%v)", u)
+		}
+		host := pu.Hostname()
+		if ip := net.ParseIP(host); ip != nil {
+			host = ip.String()
+		}
+		pins[host] = append(pins[host], list...)
+	}
+	return pins, nil
+}
@@ -0,0 +1,110 @@
+package card
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTLSServer(t *testing.T) (*httptest.Server, string) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	f, err := ioutil.TempFile("", "ca")
+	assert.NoError(t, err)
+	pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+	f.Close()
+
+	return s, f.Name()
+}
+
+func TestMakeTransport_CAFile_TrustServer(t *testing.T) {
+	s, ca := makeTLSServer(t)
+	defer s.Close()
+	defer os.Remove(ca)
+
+	tr, err := makeTransport(transportConfig{CAFile: ca, IdleConnTimeout: time.Second}, nil)
+	assert.NoError(t, err)
+
+	resp, err := (&http.Client{Transport: tr}).Get(s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestMakeTransport_CAFileInvalid_ReturnErr(t *testing.T) {
+	f, _ := ioutil.TempFile("", "ca")
+	f.WriteString("not a certificate")
+	f.Close()
+	defer os.Remove(f.Name())
+
+	_, err := makeTransport(transportConfig{CAFile: f.Name()}, nil)
+	assert.Error(t, err)
+
+	_, err = makeTransport(transportConfig{CAFile: f.Name() + "_not_exist"}, nil)
+	assert.Error(t, err)
+}
+
+func TestMakeTransport_PinInvalidFormat_ReturnErr(t *testing.T) {
+	_, err := makeTransport(transportConfig{}, map[string][]string{"host": {"md5/1234"}})
+	assert.Error(t, err)
+}
+
+func TestMakeTransport_Pins(t *testing.T) {
+	s, ca := makeTLSServer(t)
+	defer s.Close()
+	defer os.Remove(ca)
+
+	spki := sha256.Sum256(s.Certificate().RawSubjectPublicKeyInfo)
+	cert := sha256.Sum256(s.Certificate().Raw)
+
+	table := map[string]bool{
+		pinPublicKey + base64.StdEncoding.EncodeToString(spki[:]):   true,
+		pinCertificate + base64.StdEncoding.EncodeToString(cert[:]): true,
+		pinPublicKey + base64.StdEncoding.EncodeToString(cert[:]):   false,
+	}
+	for pin, success := range table {
+		pins, _ := hostPins(make(map[string][]string), []string{s.URL}, pin)
+		tr, err := makeTransport(transportConfig{CAFile: ca}, pins)
+		assert.NoError(t, err)
+
+		_, err = (&http.Client{Transport: tr}).Get(s.URL)
+		if success {
+			assert.NoError(t, err, pin)
+		} else {
+			assert.Error(t, err, pin)
+		}
+	}
+}
+
+func TestHostPins(t *testing.T) {
+	pins, err := hostPins(make(map[string][]string), []string{"https://a.com", "https://b.com:8443/", "https://127.0.0.1"}, "sha256/1, sha256/2")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"a.com":     {"sha256/1", "sha256/2"},
+		"b.com":     {"sha256/1", "sha256/2"},
+		"127.0.0.1": {"sha256/1", "sha256/2"},
+	}, pins)
+}
+
+func TestMakeTransport_PinsOfOtherIP_Accepted(t *testing.T) {
+	s, ca := makeTLSServer(t)
+	defer s.Close()
+	defer os.Remove(ca)
+	pins, _ := hostPins(make(map[string][]string), []string{"https://192.0.2.1"}, pinPublicKey+"AAAA")
+
+	tr, err := makeTransport(transportConfig{CAFile: ca}, pins)
+	assert.NoError(t, err)
+	_, err = (&http.Client{Transport: tr}).Get(s.URL)
+
+	assert.NoError(t, err)
+}
@@ -0,0 +1,215 @@
+package card
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	balancingRoundRobin = "round-robin"
+	balancingLatency    = "latency"
+
+	// latencyDecay is a weight of the last measurement in latency moving average
+	latencyDecay = 0.3
+)
+
+type endpoint struct {
+	sync.Mutex
+	URL     string
+	Breaker *circuitBreaker
+
+	latency   time.Duration
+	unhealthy bool
+}
+
+func (e *endpoint) success(latency time.Duration) {
+	e.Breaker.Success()
+
+	e.Lock()
+	defer e.Unlock()
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(latencyDecay*float64(latency) + (1-latencyDecay)*float64(e.latency))
+	}
+}
+
+func (e *endpoint) failure() {
+	e.Breaker.Failure()
+}
+
+func (e *endpoint) Latency() time.Duration {
+	e.Lock()
+	defer e.Unlock()
+	return e.latency
+}
+
+func (e *endpoint) Healthy() bool {
+	e.Lock()
+	defer e.Unlock()
+	return !e.unhealthy
+}
+
+func (e *endpoint) setHealthy(healthy bool) {
+	e.Lock()
+	defer e.Unlock()
+	e.unhealthy = !healthy
+}
+
+// upstreamPool is a list of endpoints of one upstream service (Cards or RA)
+type upstreamPool struct {
+	Name      string
+	Endpoints []*endpoint
+	Balancing string
+
+	next uint32
+}
+
+// parseUpstreams splits comma separated list of upstream addresses
+func parseUpstreams(s string) []string {
+	var urls []string
+	for _, u := range strings.Split(s, ",") {
+		u = strings.TrimRight(strings.TrimSpace(u), "/")
+		if u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+func newUpstreamPool(name string, urls []string, balancing string, breakerThreshold int, breakerOpenTimeout time.Duration) *upstreamPool {
+	p := &upstreamPool{
+		Name:      name,
+		Balancing: balancing,
+	}
+	for _, u := range urls {
+		e := &endpoint{URL: u}
+		if breakerThreshold > 0 {
+			e.Breaker = newCircuitBreaker(name, u, breakerThreshold, breakerOpenTimeout)
+		}
+		p.Endpoints = append(p.Endpoints, e)
+	}
+	return p
+}
+
+// order returns endpoints in order of preference for the next call
+func (p *upstreamPool) order() []*endpoint {
+	n := len(p.Endpoints)
+	order := make([]*endpoint, n)
+	if n == 0 {
+		return order
+	}
+
+	if p.Balancing == balancingLatency {
+		copy(order, p.Endpoints)
+		sort.SliceStable(order, func(i, j int) bool {
+			return order[i].Latency() < order[j].Latency()
+		})
+		return order
+	}
+
+	start := int(atomic.AddUint32(&p.next, 1)-1) % n
+	for i := range order {
+		order[i] = p.Endpoints[(start+i)%n]
+	}
+	return order
+}
+
+// pick returns an endpoint which accepts calls. Healthy endpoints which were not tried
+// during the current call are preferred, so retries fail over to another endpoint.
+func (p *upstreamPool) pick(tried map[*endpoint]bool) *endpoint {
+	order := p.order()
+	passes := []func(e *endpoint) bool{
+		func(e *endpoint) bool { return !tried[e] && e.Healthy() },
+		func(e *endpoint) bool { return !tried[e] },
+		func(e *endpoint) bool { return true },
+	}
+	for _, pass := range passes {
+		for _, e := range order {
+			if pass(e) && e.Breaker.Allow() {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// Available returns true if at least one endpoint accepts calls
+func (p *upstreamPool) Available() bool {
+	for _, e := range p.Endpoints {
+		if e.Breaker.State() != breakerOpen && e.Healthy() {
+			return true
+		}
+	}
+	return false
+}
+
+// healthCheck periodically requests path on every endpoint and marks endpoints which do not respond 200 OK
+// within the interval as unhealthy. It returns when stop is closed.
+func (p *upstreamPool) healthCheck(c client, path string, interval time.Duration, stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		for _, e := range p.Endpoints {
+			pctx, pcancel := context.WithTimeout(ctx, interval)
+			e.setHealthy(probe(pctx, c, e.URL+path))
+			pcancel()
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func probe(ctx context.Context, c client, url string) bool {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	req = req.WithContext(ctx)
+	resp, err := c.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+type endpointStatus struct {
+	URL       string  `json:"url"`
+	Breaker   string  `json:"breaker"`
+	Healthy   bool    `json:"healthy"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+// healthCheckStatus reports state of every endpoint of the pool. It fails if the pool has no available endpoints
+func (p *upstreamPool) healthCheckStatus(ctx context.Context) (interface{}, error) {
+	states := make([]endpointStatus, 0, len(p.Endpoints))
+	for _, e := range p.Endpoints {
+		states = append(states, endpointStatus{
+			URL:       e.URL,
+			Breaker:   e.Breaker.State().String(),
+			Healthy:   e.Healthy(),
+			LatencyMs: e.Latency().Seconds() * 1000,
+		})
+	}
+	if !p.Available() {
+		return states, fmt.Errorf("no available endpoints of %v upstream", p.Name)
+	}
+	return states, nil
+}
@@ -0,0 +1,145 @@
+package card
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/modules/card/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gopkg.in/virgil.v4"
+)
+
+func makePool(name string, urls ...string) *upstreamPool {
+	return newUpstreamPool(name, urls, balancingRoundRobin, 0, 0)
+}
+
+func TestParseUpstreams(t *testing.T) {
+	assert.Equal(t, []string{"http://a", "http://b"}, parseUpstreams(" http://a/, ,http://b"))
+	assert.Nil(t, parseUpstreams(""))
+}
+
+func TestUpstreamPoolOrder_RoundRobin(t *testing.T) {
+	p := makePool("cards", "a", "b", "c")
+
+	var first []string
+	for i := 0; i < 4; i++ {
+		first = append(first, p.order()[0].URL)
+	}
+
+	assert.Equal(t, []string{"a", "b", "c", "a"}, first)
+}
+
+func TestUpstreamPoolOrder_Latency(t *testing.T) {
+	p := newUpstreamPool("cards", []string{"a", "b", "c"}, balancingLatency, 0, 0)
+	p.Endpoints[0].success(30 * time.Millisecond)
+	p.Endpoints[1].success(10 * time.Millisecond)
+	p.Endpoints[2].success(20 * time.Millisecond)
+
+	order := p.order()
+
+	assert.Equal(t, "b", order[0].URL)
+	assert.Equal(t, "c", order[1].URL)
+	assert.Equal(t, "a", order[2].URL)
+}
+
+func TestUpstreamPoolPick_SkipTriedAndUnhealthy(t *testing.T) {
+	p := newUpstreamPool("cards", []string{"a", "b", "c"}, balancingLatency, 0, 0)
+	p.Endpoints[1].setHealthy(false)
+
+	e := p.pick(map[*endpoint]bool{p.Endpoints[0]: true})
+
+	assert.Equal(t, "c", e.URL)
+}
+
+func TestUpstreamPoolPick_AllBreakersOpen_ReturnNil(t *testing.T) {
+	p := newUpstreamPool("cards", []string{"a", "b"}, balancingRoundRobin, 1, time.Minute)
+	for _, e := range p.Endpoints {
+		e.failure()
+	}
+
+	assert.Nil(t, p.pick(map[*endpoint]bool{}))
+	assert.False(t, p.Available())
+}
+
+func TestCloudGetCard_FirstEndpointFailed_Failover(t *testing.T) {
+	f := new(fakeHttpClient)
+	f.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.HasPrefix(req.URL.String(), "cards-1")
+	})).Return(nil, fmt.Errorf("ERROR"))
+	f.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.HasPrefix(req.URL.String(), "cards-2")
+	})).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"id":"1234"}`)),
+	}, nil)
+	cloud := cloudCard{RA: makePool("ra", "ra-service"), Cards: makePool("cards", "cards-1", "cards-2"), Client: f, Retry: retryPolicy{Retries: 1}}
+
+	card, err := cloud.getCard(context.Background(), "1234")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", card.ID)
+}
+
+func TestCloudCreateCard_BreakerOpen_UseOtherEndpoint(t *testing.T) {
+	f := new(fakeHttpClient)
+	f.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return req.URL.String() == "ra-2/v1/card"
+	})).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"id":"1234"}`)),
+	}, nil)
+	ra := newUpstreamPool("ra", []string{"ra-1", "ra-2"}, balancingRoundRobin, 1, time.Minute)
+	ra.Endpoints[0].failure()
+	cloud := cloudCard{RA: ra, Cards: makePool("cards", "cards-service"), Client: f}
+
+	card, err := cloud.createCard(context.Background(), &core.CreateCardRequest{Request: virgil.SignableRequest{Snapshot: []byte(`Snapshot`)}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", card.ID)
+}
+
+func TestUpstreamPoolHealthCheckStatus_NoHealthyEndpoints_ReturnErr(t *testing.T) {
+	p := newUpstreamPool("cards", []string{"a", "b"}, balancingRoundRobin, 1, time.Minute)
+	p.Endpoints[0].Breaker.Failure()
+
+	details, err := p.healthCheckStatus(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "open", details.([]endpointStatus)[0].Breaker)
+
+	p.Endpoints[1].setHealthy(false)
+	p.Endpoints[1].Breaker.Failure()
+	_, err = p.healthCheckStatus(context.Background())
+	assert.Error(t, err)
+}
+
+// hungClient never responds, requests end with their context
+type hungClient struct{}
+
+func (hungClient) Do(req *http.Request) (*http.Response, error) {
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestUpstreamPoolHealthCheck_HungEndpoint_MarkedUnhealthy(t *testing.T) {
+	p := makePool("cards", "http://a")
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.healthCheck(hungClient{}, "/health", 20*time.Millisecond, stop)
+	}()
+
+	assert.Eventually(t, func() bool { return !p.Endpoints[0].Healthy() }, time.Second, 5*time.Millisecond)
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("health check is not stopped")
+	}
+}
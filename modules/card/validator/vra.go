@@ -1,7 +1,12 @@
 package validator
 
 import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
 	"github.com/VirgilSecurity/virgild/modules/card/core"
+	"github.com/pkg/errors"
 	virgil "gopkg.in/virgil.v4"
 	"gopkg.in/virgil.v4/virgilcrypto"
 )
@@ -20,3 +25,41 @@ func ValidateVRASign(id string, pub virgilcrypto.PublicKey) func(req *virgil.Sig
 		return ok, nil
 	}
 }
+
+// TrustedRA are public keys of registration authorities by card id
+type TrustedRA map[string]virgilcrypto.PublicKey
+
+// ParseTrustedRA parses list in format id=<base64 public key>[,id=<base64 public key>...]
+func ParseTrustedRA(s string) (TrustedRA, error) {
+	ra := make(TrustedRA)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("trusted RA (%v) must be in format id=<base64 public key>", item)
+		}
+		b, err := base64.StdEncoding.DecodeString(kv[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "trusted RA (%v) has invalid key encoding", kv[0])
+		}
+		pub, err := virgil.Crypto().ImportPublicKey(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "trusted RA (%v) has invalid key", kv[0])
+		}
+		ra[kv[0]] = pub
+	}
+	return ra, nil
+}
+
+// Signed returns true if the request is signed by any of the authorities
+func (t TrustedRA) Signed(req *virgil.SignableRequest) (bool, error) {
+	for id, pub := range t {
+		if ok, _ := ValidateVRASign(id, pub)(req); ok {
+			return true, nil
+		}
+	}
+	return false, core.VRASignInvalidErr
+}
@@ -1,6 +1,7 @@
 package validator
 
 import (
+	"encoding/base64"
 	"testing"
 
 	"github.com/VirgilSecurity/virgild/modules/card/core"
@@ -37,3 +38,21 @@ func TestValidateVRASign_SignValid_ReturnErr(t *testing.T) {
 	ok, _ := s(req)
 	assert.True(t, ok)
 }
+
+func TestParseTrustedRA_Valid_ReturnKeys(t *testing.T) {
+	kp, _ := virgil.Crypto().GenerateKeypair()
+	b, _ := virgil.Crypto().ExportPublicKey(kp.PublicKey())
+
+	ra, err := ParseTrustedRA("ra1=" + base64.StdEncoding.EncodeToString(b))
+
+	assert.NoError(t, err)
+	assert.Contains(t, ra, "ra1")
+}
+
+func TestParseTrustedRA_InvalidFormat_ReturnErr(t *testing.T) {
+	_, err := ParseTrustedRA("ra1")
+	assert.Error(t, err)
+
+	_, err = ParseTrustedRA("ra1=not base64")
+	assert.Error(t, err)
+}
@@ -1,13 +1,76 @@
 package healthcheck
 
 import (
+	"context"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/namsral/flag"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 )
 
+var checkTimeout time.Duration
+
+func init() {
+	flag.DurationVar(&checkTimeout, "health-check-timeout", 5*time.Second, "Timeout of readiness checks")
+}
+
 func Init(c coreapi.Core) {
-	c.HTTP.Router.Get("/health/status", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	}))
+	err := c.Register(coreapi.Operation{
+		Name:  "health_live",
+		Plain: true,
+		Handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+			return map[string]string{"status": coreapi.HealthOK}, nil
+		},
+		HTTP: []coreapi.HTTPBinding{
+			{Method: http.MethodGet, Path: "/health/status"},
+			{Method: http.MethodGet, Path: "/health/live"},
+		},
+	}, coreapi.Operation{
+		Name:  "health_ready",
+		Plain: true,
+		Handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+			return coreapi.CheckHealth(ctx, checkTimeout), nil
+		},
+		HTTP: []coreapi.HTTPBinding{
+			{Method: http.MethodGet, Path: "/health/ready", Encode: encodeReport},
+		},
+		// standard health service of gRPC reports readiness of the whole server
+		GRPC: &coreapi.GRPCBinding{
+			Service: healthpb.Health_ServiceDesc.ServiceName,
+			Method:  "Check",
+			New:     func() interface{} { return new(healthpb.HealthCheckRequest) },
+			Decode: func(msg interface{}) (interface{}, error) {
+				if s := msg.(*healthpb.HealthCheckRequest).GetService(); s != "" {
+					return nil, status.Errorf(codes.NotFound, "unknown service %s", s)
+				}
+				return nil, nil
+			},
+			Encode: func(resp interface{}, err error) (interface{}, error) {
+				if err != nil {
+					return nil, err
+				}
+				if resp.(coreapi.HealthReport).Status == coreapi.HealthFail {
+					return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}, nil
+				}
+				return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+			},
+		},
+	})
+	if err != nil {
+		c.Common.Logger.Err("Healthcheck.init: Cannot register operations: %+v", err)
+		os.Exit(-1)
+	}
+}
+
+// encodeReport responds 503 if any check fails, degraded checks don't make the instance not ready
+func encodeReport(resp interface{}) (int, interface{}) {
+	if resp.(coreapi.HealthReport).Status == coreapi.HealthFail {
+		return http.StatusServiceUnavailable, resp
+	}
+	return http.StatusOK, resp
 }
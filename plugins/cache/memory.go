@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"encoding/json"
+	"sync/atomic"
 	"time"
 
 	"github.com/VirgilSecurity/virgild/coreapi"
@@ -55,9 +56,18 @@ func makeMemoryCache() (coreapi.RawCache, error) {
 
 	prometheus.MustRegister(hitRate, entryCount)
 
+	expire := int64(cacheDuration / time.Second)
+	coreapi.RegisterReloadHook("memory cache", []string{"cache-mem-duration"}, func(v coreapi.ReloadValues) (func(), error) {
+		var d time.Duration
+		if err := v.Flags.Parse(func(fs *flag.FlagSet) { fs.DurationVar(&d, "cache-mem-duration", time.Hour, "") }); err != nil {
+			return nil, err
+		}
+		return func() { atomic.StoreInt64(&expire, int64(d/time.Second)) }, nil
+	})
+
 	return freeCache{
 		Cache:         fc,
-		ExpireSeconds: int(cacheDuration / time.Second),
+		ExpireSeconds: &expire,
 		Hasher:        h,
 	}, nil
 }
@@ -66,10 +76,12 @@ type hasher interface {
 	Sum64(string) int64
 }
 
+// freeCache keeps entries in process memory. ExpireSeconds is changed on reload of configuration,
+// entries which are already cached keep own expiration.
 type freeCache struct {
 	Cache         *freecache.Cache
 	Hasher        hasher
-	ExpireSeconds int
+	ExpireSeconds *int64
 }
 
 func (m freeCache) Get(key string, val interface{}) (bool, error) {
@@ -95,12 +107,20 @@ func (m freeCache) Get(key string, val interface{}) (bool, error) {
 }
 
 func (m freeCache) Set(key string, v interface{}) error {
+	return m.set(key, v, int(atomic.LoadInt64(m.ExpireSeconds)))
+}
+
+func (m freeCache) SetTTL(key string, v interface{}, ttl time.Duration) error {
+	return m.set(key, v, int(ttl/time.Second))
+}
+
+func (m freeCache) set(key string, v interface{}, expireSeconds int) error {
 	b, err := json.Marshal(v)
 	if err != nil {
 		return errors.Wrapf(err, "Cache: set(%v) marshal error", key)
 	}
 	hash := m.Hasher.Sum64(key)
-	err = m.Cache.SetInt(hash, b, m.ExpireSeconds)
+	err = m.Cache.SetInt(hash, b, expireSeconds)
 	if err != nil {
 		return errors.Wrapf(err, "Cache: set(%v,%s) internal error", key, b)
 	}
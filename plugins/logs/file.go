@@ -4,55 +4,154 @@ import (
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/VirgilSecurity/virgild/coreapi"
 	"github.com/namsral/flag"
 	"github.com/pkg/errors"
 )
 
-var logfile string
+var (
+	logfile      string
+	debugLogfile string
+	infoLogfile  string
+	warnLogfile  string
+	errLogfile   string
+
+	rotateMaxSize    int64
+	rotateMaxAge     time.Duration
+	rotateMaxBackups int
+	rotateCompress   bool
+)
 
 func init() {
 	flag.StringVar(&logfile, "filelogger-file", "-", "Path to log file ('-' - special parameter for colsole outut)")
+	flag.StringVar(&debugLogfile, "filelogger-debug-file", "", "Path to log file of debug records (by default filelogger-file)")
+	flag.StringVar(&infoLogfile, "filelogger-info-file", "", "Path to log file of info records (by default filelogger-file)")
+	flag.StringVar(&warnLogfile, "filelogger-warning-file", "", "Path to log file of warning records (by default filelogger-file)")
+	flag.StringVar(&errLogfile, "filelogger-error-file", "", "Path to log file of error records (by default filelogger-file)")
+	flag.Int64Var(&rotateMaxSize, "filelogger-max-size", 0, "Maximum size of log file in megabytes before rotation (0 - unlimited)")
+	flag.DurationVar(&rotateMaxAge, "filelogger-max-age", 0, "Maximum age of log file before rotation (0 - unlimited)")
+	flag.IntVar(&rotateMaxBackups, "filelogger-max-backups", 0, "Count of rotated log files to keep (0 - keep all)")
+	flag.BoolVar(&rotateCompress, "filelogger-compress", false, "Compress rotated log files with gzip")
 
 	coreapi.RegisterLogger("file", makeFileLogger)
 }
 
 func makeFileLogger() (coreapi.Logger, error) {
-	var (
-		infoOut io.Writer = os.Stdout
-		warnOut io.Writer = os.Stdout
-		errOut  io.Writer = os.Stderr
-	)
-	if logfile != "-" {
-		file, err := os.OpenFile(logfile, os.O_APPEND, 0666)
+	lvl, err := parseLevel(logLevel)
+	if err != nil {
+		return nil, errors.Wrap(err, "Make file logger")
+	}
+	cfg := rotateConfig{
+		MaxSize:    rotateMaxSize * 1024 * 1024,
+		MaxAge:     rotateMaxAge,
+		MaxBackups: rotateMaxBackups,
+		Compress:   rotateCompress,
+	}
+
+	files := make(map[string]*rotatingFile)
+	output := func(path string, console io.Writer) (io.Writer, error) {
+		if path == "" {
+			path = logfile
+		}
+		if path == "-" {
+			return console, nil
+		}
+		if f, ok := files[path]; ok {
+			return f, nil
+		}
+		f, err := openRotatingFile(path, cfg)
 		if err != nil {
-			return nil, errors.Wrapf(err, "Make file logger: open file (%v)", logfile)
+			return nil, errors.Wrap(err, "Make file logger")
 		}
-		infoOut = file
-		warnOut = file
-		errOut = file
+		files[path] = f
+		return f, nil
+	}
+
+	debugOut, err := output(debugLogfile, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	infoOut, err := output(infoLogfile, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	warnOut, err := output(warnLogfile, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	errOut, err := output(errLogfile, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) != 0 {
+		go reopenOnSignal(files)
 	}
 
+	var closers []*rotatingFile
+	for _, f := range files {
+		closers = append(closers, f)
+	}
 	return fileLogger{
-		info: log.New(infoOut, "[INFO] ", log.LUTC|log.LstdFlags|log.Lmicroseconds),
-		warn: log.New(warnOut, "[WARNING] ", log.LUTC|log.LstdFlags|log.Lmicroseconds),
-		err:  log.New(errOut, "[ERROR] ", log.LUTC|log.LstdFlags|log.Lmicroseconds),
+		files: closers,
+		level: lvl,
+		debug: log.New(debugOut, "[DEBUG] ", log.LUTC|log.LstdFlags|log.Lmicroseconds),
+		info:  log.New(infoOut, "[INFO] ", log.LUTC|log.LstdFlags|log.Lmicroseconds),
+		warn:  log.New(warnOut, "[WARNING] ", log.LUTC|log.LstdFlags|log.Lmicroseconds),
+		err:   log.New(errOut, "[ERROR] ", log.LUTC|log.LstdFlags|log.Lmicroseconds),
 	}, nil
 }
 
+// reopenOnSignal reopens log files on SIGHUP, so logs can be rotated by logrotate
+func reopenOnSignal(files map[string]*rotatingFile) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		for _, f := range files {
+			if err := f.Reopen(); err != nil {
+				os.Stderr.WriteString("File logger: " + err.Error() + "\n")
+			}
+		}
+	}
+}
+
 // FileLogger is simple logger
 type fileLogger struct {
-	info *log.Logger
-	warn *log.Logger
-	err  *log.Logger
+	files []*rotatingFile
+	level level
+	debug *log.Logger
+	info  *log.Logger
+	warn  *log.Logger
+	err   *log.Logger
 }
 
+func (l fileLogger) Close() error {
+	var first error
+	for _, f := range l.files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (l fileLogger) Debug(format string, args ...interface{}) {
+	if l.level <= levelDebug {
+		l.debug.Printf(format, args...)
+	}
+}
 func (l fileLogger) Info(format string, args ...interface{}) {
-	l.info.Printf(format, args...)
+	if l.level <= levelInfo {
+		l.info.Printf(format, args...)
+	}
 }
 func (l fileLogger) Warn(format string, args ...interface{}) {
-	l.warn.Printf(format, args...)
+	if l.level <= levelWarn {
+		l.warn.Printf(format, args...)
+	}
 }
 func (l fileLogger) Err(format string, args ...interface{}) {
 	l.err.Printf(format, args...)
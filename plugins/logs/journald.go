@@ -0,0 +1,192 @@
+package plugin_logs
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+)
+
+var journaldSocket string
+
+func init() {
+	flag.StringVar(&journaldSocket, "journald-socket", "/run/systemd/journal/socket", "Path to journald socket")
+
+	coreapi.RegisterLogger("journald", makeJournaldLogger)
+}
+
+func makeJournaldLogger() (coreapi.Logger, error) {
+	lvl, err := parseLevel(logLevel)
+	if err != nil {
+		return nil, errors.Wrap(err, "Make journald logger")
+	}
+	w := &journaldWriter{path: journaldSocket}
+	if err = w.connect(); err != nil {
+		return nil, errors.Wrap(err, "Make journald logger")
+	}
+	return journaldLogger{
+		w:          w,
+		level:      lvl,
+		identifier: syslogTag,
+	}, nil
+}
+
+// journaldWriter sends datagrams to journald socket. The connection is re-established once if sending fails
+// (e.g. journald was restarted).
+type journaldWriter struct {
+	sync.Mutex
+	path string
+	conn net.Conn
+	// err is the error of the last send (nil - the record was sent)
+	err error
+}
+
+func (w *journaldWriter) connect() error {
+	conn, err := net.Dial("unixgram", w.path)
+	if err != nil {
+		return errors.Wrapf(err, "connect to journald (%v)", w.path)
+	}
+	w.conn = conn
+	return nil
+}
+
+func (w *journaldWriter) send(b []byte) error {
+	w.Lock()
+	defer w.Unlock()
+
+	w.err = w.write(b)
+	return w.err
+}
+
+func (w *journaldWriter) write(b []byte) error {
+	if w.conn != nil {
+		if _, err := w.conn.Write(b); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	if err := w.connect(); err != nil {
+		return err
+	}
+	_, err := w.conn.Write(b)
+	return err
+}
+
+// health returns the error of the last send. If there is no connection, it's established again.
+func (w *journaldWriter) health() error {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return err
+		}
+		w.err = nil
+	}
+	return w.err
+}
+
+// journaldLogger sends records to journald with native protocol. Fields are sent as journal fields.
+type journaldLogger struct {
+	w          *journaldWriter
+	level      level
+	identifier string
+	fields     coreapi.Fields
+}
+
+func (l journaldLogger) Close() error {
+	l.w.Lock()
+	defer l.w.Unlock()
+
+	if l.w.conn == nil {
+		return nil
+	}
+	err := l.w.conn.Close()
+	l.w.conn = nil
+	return err
+}
+
+// Health reports whether records are delivered to journald
+func (l journaldLogger) Health(ctx context.Context) error {
+	return l.w.health()
+}
+
+func (l journaldLogger) WithFields(fields coreapi.Fields) coreapi.Logger {
+	l.fields = mergeFields(l.fields, fields)
+	return l
+}
+
+func (l journaldLogger) Debug(format string, args ...interface{}) {
+	l.log(levelDebug, format, args...)
+}
+func (l journaldLogger) Info(format string, args ...interface{}) {
+	l.log(levelInfo, format, args...)
+}
+func (l journaldLogger) Warn(format string, args ...interface{}) {
+	l.log(levelWarn, format, args...)
+}
+func (l journaldLogger) Err(format string, args ...interface{}) {
+	l.log(levelErr, format, args...)
+}
+
+func (l journaldLogger) log(lvl level, format string, args ...interface{}) {
+	if lvl < l.level {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+
+	var b bytes.Buffer
+	writeJournalField(&b, "MESSAGE", msg)
+	writeJournalField(&b, "PRIORITY", fmt.Sprint(syslogSeverities[lvl]))
+	writeJournalField(&b, "SYSLOG_IDENTIFIER", l.identifier)
+	for _, k := range sortedKeys(l.fields) {
+		writeJournalField(&b, journalFieldName(k), fmt.Sprint(l.fields[k]))
+	}
+
+	if err := l.w.send(b.Bytes()); err != nil {
+		fmt.Fprintf(os.Stderr, "Journald logger: %v\n%v\n", err, msg)
+	}
+}
+
+// writeJournalField writes field in journald native format. Values with new lines are length-prefixed.
+func writeJournalField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalFieldName converts field name to journal field name: upper case letters, digits and underscores
+// which doesn't start with underscore (such fields are reserved by journald)
+func journalFieldName(s string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+			return r
+		}
+		return '_'
+	}, s)
+	name = strings.TrimLeft(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "F_" + name
+	}
+	return name
+}
@@ -0,0 +1,124 @@
+package plugin_logs
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteJournalField_SingleLine_NameEqualsValue(t *testing.T) {
+	var b bytes.Buffer
+	writeJournalField(&b, "MESSAGE", "card created")
+
+	assert.Equal(t, "MESSAGE=card created\n", b.String())
+}
+
+func TestWriteJournalField_MultiLine_LengthPrefixed(t *testing.T) {
+	var b bytes.Buffer
+	writeJournalField(&b, "MESSAGE", "a\nb")
+
+	var expected bytes.Buffer
+	expected.WriteString("MESSAGE\n")
+	binary.Write(&expected, binary.LittleEndian, uint64(3))
+	expected.WriteString("a\nb\n")
+	assert.Equal(t, expected.Bytes(), b.Bytes())
+}
+
+func TestJournalFieldName(t *testing.T) {
+	cases := map[string]string{
+		"request_id": "REQUEST_ID",
+		"latency-ms": "LATENCY_MS",
+		"_reserved":  "RESERVED",
+		"1st":        "F_1ST",
+		"__":         "F_",
+	}
+	for name, expected := range cases {
+		assert.Equal(t, expected, journalFieldName(name), name)
+	}
+}
+
+func TestJournaldLogger_Record_SendFields(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journald")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "socket")
+	server := listenUnixgram(t, path)
+	defer server.Close()
+
+	w := &journaldWriter{path: path}
+	require.NoError(t, w.connect())
+	l := journaldLogger{w: w, level: levelInfo, identifier: "virgild"}
+	defer l.Close()
+
+	l.Debug("skipped")
+	l.WithFields(coreapi.Fields{"route": "get_card"}).Warn("msg")
+
+	assert.Equal(t, "MESSAGE=msg\nPRIORITY=4\nSYSLOG_IDENTIFIER=virgild\nROUTE=get_card\n", readDatagram(t, server))
+}
+
+func TestJournaldWriter_SocketRecreated_Reconnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journald")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "socket")
+
+	server := listenUnixgram(t, path)
+	w := &journaldWriter{path: path}
+	require.NoError(t, w.connect())
+	defer w.conn.Close()
+	require.NoError(t, w.send([]byte("MESSAGE=first\n")))
+	assert.Equal(t, "MESSAGE=first\n", readDatagram(t, server))
+
+	// journald is restarted
+	server.Close()
+	os.Remove(path)
+	server = listenUnixgram(t, path)
+	defer server.Close()
+
+	assert.NoError(t, w.send([]byte("MESSAGE=second\n")))
+	assert.Equal(t, "MESSAGE=second\n", readDatagram(t, server))
+}
+
+func TestJournaldWriter_SocketGone_ReturnErr(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journald")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	w := &journaldWriter{path: filepath.Join(dir, "socket")}
+
+	assert.Error(t, w.send([]byte("MESSAGE=msg\n")))
+}
+
+func TestJournaldLoggerHealth_SocketGoneAndRecreated_ReportAndRecover(t *testing.T) {
+	var _ coreapi.HealthChecker = journaldLogger{}
+	dir, err := ioutil.TempDir("", "journald")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "socket")
+	server := listenUnixgram(t, path)
+
+	w := &journaldWriter{path: path}
+	require.NoError(t, w.connect())
+	l := journaldLogger{w: w, level: levelInfo, identifier: "virgild"}
+	defer l.Close()
+	l.Info("first")
+	assert.NoError(t, l.Health(context.Background()))
+
+	// journald is stopped
+	server.Close()
+	os.Remove(path)
+	l.Info("lost")
+	assert.Error(t, l.Health(context.Background()))
+
+	server = listenUnixgram(t, path)
+	defer server.Close()
+	assert.NoError(t, l.Health(context.Background()))
+}
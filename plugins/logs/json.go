@@ -0,0 +1,118 @@
+package plugin_logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+)
+
+var jsonLogfile string
+
+func init() {
+	flag.StringVar(&jsonLogfile, "jsonlogger-file", "-", "Path to log file of json logger ('-' - special parameter for colsole outut)")
+
+	coreapi.RegisterLogger("json", makeJSONLogger)
+}
+
+func makeJSONLogger() (coreapi.Logger, error) {
+	lvl, err := parseLevel(logLevel)
+	if err != nil {
+		return nil, errors.Wrap(err, "Make json logger")
+	}
+	var out io.Writer = os.Stdout
+	if jsonLogfile != "-" {
+		file, err := os.OpenFile(jsonLogfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Make json logger: open file (%v)", jsonLogfile)
+		}
+		out = file
+	}
+	l := newJSONLogger(out, lvl)
+	if out != os.Stdout {
+		l.closer = out.(io.Closer)
+	}
+	return l, nil
+}
+
+func newJSONLogger(out io.Writer, lvl level) jsonLogger {
+	return jsonLogger{
+		mu:    new(sync.Mutex),
+		out:   out,
+		level: lvl,
+		now:   time.Now,
+	}
+}
+
+// jsonLogger writes every record as a JSON object on a separate line
+type jsonLogger struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	closer io.Closer
+	level  level
+	fields coreapi.Fields
+	now    func() time.Time
+}
+
+func (l jsonLogger) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closer.Close()
+}
+
+func (l jsonLogger) WithFields(fields coreapi.Fields) coreapi.Logger {
+	l.fields = mergeFields(l.fields, fields)
+	return l
+}
+
+func (l jsonLogger) Debug(format string, args ...interface{}) {
+	l.log(levelDebug, format, args...)
+}
+func (l jsonLogger) Info(format string, args ...interface{}) {
+	l.log(levelInfo, format, args...)
+}
+func (l jsonLogger) Warn(format string, args ...interface{}) {
+	l.log(levelWarn, format, args...)
+}
+func (l jsonLogger) Err(format string, args ...interface{}) {
+	l.log(levelErr, format, args...)
+}
+
+func (l jsonLogger) log(lvl level, format string, args ...interface{}) {
+	if lvl < l.level {
+		return
+	}
+	record := make(map[string]interface{}, len(l.fields)+3)
+	for k, v := range l.fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		record[k] = v
+	}
+	record["time"] = l.now().UTC().Format(time.RFC3339Nano)
+	record["level"] = lvl.String()
+	record["msg"] = fmt.Sprintf(format, args...)
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		b, _ = json.Marshal(map[string]interface{}{
+			"time":  record["time"],
+			"level": record["level"],
+			"msg":   record["msg"],
+			"error": fmt.Sprintf("cannot marshal log fields: %v", err),
+		})
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(append(b, '\n'))
+}
@@ -0,0 +1,94 @@
+package plugin_logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestJSONLogger(lvl level) (jsonLogger, *bytes.Buffer) {
+	buf := new(bytes.Buffer)
+	l := newJSONLogger(buf, lvl)
+	l.now = func() time.Time { return time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC) }
+	return l, buf
+}
+
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var r map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &r))
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestJSONLogger_Record_OneObjectPerLine(t *testing.T) {
+	l, buf := newTestJSONLogger(levelInfo)
+	l.Info("card %v", "123")
+	l.Err("failed")
+
+	records := decodeRecords(t, buf)
+	assert.Equal(t, []map[string]interface{}{
+		{"time": "2017-01-02T03:04:05Z", "level": "info", "msg": "card 123"},
+		{"time": "2017-01-02T03:04:05Z", "level": "error", "msg": "failed"},
+	}, records)
+}
+
+func TestJSONLogger_BelowLevel_Skipped(t *testing.T) {
+	l, buf := newTestJSONLogger(levelWarn)
+	l.Debug("debug")
+	l.Info("info")
+	l.Warn("warn")
+
+	records := decodeRecords(t, buf)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "warning", records[0]["level"])
+}
+
+func TestJSONLogger_WithFields_FieldsMergedAndParentUnchanged(t *testing.T) {
+	l, buf := newTestJSONLogger(levelDebug)
+	fl := coreapi.WithFields(coreapi.WithFields(l, coreapi.Fields{"route": "get_card", "id": 1}), coreapi.Fields{"id": 2})
+	fl.Info("child")
+	l.Info("parent")
+
+	records := decodeRecords(t, buf)
+	assert.Equal(t, "get_card", records[0]["route"])
+	assert.Equal(t, float64(2), records[0]["id"])
+	assert.NotContains(t, records[1], "route")
+}
+
+func TestJSONLogger_ErrorField_WriteMessage(t *testing.T) {
+	l, buf := newTestJSONLogger(levelInfo)
+	l.WithFields(coreapi.Fields{"error": errors.New("boom")}).Err("failed")
+
+	records := decodeRecords(t, buf)
+	assert.Equal(t, "boom", records[0]["error"])
+}
+
+func TestJSONLogger_UnmarshalableField_WriteRecordWithError(t *testing.T) {
+	l, buf := newTestJSONLogger(levelInfo)
+	l.WithFields(coreapi.Fields{"ch": make(chan int)}).Info("msg")
+
+	records := decodeRecords(t, buf)
+	assert.Equal(t, "msg", records[0]["msg"])
+	assert.Contains(t, records[0]["error"], "cannot marshal log fields")
+	assert.NotContains(t, records[0], "ch")
+}
+
+func TestJSONLogger_Debug_ImplementDebugLogger(t *testing.T) {
+	l, buf := newTestJSONLogger(levelDebug)
+	coreapi.Debug(coreapi.WithFields(l, coreapi.Fields{"a": 1}), "debug")
+
+	records := decodeRecords(t, buf)
+	assert.Equal(t, "debug", records[0]["level"])
+}
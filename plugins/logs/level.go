@@ -0,0 +1,73 @@
+package plugin_logs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/namsral/flag"
+)
+
+type level int
+
+const (
+	levelDebug level = iota
+	levelInfo
+	levelWarn
+	levelErr
+)
+
+func (l level) String() string {
+	switch l {
+	case levelDebug:
+		return "debug"
+	case levelWarn:
+		return "warning"
+	case levelErr:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+var logLevel string
+
+func init() {
+	flag.StringVar(&logLevel, "logger-level", "info", "Minimal level of log records (debug, info, warning, error)")
+}
+
+func parseLevel(s string) (level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return levelDebug, nil
+	case "", "info":
+		return levelInfo, nil
+	case "warn", "warning":
+		return levelWarn, nil
+	case "err", "error":
+		return levelErr, nil
+	}
+	return levelInfo, fmt.Errorf("Unknown log level (%v)", s)
+}
+
+func mergeFields(a, b coreapi.Fields) coreapi.Fields {
+	merged := make(coreapi.Fields, len(a)+len(b))
+	for k, v := range a {
+		merged[k] = v
+	}
+	for k, v := range b {
+		merged[k] = v
+	}
+	return merged
+}
+
+// sortedKeys returns keys of the fields in stable order
+func sortedKeys(fields coreapi.Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
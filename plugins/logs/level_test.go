@@ -0,0 +1,51 @@
+package plugin_logs
+
+import (
+	"testing"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLevel_KnownNames_ReturnLevel(t *testing.T) {
+	cases := map[string]level{
+		"debug":   levelDebug,
+		"":        levelInfo,
+		"info":    levelInfo,
+		" INFO ":  levelInfo,
+		"warn":    levelWarn,
+		"Warning": levelWarn,
+		"err":     levelErr,
+		"error":   levelErr,
+	}
+	for s, expected := range cases {
+		lvl, err := parseLevel(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, lvl, s)
+	}
+}
+
+func TestParseLevel_Unknown_ReturnErr(t *testing.T) {
+	_, err := parseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestLevelString_ParseBack_SameLevel(t *testing.T) {
+	for _, lvl := range []level{levelDebug, levelInfo, levelWarn, levelErr} {
+		parsed, err := parseLevel(lvl.String())
+		assert.NoError(t, err)
+		assert.Equal(t, lvl, parsed)
+	}
+}
+
+func TestMergeFields_Override_InputsUnchanged(t *testing.T) {
+	a := coreapi.Fields{"a": 1, "b": 2}
+	b := coreapi.Fields{"b": 3}
+
+	assert.Equal(t, coreapi.Fields{"a": 1, "b": 3}, mergeFields(a, b))
+	assert.Equal(t, coreapi.Fields{"a": 1, "b": 2}, a)
+}
+
+func TestSortedKeys_ReturnSorted(t *testing.T) {
+	assert.Equal(t, []string{"a", "b", "c"}, sortedKeys(coreapi.Fields{"c": 1, "a": 2, "b": 3}))
+}
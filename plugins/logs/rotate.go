@@ -0,0 +1,202 @@
+package plugin_logs
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+	// rotateRetryInterval is the delay before the next rotation after the failed one
+	rotateRetryInterval = time.Minute
+)
+
+type rotateConfig struct {
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+	Compress   bool
+}
+
+// rotatingFile is a log file which is renamed to <path>.<time> when it exceeds MaxSize or becomes older than MaxAge.
+// Only MaxBackups newest backups are kept (0 - keep all).
+type rotatingFile struct {
+	sync.Mutex
+	path string
+	cfg  rotateConfig
+	file *os.File
+	size int64
+	// startedAt is the time of the first record of the file. Records of an existing file are counted from
+	// its modification time, so restarts don't postpone rotation.
+	startedAt time.Time
+	retryAt   time.Time
+	now       func() time.Time
+
+	// cleanup serializes compression and removing of backups
+	cleanup sync.Mutex
+}
+
+func openRotatingFile(path string, cfg rotateConfig) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, cfg: cfg, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return errors.Wrapf(err, "Open log file (%v)", f.path)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrapf(err, "Stat log file (%v)", f.path)
+	}
+	f.file = file
+	f.size = info.Size()
+	f.startedAt = f.now()
+	if f.size != 0 {
+		f.startedAt = info.ModTime()
+	}
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.needRotate(int64(len(p))) {
+		// records are kept in the current file if it cannot be rotated
+		if err := f.rotate(); err != nil {
+			f.retryAt = f.now().Add(rotateRetryInterval)
+			os.Stderr.WriteString("Log rotation: " + err.Error() + "\n")
+		}
+	}
+	if f.size == 0 {
+		f.startedAt = f.now()
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) needRotate(n int64) bool {
+	if f.size == 0 || f.now().Before(f.retryAt) {
+		return false
+	}
+	if f.cfg.MaxSize > 0 && f.size+n > f.cfg.MaxSize {
+		return true
+	}
+	return f.cfg.MaxAge > 0 && f.now().Sub(f.startedAt) >= f.cfg.MaxAge
+}
+
+// Reopen opens the file again. It's used after the file was moved by external tool (e.g. logrotate).
+// The current file is kept if the new one cannot be opened.
+func (f *rotatingFile) Reopen() error {
+	f.Lock()
+	defer f.Unlock()
+
+	old := f.file
+	if err := f.open(); err != nil {
+		return err
+	}
+	return old.Close()
+}
+
+func (f *rotatingFile) Close() error {
+	f.Lock()
+	defer f.Unlock()
+
+	if err := f.file.Sync(); err != nil {
+		return errors.Wrapf(err, "Sync log file (%v)", f.path)
+	}
+	return f.file.Close()
+}
+
+// rotate renames the file and opens the new one. The current file stays open until the new one is opened,
+// so a failed rotation doesn't lose records.
+func (f *rotatingFile) rotate() error {
+	backup := f.path + "." + f.now().UTC().Format(backupTimeFormat)
+	if err := os.Rename(f.path, backup); err != nil {
+		return errors.Wrapf(err, "Rotate log file (%v)", f.path)
+	}
+	old := f.file
+	if err := f.open(); err != nil {
+		if rerr := os.Rename(backup, f.path); rerr != nil {
+			os.Stderr.WriteString("Log rotation: " + rerr.Error() + "\n")
+		}
+		return err
+	}
+	old.Close()
+	go f.clean(backup)
+	return nil
+}
+
+func (f *rotatingFile) clean(backup string) {
+	f.cleanup.Lock()
+	defer f.cleanup.Unlock()
+
+	if f.cfg.Compress {
+		if err := compressFile(backup); err != nil {
+			os.Stderr.WriteString("Log rotation: " + err.Error() + "\n")
+		}
+	}
+	if f.cfg.MaxBackups <= 0 {
+		return
+	}
+	backups := f.backups()
+	for len(backups) > f.cfg.MaxBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
+
+// backups returns backups of the file from the oldest to the newest
+func (f *rotatingFile) backups() []string {
+	matches, _ := filepath.Glob(f.path + ".*")
+	var backups []string
+	for _, m := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(m, f.path+"."), ".gz")
+		if _, err := time.Parse(backupTimeFormat, suffix); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	sort.Strings(backups)
+	return backups
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "open backup (%v)", path)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return errors.Wrapf(err, "create compressed backup (%v)", path)
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return errors.Wrapf(err, "compress backup (%v)", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,151 @@
+package plugin_logs
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) now() time.Time {
+	return c.t
+}
+
+func openTestRotatingFile(t *testing.T, cfg rotateConfig) (*rotatingFile, *testClock, func()) {
+	dir, err := ioutil.TempDir("", "rotate")
+	require.NoError(t, err)
+	clock := &testClock{t: time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)}
+
+	f, err := openRotatingFile(filepath.Join(dir, "virgild.log"), cfg)
+	require.NoError(t, err)
+	f.now = clock.now
+	f.startedAt = clock.now()
+	return f, clock, func() {
+		f.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestRotatingFile_MaxSizeExceeded_Rotate(t *testing.T) {
+	f, clock, cleanup := openTestRotatingFile(t, rotateConfig{MaxSize: 10})
+	defer cleanup()
+
+	f.Write([]byte("12345678\n"))
+	f.Write([]byte("abc\n"))
+
+	backup := f.path + "." + clock.t.Format(backupTimeFormat)
+	assert.Equal(t, "12345678\n", readFile(t, backup))
+	assert.Equal(t, "abc\n", readFile(t, f.path))
+}
+
+func TestRotatingFile_MaxSizeNotExceeded_NoRotate(t *testing.T) {
+	f, _, cleanup := openTestRotatingFile(t, rotateConfig{MaxSize: 10})
+	defer cleanup()
+
+	f.Write([]byte("1234\n"))
+	f.Write([]byte("5678\n"))
+
+	assert.Empty(t, f.backups())
+	assert.Equal(t, "1234\n5678\n", readFile(t, f.path))
+}
+
+func TestRotatingFile_MaxAgeExceeded_Rotate(t *testing.T) {
+	f, clock, cleanup := openTestRotatingFile(t, rotateConfig{MaxAge: time.Hour})
+	defer cleanup()
+
+	f.Write([]byte("old\n"))
+	clock.t = clock.t.Add(time.Hour)
+	f.Write([]byte("new\n"))
+
+	backup := f.path + "." + clock.t.Format(backupTimeFormat)
+	assert.Equal(t, "old\n", readFile(t, backup))
+	assert.Equal(t, "new\n", readFile(t, f.path))
+}
+
+func TestRotatingFile_ExistingFileOlderThanMaxAge_RotateOnFirstWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "virgild.log")
+	require.NoError(t, ioutil.WriteFile(path, []byte("old\n"), 0666))
+	modTime := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+
+	f, err := openRotatingFile(path, rotateConfig{MaxAge: time.Hour})
+	require.NoError(t, err)
+	defer f.Close()
+	f.Write([]byte("new\n"))
+
+	assert.Len(t, f.backups(), 1)
+	assert.Equal(t, "new\n", readFile(t, path))
+}
+
+func TestRotatingFile_RenameFailed_KeepWritingCurrentFile(t *testing.T) {
+	f, clock, cleanup := openTestRotatingFile(t, rotateConfig{MaxSize: 5})
+	defer cleanup()
+	// a non-empty directory with the name of the backup makes the rename fail
+	backup := f.path + "." + clock.t.Format(backupTimeFormat)
+	require.NoError(t, os.MkdirAll(filepath.Join(backup, "dir"), 0777))
+
+	f.Write([]byte("1234\n"))
+	n, err := f.Write([]byte("5678\n"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, "1234\n5678\n", readFile(t, f.path))
+	assert.Equal(t, clock.t.Add(rotateRetryInterval), f.retryAt)
+}
+
+func TestRotatingFileClean_MaxBackups_RemoveOldest(t *testing.T) {
+	f, clock, cleanup := openTestRotatingFile(t, rotateConfig{MaxBackups: 2})
+	defer cleanup()
+	var backups []string
+	for i := 0; i < 4; i++ {
+		b := f.path + "." + clock.t.Add(time.Duration(i)*time.Minute).Format(backupTimeFormat)
+		require.NoError(t, ioutil.WriteFile(b, []byte("backup\n"), 0666))
+		backups = append(backups, b)
+	}
+	other := f.path + ".other"
+	require.NoError(t, ioutil.WriteFile(other, []byte("other\n"), 0666))
+
+	f.clean(backups[3])
+
+	assert.Equal(t, backups[2:], f.backups())
+	assert.FileExists(t, other)
+}
+
+func TestRotatingFileClean_Compress_ReplaceBackupByGzip(t *testing.T) {
+	f, clock, cleanup := openTestRotatingFile(t, rotateConfig{Compress: true})
+	defer cleanup()
+	backup := f.path + "." + clock.t.Format(backupTimeFormat)
+	require.NoError(t, ioutil.WriteFile(backup, []byte("backup\n"), 0666))
+
+	f.clean(backup)
+
+	_, err := os.Stat(backup)
+	assert.True(t, os.IsNotExist(err))
+	gzFile, err := os.Open(backup + ".gz")
+	require.NoError(t, err)
+	defer gzFile.Close()
+	gz, err := gzip.NewReader(gzFile)
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(gz)
+	assert.NoError(t, err)
+	assert.Equal(t, "backup\n", string(b))
+	assert.Equal(t, []string{backup + ".gz"}, f.backups())
+}
@@ -0,0 +1,363 @@
+package plugin_logs
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+)
+
+var (
+	syslogAddress  string
+	syslogFacility string
+	syslogTag      string
+	syslogSDID     string
+)
+
+func init() {
+	flag.StringVar(&syslogAddress, "syslog-address", "", "Syslog server address (udp://host:port or tcp://host:port, empty - local syslog socket)")
+	flag.StringVar(&syslogFacility, "syslog-facility", "daemon", "Syslog facility (daemon, user, local0-local7)")
+	flag.StringVar(&syslogTag, "syslog-tag", "virgild", "Application name of syslog and journald records")
+	flag.StringVar(&syslogSDID, "syslog-sd-id", "", "SD-ID of structured data with record fields (name@<private enterprise number>, empty - fields are written to the message)")
+
+	coreapi.RegisterLogger("syslog", makeSyslogLogger)
+}
+
+var syslogFacilities = map[string]int{
+	"user":   1,
+	"daemon": 3,
+	"local0": 16,
+	"local1": 17,
+	"local2": 18,
+	"local3": 19,
+	"local4": 20,
+	"local5": 21,
+	"local6": 22,
+	"local7": 23,
+}
+
+// syslog severities of log levels
+var syslogSeverities = map[level]int{
+	levelDebug: 7,
+	levelInfo:  6,
+	levelWarn:  4,
+	levelErr:   3,
+}
+
+var localSyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// sdIDPattern is SD-ID of structured data which isn't registered by IANA (RFC 5424, section 6.3.2)
+var sdIDPattern = regexp.MustCompile(`^[!#-<>-\\^-~]+@[1-9][0-9]*(\.[0-9]+)*$`)
+
+func makeSyslogLogger() (coreapi.Logger, error) {
+	lvl, err := parseLevel(logLevel)
+	if err != nil {
+		return nil, errors.Wrap(err, "Make syslog logger")
+	}
+	facility, ok := syslogFacilities[strings.ToLower(syslogFacility)]
+	if !ok {
+		return nil, fmt.Errorf("Make syslog logger: unknown facility (%v)", syslogFacility)
+	}
+	if syslogSDID != "" && (!sdIDPattern.MatchString(syslogSDID) || len(syslogSDID) > 32) {
+		return nil, fmt.Errorf("Make syslog logger: SD-ID (%v) must be name@<private enterprise number>", syslogSDID)
+	}
+	network, addr, err := parseSyslogAddress(syslogAddress)
+	if err != nil {
+		return nil, errors.Wrap(err, "Make syslog logger")
+	}
+	hostname, _ := os.Hostname()
+
+	w := &syslogWriter{network: network, addr: addr}
+	if err = w.connect(); err != nil {
+		return nil, errors.Wrap(err, "Make syslog logger")
+	}
+	return syslogLogger{
+		w:        w,
+		level:    lvl,
+		facility: facility,
+		hostname: hostname,
+		tag:      syslogTag,
+		sdID:     syslogSDID,
+		pid:      os.Getpid(),
+		now:      time.Now,
+	}, nil
+}
+
+func parseSyslogAddress(s string) (network, addr string, err error) {
+	if s == "" {
+		return "unixgram", "", nil
+	}
+	parts := strings.SplitN(s, "://", 2)
+	if len(parts) != 2 || (parts[0] != "udp" && parts[0] != "tcp") {
+		return "", "", fmt.Errorf("Syslog address (%v) must be udp://host:port or tcp://host:port", s)
+	}
+	return parts[0], parts[1], nil
+}
+
+// syslogWriter sends messages to syslog server. TCP messages are framed with octet counting (RFC 6587).
+// The connection is re-established if sending fails. After a failed attempt messages are dropped until
+// the backoff passes, remote servers are dialed in background, so log calls don't wait for syslog.
+type syslogWriter struct {
+	sync.Mutex
+	network string
+	addr    string
+	conn    net.Conn
+	// stream is set if local syslog socket is a stream socket
+	stream bool
+	// err is the error of the last send (nil - the record was sent)
+	err error
+	// retryAt is time of the next attempt to connect after failure
+	retryAt time.Time
+	backoff time.Duration
+	dialing bool
+	closed  bool
+}
+
+const (
+	syslogMinBackoff = time.Second
+	syslogMaxBackoff = 30 * time.Second
+)
+
+func (w *syslogWriter) connect() error {
+	conn, stream, err := w.dial()
+	if err != nil {
+		return err
+	}
+	w.conn, w.stream = conn, stream
+	return nil
+}
+
+// dial connects to syslog, it doesn't change the state of the writer
+func (w *syslogWriter) dial() (net.Conn, bool, error) {
+	if w.network != "unixgram" {
+		conn, err := net.DialTimeout(w.network, w.addr, 5*time.Second)
+		if err != nil {
+			return nil, false, errors.Wrapf(err, "connect to syslog (%v://%v)", w.network, w.addr)
+		}
+		return conn, false, nil
+	}
+	for _, path := range localSyslogSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			conn, err := net.Dial(network, path)
+			if err == nil {
+				return conn, network == "unix", nil
+			}
+		}
+	}
+	return nil, false, fmt.Errorf("connect to local syslog: no socket found (%v)", strings.Join(localSyslogSockets, ", "))
+}
+
+func (w *syslogWriter) send(msg string) error {
+	w.Lock()
+	defer w.Unlock()
+
+	w.err = w.write(msg)
+	return w.err
+}
+
+func (w *syslogWriter) write(msg string) error {
+	if w.conn != nil {
+		if _, err := w.conn.Write(w.frame(msg)); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	if w.dialing || time.Now().Before(w.retryAt) {
+		return fmt.Errorf("syslog is disconnected, the record is dropped")
+	}
+	if w.network != "unixgram" {
+		// dialing a remote server may take seconds
+		w.dialing = true
+		go w.reconnect()
+		return fmt.Errorf("syslog is disconnected, the record is dropped while reconnecting")
+	}
+	if err := w.connect(); err != nil {
+		w.failed()
+		return err
+	}
+	w.backoff = 0
+	_, err := w.conn.Write(w.frame(msg))
+	return err
+}
+
+// reconnect dials syslog in background
+func (w *syslogWriter) reconnect() {
+	conn, stream, err := w.dial()
+
+	w.Lock()
+	defer w.Unlock()
+	w.dialing = false
+	if err != nil {
+		w.err = err
+		w.failed()
+		return
+	}
+	if w.conn != nil || w.closed {
+		conn.Close()
+		return
+	}
+	w.conn, w.stream, w.backoff = conn, stream, 0
+}
+
+// failed doubles the backoff of connection attempts, it's called under lock
+func (w *syslogWriter) failed() {
+	w.backoff *= 2
+	if w.backoff < syslogMinBackoff {
+		w.backoff = syslogMinBackoff
+	}
+	if w.backoff > syslogMaxBackoff {
+		w.backoff = syslogMaxBackoff
+	}
+	w.retryAt = time.Now().Add(w.backoff)
+}
+
+// health returns the error of the last send. If there is no connection, it's established again.
+func (w *syslogWriter) health() error {
+	w.Lock()
+	if w.conn != nil || w.dialing {
+		defer w.Unlock()
+		return w.err
+	}
+	w.Unlock()
+
+	conn, stream, err := w.dial()
+
+	w.Lock()
+	defer w.Unlock()
+	if err != nil {
+		return err
+	}
+	if w.conn != nil {
+		conn.Close()
+		return w.err
+	}
+	w.conn, w.stream, w.backoff, w.err = conn, stream, 0, nil
+	return nil
+}
+
+func (w *syslogWriter) frame(msg string) []byte {
+	switch {
+	case w.network == "tcp":
+		return []byte(fmt.Sprintf("%d %s", len(msg), msg))
+	case w.stream:
+		return []byte(msg + "\n")
+	}
+	return []byte(msg)
+}
+
+// syslogLogger formats records according to RFC 5424. Fields are sent as structured data if SD-ID is configured.
+type syslogLogger struct {
+	w        *syslogWriter
+	level    level
+	facility int
+	hostname string
+	tag      string
+	// sdID is SD-ID of the fields (empty - fields are written to the message)
+	sdID   string
+	pid    int
+	fields coreapi.Fields
+	now    func() time.Time
+}
+
+func (l syslogLogger) Close() error {
+	l.w.Lock()
+	defer l.w.Unlock()
+
+	l.w.closed = true
+	if l.w.conn == nil {
+		return nil
+	}
+	err := l.w.conn.Close()
+	l.w.conn = nil
+	return err
+}
+
+// Health reports whether records are delivered to syslog
+func (l syslogLogger) Health(ctx context.Context) error {
+	return l.w.health()
+}
+
+func (l syslogLogger) WithFields(fields coreapi.Fields) coreapi.Logger {
+	l.fields = mergeFields(l.fields, fields)
+	return l
+}
+
+func (l syslogLogger) Debug(format string, args ...interface{}) {
+	l.log(levelDebug, format, args...)
+}
+func (l syslogLogger) Info(format string, args ...interface{}) {
+	l.log(levelInfo, format, args...)
+}
+func (l syslogLogger) Warn(format string, args ...interface{}) {
+	l.log(levelWarn, format, args...)
+}
+func (l syslogLogger) Err(format string, args ...interface{}) {
+	l.log(levelErr, format, args...)
+}
+
+func (l syslogLogger) log(lvl level, format string, args ...interface{}) {
+	if lvl < l.level {
+		return
+	}
+	msg := l.format(lvl, fmt.Sprintf(format, args...))
+	if err := l.w.send(msg); err != nil {
+		fmt.Fprintf(os.Stderr, "Syslog logger: %v\n%v\n", err, msg)
+	}
+}
+
+func (l syslogLogger) format(lvl level, msg string) string {
+	sd := "-"
+	if len(l.fields) != 0 && l.sdID != "" {
+		params := make([]string, 0, len(l.fields))
+		for _, k := range sortedKeys(l.fields) {
+			params = append(params, fmt.Sprintf(`%s="%s"`, sdName(k), sdEscape(fmt.Sprint(l.fields[k]))))
+		}
+		sd = "[" + l.sdID + " " + strings.Join(params, " ") + "]"
+	} else if len(l.fields) != 0 {
+		pairs := make([]string, 0, len(l.fields))
+		for _, k := range sortedKeys(l.fields) {
+			pairs = append(pairs, fmt.Sprintf("%v=%v", k, l.fields[k]))
+		}
+		msg = "[" + strings.Join(pairs, " ") + "] " + msg
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d - %s %s",
+		l.facility*8+syslogSeverities[lvl],
+		l.now().UTC().Format(time.RFC3339Nano),
+		nilValue(l.hostname),
+		nilValue(l.tag),
+		l.pid,
+		sd,
+		msg)
+}
+
+func nilValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.Replace(s, " ", "_", -1)
+}
+
+// sdName removes characters which are not allowed in structured data names
+func sdName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= 32 || r >= 127 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func sdEscape(s string) string {
+	return sdEscaper.Replace(s)
+}
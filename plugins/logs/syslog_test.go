@@ -0,0 +1,221 @@
+package plugin_logs
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSyslogLogger(sdID string) syslogLogger {
+	return syslogLogger{
+		level:    levelInfo,
+		facility: 3,
+		hostname: "host 1",
+		tag:      "virgild",
+		sdID:     sdID,
+		pid:      42,
+		now:      func() time.Time { return time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+}
+
+// listenUnixgram listens datagram socket in temp directory
+func listenUnixgram(t *testing.T, path string) *net.UnixConn {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	return conn
+}
+
+func readDatagram(t *testing.T, conn *net.UnixConn) string {
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestParseSyslogAddress(t *testing.T) {
+	network, addr, err := parseSyslogAddress("")
+	assert.NoError(t, err)
+	assert.Equal(t, "unixgram", network)
+	assert.Equal(t, "", addr)
+
+	network, addr, err = parseSyslogAddress("tcp://logs:514")
+	assert.NoError(t, err)
+	assert.Equal(t, "tcp", network)
+	assert.Equal(t, "logs:514", addr)
+
+	_, _, err = parseSyslogAddress("http://logs:514")
+	assert.Error(t, err)
+	_, _, err = parseSyslogAddress("logs:514")
+	assert.Error(t, err)
+}
+
+func TestSDIDPattern(t *testing.T) {
+	for _, id := range []string{"virgild@12345", "fields@1.3.6"} {
+		assert.True(t, sdIDPattern.MatchString(id), id)
+	}
+	for _, id := range []string{"fields", "my fields@123", `a"b@123`, "a=b@123", "fields@", "fields@0"} {
+		assert.False(t, sdIDPattern.MatchString(id), id)
+	}
+}
+
+func TestSyslogLoggerFormat_WithoutFields_NilStructuredData(t *testing.T) {
+	l := newTestSyslogLogger("")
+
+	assert.Equal(t, "<30>1 2017-01-02T03:04:05Z host_1 virgild 42 - - card created", l.format(levelInfo, "card created"))
+	assert.Equal(t, "<27>1 2017-01-02T03:04:05Z host_1 virgild 42 - - failed", l.format(levelErr, "failed"))
+}
+
+func TestSyslogLoggerFormat_FieldsWithoutSDID_FieldsInMessage(t *testing.T) {
+	l := newTestSyslogLogger("").WithFields(coreapi.Fields{"route": "get_card", "id": 1}).(syslogLogger)
+
+	assert.Equal(t, "<30>1 2017-01-02T03:04:05Z host_1 virgild 42 - - [id=1 route=get_card] msg", l.format(levelInfo, "msg"))
+}
+
+func TestSyslogLoggerFormat_FieldsWithSDID_StructuredData(t *testing.T) {
+	l := newTestSyslogLogger("virgild@12345").WithFields(coreapi.Fields{"route": "get_card", "bad name": `a"b]c\`}).(syslogLogger)
+
+	assert.Equal(t,
+		`<30>1 2017-01-02T03:04:05Z host_1 virgild 42 - [virgild@12345 bad_name="a\"b\]c\\" route="get_card"] msg`,
+		l.format(levelInfo, "msg"))
+}
+
+func TestSyslogLogger_BelowLevel_NotSent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syslog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log")
+	server := listenUnixgram(t, path)
+	defer server.Close()
+	conn, err := net.Dial("unixgram", path)
+	require.NoError(t, err)
+
+	l := newTestSyslogLogger("")
+	l.level = levelWarn
+	l.w = &syslogWriter{network: "unixgram", conn: conn}
+	defer l.Close()
+	l.Info("skipped")
+	l.Warn("sent")
+
+	assert.Equal(t, "<28>1 2017-01-02T03:04:05Z host_1 virgild 42 - - sent", readDatagram(t, server))
+}
+
+func TestSyslogWriter_TCP_OctetCountingFrame(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	w := &syslogWriter{network: "tcp", addr: ln.Addr().String()}
+	require.NoError(t, w.connect())
+	defer w.conn.Close()
+	server, err := ln.Accept()
+	require.NoError(t, err)
+	defer server.Close()
+
+	require.NoError(t, w.send("<30>1 msg"))
+	buf := make([]byte, 64)
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := server.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "9 <30>1 msg", string(buf[:n]))
+}
+
+func TestSyslogWriter_LocalSocketRecreated_Reconnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syslog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log")
+	sockets := localSyslogSockets
+	localSyslogSockets = []string{path}
+	defer func() { localSyslogSockets = sockets }()
+
+	server := listenUnixgram(t, path)
+	w := &syslogWriter{network: "unixgram"}
+	require.NoError(t, w.connect())
+	defer w.conn.Close()
+	require.NoError(t, w.send("first"))
+	assert.Equal(t, "first", readDatagram(t, server))
+
+	// syslog daemon is restarted
+	server.Close()
+	os.Remove(path)
+	server = listenUnixgram(t, path)
+	defer server.Close()
+
+	assert.NoError(t, w.send("second"))
+	assert.Equal(t, "second", readDatagram(t, server))
+}
+
+func TestSyslogLoggerHealth_SendFailed_ReportErr(t *testing.T) {
+	var _ coreapi.HealthChecker = syslogLogger{}
+	dir, err := ioutil.TempDir("", "syslog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log")
+	sockets := localSyslogSockets
+	localSyslogSockets = []string{path}
+	defer func() { localSyslogSockets = sockets }()
+	server := listenUnixgram(t, path)
+
+	l := newTestSyslogLogger("")
+	l.w = &syslogWriter{network: "unixgram"}
+	require.NoError(t, l.w.connect())
+	defer l.Close()
+	l.Info("first")
+	assert.NoError(t, l.Health(context.Background()))
+
+	// syslog daemon is stopped
+	server.Close()
+	os.Remove(path)
+	l.Info("lost")
+	assert.Error(t, l.Health(context.Background()))
+
+	server = listenUnixgram(t, path)
+	defer server.Close()
+	assert.NoError(t, l.Health(context.Background()))
+}
+
+func TestSyslogLogger_Unreachable_ReturnQuickly(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	l := newTestSyslogLogger("")
+	l.w = &syslogWriter{network: "tcp", addr: ln.Addr().String()}
+	require.NoError(t, l.w.connect())
+	defer l.Close()
+	// syslog server is stopped, the address is dialed with timeout
+	ln.Close()
+	l.w.conn.Close()
+	l.w.addr = "10.255.255.1:514"
+
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		l.Info("record %d", i)
+	}
+
+	assert.True(t, time.Since(start) < time.Second)
+	l.w.Lock()
+	defer l.w.Unlock()
+	assert.Nil(t, l.w.conn)
+}
+
+func TestSyslogWriter_ConnectFailed_DropUntilBackoff(t *testing.T) {
+	sockets := localSyslogSockets
+	localSyslogSockets = []string{filepath.Join(os.TempDir(), "missing-syslog-socket")}
+	defer func() { localSyslogSockets = sockets }()
+	w := &syslogWriter{network: "unixgram"}
+
+	assert.Error(t, w.send("first"))
+	retryAt := w.retryAt
+	assert.Error(t, w.send("second"))
+
+	assert.Equal(t, syslogMinBackoff, w.backoff)
+	assert.Equal(t, retryAt, w.retryAt)
+}
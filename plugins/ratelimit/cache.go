@@ -0,0 +1,62 @@
+package plugin_ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	coreapi.RegisterRateLimiter("cache", makeCacheLimiter)
+}
+
+func makeCacheLimiter(cache coreapi.Cache) (coreapi.RateLimiter, error) {
+	return &cacheLimiter{
+		cache: cache,
+		now:   time.Now,
+	}, nil
+}
+
+// cacheLimiter keeps buckets in the configured cache until they are refilled. If the cache backend is shared
+// between VirgilD instances, the limits are shared too. Updates are not atomic across
+// instances, so concurrent requests on different instances may slightly exceed the limit.
+type cacheLimiter struct {
+	sync.Mutex
+	cache coreapi.Cache
+	now   func() time.Time
+}
+
+func (l *cacheLimiter) Take(key string, limit coreapi.Limit) (bool, time.Duration, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	var b coreapi.Bucket
+	checked, ok := l.cache.(coreapi.CheckedCache)
+	if !ok {
+		l.cache.Get(key, &b)
+		allow, wait := b.Take(l.now(), limit)
+		if tc, ok := l.cache.(coreapi.TTLCache); ok {
+			tc.SetTTL(key, b, bucketTTL(b, limit))
+		} else {
+			l.cache.Set(key, b)
+		}
+		return allow, wait, nil
+	}
+
+	if _, err := checked.GetChecked(key, &b); err != nil {
+		return false, 0, errors.Wrap(err, "Cache limiter: get bucket")
+	}
+	allow, wait := b.Take(l.now(), limit)
+	if err := checked.SetTTLChecked(key, b, bucketTTL(b, limit)); err != nil {
+		return false, 0, errors.Wrap(err, "Cache limiter: set bucket")
+	}
+	return allow, wait, nil
+}
+
+// bucketTTL keeps the bucket in the cache until it's refilled (e.g. until the end of the quota period),
+// a removed bucket would be full
+func bucketTTL(b coreapi.Bucket, limit coreapi.Limit) time.Duration {
+	return b.Refill(limit).Truncate(time.Second) + time.Second
+}
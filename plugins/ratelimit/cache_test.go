@@ -0,0 +1,38 @@
+package plugin_ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCheckedCache struct {
+	ttls map[string]time.Duration
+}
+
+func (c *fakeCheckedCache) Get(key string, val interface{}) bool { return false }
+func (c *fakeCheckedCache) Set(key string, val interface{})      {}
+func (c *fakeCheckedCache) Del(key string)                       {}
+func (c *fakeCheckedCache) GetChecked(key string, val interface{}) (bool, error) {
+	return false, nil
+}
+func (c *fakeCheckedCache) SetChecked(key string, val interface{}) error { return nil }
+func (c *fakeCheckedCache) SetTTLChecked(key string, val interface{}, ttl time.Duration) error {
+	c.ttls[key] = ttl
+	return nil
+}
+
+func TestCacheLimiterTake_Quota_KeepBucketUntilRefilled(t *testing.T) {
+	cache := &fakeCheckedCache{ttls: make(map[string]time.Duration)}
+	l, err := makeCacheLimiter(cache)
+	require.NoError(t, err)
+
+	_, _, err = l.Take("quota", coreapi.Limit{Rate: 10 / (24 * time.Hour).Seconds(), Burst: 10})
+	require.NoError(t, err)
+
+	// one request of ten is refilled in 2.4 hours
+	assert.True(t, cache.ttls["quota"] >= 144*time.Minute)
+}
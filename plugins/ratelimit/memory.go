@@ -0,0 +1,89 @@
+package plugin_ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+)
+
+const cleanupInterval = time.Minute
+
+func init() {
+	coreapi.RegisterRateLimiter("mem", makeMemoryLimiter)
+}
+
+func makeMemoryLimiter(cache coreapi.Cache) (coreapi.RateLimiter, error) {
+	l := &memoryLimiter{
+		buckets: make(map[string]*memoryBucket),
+		now:     time.Now,
+		done:    make(chan struct{}),
+	}
+	return l, nil
+}
+
+type memoryBucket struct {
+	coreapi.Bucket
+	// full is the time when the bucket is refilled
+	full time.Time
+}
+
+// memoryLimiter keeps buckets in process memory, so limits are not shared between VirgilD instances
+type memoryLimiter struct {
+	sync.Mutex
+	buckets map[string]*memoryBucket
+	now     func() time.Time
+	done    chan struct{}
+}
+
+// Start runs cleanup of unused buckets
+func (l *memoryLimiter) Start(ctx context.Context) error {
+	go func() {
+		t := time.NewTicker(cleanupInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				l.cleanup()
+			case <-l.done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (l *memoryLimiter) Stop(ctx context.Context) error {
+	close(l.done)
+	return nil
+}
+
+func (l *memoryLimiter) Take(key string, limit coreapi.Limit) (bool, time.Duration, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = new(memoryBucket)
+		l.buckets[key] = b
+	}
+	now := l.now()
+	allow, wait := b.Take(now, limit)
+	b.full = now.Add(b.Refill(limit))
+	return allow, wait, nil
+}
+
+// cleanup removes buckets which are refilled, they are equal to new ones. Buckets of quotas are kept
+// until the end of the quota period.
+func (l *memoryLimiter) cleanup() {
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.now()
+	for k, b := range l.buckets {
+		if !b.full.After(now) {
+			delete(l.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package plugin_ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VirgilSecurity/virgild/coreapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryLimiterCleanup_QuotaSpent_KeepBucket(t *testing.T) {
+	now := time.Now()
+	l, err := makeMemoryLimiter(nil)
+	require.NoError(t, err)
+	ml := l.(*memoryLimiter)
+	ml.now = func() time.Time { return now }
+	// 10 requests per day
+	quota := coreapi.Limit{Rate: 10 / (24 * time.Hour).Seconds(), Burst: 10}
+	for i := 0; i < 10; i++ {
+		allow, _, err := ml.Take("quota", quota)
+		require.NoError(t, err)
+		require.True(t, allow)
+	}
+
+	now = now.Add(2 * cleanupInterval)
+	ml.cleanup()
+
+	allow, _, err := ml.Take("quota", quota)
+	require.NoError(t, err)
+	assert.False(t, allow)
+}
+
+func TestMemoryLimiterCleanup_BucketRefilled_RemoveBucket(t *testing.T) {
+	now := time.Now()
+	l, err := makeMemoryLimiter(nil)
+	require.NoError(t, err)
+	ml := l.(*memoryLimiter)
+	ml.now = func() time.Time { return now }
+	_, _, err = ml.Take("token", coreapi.Limit{Rate: 1, Burst: 10})
+	require.NoError(t, err)
+
+	now = now.Add(time.Second)
+	ml.cleanup()
+
+	assert.Len(t, ml.buckets, 0)
+}